@@ -0,0 +1,67 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+)
+
+// maxBatchItems caps the items of one batch call.
+const maxBatchItems = 256
+
+// Batch methods run a method over many inputs in one round-trip: "batch"
+// takes the method name and the items, "batch_uppercase" fixes the method.
+// Each item is that method's params, a bare value standing for a one-param
+// list, and results come back as an array in item order. The whole batch
+// shares the call's deadline and fails on the first bad item.
+func init() {
+    methods["batch"] = method{
+	schema: paramSchema{
+	    {Name: "method", Type: "string", Required: true},
+	    {Name: "items", Type: "array", Required: true},
+	},
+	handle: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	    return runBatch(ctx, args["method"].(string), args["items"].([]interface{}))
+	},
+    }
+    methods["batch_uppercase"] = method{
+	schema: paramSchema{{Name: "items", Type: "array", Required: true}},
+	handle: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	    return runBatch(ctx, "uppercase", args["items"].([]interface{}))
+	},
+    }
+}
+
+// runBatch validates and runs each item against the named method.
+func runBatch(ctx context.Context, name string, items []interface{}) (interface{}, error) {
+    m, ok := methods[name]
+    if !ok || strings.HasPrefix(name, "batch") { // Batches don't nest
+	return nil, fmt.Errorf("invalid params: unknown batch method %q", name)
+    }
+    if len(items) > maxBatchItems {
+	return nil, fmt.Errorf("invalid params: batch of %d items exceeds the limit of %d", len(items), maxBatchItems)
+    }
+
+    results := make([]interface{}, len(items))
+    for i, item := range items {
+	if err := ctx.Err(); err != nil {
+	    return nil, err
+	}
+	params := item
+	switch item.(type) {
+	case []interface{}, map[string]interface{}:
+	default:
+	    params = []interface{}{item}
+	}
+	raw, _ := json.Marshal(params)
+	args, err := m.schema.validate(raw)
+	if err != nil {
+	    return nil, fmt.Errorf("item %d: %v", i, err)
+	}
+	if results[i], err = m.handle(ctx, args); err != nil {
+	    return nil, fmt.Errorf("item %d: %v", i, err)
+	}
+    }
+    return results, nil
+}
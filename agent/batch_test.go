@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunBatch(t *testing.T) {
+	ctx := context.Background()
+
+	// Bare values stand for one-param lists; arrays and objects pass as is
+	got, err := runBatch(ctx, "uppercase", []interface{}{"a", []interface{}{"b"}, map[string]interface{}{"text": "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := got.([]interface{})
+	if len(results) != 3 || results[0] != "A" || results[1] != "B" || results[2] != "C" {
+		t.Fatalf("results %v, want [A B C] in item order", results)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		items   []interface{}
+		wantErr string
+	}{
+		{"unknown method", "nope", []interface{}{"a"}, `unknown batch method "nope"`},
+		{"nested batch", "batch", []interface{}{"a"}, `unknown batch method "batch"`},
+		{"nested batch_uppercase", "batch_uppercase", []interface{}{"a"}, `unknown batch method "batch_uppercase"`},
+		{"over the item limit", "uppercase", make([]interface{}, maxBatchItems+1), "exceeds the limit of 256"},
+		{"first bad item", "uppercase", []interface{}{"a", 1, true}, `item 1: invalid params: field "text" must be string, got number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := runBatch(ctx, tt.method, tt.items); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("runBatch() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A batch at the limit runs
+	items := make([]interface{}, maxBatchItems)
+	for i := range items {
+		items[i] = "x"
+	}
+	if _, err := runBatch(ctx, "uppercase", items); err != nil {
+		t.Fatalf("batch of %d items: %v", maxBatchItems, err)
+	}
+}
+
+func TestBatchUppercase(t *testing.T) {
+	resp, _ := handleLine([]byte(`{"method":"batch_uppercase","params":[["ab","cd"]],"id":1}`))
+	results, _ := resp.Result.([]interface{})
+	if resp.Error != "" || len(results) != 2 || results[0] != "AB" || results[1] != "CD" {
+		t.Fatalf("batch_uppercase: %+v", resp)
+	}
+}
@@ -1,64 +1,177 @@
 package main
 
 import (
+    "bufio"
+    "bytes"
+    "context"
     "encoding/json"
+    "fmt"
     "log"
     "os"
     "strings"
+    "time"
 )
 
 // Architecture: The Agent is purely reactive. It maintains no network state.
-// It listens on Stdin for work and replies on Stdout.
+// It listens on Stdin for work and replies on Stdout, one JSON message per
+// line. Handlers must not write to Stdout: os.Stdout is pointed at Stderr so
+// a stray print lands in the logs instead of the Daemon's response stream.
 func main() {
-    decoder := json.NewDecoder(os.Stdin)
+    reader := bufio.NewReader(os.Stdin)
     encoder := json.NewEncoder(os.Stdout)
+    os.Stdout = os.Stderr
 
     for {
-	var req struct {
-	    Method string   `json:"method"`
-	    Params []string `json:"params"` // distinct from generic interface for simplicity
-	    ID     int      `json:"id"`
-	}
-
-	// Block until a request arrives via the Daemon
-	if err := decoder.Decode(&req); err != nil {
-	    if err.Error() == "EOF" {
+	// Block until a request line arrives via the Daemon
+	line, readErr := reader.ReadBytes('\n')
+	if len(bytes.TrimSpace(line)) == 0 {
+	    if readErr != nil {
 		return // Daemon closed the pipe
 	    }
-	    log.Printf("Agent Error: %v", err)
 	    continue
 	}
 
-	// Business Logic (The actual "Service")
-	var result string
-	switch req.Method {
-	case "uppercase":
-	    if len(req.Params) > 0 {
-		result = strings.ToUpper(req.Params[0])
-	    }
-	case "reverse":
-	    if len(req.Params) > 0 {
-		runes := []rune(req.Params[0])
-		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
-		    runes[i], runes[j] = runes[j], runes[i]
-		}
-		result = string(runes)
-	    }
-	default:
-	    result = "unknown method"
+	// Respond to Daemon, unless the line was a notification
+	resp, reply := handleLine(line)
+	if !reply {
+	    continue
 	}
+	if err := encoder.Encode(resp); err != nil {
+	    log.Fatal(err)
+	}
+    }
+}
+
+// JSON-RPC 2.0 error codes carried in response.Code.
+const (
+    codeParseError     = -32700
+    codeMethodNotFound = -32601
+    codeInvalidParams  = -32602
+    codeHandlerError   = -32000 // The handler failed or ran past its deadline
+)
+
+// response is one reply line to the Daemon. Code classifies Error and is
+// omitted on success.
+type response struct {
+    Result interface{} `json:"result"`
+    Error  string      `json:"error,omitempty"`
+    Code   int         `json:"code,omitempty"`
+    ID     int         `json:"id"`
+}
 
-	// Respond to Daemon
-	resp := struct {
-	    Result string `json:"result"`
-	    ID     int    `json:"id"`
-	}{
-	    Result: result,
-	    ID:     req.ID,
+// handleLine answers one request line; reply is false for notifications.
+// Every other line gets a response, so a caller waiting on its ID never
+// hangs: a line that can't be decoded is a parse error under ID 0 (or its
+// ID, when only another field was malformed), and the next line starts
+// fresh.
+//
+// As in JSON-RPC, a request without an "id" (or with "id": null) is a
+// notification: the handler runs but nothing is written back, not even an
+// error, which is only logged.
+func handleLine(line []byte) (resp response, reply bool) {
+    var req struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"` // positional array or named object, see schema.go
+	ID     *int            `json:"id"`     // nil for notifications
+	// TimeoutMs is the caller's deadline forwarded by the Daemon (0 = none)
+	TimeoutMs int64 `json:"timeout_ms"`
+    }
+    if err := json.Unmarshal(line, &req); err != nil {
+	log.Printf("Agent Error: %v", err)
+	resp = response{Error: "parse error: " + err.Error(), Code: codeParseError}
+	if req.ID != nil {
+	    resp.ID = *req.ID
 	}
+	return resp, true
+    }
 
-	if err := encoder.Encode(resp); err != nil {
-	    log.Fatal(err)
+    // Business Logic (The actual "Service")
+    m, ok := methods[req.Method]
+    if !ok {
+	resp = response{Error: fmt.Sprintf("method not found: %q", req.Method), Code: codeMethodNotFound}
+    } else {
+	start := time.Now()
+	resp = invoke(m, req.Params, req.TimeoutMs)
+	metrics.observe(req.Method, time.Since(start), resp.Error != "")
+    }
+
+    if req.ID == nil {
+	if resp.Error != "" {
+	    log.Printf("Agent Error: notification %q: %s", req.Method, resp.Error)
+	}
+	return resp, false
+    }
+    resp.ID = *req.ID
+    return resp, true
+}
+
+// invoke validates params against m's schema and runs it.
+func invoke(m method, params json.RawMessage, timeoutMs int64) response {
+    args, err := m.schema.validate(params)
+    if err != nil {
+	return response{Error: err.Error(), Code: codeInvalidParams}
+    }
+    result, errMsg := run(m, args, timeoutMs)
+    if errMsg != "" {
+	return response{Error: errMsg, Code: codeHandlerError}
+    }
+    return response{Result: result}
+}
+
+// method pairs a handler with the schema its params are checked against
+// before it runs, so handlers can use args without re-validating. Slow
+// handlers should watch ctx, which ends at the caller's deadline. A non-nil
+// error is returned to the caller as the response's error.
+type method struct {
+    schema paramSchema
+    handle func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+}
+
+// run calls a handler under the request's deadline. A handler that
+// overruns is abandoned and the caller gets a "deadline exceeded" error.
+func run(m method, args map[string]interface{}, timeoutMs int64) (interface{}, string) {
+    ctx := context.Background()
+    if timeoutMs > 0 {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+    }
+
+    type outcome struct {
+	result interface{}
+	err    error
+    }
+    done := make(chan outcome, 1)
+    go func() {
+	result, err := m.handle(ctx, args)
+	done <- outcome{result, err}
+    }()
+    select {
+    case o := <-done:
+	if o.err != nil {
+	    return nil, o.err.Error()
 	}
+	return o.result, ""
+    case <-ctx.Done():
+	return nil, "deadline exceeded"
     }
 }
+
+var methods = map[string]method{
+    "uppercase": {
+	schema: paramSchema{{Name: "text", Type: "string", Required: true}},
+	handle: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	    return strings.ToUpper(args["text"].(string)), nil
+	},
+    },
+    "reverse": {
+	schema: paramSchema{{Name: "text", Type: "string", Required: true}},
+	handle: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	    runes := []rune(args["text"].(string))
+	    for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	    }
+	    return string(runes), nil
+	},
+    },
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		reply bool
+		id    int
+		code  int
+		want  interface{}
+	}{
+		{"call", `{"method":"uppercase","params":["hi"],"id":3}`, true, 3, 0, "HI"},
+		{"named params", `{"method":"reverse","params":{"text":"abc"},"id":4}`, true, 4, 0, "cba"},
+		{"malformed JSON", `{"method":`, true, 0, codeParseError, nil},
+		{"malformed field keeps its id", `{"id":5,"method":7}`, true, 5, codeParseError, nil},
+		{"unknown method", `{"method":"nope","id":6}`, true, 6, codeMethodNotFound, nil},
+		{"invalid params", `{"method":"uppercase","params":[1],"id":7}`, true, 7, codeInvalidParams, nil},
+		{"notification", `{"method":"uppercase","params":["hi"]}`, false, 0, 0, nil},
+		{"null id is a notification", `{"method":"uppercase","params":["hi"],"id":null}`, false, 0, 0, nil},
+		{"failed notification", `{"method":"nope"}`, false, 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, reply := handleLine([]byte(tt.line))
+			if reply != tt.reply {
+				t.Fatalf("reply = %v, want %v", reply, tt.reply)
+			}
+			if !reply {
+				return
+			}
+			if resp.ID != tt.id || resp.Code != tt.code {
+				t.Fatalf("got id %d code %d (%s), want id %d code %d", resp.ID, resp.Code, resp.Error, tt.id, tt.code)
+			}
+			if tt.code == 0 && (resp.Error != "" || resp.Result != tt.want) {
+				t.Fatalf("got %+v, want result %v", resp, tt.want)
+			}
+			if tt.code != 0 && resp.Error == "" {
+				t.Fatal("error code without a message")
+			}
+		})
+	}
+}
+
+func TestHandleLineParseErrorMessage(t *testing.T) {
+	resp, _ := handleLine([]byte("not json"))
+	if !strings.HasPrefix(resp.Error, "parse error: ") {
+		t.Fatalf("error %q, want a parse error", resp.Error)
+	}
+}
+
+func TestRunDeadline(t *testing.T) {
+	slow := method{handle: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+		return "late", nil
+	}}
+
+	start := time.Now()
+	result, errMsg := run(slow, nil, 50)
+	if errMsg != "deadline exceeded" || result != nil {
+		t.Fatalf("run = %v, %q; want deadline exceeded", result, errMsg)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("deadline answered after %s", elapsed)
+	}
+
+	// Without a deadline the handler runs to completion
+	quick := method{handle: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("deadline set without timeout_ms")
+		}
+		return "ok", nil
+	}}
+	if result, errMsg := run(quick, nil, 0); result != "ok" || errMsg != "" {
+		t.Fatalf("run = %v, %q", result, errMsg)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "log"
+    "net/http"
+    "os"
+    "sync"
+    "time"
+)
+
+// Per-method metrics are off unless AGENT_METRICS is set. When on, the
+// "__metrics" method returns them, and AGENT_METRICS_ADDR (e.g.
+// "127.0.0.1:9102") also serves them as JSON at /metrics, for agents run
+// standalone. Only calls to known methods are counted, so a caller can't
+// grow the table with made-up names.
+var metrics *methodMetrics
+
+func init() {
+    if os.Getenv("AGENT_METRICS") == "" {
+	return
+    }
+    metrics = &methodMetrics{stats: make(map[string]*methodStats)}
+    methods["__metrics"] = method{
+	handle: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	    return metrics.snapshot(), nil
+	},
+    }
+
+    if addr := os.Getenv("AGENT_METRICS_ADDR"); addr != "" {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+	    w.Header().Set("Content-Type", "application/json")
+	    json.NewEncoder(w).Encode(metrics.snapshot())
+	})
+	go func() {
+	    log.Printf("Agent metrics on http://%s/metrics", addr)
+	    if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Agent metrics server failed: %v", err)
+	    }
+	}()
+    }
+}
+
+// methodStats accumulates one method's calls. Errors counts calls answered
+// with an error, including invalid params and deadlines.
+type methodStats struct {
+    Calls   int64   `json:"calls"`
+    Errors  int64   `json:"errors"`
+    TotalMs float64 `json:"total_ms"`
+    AvgMs   float64 `json:"avg_ms"`
+    MaxMs   float64 `json:"max_ms"`
+}
+
+type methodMetrics struct {
+    mu    sync.Mutex
+    stats map[string]*methodStats
+}
+
+// observe records one call. A nil receiver (metrics disabled) is a no-op.
+func (m *methodMetrics) observe(name string, elapsed time.Duration, failed bool) {
+    if m == nil || name == "__metrics" {
+	return
+    }
+    ms := float64(elapsed) / float64(time.Millisecond)
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    s, ok := m.stats[name]
+    if !ok {
+	s = &methodStats{}
+	m.stats[name] = s
+    }
+    s.Calls++
+    if failed {
+	s.Errors++
+    }
+    s.TotalMs += ms
+    s.AvgMs = s.TotalMs / float64(s.Calls)
+    if ms > s.MaxMs {
+	s.MaxMs = ms
+    }
+}
+
+// snapshot copies the stats, keyed by method name, for "__metrics" and
+// /metrics.
+func (m *methodMetrics) snapshot() map[string]methodStats {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    snap := make(map[string]methodStats, len(m.stats))
+    for name, s := range m.stats {
+	snap[name] = *s
+    }
+    return snap
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMethodMetrics(t *testing.T) {
+	prev := metrics
+	metrics = &methodMetrics{stats: make(map[string]*methodStats)}
+	t.Cleanup(func() { metrics = prev })
+
+	for _, line := range []string{
+		`{"method":"uppercase","params":["a"],"id":1}`,
+		`{"method":"uppercase","params":[1],"id":2}`, // Invalid params count as errors
+		`{"method":"made-up","id":3}`,
+		`{"method":"another-made-up"}`,
+	} {
+		handleLine([]byte(line))
+	}
+
+	snap := metrics.snapshot()
+	if len(snap) != 1 {
+		t.Fatalf("metrics for %d methods, want only uppercase: %v", len(snap), snap)
+	}
+	s := snap["uppercase"]
+	if s.Calls != 2 || s.Errors != 1 {
+		t.Fatalf("uppercase: %d calls, %d errors; want 2 and 1", s.Calls, s.Errors)
+	}
+
+	// The snapshot is a copy
+	snap["uppercase"] = methodStats{}
+	if metrics.snapshot()["uppercase"].Calls != 2 {
+		t.Fatal("snapshot aliases the live stats")
+	}
+}
+
+func TestMethodMetricsObserve(t *testing.T) {
+	m := &methodMetrics{stats: make(map[string]*methodStats)}
+	m.observe("reverse", 10*time.Millisecond, false)
+	m.observe("reverse", 30*time.Millisecond, true)
+	m.observe("__metrics", time.Millisecond, false)
+
+	snap := m.snapshot()
+	if _, ok := snap["__metrics"]; ok {
+		t.Fatal("__metrics counted itself")
+	}
+	s := snap["reverse"]
+	if s.Calls != 2 || s.Errors != 1 || s.TotalMs != 40 || s.AvgMs != 20 || s.MaxMs != 30 {
+		t.Fatalf("reverse stats %+v", s)
+	}
+
+	var disabled *methodMetrics
+	disabled.observe("reverse", time.Millisecond, false) // No-op, no panic
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+)
+
+// paramSpec describes one JSON-RPC param: its name, JSON type
+// ("string", "number", "boolean", "array", "object") and whether it must be present.
+type paramSpec struct {
+    Name     string
+    Type     string
+    Required bool
+}
+
+// paramSchema lists a method's params in positional order.
+type paramSchema []paramSpec
+
+// validate checks raw params against the schema and returns them by name.
+// Params may be a positional array (matched in schema order) or an object
+// keyed by param name. Errors name the offending field.
+func (s paramSchema) validate(raw json.RawMessage) (map[string]interface{}, error) {
+    args := map[string]interface{}{}
+
+    if len(raw) > 0 && string(raw) != "null" {
+	var positional []interface{}
+	if err := json.Unmarshal(raw, &positional); err == nil {
+	    if len(positional) > len(s) {
+		return nil, fmt.Errorf("invalid params: expected at most %d params, got %d", len(s), len(positional))
+	    }
+	    for i, v := range positional {
+		args[s[i].Name] = v
+	    }
+	} else if err := json.Unmarshal(raw, &args); err != nil {
+	    return nil, fmt.Errorf("invalid params: must be an array or an object")
+	}
+    }
+
+    for _, spec := range s {
+	v, ok := args[spec.Name]
+	if !ok || v == nil {
+	    if spec.Required {
+		return nil, fmt.Errorf("invalid params: missing required field %q", spec.Name)
+	    }
+	    continue
+	}
+	if got := jsonType(v); got != spec.Type {
+	    return nil, fmt.Errorf("invalid params: field %q must be %s, got %s", spec.Name, spec.Type, got)
+	}
+    }
+    return args, nil
+}
+
+// jsonType names the JSON type of a value decoded by encoding/json.
+func jsonType(v interface{}) string {
+    switch v.(type) {
+    case string:
+	return "string"
+    case float64:
+	return "number"
+    case bool:
+	return "boolean"
+    case []interface{}:
+	return "array"
+    case map[string]interface{}:
+	return "object"
+    default:
+	return "null"
+    }
+}
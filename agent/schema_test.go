@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParamSchemaValidate(t *testing.T) {
+	schema := paramSchema{
+		{Name: "text", Type: "string", Required: true},
+		{Name: "count", Type: "number"},
+	}
+
+	tests := []struct {
+		name    string
+		params  string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{"positional", `["hi", 2]`, map[string]interface{}{"text": "hi", "count": 2.0}, ""},
+		{"named", `{"text": "hi"}`, map[string]interface{}{"text": "hi"}, ""},
+		{"optional omitted", `["hi"]`, map[string]interface{}{"text": "hi"}, ""},
+		{"missing field", `{"count": 2}`, nil, `missing required field "text"`},
+		{"no params", ``, nil, `missing required field "text"`},
+		{"null params", `null`, nil, `missing required field "text"`},
+		{"null required field", `[null]`, nil, `missing required field "text"`},
+		{"wrong type", `[7]`, nil, `field "text" must be string, got number`},
+		{"wrong type named", `{"text": "hi", "count": "2"}`, nil, `field "count" must be number, got string`},
+		{"too many positional", `["hi", 2, true]`, nil, "expected at most 2 params, got 3"},
+		{"neither array nor object", `"hi"`, nil, "must be an array or an object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := schema.validate(json.RawMessage(tt.params))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("validate() error = %v, want %q", err, tt.wantErr)
+				}
+				if !strings.HasPrefix(err.Error(), "invalid params: ") {
+					t.Fatalf("error %q lacks the invalid params prefix", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+			if len(args) != len(tt.want) {
+				t.Fatalf("args %v, want %v", args, tt.want)
+			}
+			for k, v := range tt.want {
+				if args[k] != v {
+					t.Fatalf("args %v, want %v", args, tt.want)
+				}
+			}
+		})
+	}
+}
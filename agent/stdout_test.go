@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// agentMainEnv makes the test binary run the agent's main loop instead of
+// the tests, with a handler that prints to stdout, so the stream can be
+// checked end to end.
+const agentMainEnv = "PRXS_AGENT_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(agentMainEnv) == "1" {
+		methods["noisy"] = method{handle: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			fmt.Println("handler chatter on stdout")
+			fmt.Fprint(os.Stdout, `{"result":"forged","id":1}`+"\n")
+			log.New(os.Stdout, "", 0).Print("handler log on stdout")
+			return "quiet", nil
+		}}
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestHandlerStdoutKeptOffStream(t *testing.T) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), agentMainEnv+"=1")
+	cmd.Stdin = strings.NewReader(strings.Join([]string{
+		`{"method":"noisy","id":1}`,
+		`{"method":"noisy"}`,
+		`{"method":"uppercase","params":["hi"],"id":2}`,
+		`{"method":"noisy","id":3}`,
+	}, "\n") + "\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("agent: %v\n%s", err, stderr.String())
+	}
+
+	// Exactly one response line per call, in order; the notification and
+	// every handler print stay off stdout
+	want := []response{{Result: "quiet", ID: 1}, {Result: "HI", ID: 2}, {Result: "quiet", ID: 3}}
+	lines := bufio.NewScanner(&stdout)
+	var got []response
+	for lines.Scan() {
+		var resp response
+		if err := json.Unmarshal(lines.Bytes(), &resp); err != nil {
+			t.Fatalf("non-JSON line on stdout: %q", lines.Text())
+		}
+		got = append(got, resp)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("stdout responses %+v, want %+v", got, want)
+	}
+	if n := strings.Count(stderr.String(), "handler chatter on stdout"); n != 3 {
+		t.Errorf("handler output reached stderr %d times, want 3:\n%s", n, stderr.String())
+	}
+}
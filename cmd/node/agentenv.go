@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// agentSandbox limits what the agent subprocess inherits from the provider.
+// Zero values keep today's behavior: the provider's environment, working
+// directory and user.
+type agentSandbox struct {
+	// Env is the allow-list of environment entries: NAME copies the
+	// provider's value if set, NAME=value sets one explicitly. nil inherits
+	// the provider's whole environment; an empty list gives the agent none.
+	Env  []string
+	Dir  string // Working directory ("" = the provider's)
+	User string // Run the agent as this user name or uid ("" = the provider's)
+}
+
+// parseAgentEnv reads a comma-separated -agent-env value. "" means inherit
+// everything; "-" means an empty environment.
+func parseAgentEnv(spec string) []string {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil
+	}
+	env := []string{}
+	if spec == "-" {
+		return env
+	}
+	for _, e := range strings.Split(spec, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			env = append(env, e)
+		}
+	}
+	return env
+}
+
+// environ builds the agent's environment from the allow-list.
+func (s agentSandbox) environ() []string {
+	if s.Env == nil {
+		return nil // exec.Cmd inherits os.Environ()
+	}
+	env := make([]string, 0, len(s.Env))
+	for _, e := range s.Env {
+		if strings.Contains(e, "=") {
+			env = append(env, e)
+		} else if v, ok := os.LookupEnv(e); ok {
+			env = append(env, e+"="+v)
+		}
+	}
+	return env
+}
+
+// apply configures cmd to run inside the sandbox. A relative script path in
+// cmd's args must already be absolute when Dir is set; see agentScriptPath.
+func (s agentSandbox) apply(cmd *exec.Cmd) error {
+	cmd.Env = s.environ()
+	cmd.Dir = s.Dir
+	if s.User != "" {
+		if err := setAgentUser(cmd, s.User); err != nil {
+			return fmt.Errorf("invalid -agent-user %q: %v", s.User, err)
+		}
+	}
+	return nil
+}
+
+// agentScriptPath resolves the agent script against the provider's working
+// directory, since the agent may run from another one.
+func (s agentSandbox) agentScriptPath(path string) (string, error) {
+	if s.Dir == "" {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAgentEnvAllowList(t *testing.T) {
+	t.Setenv("PRXS_ALLOWED", "yes")
+	t.Setenv("PRXS_SECRET", "hunter2")
+
+	sandbox := agentSandbox{Env: parseAgentEnv("PRXS_ALLOWED, PRXS_SET=1, PRXS_UNSET")}
+	env := sandbox.environ()
+	want := []string{"PRXS_ALLOWED=yes", "PRXS_SET=1"}
+	if !slices.Equal(env, want) {
+		t.Fatalf("environ() = %v, want %v", env, want)
+	}
+
+	if env := (agentSandbox{Env: parseAgentEnv("-")}).environ(); env == nil || len(env) != 0 {
+		t.Fatalf("\"-\" gives %#v, want an empty environment", env)
+	}
+	if env := (agentSandbox{Env: parseAgentEnv("")}).environ(); env != nil {
+		t.Fatalf("\"\" gives %v, want the inherited environment", env)
+	}
+
+	// The spawned process sees only the allow-listed entries
+	path, err := exec.LookPath("env")
+	if err != nil {
+		t.Skip("no env binary")
+	}
+	cmd := exec.Command(path)
+	if err := sandbox.apply(cmd); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := strings.Fields(string(out))
+	slices.Sort(seen)
+	if !slices.Equal(seen, want) {
+		t.Fatalf("agent environment %v, want %v", seen, want)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"prxs/common"
+)
+
+// agentPipe is the provider's end of the agent's stdin/stdout. The contract
+// is newline-delimited JSON: one request per line in, and exactly one JSON
+// response object per line out, echoing the request's id. Agents must not
+// write anything else to stdout; logs belong on stderr.
+//
+// Each request is stamped with the pipe's own sequence number, so a line
+// that isn't a JSON response or that answers another id is detected as stray
+// output, logged and skipped, instead of being taken for the reply and
+// shifting every later response by one.
+type agentPipe struct {
+	w      io.Writer
+	r      *bufio.Reader
+	lastID int
+}
+
+func newAgentPipe(w io.Writer, r io.Reader) *agentPipe {
+	return &agentPipe{w: w, r: bufio.NewReader(r)}
+}
+
+// call sends req and returns the agent's matching response, carrying req's
+// original ID. The pipe carries one call at a time; callers serialize.
+func (p *agentPipe) call(req common.JSONRPCRequest) (common.JSONRPCResponse, error) {
+	p.lastID++
+	id, callerID := p.lastID, req.ID
+	req.ID = id
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return common.JSONRPCResponse{}, fmt.Errorf("failed to encode agent request: %v", err)
+	}
+	if _, err := p.w.Write(append(line, '\n')); err != nil {
+		return common.JSONRPCResponse{}, fmt.Errorf("failed to write to agent stdin: %v", err)
+	}
+
+	for {
+		raw, err := p.r.ReadBytes('\n')
+		if err != nil {
+			if len(bytes.TrimSpace(raw)) > 0 {
+				log.Printf("[Daemon] Discarding unterminated agent output: %.200q\n", raw)
+			}
+			return common.JSONRPCResponse{}, fmt.Errorf("failed to read agent response: %v", err)
+		}
+		resp, ok := parseAgentLine(raw, id)
+		if !ok {
+			if len(bytes.TrimSpace(raw)) > 0 {
+				log.Printf("[Daemon] Discarding stray agent output (handlers must not write to stdout): %.200q\n", raw)
+			}
+			continue
+		}
+		resp.ID = callerID
+		return resp, nil
+	}
+}
+
+// parseAgentLine accepts a line only if it is a single JSON object whose id
+// is the one awaited.
+func parseAgentLine(raw []byte, id int) (common.JSONRPCResponse, bool) {
+	var msg struct {
+		common.JSONRPCResponse
+		ID *int `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil || msg.ID == nil || *msg.ID != id {
+		return common.JSONRPCResponse{}, false
+	}
+	return msg.JSONRPCResponse, true
+}
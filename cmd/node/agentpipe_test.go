@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"prxs/common"
+)
+
+func TestAgentPipeSkipsStrayOutput(t *testing.T) {
+	// The pipe stamps its first call with id 1 and its second with id 2
+	out := strings.NewReader(strings.Join([]string{
+		"loading model...",
+		`{"result":"late","id":0}`,
+		`{"result":"wrong","id":2}`,
+		`[1, 2]`,
+		"",
+		`{"result":"first","id":1}`,
+		`{"result":"second","id":2}`,
+	}, "\n") + "\n")
+	var in bytes.Buffer
+	p := newAgentPipe(&in, out)
+
+	for _, want := range []struct {
+		callerID int
+		result   string
+	}{
+		{42, "first"},
+		{7, "second"},
+	} {
+		resp, err := p.call(common.JSONRPCRequest{Method: "echo", ID: want.callerID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Result != want.result || resp.ID != want.callerID {
+			t.Errorf("got result %v id %d, want %q id %d", resp.Result, resp.ID, want.result, want.callerID)
+		}
+	}
+
+	// The agent saw the pipe's own ids, not the callers'
+	for i, line := range strings.Split(strings.TrimSpace(in.String()), "\n") {
+		var req common.JSONRPCRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			t.Fatal(err)
+		}
+		if req.ID != i+1 {
+			t.Errorf("request %d sent with id %d", i, req.ID)
+		}
+	}
+}
+
+func TestAgentPipeEOF(t *testing.T) {
+	p := newAgentPipe(&bytes.Buffer{}, strings.NewReader("noise\n"+`{"result":"x","id":1`))
+	if _, err := p.call(common.JSONRPCRequest{Method: "echo"}); err == nil {
+		t.Fatal("call succeeded on a closed stdout")
+	}
+}
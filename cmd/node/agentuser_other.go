@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// setAgentUser is only supported on Unix.
+func setAgentUser(cmd *exec.Cmd, name string) error {
+	return fmt.Errorf("running the agent as another user is not supported on %s", runtime.GOOS)
+}
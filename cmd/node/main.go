@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -13,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +21,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	ma "github.com/multiformats/go-multiaddr"
 
 	"prxs/common"
 	"prxs/mcp"
@@ -33,14 +34,21 @@ func init() {
 // --- Agent Management ---
 
 type ProviderDaemon struct {
-	agentCmd     *exec.Cmd
-	agentEncoder *json.Encoder
-	agentDecoder *json.Decoder
-	mu           sync.Mutex
-	Card         common.ServiceCard
+	agentCmd *exec.Cmd
+	agent    *agentPipe // Guarded by mu
+	mu       sync.Mutex
+	Card     common.ServiceCard
+
+	// pending admits calls to the agent, running or waiting for mu; a
+	// call that finds it full is answered ServerBusy. nil = unlimited.
+	pending chan struct{}
+
+	// limiter enforces Card.RateLimit; excess calls are answered
+	// RateLimited. nil = unlimited.
+	limiter *callLimiter
 }
 
-func buildStakeProof(priv crypto.PrivKey, amount float64, chainID string) (*common.StakeProof, error) {
+func buildStakeProof(priv crypto.PrivKey, amount float64, denom string, chainID string, owner string) (*common.StakeProof, error) {
 	nonce := time.Now().UnixNano()
 	txHash := fmt.Sprintf("mock-tx-%x", nonce)
 	timestamp := time.Now().Unix()
@@ -50,23 +58,26 @@ func buildStakeProof(priv crypto.PrivKey, amount float64, chainID string) (*comm
 		return nil, fmt.Errorf("failed to derive peer ID: %v", err)
 	}
 
-	payload := fmt.Sprintf("%s|%f|%d|%d|%s", txHash, amount, nonce, timestamp, chainID)
-	digest := sha256.Sum256([]byte(payload))
-
-	signature, err := priv.Sign(digest[:])
+	algo, err := common.StakeAlgoForKey(priv.GetPublic())
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign stake proof: %v", err)
+		return nil, fmt.Errorf("failed to determine stake algorithm: %v", err)
 	}
 
-	return &common.StakeProof{
+	proof := &common.StakeProof{
 		TxHash:    txHash,
 		Staker:    pid.String(),
 		Amount:    amount,
+		Denom:     denom,
 		Nonce:     nonce,
 		Timestamp: timestamp,
 		ChainID:   chainID,
-		Signature: signature,
-	}, nil
+		Owner:     owner,
+		Algo:      algo,
+	}
+	if err := common.SignStakeProof(priv, proof); err != nil {
+		return nil, fmt.Errorf("failed to sign stake proof: %v", err)
+	}
+	return proof, nil
 }
 
 func loadStakeProofFromFile(path string, priv crypto.PrivKey, chainID string) (*common.StakeProof, error) {
@@ -88,9 +99,10 @@ func loadStakeProofFromFile(path string, priv crypto.PrivKey, chainID string) (*
 	}
 
 	pub := priv.GetPublic()
-	payload := fmt.Sprintf("%s|%f|%d|%d|%s", proof.TxHash, proof.Amount, proof.Nonce, proof.Timestamp, proof.ChainID)
-	digest := sha256.Sum256([]byte(payload))
-	ok, err := pub.Verify(digest[:], proof.Signature)
+	if err := common.CheckStakeAlgo(&proof, pub); err != nil {
+		return nil, err
+	}
+	ok, err := common.VerifyStakeSignature(pub, &proof)
 	if err != nil || !ok {
 		return nil, fmt.Errorf("stake proof signature invalid")
 	}
@@ -106,7 +118,7 @@ func openBrowser(url string) {
 	_ = cmd.Start()
 }
 
-func runStakingHelper(ctx context.Context, proofPath string, amount float64, chainID string, address string, webPort int, priv crypto.PrivKey) (*common.StakeProof, error) {
+func runStakingHelper(ctx context.Context, proofPath string, amount float64, denom string, chainID string, address string, owner string, webPort int, priv crypto.PrivKey) (*common.StakeProof, error) {
 	fmt.Printf("[Prov] Staking required. Visit http://127.0.0.1:%d/stake to stake %.2f tokens (chain=%s)\n", webPort, amount, chainID)
 
 	type pageData struct {
@@ -146,7 +158,7 @@ func runStakingHelper(ctx context.Context, proofPath string, amount float64, cha
 		case http.MethodGet:
 			_ = tmpl.Execute(w, pageData{Address: address, Amount: amount, ChainID: chainID, ProofPath: proofPath})
 		case http.MethodPost:
-			proof, err := buildStakeProof(priv, amount, chainID)
+			proof, err := buildStakeProof(priv, amount, denom, chainID, owner)
 			if err != nil {
 				http.Error(w, "failed to build stake proof", http.StatusInternalServerError)
 				return
@@ -189,7 +201,11 @@ func runStakingHelper(ctx context.Context, proofPath string, amount float64, cha
 	}
 }
 
-func NewProviderDaemon(agentPath string) (*ProviderDaemon, error) {
+func NewProviderDaemon(agentPath string, sandbox agentSandbox) (*ProviderDaemon, error) {
+	agentPath, err := sandbox.agentScriptPath(agentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve agent path: %v", err)
+	}
 	log.Printf("[Daemon] Launching agent script: %s\n", agentPath)
 
 	// Try python first (Windows), then python3
@@ -203,6 +219,9 @@ func NewProviderDaemon(agentPath string) (*ProviderDaemon, error) {
 	}
 	log.Printf("[Daemon] Using Python command: %s", pythonCmd)
 	cmd := exec.Command(pythonCmd, "-u", agentPath)
+	if err := sandbox.apply(cmd); err != nil {
+		return nil, err
+	}
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -220,21 +239,16 @@ func NewProviderDaemon(agentPath string) (*ProviderDaemon, error) {
 	}
 
 	pd := &ProviderDaemon{
-		agentCmd:     cmd,
-		agentEncoder: json.NewEncoder(stdin),
-		agentDecoder: json.NewDecoder(stdout),
+		agentCmd: cmd,
+		agent:    newAgentPipe(stdin, stdout),
 	}
 
 	// --- HANDSHAKE ---
 	log.Println("[Daemon] Sending 'initialize' handshake...")
 
 	initReq := common.JSONRPCRequest{Method: "initialize", ID: 0}
-	if err := pd.agentEncoder.Encode(initReq); err != nil {
-		return nil, fmt.Errorf("failed to write to agent stdin: %v", err)
-	}
-
-	var resp common.JSONRPCResponse
-	if err := pd.agentDecoder.Decode(&resp); err != nil {
+	resp, err := pd.agent.call(initReq)
+	if err != nil {
 		return nil, fmt.Errorf("agent handshake failed (did the script crash?): %v", err)
 	}
 
@@ -254,13 +268,73 @@ func (pd *ProviderDaemon) HandleExecutionStream(stream network.Stream) {
 		return
 	}
 
+	if t := req.Payment; t != nil {
+		err := t.Verify()
+		if err == nil && t.ProviderID != stream.Conn().LocalPeer().String() {
+			err = fmt.Errorf("ticket is for provider %s", t.ProviderID)
+		}
+		if err != nil {
+			log.Printf("[Daemon] Refusing %s: %v\n", req.Method, err)
+			json.NewEncoder(rw).Encode(common.JSONRPCResponse{Error: common.InvalidPayment, ID: req.ID})
+			rw.Flush()
+			return
+		}
+	}
+
+	if ok, wait := pd.limiter.allow(); !ok {
+		retry := max(wait.Milliseconds(), 1)
+		log.Printf("[Daemon] Refusing %s: over the %.4g calls/s rate limit\n", req.Method, pd.Card.RateLimit)
+		json.NewEncoder(rw).Encode(common.JSONRPCResponse{Error: common.RateLimited, ID: req.ID, RetryAfterMs: retry})
+		rw.Flush()
+		return
+	}
+
+	if pd.pending != nil {
+		select {
+		case pd.pending <- struct{}{}:
+		default:
+			log.Printf("[Daemon] Refusing %s: %d calls already pending\n", req.Method, cap(pd.pending))
+			json.NewEncoder(rw).Encode(common.JSONRPCResponse{Error: common.ServerBusy, ID: req.ID})
+			rw.Flush()
+			return
+		}
+	}
+
 	fmt.Printf("[Daemon] Executing %s...\n", req.Method)
 
-	pd.mu.Lock()
-	pd.agentEncoder.Encode(req)
+	ctx := context.Background()
+	if req.TimeoutMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.TimeoutMs)*time.Millisecond)
+		defer cancel()
+	}
+
+	// The agent pipe carries one call at a time, so a call that outlives its
+	// deadline still runs to completion in the background (keeping the pipe
+	// in sync); only its caller stops waiting. It keeps its pending slot
+	// until then.
+	done := make(chan common.JSONRPCResponse, 1)
+	go func() {
+		if pd.pending != nil {
+			defer func() { <-pd.pending }()
+		}
+		pd.mu.Lock()
+		defer pd.mu.Unlock()
+		resp, err := pd.agent.call(req)
+		if err != nil {
+			log.Printf("[Daemon] Agent call %s failed: %v\n", req.Method, err)
+			resp = common.JSONRPCResponse{Error: "agent unavailable", ID: req.ID}
+		}
+		done <- resp
+	}()
+
 	var resp common.JSONRPCResponse
-	pd.agentDecoder.Decode(&resp)
-	pd.mu.Unlock()
+	select {
+	case resp = <-done:
+	case <-ctx.Done():
+		log.Printf("[Daemon] %s exceeded its %dms deadline\n", req.Method, req.TimeoutMs)
+		resp = common.JSONRPCResponse{Error: common.DeadlineExceeded, ID: req.ID}
+	}
 
 	json.NewEncoder(rw).Encode(resp)
 	rw.Flush()
@@ -268,20 +342,29 @@ func (pd *ProviderDaemon) HandleExecutionStream(stream network.Stream) {
 
 // --- Provider Logic ---
 
-func startProvider(port int, agentPath string, bootstrapAddr string, devMode bool, stakeAmount float64, stakeChain string, stakeProofPath string, stakeWebPort int, stakeAddress string, privKey crypto.PrivKey) {
+func startProvider(port int, agentPath string, bootstrapAddr string, devMode bool, stakeAmount float64, stakeDenom string, stakeChain string, stakeProofPath string, stakeWebPort int, stakeAddress string, stakeOwner string, listenAddrs []ma.Multiaddr, sandbox agentSandbox, maxPending int, rateLimit float64, dhtPrefix string, privKey crypto.PrivKey) {
 	ctx := context.Background()
 
-	h, err := libp2p.New(common.CommonLibp2pOptions(port, privKey)...)
+	h, err := libp2p.New(common.CommonLibp2pOptions(port, privKey, listenAddrs)...)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer h.Close()
 
-	daemon, err := NewProviderDaemon(agentPath)
+	daemon, err := NewProviderDaemon(agentPath, sandbox)
 	if err != nil {
 		log.Fatalf("Failed to start agent: %v", err)
 	}
 	defer daemon.agentCmd.Process.Kill()
+	if maxPending > 0 {
+		daemon.pending = make(chan struct{}, maxPending)
+	}
+	// -rate-limit overrides what the agent advertises; the registry and
+	// clients see the limit actually enforced
+	if rateLimit > 0 {
+		daemon.Card.RateLimit = rateLimit
+	}
+	daemon.limiter = newCallLimiter(daemon.Card.RateLimit, common.RealClock{})
 
 	// Ensure stake proof exists (load or guide user)
 	stakeProof, err := loadStakeProofFromFile(stakeProofPath, privKey, stakeChain)
@@ -289,7 +372,7 @@ func startProvider(port int, agentPath string, bootstrapAddr string, devMode boo
 		log.Fatalf("Failed to load stake proof: %v", err)
 	}
 	if stakeProof == nil {
-		stakeProof, err = runStakingHelper(ctx, stakeProofPath, stakeAmount, stakeChain, stakeAddress, stakeWebPort, privKey)
+		stakeProof, err = runStakingHelper(ctx, stakeProofPath, stakeAmount, stakeDenom, stakeChain, stakeAddress, stakeOwner, stakeWebPort, privKey)
 		if err != nil {
 			log.Fatalf("Staking helper failed: %v", err)
 		}
@@ -301,7 +384,7 @@ func startProvider(port int, agentPath string, bootstrapAddr string, devMode boo
 
 	h.SetStreamHandler(common.ProtocolID, daemon.HandleExecutionStream)
 
-	kademliaDHT, _ := common.SetupDHT(ctx, h, []string{bootstrapAddr}, devMode)
+	kademliaDHT, _ := common.SetupDHT(ctx, h, []string{bootstrapAddr}, devMode, dhtPrefix)
 
 	// Registration Loop
 	go func() {
@@ -329,6 +412,8 @@ func startProvider(port int, agentPath string, bootstrapAddr string, devMode boo
 			}
 
 			registered := false
+			interval := 30 * time.Second
+			var backoff time.Duration
 			for _, p := range candidatePeers {
 				if p.ID == h.ID() {
 					continue
@@ -370,17 +455,27 @@ func startProvider(port int, agentPath string, bootstrapAddr string, devMode boo
 				if resp.Success {
 					log.Printf("[Prov] ✅ SUCCESS: Registered with %s\n", p.ID.ShortString())
 					registered = true
+					// Follow the registry's load-based cadence when it offers one
+					if resp.HeartbeatInterval > 0 {
+						interval = time.Duration(resp.HeartbeatInterval) * time.Second
+					}
 					break
 				}
+				if resp.RetryAfter > 0 {
+					// Over the registry's limits: wait as long as it asks
+					log.Printf("[Prov] Registry %s asked to retry in %ds: %s\n", p.ID.ShortString(), resp.RetryAfter, resp.Error)
+					backoff = max(backoff, time.Duration(resp.RetryAfter)*time.Second)
+				}
 			}
 
 			if !registered {
-				log.Println("[Prov] ❌ Failed to register. Retrying in 10s...")
+				interval = max(interval, backoff)
+				log.Printf("[Prov] ❌ Failed to register. Retrying in %s...\n", interval)
 			} else {
-				log.Println("[Prov] Registration checks pass. Sleeping 30s...")
+				log.Printf("[Prov] Registration checks pass. Sleeping %s...\n", interval)
 			}
 
-			time.Sleep(30 * time.Second)
+			time.Sleep(interval)
 		}
 	}()
 
@@ -389,12 +484,12 @@ func startProvider(port int, agentPath string, bootstrapAddr string, devMode boo
 
 // --- Client Logic ---
 
-func startClient(bootstrapAddr string, query string, args string, devMode bool, privKey crypto.PrivKey) {
+func startClient(bootstrapAddr string, query string, args string, accessToken string, devMode bool, dhtPrefix string, privKey crypto.PrivKey) {
 	ctx := context.Background()
-	h, _ := libp2p.New(common.CommonLibp2pOptions(0, privKey)...)
+	h, _ := libp2p.New(common.CommonLibp2pOptions(0, privKey, nil)...)
 	defer h.Close()
 
-	kademliaDHT, _ := common.SetupDHT(ctx, h, []string{bootstrapAddr}, devMode)
+	kademliaDHT, _ := common.SetupDHT(ctx, h, []string{bootstrapAddr}, devMode, dhtPrefix)
 	rd := routing.NewRoutingDiscovery(kademliaDHT)
 
 	fmt.Println("CLIENT ONLINE.")
@@ -455,19 +550,16 @@ func startClient(bootstrapAddr string, query string, args string, devMode bool,
 	// Query Registry
 	log.Printf("2. Asking Registry for service: '%s'...\n", query)
 
-	stream, err := h.NewStream(ctx, registryPeer, common.RegistryProtocolID)
+	resp, err := common.CallRegistry(ctx, h, registryPeer, common.RegistryRequest{Method: "find", Query: query, Token: accessToken})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	req := common.RegistryRequest{Method: "find", Query: query}
-	rw := bufio.NewReadWriter(bufio.NewReader(stream), bufio.NewWriter(stream))
-	json.NewEncoder(rw).Encode(req)
-	rw.Flush()
-
-	var resp common.RegistryResponse
-	json.NewDecoder(rw).Decode(&resp)
-	stream.Close()
+	if resp.Attestation == nil {
+		log.Printf(" > Warning: registry response is not attested\n")
+	} else if err := common.VerifyFindResponse(h.Peerstore().PubKey(registryPeer), query, resp, 5*time.Minute); err != nil {
+		log.Fatalf("Registry response failed attestation check: %v", err)
+	}
 
 	if len(resp.Providers) == 0 {
 		log.Fatalf("Registry returned 0 providers for '%s'", query)
@@ -486,11 +578,6 @@ func startClient(bootstrapAddr string, query string, args string, devMode bool,
 	}
 
 	// Execute RPC
-	s, err := h.NewStream(ctx, target.ID, common.ProtocolID)
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	log.Println("4. Sending Computation Request...")
 	var payload interface{} = args
 	if err := json.Unmarshal([]byte(args), &payload); err == nil {
@@ -499,13 +586,9 @@ func startClient(bootstrapAddr string, query string, args string, devMode bool,
 
 	execReq := common.JSONRPCRequest{Method: "compute", Params: payload, ID: 1}
 
-	rwExec := bufio.NewReadWriter(bufio.NewReader(s), bufio.NewWriter(s))
-	json.NewEncoder(rwExec).Encode(execReq)
-	rwExec.Flush()
-
-	var execResp common.JSONRPCResponse
-	if err := json.NewDecoder(rwExec).Decode(&execResp); err != nil {
-		log.Fatalf("Failed to decode response: %v", err)
+	execResp, err := common.CallProvider(ctx, h, target.ID, execReq)
+	if err != nil {
+		log.Fatalf("Execution request failed: %v", err)
 	}
 
 	fmt.Printf("\n--- RESULT ---\n%v\n--------------\n", execResp.Result)
@@ -513,7 +596,7 @@ func startClient(bootstrapAddr string, query string, args string, devMode bool,
 
 // --- MCP Server Logic ---
 
-func startMCPServer(configPath string, bootstrapAddr string, devMode bool, privKey crypto.PrivKey) {
+func startMCPServer(configPath string, bootstrapAddr string, devMode bool, dhtPrefix string, privKey crypto.PrivKey) {
 	ctx := context.Background()
 
 	// Load MCP configuration
@@ -523,14 +606,14 @@ func startMCPServer(configPath string, bootstrapAddr string, devMode bool, privK
 	}
 
 	// Create libp2p host (as client)
-	h, err := libp2p.New(common.CommonLibp2pOptions(0, privKey)...)
+	h, err := libp2p.New(common.CommonLibp2pOptions(0, privKey, nil)...)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer h.Close()
 
 	// Setup DHT
-	kademliaDHT, err := common.SetupDHT(ctx, h, []string{bootstrapAddr}, devMode)
+	kademliaDHT, err := common.SetupDHT(ctx, h, []string{bootstrapAddr}, devMode, dhtPrefix)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -553,19 +636,41 @@ func main() {
 	agent := flag.String("agent", "./calc.py", "agent binary")
 	query := flag.String("query", "math", "service query (client only)")
 	args := flag.String("args", "16", "rpc arguments (client only)")
+	accessToken := flag.String("access-token", "", "token presented to the registry to find private services (client only)")
 	keyFile := flag.String("key", "", "path to key file (e.g. node.key)")
 	devMode := flag.Bool("dev", true, "Enable LAN/Dev mode")
+	dhtPrefix := flag.String("dht-prefix", common.DefaultDHTPrefix, "DHT protocol prefix; must match the registry's (isolates separate deployments)")
 	stakeAmount := flag.Float64("stake-amount", 10.0, "mock stake amount (provider only)")
+	stakeDenom := flag.String("stake-denom", "", "denomination of -stake-amount, e.g. uprxs; empty = the registry's base unit (provider only)")
 	stakeChain := flag.String("stake-chain", "mock-l2", "mock chain id for staking (provider only)")
 	stakeProofPath := flag.String("stake-proof", "stake_proof.json", "path to stake proof file (provider only)")
 	stakeWebPort := flag.Int("stake-web-port", 8090, "port for local staking helper UI (provider only)")
 	stakeAddress := flag.String("stake-address", "0xDEADBEEF00000000000000000000000000DEMO", "display address for staking UI (provider only)")
+	stakeOwner := flag.String("stake-owner", "", "on-chain identity funding the stake, shared by all peers of one operator (provider only)")
 	mcpConfig := flag.String("mcp-config", "mcp_config.yaml", "path to MCP config file (mcp-server only)")
+	listen := flag.String("listen", "", "comma-separated listen multiaddrs; overrides the -port defaults (provider only)")
+	agentEnv := flag.String("agent-env", "", "comma-separated env vars the agent may see: NAME copies ours, NAME=value sets one; empty = inherit all, - = none (provider only)")
+	agentDir := flag.String("agent-dir", "", "working directory for the agent; empty = the provider's (provider only)")
+	agentMaxPending := flag.Int("agent-max-pending", 32, "calls the agent may have running or queued at once; more are refused with \"server busy\" (0 = unlimited, provider only)")
+	rateLimit := flag.Float64("rate-limit", 0, "calls per second the provider accepts, advertised in its card; more are refused with \"rate limit exceeded\" (0 = the agent card's rate_limit, provider only)")
+	agentUser := flag.String("agent-user", "", "run the agent as this user name or uid, needs privileges to switch users; Unix only (provider only)")
 	flag.Parse()
 
+	sandbox := agentSandbox{Env: parseAgentEnv(*agentEnv), Dir: *agentDir, User: *agentUser}
+
+	listenAddrs, err := common.ParseListenAddrs(strings.Split(*listen, ","))
+	if err != nil {
+		log.Fatalf("Invalid -listen: %v", err)
+	}
+	if _, err := common.DHTOptions(*dhtPrefix, *devMode); err != nil {
+		log.Fatalf("Invalid -dht-prefix: %v", err)
+	}
+	if *rateLimit < 0 {
+		log.Fatalf("Invalid -rate-limit: must be >= 0")
+	}
+
 	// Load Key if specified, otherwise generate ephemeral
 	var privKey crypto.PrivKey
-	var err error
 
 	if *keyFile != "" {
 		privKey, err = common.LoadOrGenerateKey(*keyFile)
@@ -582,17 +687,17 @@ func main() {
 		if *bootstrap == "" {
 			log.Fatal("Need -bootstrap")
 		}
-		startProvider(*port, *agent, *bootstrap, *devMode, *stakeAmount, *stakeChain, *stakeProofPath, *stakeWebPort, *stakeAddress, privKey)
+		startProvider(*port, *agent, *bootstrap, *devMode, *stakeAmount, *stakeDenom, *stakeChain, *stakeProofPath, *stakeWebPort, *stakeAddress, *stakeOwner, listenAddrs, sandbox, *agentMaxPending, *rateLimit, *dhtPrefix, privKey)
 	case "client":
 		if *bootstrap == "" {
 			log.Fatal("Need -bootstrap")
 		}
-		startClient(*bootstrap, *query, *args, *devMode, privKey)
+		startClient(*bootstrap, *query, *args, *accessToken, *devMode, *dhtPrefix, privKey)
 	case "mcp-server":
 		if *bootstrap == "" {
 			log.Fatal("Need -bootstrap")
 		}
-		startMCPServer(*mcpConfig, *bootstrap, *devMode, privKey)
+		startMCPServer(*mcpConfig, *bootstrap, *devMode, *dhtPrefix, privKey)
 	default:
 		log.Fatalf("Invalid mode: %s. Use 'provider', 'client', or 'mcp-server'", *mode)
 	}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+
+	"prxs/common"
+)
+
+// fakeAgent stands in for the agent subprocess: it answers each request
+// line on the daemon's pipe with handle's response.
+func fakeAgent(t *testing.T, handle func(req common.JSONRPCRequest) common.JSONRPCResponse) *agentPipe {
+	t.Helper()
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	t.Cleanup(func() {
+		reqW.Close()
+		respW.Close()
+	})
+	go func() {
+		lines := bufio.NewScanner(reqR)
+		for lines.Scan() {
+			var req common.JSONRPCRequest
+			if err := json.Unmarshal(lines.Bytes(), &req); err != nil {
+				return
+			}
+			resp := handle(req)
+			resp.ID = req.ID
+			b, _ := json.Marshal(resp)
+			if _, err := respW.Write(append(b, '\n')); err != nil {
+				return
+			}
+		}
+	}()
+	return newAgentPipe(reqW, respR)
+}
+
+func newTestHost(t *testing.T) host.Host {
+	t.Helper()
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := common.NewLoopbackHost(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// serveDaemon serves pd's execution handler on a loopback host and returns
+// a function calling it from a client host.
+func serveDaemon(t *testing.T, pd *ProviderDaemon) func(req common.JSONRPCRequest) *common.JSONRPCResponse {
+	t.Helper()
+	provider, client := newTestHost(t), newTestHost(t)
+	provider.SetStreamHandler(common.ProtocolID, pd.HandleExecutionStream)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := common.ConnectHosts(ctx, provider, client); err != nil {
+		t.Fatal(err)
+	}
+	return func(req common.JSONRPCRequest) *common.JSONRPCResponse {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		resp, err := common.CallProvider(ctx, client, provider.ID(), req)
+		if err != nil {
+			t.Errorf("call %s failed: %v", req.Method, err)
+			return &common.JSONRPCResponse{}
+		}
+		return resp
+	}
+}
+
+func TestPendingCap(t *testing.T) {
+	const limit = 2
+	started := make(chan struct{}, limit+1)
+	release := make(chan struct{})
+	pd := &ProviderDaemon{
+		agent: fakeAgent(t, func(req common.JSONRPCRequest) common.JSONRPCResponse {
+			started <- struct{}{}
+			<-release
+			return common.JSONRPCResponse{Result: "done"}
+		}),
+		pending: make(chan struct{}, limit),
+	}
+	call := serveDaemon(t, pd)
+
+	// limit calls hold every slot: one runs in the agent, the rest wait
+	// for the pipe
+	results := make(chan *common.JSONRPCResponse, limit)
+	for i := 0; i < limit; i++ {
+		go func(id int) { results <- call(common.JSONRPCRequest{Method: "work", ID: id}) }(i + 1)
+	}
+	<-started
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pd.pending) < limit {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d calls pending", len(pd.pending), limit)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if resp := call(common.JSONRPCRequest{Method: "work", ID: 99}); resp.Error != common.ServerBusy || resp.ID != 99 {
+		t.Fatalf("call past the cap: %+v", resp)
+	}
+
+	close(release)
+	for i := 0; i < limit; i++ {
+		if resp := <-results; resp.Error != "" || resp.Result != "done" {
+			t.Fatalf("admitted call: %+v", resp)
+		}
+	}
+	// Slots free up once the calls finish
+	if resp := call(common.JSONRPCRequest{Method: "work", ID: 100}); resp.Error != "" {
+		t.Fatalf("call after the queue drained: %+v", resp)
+	}
+}
+
+func TestCallDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	pd := &ProviderDaemon{
+		agent: fakeAgent(t, func(req common.JSONRPCRequest) common.JSONRPCResponse {
+			<-release
+			return common.JSONRPCResponse{Result: "late"}
+		}),
+	}
+	call := serveDaemon(t, pd)
+
+	start := time.Now()
+	resp := call(common.JSONRPCRequest{Method: "slow", ID: 4, TimeoutMs: 50})
+	if resp.Error != common.DeadlineExceeded || resp.ID != 4 {
+		t.Fatalf("slow call: %+v", resp)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("deadline answered after %s", elapsed)
+	}
+}
+
+func TestRateLimitedRetryAfter(t *testing.T) {
+	clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+	calls := 0
+	pd := &ProviderDaemon{
+		agent: fakeAgent(t, func(req common.JSONRPCRequest) common.JSONRPCResponse {
+			calls++
+			return common.JSONRPCResponse{Result: "ok"}
+		}),
+		Card:    common.ServiceCard{RateLimit: 1},
+		limiter: newCallLimiter(1, clock),
+	}
+	call := serveDaemon(t, pd)
+
+	if resp := call(common.JSONRPCRequest{Method: "work", ID: 1}); resp.Error != "" {
+		t.Fatalf("first call: %+v", resp)
+	}
+	clock.Advance(250 * time.Millisecond)
+	resp := call(common.JSONRPCRequest{Method: "work", ID: 2})
+	if resp.Error != common.RateLimited || resp.ID != 2 || resp.RetryAfterMs != 750 {
+		t.Fatalf("call over the limit: %+v, want RateLimited for id 2 retrying after 750ms", resp)
+	}
+	if calls != 1 {
+		t.Fatalf("agent saw %d calls, want the refused one kept from it", calls)
+	}
+
+	// Waiting out the hint is enough
+	clock.Advance(time.Duration(resp.RetryAfterMs) * time.Millisecond)
+	if resp := call(common.JSONRPCRequest{Method: "work", ID: 3}); resp.Error != "" || resp.ID != 3 {
+		t.Fatalf("call after the hint: %+v", resp)
+	}
+}
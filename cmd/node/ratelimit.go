@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"prxs/common"
+)
+
+// callLimiter is a token bucket enforcing the rate a provider advertises in
+// ServiceCard.RateLimit. It holds up to one second of calls (at least one)
+// so short bursts pass. A nil *callLimiter admits everything.
+type callLimiter struct {
+	rate  float64 // Tokens per second
+	burst float64
+	clock common.Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newCallLimiter returns nil, disabling limiting, for rate <= 0. Tokens
+// refill as clock advances.
+func newCallLimiter(rate float64, clock common.Clock) *callLimiter {
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return nil
+	}
+	burst := math.Max(1, math.Ceil(rate))
+	return &callLimiter{rate: rate, burst: burst, clock: clock, tokens: burst, last: clock.Now()}
+}
+
+// allow takes a token if one is available; otherwise it returns how long
+// until the next one is.
+func (l *callLimiter) allow() (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"prxs/common"
+)
+
+func TestCallLimiter(t *testing.T) {
+	clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+	l := newCallLimiter(2, clock)
+
+	// A burst of one second's worth of calls passes, then the bucket is empty
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow(); !ok {
+			t.Fatalf("call %d of the burst rejected", i+1)
+		}
+	}
+	ok, wait := l.allow()
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("allow = %v, %s; want rejected with 500ms to wait", ok, wait)
+	}
+
+	clock.Advance(499 * time.Millisecond)
+	if ok, _ := l.allow(); ok {
+		t.Fatal("admitted before the next token")
+	}
+	clock.Advance(time.Millisecond)
+	if ok, _ := l.allow(); !ok {
+		t.Fatal("rejected once the next token was due")
+	}
+
+	if l := newCallLimiter(0, clock); l != nil {
+		t.Fatal("rate 0 should disable limiting")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+
+	"prxs/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// accessTokenHeader carries the access token for private services on REST
+// queries. Over the registry RPC it is RegistryRequest.Token.
+const accessTokenHeader = "X-Access-Token"
+
+// Bound on a private card's AllowPeers and TokenHashes, each.
+const maxAccessEntries = 64
+
+// accessCreds identifies a caller to private services. REST callers have
+// no peer identity and can only present a token.
+type accessCreds struct {
+	Peer  peer.ID
+	Token string
+}
+
+// restAccess reads the caller's access token from the request header.
+func restAccess(c *gin.Context) accessCreds {
+	return accessCreds{Token: c.GetHeader(accessTokenHeader)}
+}
+
+// canSee reports whether the caller may discover the service. Public
+// services are visible to everyone.
+func (a accessCreds) canSee(card common.ServiceCard) bool {
+	if card.Visibility != common.VisibilityPrivate {
+		return true
+	}
+	if a.Peer != "" {
+		for _, p := range card.AllowPeers {
+			if p == a.Peer.String() {
+				return true
+			}
+		}
+	}
+	if a.Token != "" {
+		hash := []byte(common.HashAccessToken(a.Token))
+		for _, h := range card.TokenHashes {
+			if subtle.ConstantTimeCompare(hash, []byte(h)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkVisibility validates a card's access settings at registration. A
+// private card must name at least one peer or token, or nobody could find it.
+func checkVisibility(card common.ServiceCard) error {
+	switch card.Visibility {
+	case "", common.VisibilityPublic:
+		return nil
+	case common.VisibilityPrivate:
+	default:
+		return fmt.Errorf("invalid visibility %q (want %q or %q)", card.Visibility, common.VisibilityPublic, common.VisibilityPrivate)
+	}
+
+	if len(card.AllowPeers) == 0 && len(card.TokenHashes) == 0 {
+		return fmt.Errorf("private service needs allow_peers or token_hashes")
+	}
+	if len(card.AllowPeers) > maxAccessEntries || len(card.TokenHashes) > maxAccessEntries {
+		return fmt.Errorf("too many access entries (max %d each)", maxAccessEntries)
+	}
+	for _, p := range card.AllowPeers {
+		if _, err := peer.Decode(p); err != nil {
+			return fmt.Errorf("invalid allow_peers entry %q: %v", p, err)
+		}
+	}
+	for _, h := range card.TokenHashes {
+		if b, err := hex.DecodeString(h); err != nil || len(b) != 32 {
+			return fmt.Errorf("invalid token_hashes entry %q (want hex SHA-256)", h)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"prxs/common"
+)
+
+func TestPrivateServiceVisibility(t *testing.T) {
+	r := newTestRegistry(t)
+	allowed := newTestPeer(t)
+	card := common.ServiceCard{
+		Name:        "private-svc",
+		Visibility:  common.VisibilityPrivate,
+		AllowPeers:  []string{allowed.ID().String()},
+		TokenHashes: []string{common.HashAccessToken("s3cret")},
+	}
+	registerAs(t, r, newTestPeer(t), card)
+
+	tests := []struct {
+		name   string
+		caller *testPeer
+		token  string
+		want   int
+	}{
+		{"no credentials", newTestPeer(t), "", 0},
+		{"wrong token", newTestPeer(t), "guess", 0},
+		{"token", newTestPeer(t), "s3cret", 1},
+		{"allowed peer", allowed, "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := r.handleRequest(tt.caller.ID(), common.RegistryRequest{Method: "find", Query: "private-svc", Token: tt.token})
+			if len(resp.Providers) != tt.want {
+				t.Fatalf("find returned %d providers, want %d (%+v)", len(resp.Providers), tt.want, resp)
+			}
+		})
+	}
+
+	router := r.setupRESTAPI()
+	for _, tt := range []struct {
+		token string
+		want  int
+	}{{"", http.StatusNotFound}, {"guess", http.StatusNotFound}, {"s3cret", http.StatusOK}} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/services/private-svc", nil)
+		if tt.token != "" {
+			req.Header.Set(accessTokenHeader, tt.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Fatalf("GET with token %q: status %d, want %d: %s", tt.token, w.Code, tt.want, w.Body)
+		}
+		if tt.want == http.StatusOK {
+			var body struct{ Count int }
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Count != 1 {
+				t.Fatalf("GET with token: %s", w.Body)
+			}
+		}
+	}
+}
+
+func TestCORSAllowsAccessToken(t *testing.T) {
+	router := newTestRegistry(t).setupRESTAPI()
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/services/private-svc", nil)
+	req.Header.Set("Origin", "http://localhost:5173")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", accessTokenHeader)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code >= 300 {
+		t.Fatalf("preflight status %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(strings.ToLower(got), strings.ToLower(accessTokenHeader)) {
+		t.Fatalf("Access-Control-Allow-Headers = %q, want it to include %s", got, accessTokenHeader)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"prxs/common"
+	"prxs/storage"
+)
+
+// requireAdmin guards operator endpoints with the -admin-token bearer token.
+// Admin endpoints are disabled entirely when no token is configured.
+func (r *RegistryNode) requireAdmin(c *gin.Context) {
+	if r.adminToken == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API disabled (no -admin-token configured)"})
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(r.adminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+	c.Next()
+}
+
+// --- Featured services ---
+
+// listFeatured returns the featured service names.
+// GET /api/v1/admin/featured
+func (r *RegistryNode) listFeatured(c *gin.Context) {
+	r.mu.Lock()
+	names := r.featuredNames()
+	r.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"featured": names, "count": len(names)})
+}
+
+// setFeatured pins (PUT) or unpins (DELETE) a service name.
+// PUT|DELETE /api/v1/admin/featured/:name
+func (r *RegistryNode) setFeatured(c *gin.Context) {
+	name := c.Param("name")
+	featured := c.Request.Method == http.MethodPut
+
+	if err := r.storage.SetFeatured(c.Request.Context(), name, featured); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	r.mu.Lock()
+	if featured {
+		r.featured[name] = true
+	} else {
+		delete(r.featured, name)
+	}
+	r.touchView()
+	r.mu.Unlock()
+
+	log.Printf("[Reg] Admin set featured=%t for service %s\n", featured, name)
+	c.JSON(http.StatusOK, gin.H{"service": name, "featured": featured})
+}
+
+// featuredNames returns the featured names, sorted. Callers must hold r.mu.
+func (r *RegistryNode) featuredNames() []string {
+	names := make([]string, 0, len(r.featured))
+	for name := range r.featured {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serviceOrder lists the keys of a name-keyed listing with featured services
+// first, each group alphabetical. Callers must hold r.mu.
+func (r *RegistryNode) serviceOrder(names []string) []string {
+	order := append([]string(nil), names...)
+	sort.Slice(order, func(i, j int) bool {
+		fi, fj := r.featured[order[i]], r.featured[order[j]]
+		if fi != fj {
+			return fi
+		}
+		return order[i] < order[j]
+	})
+	return order
+}
+
+// annotateFeatured adds the featured names among names to a name-keyed
+// listing response, plus an "order" with featured services first when the
+// request asks for ?featured_first=true. Callers must hold r.mu.
+func (r *RegistryNode) annotateFeatured(c *gin.Context, names []string, resp gin.H) {
+	featured := []string{}
+	for _, name := range names {
+		if r.featured[name] {
+			featured = append(featured, name)
+		}
+	}
+	sort.Strings(featured)
+	resp["featured"] = featured
+	if c.Query("featured_first") == "true" {
+		resp["order"] = r.serviceOrder(names)
+	}
+}
+
+// --- Staker removal ---
+
+// removedRegistration is one provider dropped by deregisterStaker.
+type removedRegistration struct {
+	PeerID   string   `json:"peer_id"`
+	Services []string `json:"services"`
+}
+
+// deregisterStaker removes every registration whose stake proof names the
+// staker, e.g. when its key is compromised, from memory, the indexes,
+// storage and Qdrant. Returns what was removed (an empty list when nothing
+// matched).
+// POST /api/v1/admin/deregister_staker/:staker
+func (r *RegistryNode) deregisterStaker(c *gin.Context) {
+	staker := c.Param("staker")
+
+	r.mu.Lock()
+	dropped := r.dropStaker(staker)
+	r.mu.Unlock()
+	r.finishDrops(dropped)
+
+	removed := []removedRegistration{}
+	for _, d := range dropped {
+		names := make([]string, 0, 1+len(d.rec.Extra))
+		for _, card := range d.rec.cards() {
+			names = append(names, card.Name)
+		}
+		removed = append(removed, removedRegistration{PeerID: d.rec.AddrInfo.ID.String(), Services: names})
+	}
+
+	sort.Slice(removed, func(i, j int) bool { return removed[i].PeerID < removed[j].PeerID })
+	log.Printf("[Reg] Admin deregistered staker %s: %d providers removed\n", staker, len(removed))
+	c.JSON(http.StatusOK, gin.H{"staker": staker, "removed": removed, "count": len(removed)})
+}
+
+// dropStaker removes every registration whose stake proof names staker and
+// returns the removed records for finishDrops. Callers must hold r.mu.
+func (r *RegistryNode) dropStaker(staker string) []droppedRecord {
+	var removed []droppedRecord
+	for pid, rec := range r.Registrations {
+		if rec.StakeProof == nil || rec.StakeProof.Staker != staker {
+			continue
+		}
+		removed = append(removed, r.dropRegistration(pid, archiveReasonStaker))
+	}
+	return removed
+}
+
+// --- Re-embedding ---
+
+// reindexBatchSize is how many vectors adminReindex upserts per Qdrant request.
+const reindexBatchSize = 64
+
+// adminReindex recomputes the embedding of every live registration with the
+// current embedder and re-upserts the vectors into Qdrant in batches; cards
+// whose provider supplied its own vector are re-upserted with it. The
+// registry keeps serving meanwhile: embeddings are computed without holding
+// r.mu, and a record that was replaced or removed in the meantime is skipped.
+// POST /api/v1/admin/reindex
+func (r *RegistryNode) adminReindex(c *gin.Context) {
+	if r.qdrant == nil || r.embedder == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "semantic search not enabled"})
+		return
+	}
+
+	type item struct {
+		pid    peer.ID
+		record *RegistrationRecord
+		card   common.ServiceCard
+		index  int // Position in record.cards(): 0 is ServiceCard, then Extra
+	}
+	r.mu.Lock()
+	items := make([]item, 0, len(r.Registrations))
+	for pid, rec := range r.Registrations {
+		for i, card := range rec.cards() {
+			items = append(items, item{pid: pid, record: rec, card: card, index: i})
+		}
+	}
+	r.mu.Unlock()
+
+	ctx := c.Request.Context()
+	reindexed, failed := 0, 0
+	batch := make([]qdrantPoint, 0, reindexBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.qdrant.UpsertServices(batch); err != nil {
+			log.Printf("[Reg] Reindex batch upsert failed: %v\n", err)
+			failed += len(batch)
+		} else {
+			reindexed += len(batch)
+		}
+		batch = batch[:0]
+	}
+
+	for _, it := range items {
+		card := it.card
+		own := it.record.suppliedEmbedding(card.Name)
+		vec, text := card.Embedding, ""
+		var err error
+		if !own {
+			text = r.embeddingInput(cardEmbeddingText(card))
+			vec, err = r.embedder.EmbedText(ctx, text)
+		}
+		if err == nil {
+			err = r.validateEmbedding(vec)
+		}
+		if err != nil {
+			log.Printf("[Reg] Reindex: embedding %s failed: %v\n", it.pid.ShortString(), err)
+			failed++
+			continue
+		}
+		if !own && r.embedCache != nil {
+			r.embedCache.put(r.embedCacheKey(text), vec)
+		}
+
+		var stored *storage.RegistrationRecord
+		var ttl time.Duration
+		r.mu.Lock()
+		live := r.Registrations[it.pid] == it.record
+		if live && !own {
+			if it.index == 0 {
+				it.record.ServiceCard.Embedding = vec
+			} else {
+				it.record.Extra[it.index-1].Embedding = vec
+			}
+			r.touchView()
+			stored, ttl = r.convertToStorageRecord(it.record), r.storageTTL(it.record)
+		}
+		r.mu.Unlock()
+		if !live {
+			continue
+		}
+		if stored != nil {
+			r.storeRegistration(it.pid, stored, ttl)
+		}
+
+		batch = append(batch, qdrantPoint{
+			ID:      fmt.Sprintf("%s:%s", it.pid.String(), card.Name),
+			Vector:  vec,
+			Payload: r.qdrantPayload(it.pid, card),
+		})
+		if len(batch) == reindexBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	log.Printf("[Reg] Admin reindex: %d re-indexed, %d failed\n", reindexed, failed)
+	c.JSON(http.StatusOK, gin.H{"reindexed": reindexed, "failed": failed})
+}
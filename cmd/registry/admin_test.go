@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prxs/common"
+)
+
+func TestAdminReindex(t *testing.T) {
+	r := newTestRegistry(t)
+	r.adminToken = "secret"
+	qdrant, embedder := withEmbedding(t, r)
+	router := r.setupRESTAPI()
+
+	single := newTestPeer(t)
+	registerAs(t, r, single, common.ServiceCard{Name: "alpha", Description: "First"})
+	gateway := newTestPeer(t)
+	knowPeer(t, r, gateway)
+	own := []float32{0.1, 0.2, 0.3}
+	resp := r.handleRequest(gateway.ID(), common.RegistryRequest{
+		Method: "register_batch",
+		Cards: []common.ServiceCard{
+			{Name: "beta", Description: "Second"},
+			{Name: "gamma", Description: "Third", Embedding: own},
+		},
+		ProviderInfo: gateway.addrInfo(),
+		StakeProof:   gateway.stakeProof(t, 100, time.Now().UnixNano()),
+	})
+	if !resp.Success {
+		t.Fatalf("register_batch failed: %s", resp.Error)
+	}
+
+	// Forget the vectors written at registration
+	qdrant.mu.Lock()
+	clear(qdrant.points)
+	qdrant.mu.Unlock()
+	embedded := len(embedder.calls())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/reindex", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var body struct{ Reindexed, Failed int }
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("reindex: %d %s", w.Code, w.Body)
+	}
+	if body.Reindexed != 3 || body.Failed != 0 {
+		t.Fatalf("reindexed %d, failed %d; want 3 and 0", body.Reindexed, body.Failed)
+	}
+	if n := len(embedder.calls()) - embedded; n != 2 {
+		t.Fatalf("embedded %d cards, want the 2 without their own vector", n)
+	}
+
+	for _, id := range []string{single.ID().String() + ":alpha", gateway.ID().String() + ":beta", gateway.ID().String() + ":gamma"} {
+		p, ok := qdrant.point(id)
+		if !ok || len(p.Vector) != 3 {
+			t.Fatalf("point %s not re-upserted: %+v", id, p)
+		}
+	}
+	if p, _ := qdrant.point(gateway.ID().String() + ":gamma"); p.Vector[0] != own[0] || p.Vector[2] != own[2] {
+		t.Fatalf("supplied vector replaced: %v", p.Vector)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	adminNonceTTL = time.Minute // How long an issued admin challenge stays valid
+	maxAdminNonce = 1024        // Outstanding challenges; more are refused
+)
+
+// parseAdminKeys parses -admin-keys, a comma-separated list of the peer IDs
+// of keys allowed to sign admin RPC commands.
+func parseAdminKeys(s string) ([]peer.ID, error) {
+	var ids []peer.ID
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		id, err := peer.Decode(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin key %q: %v", part, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// adminAuth authenticates admin RPC commands: it issues single-use nonces
+// to the peer that asked and checks that a command is signed over one by an
+// authorized key. The stream's own peer ID grants nothing, so an operator
+// can use any connection as long as it holds an admin key.
+type adminAuth struct {
+	keys map[peer.ID]bool
+
+	mu     sync.Mutex
+	nonces map[string]adminNonce
+}
+
+type adminNonce struct {
+	peer    peer.ID // Peer the challenge was issued to
+	expires time.Time
+}
+
+// newAdminAuth returns nil, disabling admin RPC, when no key is authorized.
+func newAdminAuth(keys []peer.ID) *adminAuth {
+	if len(keys) == 0 {
+		return nil
+	}
+	a := &adminAuth{keys: make(map[peer.ID]bool), nonces: make(map[string]adminNonce)}
+	for _, id := range keys {
+		a.keys[id] = true
+	}
+	return a
+}
+
+// issue returns a fresh nonce for remote, valid for adminNonceTTL from now.
+func (a *adminAuth) issue(remote peer.ID, now time.Time) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for n, e := range a.nonces {
+		if now.After(e.expires) {
+			delete(a.nonces, n)
+		}
+	}
+	if len(a.nonces) >= maxAdminNonce {
+		return "", fmt.Errorf("too many outstanding admin challenges")
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := hex.EncodeToString(b)
+	a.nonces[nonce] = adminNonce{peer: remote, expires: now.Add(adminNonceTTL)}
+	return nonce, nil
+}
+
+// consume spends nonce, reporting whether it was issued to remote and is
+// still valid at now. A nonce is spent even when the command then fails to
+// verify.
+func (a *adminAuth) consume(nonce string, remote peer.ID, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.nonces[nonce]
+	if !ok {
+		return false
+	}
+	delete(a.nonces, nonce)
+	return e.peer == remote && now.Before(e.expires)
+}
+
+// peerBans holds operator bans set through the admin RPC, in memory only.
+// A nil *peerBans bans nobody.
+type peerBans struct {
+	mu     sync.Mutex
+	banned map[peer.ID]time.Time // Peer -> ban expiry
+}
+
+func newPeerBans() *peerBans {
+	return &peerBans{banned: make(map[peer.ID]time.Time)}
+}
+
+func (b *peerBans) ban(pid peer.ID, until time.Time) {
+	b.mu.Lock()
+	b.banned[pid] = until
+	b.mu.Unlock()
+}
+
+// blockedUntil returns when pid's ban expires, or false if it isn't banned
+// at now.
+func (b *peerBans) blockedUntil(pid peer.ID, now time.Time) (time.Time, bool) {
+	if b == nil {
+		return time.Time{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until, ok := b.banned[pid]
+	if !ok {
+		return time.Time{}, false
+	}
+	if now.After(until) {
+		delete(b.banned, pid)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// prune drops bans expired at now.
+func (b *peerBans) prune(now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for pid, until := range b.banned {
+		if now.After(until) {
+			delete(b.banned, pid)
+		}
+	}
+}
+
+// adminChallenge answers RegistryMethodAdminChallenge with a nonce.
+func (r *RegistryNode) adminChallenge(remotePeer peer.ID) common.RegistryResponse {
+	resp := common.RegistryResponse{}
+	if r.adminAuth == nil {
+		resp.Error = "admin RPC disabled (no -admin-keys configured)"
+		return resp
+	}
+	nonce, err := r.adminAuth.issue(remotePeer, r.now())
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Nonce = nonce
+	resp.Success = true
+	return resp
+}
+
+// adminCommand authenticates and executes a RegistryMethodAdmin call. The
+// providers it removed are returned in Providers.
+func (r *RegistryNode) adminCommand(remotePeer peer.ID, cmd *common.AdminCommand) common.RegistryResponse {
+	resp := common.RegistryResponse{}
+	if r.adminAuth == nil {
+		resp.Error = "admin RPC disabled (no -admin-keys configured)"
+		return resp
+	}
+	if cmd == nil {
+		resp.Error = "admin command required"
+		return resp
+	}
+	if !r.adminAuth.consume(cmd.Nonce, remotePeer, r.now()) {
+		resp.Error = "unknown or expired admin nonce"
+		return resp
+	}
+	signer, err := cmd.Verify(r.Host.ID())
+	if err != nil {
+		resp.Error = err.Error()
+		log.Printf("[Reg] Rejected admin %s from %s: %v\n", cmd.Action, remotePeer.ShortString(), err)
+		return resp
+	}
+	if !r.adminAuth.keys[signer] {
+		resp.Error = "unauthorized admin key"
+		log.Printf("[Reg] Rejected admin %s from %s: key %s not authorized\n", cmd.Action, remotePeer.ShortString(), signer.ShortString())
+		return resp
+	}
+
+	var removed []droppedRecord
+	switch cmd.Action {
+	case common.AdminActionPrune, common.AdminActionBan:
+		pid, err := peer.Decode(cmd.Target)
+		if err != nil {
+			resp.Error = fmt.Sprintf("invalid target peer id %q", cmd.Target)
+			return resp
+		}
+		if cmd.Action == common.AdminActionBan {
+			if cmd.Duration <= 0 {
+				resp.Error = "ban duration required"
+				return resp
+			}
+			r.adminBans.ban(pid, r.now().Add(time.Duration(cmd.Duration)*time.Second))
+		}
+		r.mu.Lock()
+		if _, ok := r.Registrations[pid]; ok {
+			removed = append(removed, r.dropRegistration(pid, archiveReasonAdmin))
+		}
+		r.mu.Unlock()
+		r.finishDrops(removed)
+		if len(removed) == 0 && cmd.Action == common.AdminActionPrune {
+			resp.Error = "provider not registered"
+			return resp
+		}
+
+	case common.AdminActionDeregisterStaker:
+		if cmd.Target == "" {
+			resp.Error = "staker required"
+			return resp
+		}
+		r.mu.Lock()
+		removed = r.dropStaker(cmd.Target)
+		r.mu.Unlock()
+		r.finishDrops(removed)
+
+	default:
+		resp.Error = fmt.Sprintf("unknown admin action %q", cmd.Action)
+		return resp
+	}
+
+	resp.Providers = make([]peer.AddrInfo, 0, len(removed))
+	for _, d := range removed {
+		resp.Providers = append(resp.Providers, d.rec.AddrInfo)
+	}
+	resp.Success = true
+	log.Printf("[Reg] Admin %s %s by key %s: %d providers removed\n", cmd.Action, cmd.Target, signer.ShortString(), len(removed))
+	return resp
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// runAdmin connects operator to r and runs cmd signed with key.
+func runAdmin(t *testing.T, r *RegistryNode, operator *testPeer, key crypto.PrivKey, cmd common.AdminCommand) *common.RegistryResponse {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := common.ConnectHosts(ctx, r.Host, operator.Host); err != nil {
+		t.Fatalf("failed to connect to registry: %v", err)
+	}
+	rs, err := common.OpenRegistryStream(ctx, operator.Host, r.Host.ID())
+	if err != nil {
+		t.Fatalf("failed to open registry stream: %v", err)
+	}
+	defer rs.Close()
+	resp, err := common.RunAdminCommand(rs, r.Host.ID(), key, cmd, 5*time.Second)
+	if err != nil {
+		t.Fatalf("admin %s failed: %v", cmd.Action, err)
+	}
+	return resp
+}
+
+func TestAdminRPCAuthorization(t *testing.T) {
+	r := newTestRegistry(t)
+	admin, intruder := newTestPeer(t), newTestPeer(t)
+	r.adminAuth = newAdminAuth([]peer.ID{admin.ID()})
+
+	provider := newTestPeer(t)
+	registerAs(t, r, provider, common.ServiceCard{Name: "svc"})
+	prune := common.AdminCommand{Action: common.AdminActionPrune, Target: provider.ID().String()}
+
+	// The intruder's own connection doesn't help without an admin key
+	resp := runAdmin(t, r, intruder, intruder.key, prune)
+	if resp.Success || resp.Error != "unauthorized admin key" {
+		t.Fatalf("command signed by an unauthorized key: %+v", resp)
+	}
+	if _, ok := r.Registrations[provider.ID()]; !ok {
+		t.Fatal("unauthorized prune removed the provider")
+	}
+
+	// Any connection may carry a command signed by an admin key
+	resp = runAdmin(t, r, intruder, admin.key, prune)
+	if !resp.Success || len(resp.Providers) != 1 || resp.Providers[0].ID != provider.ID() {
+		t.Fatalf("authorized prune: %+v", resp)
+	}
+	if _, ok := r.Registrations[provider.ID()]; ok {
+		t.Fatal("authorized prune left the provider registered")
+	}
+}
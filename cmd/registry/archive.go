@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"prxs/storage"
+)
+
+// Reasons recorded with archived registrations.
+const (
+	archiveReasonPruned   = "pruned"   // Missed too many heartbeats
+	archiveReasonEvicted  = "evicted"  // Dropped for -max-registrations
+	archiveReasonRestored = "restored" // Already stale when read back at startup
+	archiveReasonStaker   = "staker"   // Removed with its staker by an operator
+	archiveReasonAdmin    = "admin"    // Pruned or banned through the admin RPC
+)
+
+// archiveRegistration copies a record the registry is about to drop into the
+// archive, when -archive-stale is set. Callers must hold r.mu or otherwise
+// own rec.
+func (r *RegistryNode) archiveRegistration(pid peer.ID, rec *RegistrationRecord, reason string) {
+	if r.archive == nil {
+		return
+	}
+	entry := storage.ArchivedRegistration{
+		PeerID:     pid.String(),
+		Record:     *r.convertToStorageRecord(rec),
+		Reason:     reason,
+		ArchivedAt: r.now(),
+	}
+	key := fmt.Sprintf("archive:%s:%d", pid, entry.ArchivedAt.UnixNano())
+	r.retries.do(key, "archive of registration "+pid.ShortString(), func() error {
+		return r.archive.ArchiveRegistration(context.Background(), entry, r.archiveTTL)
+	})
+}
+
+// restoreMaxAge is how far back restoreState reads records. With archiving
+// on it reads everything still in storage, so stale records can be archived
+// instead of silently skipped.
+func (r *RegistryNode) restoreMaxAge() time.Duration {
+	if r.archive != nil {
+		return time.Duration(math.MaxInt64)
+	}
+	return r.pruneAfter()
+}
+
+// listArchived returns archived registrations, newest first.
+// GET /api/v1/admin/archive?peer_id=<id>&limit=100
+func (r *RegistryNode) listArchived(c *gin.Context) {
+	if r.archive == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "archive not enabled (start with -archive-stale)"})
+		return
+	}
+	peerID := c.Query("peer_id")
+	if peerID != "" {
+		if _, err := peer.Decode(peerID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid peer_id %q", peerID)})
+			return
+		}
+	}
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit %q", v)})
+			return
+		}
+		limit = n
+	}
+
+	entries, err := r.archive.ListArchived(c.Request.Context(), peerID, limit)
+	if err != nil {
+		log.Printf("[Reg] Failed to list archive: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"archived": entries, "count": len(entries)})
+}
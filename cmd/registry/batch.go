@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// cards returns every service the record registers: ServiceCard first,
+// then a gateway's Extra cards.
+func (rec *RegistrationRecord) cards() []common.ServiceCard {
+	return append([]common.ServiceCard{rec.ServiceCard}, rec.Extra...)
+}
+
+// card returns the record's card for the named service.
+func (rec *RegistrationRecord) card(name string) (common.ServiceCard, bool) {
+	if rec.ServiceCard.Name == name {
+		return rec.ServiceCard, true
+	}
+	for _, c := range rec.Extra {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return common.ServiceCard{}, false
+}
+
+// suppliedEmbedding reports whether the provider sent the named card's
+// embedding itself.
+func (rec *RegistrationRecord) suppliedEmbedding(name string) bool {
+	return slices.Contains(rec.SuppliedEmbeddings, name)
+}
+
+// indexRecord adds every card of rec to the service and capability
+// indexes. Callers must hold r.mu.
+func (r *RegistryNode) indexRecord(pid peer.ID, rec *RegistrationRecord) {
+	r.touchView()
+	for _, c := range rec.cards() {
+		r.addToIndex(pid, c.Name)
+		r.capabilities.add(pid, c)
+	}
+}
+
+// unindexRecord drops every card of rec from the service and capability
+// indexes. Callers must hold r.mu.
+func (r *RegistryNode) unindexRecord(pid peer.ID, rec *RegistrationRecord) {
+	r.touchView()
+	for _, c := range rec.cards() {
+		r.removeFromIndex(pid, c.Name)
+		r.capabilities.remove(pid, c)
+	}
+}
+
+// registerBatch handles "register_batch": a gateway registers several
+// services under one stake proof. The batch is all-or-nothing: every card
+// is validated (and embedded) before any state changes, and it replaces
+// whatever the peer had registered before.
+func (r *RegistryNode) registerBatch(remotePeer peer.ID, req common.RegistryRequest) common.RegistryResponse {
+	resp := common.RegistryResponse{Success: false}
+
+	if len(req.Cards) == 0 {
+		resp.Error = "register_batch requires at least one card"
+		return resp
+	}
+	if r.maxServices > 0 && len(req.Cards) > r.maxServices {
+		resp.Error = fmt.Sprintf("batch of %d cards exceeds the limit of %d services per provider", len(req.Cards), r.maxServices)
+		return resp
+	}
+	if err := r.checkProviderInfo(req.ProviderInfo); err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	seen := make(map[string]bool, len(req.Cards))
+	for i, card := range req.Cards {
+		if card.Name == "" {
+			resp.Error = fmt.Sprintf("card %d: service name required", i)
+			return resp
+		}
+		if seen[card.Name] {
+			resp.Error = fmt.Sprintf("card %d: duplicate service %q", i, card.Name)
+			return resp
+		}
+		seen[card.Name] = true
+		if err := checkMetadata(card.Metadata); err != nil {
+			resp.Error = fmt.Sprintf("card %d (%s): %v", i, card.Name, err)
+			return resp
+		}
+		if err := checkRateLimit(card); err != nil {
+			resp.Error = fmt.Sprintf("card %d (%s): %v", i, card.Name, err)
+			return resp
+		}
+		if err := checkVisibility(card); err != nil {
+			resp.Error = fmt.Sprintf("card %d (%s): %v", i, card.Name, err)
+			return resp
+		}
+	}
+
+	if err := r.checkRegistrationRate(); err != nil {
+		rejectCall(&resp, err)
+		return resp
+	}
+	if err := r.checkStakeValidity(remotePeer, req.StakeProof); err != nil {
+		resp.Error = err.Error()
+		r.stakeFailure(remotePeer)
+		return resp
+	}
+	for _, card := range req.Cards {
+		if err := r.checkStakerDiversity(remotePeer, card.Name, req.StakeProof); err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+	}
+
+	cards := make([]common.ServiceCard, len(req.Cards))
+	copy(cards, req.Cards)
+	var supplied []string
+	for _, card := range cards {
+		if len(card.Embedding) > 0 {
+			if err := r.validateEmbedding(card.Embedding); err != nil {
+				resp.Error = fmt.Sprintf("invalid embedding for %s: %v", card.Name, err)
+				return resp
+			}
+			supplied = append(supplied, card.Name)
+		}
+	}
+	if r.qdrant != nil {
+		for i := range cards {
+			if len(cards[i].Embedding) == 0 && r.embedder != nil {
+				vec, err := r.embedCard(context.Background(), cards[i])
+				if err != nil {
+					resp.Error = fmt.Sprintf("failed to embed service card %s: %v", cards[i].Name, err)
+					return resp
+				}
+				cards[i].Embedding = vec
+			}
+			if err := r.validateEmbedding(cards[i].Embedding); err != nil {
+				resp.Error = fmt.Sprintf("invalid embedding for %s: %v", cards[i].Name, err)
+				return resp
+			}
+		}
+	}
+
+	// Replay protection as for "register", except that a gateway may resend
+	// the proof its current registration already uses to change its cards.
+	key := fmt.Sprintf("%s|%d", req.StakeProof.TxHash, req.StakeProof.Nonce)
+	r.mu.Lock()
+	existing, isRegistered := r.Registrations[remotePeer]
+	refresh := isRegistered && existing.StakeProof != nil &&
+		existing.StakeProof.TxHash == req.StakeProof.TxHash && existing.StakeProof.Nonce == req.StakeProof.Nonce
+	r.mu.Unlock()
+
+	r.stakeMu.Lock()
+	stakes := r.peerStakes[remotePeer]
+	used := false
+	for _, k := range stakes {
+		if k == key {
+			used = true
+			break
+		}
+	}
+	if used && !refresh {
+		r.stakeMu.Unlock()
+		resp.Error = "stake proof already used (replay detected)"
+		r.stakeFailure(remotePeer)
+		return resp
+	}
+	if !used {
+		r.peerStakes[remotePeer] = append(stakes, key)
+		if err := r.storage.SavePeerStakes(context.Background(), remotePeer, r.peerStakes[remotePeer]); err != nil {
+			log.Printf("[Reg] Warning: Failed to save peer stakes to Redis: %v", err)
+		}
+	}
+	r.stakeMu.Unlock()
+
+	record := &RegistrationRecord{
+		LastSeen:    r.now(),
+		ServiceCard: cards[0],
+		Extra:       cards[1:],
+		StakeProof:  req.StakeProof,
+		AddrInfo:    *req.ProviderInfo,
+		Stake:       r.stakeValue(req.StakeProof),
+
+		SuppliedEmbeddings: supplied,
+	}
+
+	var evicted []droppedRecord
+	r.mu.Lock()
+	old, ok := r.Registrations[remotePeer]
+	if ok {
+		r.unindexRecord(remotePeer, old)
+	} else {
+		evicted = r.evictForCapacity(1, remotePeer)
+	}
+	r.Registrations[remotePeer] = record
+	r.indexRecord(remotePeer, record)
+	r.recordHistory(remotePeer, old, record, "")
+	stored, ttl := r.convertToStorageRecord(record), r.storageTTL(record)
+	providers := len(r.Registrations)
+	r.mu.Unlock()
+	r.storeRegistration(remotePeer, stored, ttl)
+	r.finishDrops(evicted)
+
+	if r.qdrant != nil {
+		// Cards the replacement batch drops lose their points
+		if ok {
+			for _, card := range old.cards() {
+				if slices.ContainsFunc(cards, func(c common.ServiceCard) bool { return c.Name == card.Name }) {
+					continue
+				}
+				pointID := fmt.Sprintf("%s:%s", remotePeer.String(), card.Name)
+				r.retries.do("qdrant:"+pointID, "Qdrant remove of "+pointID, func() error {
+					return r.qdrant.RemoveService(pointID)
+				})
+			}
+		}
+
+		points := make([]qdrantPoint, 0, len(cards))
+		for _, card := range cards {
+			points = append(points, qdrantPoint{
+				ID:      fmt.Sprintf("%s:%s", remotePeer.String(), card.Name),
+				Vector:  card.Embedding,
+				Payload: r.qdrantPayload(remotePeer, card),
+			})
+		}
+		r.retries.do("qdrant:batch:"+remotePeer.String(), "Qdrant batch upsert for "+remotePeer.ShortString(), func() error {
+			return r.qdrant.UpsertServices(points)
+		})
+	}
+
+	log.Printf("[Reg] Batch registration: %s (%d services)\n", remotePeer.ShortString(), len(cards))
+	resp.Success = true
+	r.stakeBans.reset(remotePeer)
+	resp.HeartbeatInterval = int(r.heartbeatHint(providers) / time.Second)
+	return resp
+}
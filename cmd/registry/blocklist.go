@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// stakeBlocklist temporarily bans peers that keep submitting invalid or
+// replayed stake proofs. A nil *stakeBlocklist bans nobody.
+type stakeBlocklist struct {
+	threshold int           // Failures within window that trigger a ban
+	window    time.Duration // Sliding window failures are counted in
+	duration  time.Duration // How long a ban lasts
+
+	mu       sync.Mutex
+	failures map[peer.ID][]time.Time
+	banned   map[peer.ID]time.Time // Peer -> ban expiry
+}
+
+func newStakeBlocklist(threshold int, window, duration time.Duration) *stakeBlocklist {
+	if threshold <= 0 {
+		return nil
+	}
+	return &stakeBlocklist{
+		threshold: threshold,
+		window:    window,
+		duration:  duration,
+		failures:  make(map[peer.ID][]time.Time),
+		banned:    make(map[peer.ID]time.Time),
+	}
+}
+
+// blockedUntil returns when pid's ban expires, or false if it isn't banned
+// at now.
+func (b *stakeBlocklist) blockedUntil(pid peer.ID, now time.Time) (time.Time, bool) {
+	if b == nil {
+		return time.Time{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until, ok := b.banned[pid]
+	if !ok {
+		return time.Time{}, false
+	}
+	if now.After(until) {
+		delete(b.banned, pid)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// fail records an invalid stake attempt by pid at now and reports whether
+// it tipped the peer into a ban.
+func (b *stakeBlocklist) fail(pid peer.ID, now time.Time) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	recent := b.failures[pid][:0]
+	for _, t := range b.failures[pid] {
+		if now.Sub(t) <= b.window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+
+	if len(recent) < b.threshold {
+		b.failures[pid] = recent
+		return false
+	}
+	delete(b.failures, pid)
+	b.banned[pid] = now.Add(b.duration)
+	return true
+}
+
+// reset clears pid's failure count after a valid registration.
+func (b *stakeBlocklist) reset(pid peer.ID) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	delete(b.failures, pid)
+	b.mu.Unlock()
+}
+
+// prune drops bans and failure windows expired at now; run periodically so
+// peers that never come back don't accumulate.
+func (b *stakeBlocklist) prune(now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for pid, until := range b.banned {
+		if now.After(until) {
+			delete(b.banned, pid)
+		}
+	}
+	for pid, times := range b.failures {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) > b.window {
+			delete(b.failures, pid)
+		}
+	}
+}
+
+// stakeFailure counts an invalid or replayed stake proof from pid against
+// the blocklist, logging when it results in a ban.
+func (r *RegistryNode) stakeFailure(pid peer.ID) {
+	if r.stakeBans.fail(pid, r.now()) {
+		log.Printf("[Reg] Blocked %s for %s after %d invalid stake attempts\n", pid.ShortString(), r.stakeBans.duration, r.stakeBans.threshold)
+	}
+}
+
+// checkBlocked rejects registration calls from a banned peer, telling it to
+// retry once the ban expires.
+func (r *RegistryNode) checkBlocked(pid peer.ID) error {
+	now := r.now()
+	if until, ok := r.adminBans.blockedUntil(pid, now); ok {
+		return &retryLaterError{
+			Reason: fmt.Sprintf("peer banned by the registry operator (until %s)", until.Format(time.RFC3339)),
+			Wait:   until.Sub(now),
+		}
+	}
+	if until, ok := r.stakeBans.blockedUntil(pid, now); ok {
+		return &retryLaterError{
+			Reason: fmt.Sprintf("peer temporarily blocked after repeated invalid stake proofs (until %s)", until.Format(time.RFC3339)),
+			Wait:   until.Sub(now),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"prxs/common"
+)
+
+// capabilityIndex maps input and output names (lowercased) to the peers
+// whose ServiceCard declares them. It is guarded by RegistryNode.mu.
+type capabilityIndex struct {
+	inputs  map[string]map[peer.ID]bool
+	outputs map[string]map[peer.ID]bool
+}
+
+func newCapabilityIndex() *capabilityIndex {
+	return &capabilityIndex{
+		inputs:  make(map[string]map[peer.ID]bool),
+		outputs: make(map[string]map[peer.ID]bool),
+	}
+}
+
+// add indexes the inputs and outputs of a provider's card.
+func (ci *capabilityIndex) add(pid peer.ID, card common.ServiceCard) {
+	indexNames(ci.inputs, pid, card.Inputs)
+	indexNames(ci.outputs, pid, card.Outputs)
+}
+
+// remove drops a provider's card from the index.
+func (ci *capabilityIndex) remove(pid peer.ID, card common.ServiceCard) {
+	unindexNames(ci.inputs, pid, card.Inputs)
+	unindexNames(ci.outputs, pid, card.Outputs)
+}
+
+// match returns the peers declaring every requested input and output.
+// Names compare case-insensitively. With nothing requested it matches nothing.
+func (ci *capabilityIndex) match(inputs, outputs []string) []peer.ID {
+	var candidates map[peer.ID]bool
+	narrow := func(index map[string]map[peer.ID]bool, names []string) {
+		for _, name := range names {
+			set := index[strings.ToLower(name)]
+			next := make(map[peer.ID]bool)
+			for pid := range set {
+				if candidates == nil || candidates[pid] {
+					next[pid] = true
+				}
+			}
+			candidates = next
+		}
+	}
+	narrow(ci.inputs, inputs)
+	narrow(ci.outputs, outputs)
+
+	result := make([]peer.ID, 0, len(candidates))
+	for pid := range candidates {
+		result = append(result, pid)
+	}
+	return result
+}
+
+// declaresAll reports whether card lists every input and output (compared
+// case-insensitively), as match does for whole providers.
+func declaresAll(card common.ServiceCard, inputs, outputs []string) bool {
+	has := func(declared []string, name string) bool {
+		for _, d := range declared {
+			if strings.EqualFold(d, name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range inputs {
+		if !has(card.Inputs, name) {
+			return false
+		}
+	}
+	for _, name := range outputs {
+		if !has(card.Outputs, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func indexNames(index map[string]map[peer.ID]bool, pid peer.ID, names []string) {
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if index[key] == nil {
+			index[key] = make(map[peer.ID]bool)
+		}
+		index[key][pid] = true
+	}
+}
+
+func unindexNames(index map[string]map[peer.ID]bool, pid peer.ID, names []string) {
+	for _, name := range names {
+		key := strings.ToLower(name)
+		delete(index[key], pid)
+		if len(index[key]) == 0 {
+			delete(index, key)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"prxs/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// retryLaterError is a rejection caused by a rate or capacity limit rather
+// than by the request itself: the same call should succeed after Wait.
+type retryLaterError struct {
+	Reason string
+	Wait   time.Duration
+}
+
+func (e *retryLaterError) Error() string {
+	return fmt.Sprintf("%s; try again in %ds", e.Reason, retryAfterSeconds(e.Wait))
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds, at least 1, as sent
+// in RegistryResponse.RetryAfter and the Retry-After header.
+func retryAfterSeconds(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+// rejectCall fails an RPC response with err, adding the retry hint when err
+// is a retryLaterError.
+func rejectCall(resp *common.RegistryResponse, err error) {
+	resp.Error = err.Error()
+	var retry *retryLaterError
+	if errors.As(err, &retry) {
+		resp.RetryAfter = retryAfterSeconds(retry.Wait)
+	}
+}
+
+// restRetryAfter is the back-off suggested to REST callers turned away by
+// limitConcurrency; in-flight requests finish quickly.
+const restRetryAfter = time.Second
+
+// limitConcurrency caps in-flight REST requests at max (0 = unlimited).
+// Requests over the cap are refused at once with 503 and a Retry-After
+// header instead of queueing behind the registry lock.
+func limitConcurrency(max int) gin.HandlerFunc {
+	if max <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	slots := make(chan struct{}, max)
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			c.Next()
+		default:
+			err := &retryLaterError{Reason: "registry over capacity", Wait: restRetryAfter}
+			c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(err.Wait)))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":       err.Error(),
+				"retry_after": retryAfterSeconds(err.Wait),
+			})
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"prxs/common"
+)
+
+// denomTable converts stake amounts to the registry's base unit, which is
+// the unit of -min-stake and -max-stake. It maps a lowercased denomination
+// to how many base units one unit of it is worth. Proofs without a Denom
+// are taken to be in the base unit already.
+type denomTable map[string]float64
+
+// parseDenomTable parses "prxs=1,uprxs=0.000001".
+func parseDenomTable(spec string) (denomTable, error) {
+	table := denomTable{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rate, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid denomination entry %q (want name=rate)", entry)
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if err != nil || f <= 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("invalid rate for denomination %q: %q", name, rate)
+		}
+		table[name] = f
+	}
+	return table, nil
+}
+
+// normalize returns the proof's amount in base units. Unknown
+// denominations are rejected.
+func (t denomTable) normalize(proof *common.StakeProof) (float64, error) {
+	if proof.Denom == "" {
+		return proof.Amount, nil
+	}
+	rate, ok := t[strings.ToLower(proof.Denom)]
+	if !ok {
+		return 0, fmt.Errorf("unknown stake denomination %q", proof.Denom)
+	}
+	return proof.Amount * rate, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"sync"
+
+	"prxs/common"
+)
+
+// embeddingCache is an LRU of card embeddings keyed by a hash of the card's
+// embeddable text. A card whose text changes hashes to a new key, so stale
+// vectors are never served; the old entry simply ages out.
+type embeddingCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // front = most recently used
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type embeddingCacheEntry struct {
+	key    [sha256.Size]byte
+	vector []float32
+}
+
+func newEmbeddingCache(max int) *embeddingCache {
+	return &embeddingCache{
+		max:     max,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+func (ec *embeddingCache) get(key [sha256.Size]byte) ([]float32, bool) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	el, ok := ec.entries[key]
+	if !ok {
+		return nil, false
+	}
+	ec.order.MoveToFront(el)
+	return el.Value.(*embeddingCacheEntry).vector, true
+}
+
+func (ec *embeddingCache) put(key [sha256.Size]byte, vector []float32) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if el, ok := ec.entries[key]; ok {
+		el.Value.(*embeddingCacheEntry).vector = vector
+		ec.order.MoveToFront(el)
+		return
+	}
+	ec.entries[key] = ec.order.PushFront(&embeddingCacheEntry{key: key, vector: vector})
+	for ec.order.Len() > ec.max {
+		oldest := ec.order.Back()
+		ec.order.Remove(oldest)
+		delete(ec.entries, oldest.Value.(*embeddingCacheEntry).key)
+	}
+}
+
+// cardEmbeddingText is the text the registry embeds for a card that arrives
+// without its own vector.
+func cardEmbeddingText(card common.ServiceCard) string {
+	parts := []string{card.Name, card.Description}
+	if len(card.Tags) > 0 {
+		parts = append(parts, "tags: "+strings.Join(card.Tags, ", "))
+	}
+	if len(card.Inputs) > 0 {
+		parts = append(parts, "inputs: "+strings.Join(card.Inputs, ", "))
+	}
+	if len(card.Outputs) > 0 {
+		parts = append(parts, "outputs: "+strings.Join(card.Outputs, ", "))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// embedCacheKey scopes the cache key to the embedding model, so switching
+// models never serves vectors from the old one.
+func (r *RegistryNode) embedCacheKey(text string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(r.embedder.Model + "\x00" + text))
+}
+
+// embedCard computes a card's embedding with the configured embedder,
+// reusing the cached vector when the card text is unchanged.
+func (r *RegistryNode) embedCard(ctx context.Context, card common.ServiceCard) ([]float32, error) {
+	text := r.embeddingInput(cardEmbeddingText(card))
+	if r.embedCache == nil {
+		return r.embedder.EmbedText(ctx, text)
+	}
+
+	key := r.embedCacheKey(text)
+	if vec, ok := r.embedCache.get(key); ok {
+		embeddingCacheHits.Inc()
+		return vec, nil
+	}
+	embeddingCacheMisses.Inc()
+
+	vec, err := r.embedder.EmbedText(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	r.embedCache.put(key, vec)
+	return vec, nil
+}
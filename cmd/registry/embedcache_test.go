@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"prxs/common"
+)
+
+// fakeEmbedder is an httptest stand-in for the embeddings API. It records
+// the inputs it is sent and answers each with a vector of dim values.
+type fakeEmbedder struct {
+	*httptest.Server
+	mu     sync.Mutex
+	inputs []string
+}
+
+func newFakeEmbedder(t *testing.T, dim int) *fakeEmbedder {
+	t.Helper()
+	f := &fakeEmbedder{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body embeddingRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.inputs = append(f.inputs, body.Input)
+		f.mu.Unlock()
+		vec := make([]float64, dim)
+		for i := range vec {
+			vec[i] = float64(len(body.Input)+i) / 100
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{{"embedding": vec}},
+		})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// calls returns the inputs embedded so far.
+func (f *fakeEmbedder) calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.inputs...)
+}
+
+// withEmbedding gives r a fake Qdrant and a fake embedder of dimension 3.
+func withEmbedding(t *testing.T, r *RegistryNode) (*fakeQdrant, *fakeEmbedder) {
+	t.Helper()
+	q, e := newFakeQdrant(t), newFakeEmbedder(t, 3)
+	r.qdrant = q.client()
+	r.embedder = NewEmbeddingClient("", "test-model", e.URL, 3)
+	r.embeddingDim = 3
+	return q, e
+}
+
+func TestEmbeddingCacheReregister(t *testing.T) {
+	r := newTestRegistry(t)
+	r.embedCache = newEmbeddingCache(16)
+	_, embedder := withEmbedding(t, r)
+	p := newTestPeer(t)
+
+	card := common.ServiceCard{Name: "svc", Description: "Translates text"}
+	registerAs(t, r, p, card)
+	registerAs(t, r, p, card)
+	if n := len(embedder.calls()); n != 1 {
+		t.Fatalf("embedder called %d times for an unchanged card, want 1", n)
+	}
+
+	// Changed text misses the cache
+	card.Description = "Translates speech"
+	registerAs(t, r, p, card)
+	if n := len(embedder.calls()); n != 2 {
+		t.Fatalf("embedder called %d times after the text changed, want 2", n)
+	}
+}
+
+func TestEmbeddingCacheEvictsOldest(t *testing.T) {
+	ec := newEmbeddingCache(2)
+	keys := [][32]byte{{1}, {2}, {3}}
+	ec.put(keys[0], []float32{1})
+	ec.put(keys[1], []float32{2})
+	ec.get(keys[0]) // keys[1] is now the least recently used
+	ec.put(keys[2], []float32{3})
+
+	if _, ok := ec.get(keys[1]); ok {
+		t.Fatal("least recently used entry kept")
+	}
+	for _, k := range []int{0, 2} {
+		if _, ok := ec.get(keys[k]); !ok {
+			t.Fatalf("entry %d evicted", k)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// evictForCapacity makes room under -max-registrations for incoming new
+// providers by dropping the least recently seen ones, never keep. Returns
+// the evicted registrations, to be passed to finishDrops once r.mu is
+// released. Callers must hold r.mu.
+func (r *RegistryNode) evictForCapacity(incoming int, keep peer.ID) []droppedRecord {
+	if r.maxRegistrations <= 0 {
+		return nil
+	}
+	var evicted []droppedRecord
+	for len(r.Registrations)+incoming > r.maxRegistrations {
+		var stalest peer.ID
+		var oldest time.Time
+		for pid, rec := range r.Registrations {
+			if pid == keep {
+				continue
+			}
+			if stalest == "" || rec.LastSeen.Before(oldest) {
+				stalest, oldest = pid, rec.LastSeen
+			}
+		}
+		if stalest == "" {
+			break
+		}
+		evicted = append(evicted, r.evictRegistration(stalest))
+	}
+	return evicted
+}
+
+// evictRegistration drops a provider to make room under -max-registrations.
+// Callers must hold r.mu.
+func (r *RegistryNode) evictRegistration(pid peer.ID) droppedRecord {
+	d := r.dropRegistration(pid, archiveReasonEvicted)
+
+	registrationsEvicted.Inc()
+	log.Printf("[Reg] Evicted provider %s (last seen %s): -max-registrations %d reached\n",
+		pid.ShortString(), d.rec.LastSeen.Format(time.RFC3339), r.maxRegistrations)
+	return d
+}
+
+// droppedRecord is a registration removed from memory whose archive copy and
+// store deletes are still to be written by finishDrops.
+type droppedRecord struct {
+	pid    peer.ID
+	rec    *RegistrationRecord
+	reason string
+}
+
+// dropRegistration removes a live provider from memory and the indexes and
+// returns it; finishDrops then archives it under reason (when -archive-stale
+// is set) and deletes it from storage and Qdrant. Callers must hold r.mu
+// and pid must be registered.
+func (r *RegistryNode) dropRegistration(pid peer.ID, reason string) droppedRecord {
+	rec := r.Registrations[pid]
+	delete(r.Registrations, pid)
+	r.unindexRecord(pid, rec)
+	r.recordHistory(pid, rec, nil, reason)
+	return droppedRecord{pid: pid, rec: rec, reason: reason}
+}
+
+// finishDrops writes the archive copies and store deletes of dropped
+// registrations. Call it after releasing r.mu: the records are no longer
+// reachable from the registry, so nothing else touches them.
+func (r *RegistryNode) finishDrops(drops []droppedRecord) {
+	for _, d := range drops {
+		r.archiveRegistration(d.pid, d.rec, d.reason)
+		r.purgeStores(d.pid, d.rec)
+	}
+}
+
+// purgeStores deletes rec from the registration store and its cards from
+// Qdrant. Failed deletes are queued for retry like any other write; the
+// first failure is returned. The deletes go over the network, so callers
+// shouldn't hold r.mu; rec must already be out of the registry.
+func (r *RegistryNode) purgeStores(pid peer.ID, rec *RegistrationRecord) error {
+	err := r.deleteRegistration(pid, rec.ServiceCard.Name)
+	if r.qdrant != nil {
+		for _, card := range rec.cards() {
+			pointID := fmt.Sprintf("%s:%s", pid.String(), card.Name)
+			qerr := r.retries.do("qdrant:"+pointID, "Qdrant remove of "+pointID, func() error {
+				return r.qdrant.RemoveService(pointID)
+			})
+			if err == nil {
+				err = qerr
+			}
+		}
+	}
+	return err
+}
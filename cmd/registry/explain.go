@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+
+	"prxs/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ?explain=true adds, per result, the factors that placed it where it is,
+// for tuning -rank-weight-* and -search-freshness-weight.
+
+// termMatch is where a query term was found in a card. Position is the byte
+// offset within the field after -fold-text folding, if enabled.
+type termMatch struct {
+	Term     string `json:"term"`
+	Field    string `json:"field"` // "name", "description" or "tags"
+	Position int    `json:"position"`
+}
+
+// matchTerms finds the first occurrence of each term in the card's name,
+// description and tags (in that order of preference).
+func (r *RegistryNode) matchTerms(card common.ServiceCard, terms []string) []termMatch {
+	fields := []struct{ name, text string }{
+		{"name", r.matchText(card.Name)},
+		{"description", r.matchText(card.Description)},
+		{"tags", r.matchText(strings.Join(card.Tags, " "))},
+	}
+	matches := []termMatch{}
+	for _, term := range terms {
+		for _, f := range fields {
+			if i := strings.Index(f.text, term); i >= 0 {
+				matches = append(matches, termMatch{Term: term, Field: f.name, Position: i})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// searchExplain breaks down a semantic (or keyword fallback) search score:
+//
+//	score = (1 - freshness_weight) * relevance + freshness_weight * freshness
+//
+// Relevance is the vector similarity, or in keyword mode the fraction of
+// query terms matched. Stake is reported but does not affect the score.
+type searchExplain struct {
+	VectorScore     *float64    `json:"vector_score,omitempty"` // Raw Qdrant score, semantic mode only
+	Matches         []termMatch `json:"matches"`
+	Relevance       float64     `json:"relevance"`
+	Freshness       float64     `json:"freshness"`
+	FreshnessWeight float64     `json:"freshness_weight"`
+	Stake           float64     `json:"stake"`
+	Score           float64     `json:"score"`
+}
+
+// explainSearch builds the explanation of a search hit. Callers must hold r.mu.
+func (r *RegistryNode) explainSearch(rec *RegistrationRecord, card common.ServiceCard, query string, relevance, fresh float64) *searchExplain {
+	return &searchExplain{
+		Matches:         r.matchTerms(card, strings.Fields(r.matchText(query))),
+		Relevance:       relevance,
+		Freshness:       fresh,
+		FreshnessWeight: r.freshnessWeight,
+		Stake:           rec.Stake,
+		Score:           r.searchScore(relevance, fresh),
+	}
+}
+
+// providerExplain is one provider's place in a ranked /services/search
+// listing. Signals are the normalized inputs the rank mode combined into
+// Score: cost, stake, latency and reputation for rank=score, freshness and
+// stake for rank=default, none when providers keep index order.
+type providerExplain struct {
+	PeerID     string             `json:"peer_id"`
+	Position   int                `json:"position"` // 1-based
+	Score      float64            `json:"score"`
+	Signals    map[string]float64 `json:"signals,omitempty"`
+	Stake      float64            `json:"stake"`
+	AgeSeconds float64            `json:"age_seconds"`
+}
+
+// explainRanking describes records, already ordered by rankRecords(mode).
+// Callers must hold r.mu.
+func (r *RegistryNode) explainRanking(mode string, records []*RegistrationRecord) []providerExplain {
+	out := make([]providerExplain, len(records))
+	for i, rec := range records {
+		out[i] = providerExplain{
+			PeerID:     rec.AddrInfo.ID.String(),
+			Position:   i + 1,
+			Stake:      rec.Stake,
+			AgeSeconds: r.now().Sub(rec.LastSeen).Seconds(),
+		}
+	}
+
+	switch mode {
+	case rankModeScore:
+		for i, s := range r.rankWeights.signals(records) {
+			out[i].Score = r.rankWeights.combine(s)
+			out[i].Signals = map[string]float64{
+				"cost":       s.Cost,
+				"stake":      s.Stake,
+				"latency":    s.Latency,
+				"reputation": s.Reputation,
+			}
+		}
+	case rankModeDefault:
+		maxStake := 0.0
+		for _, rec := range records {
+			maxStake = max(maxStake, rec.Stake)
+		}
+		for i, rec := range records {
+			fresh, stake := r.defaultSignals(rec, maxStake)
+			out[i].Score = r.defaultScore(rec, maxStake)
+			out[i].Signals = map[string]float64{"freshness": fresh, "stake": stake}
+		}
+	}
+	return out
+}
+
+// rankWeightsView is the weights a rank mode combines Signals with.
+func (r *RegistryNode) rankWeightsView(mode string) gin.H {
+	switch mode {
+	case rankModeScore:
+		w := r.rankWeights
+		return gin.H{"cost": w.Cost, "stake": w.Stake, "latency": w.Latency, "reputation": w.Reputation}
+	case rankModeDefault:
+		return gin.H{"freshness": 0.5, "stake": 0.5}
+	}
+	return nil
+}
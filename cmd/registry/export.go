@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"prxs/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// exportChunkSize is how many providers are read per lock acquisition
+// while streaming an export.
+const exportChunkSize = 100
+
+// exportLine is one NDJSON line of the service export: a provider of one
+// service. A gateway appears once per service it registers.
+type exportLine struct {
+	Service  string             `json:"service"`
+	PeerID   string             `json:"peer_id"`
+	AddrInfo peer.AddrInfo      `json:"addr_info"`
+	Card     common.ServiceCard `json:"card"`
+	LastSeen time.Time          `json:"last_seen"`
+	Featured bool               `json:"featured"`
+}
+
+// exportServices streams every provider visible to the caller as NDJSON.
+// The peer list is snapshotted up front and records are read in chunks, so
+// the registry lock is only held briefly and the response is never buffered
+// whole.
+// GET /api/v1/services/export.ndjson
+func (r *RegistryNode) exportServices(c *gin.Context) {
+	access := restAccess(c)
+
+	r.mu.Lock()
+	pids := make([]peer.ID, 0, len(r.Registrations))
+	for pid := range r.Registrations {
+		pids = append(pids, pid)
+	}
+	r.mu.Unlock()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+
+	for start := 0; start < len(pids); start += exportChunkSize {
+		end := min(start+exportChunkSize, len(pids))
+
+		lines := make([]exportLine, 0, end-start)
+		r.mu.Lock()
+		for _, pid := range pids[start:end] {
+			rec, ok := r.Registrations[pid]
+			if !ok {
+				continue // Pruned since the snapshot
+			}
+			for _, card := range rec.cards() {
+				if !access.canSee(card) {
+					continue
+				}
+				card.Embedding = nil
+				lines = append(lines, exportLine{
+					Service:  card.Name,
+					PeerID:   pid.String(),
+					AddrInfo: rec.AddrInfo,
+					Card:     card,
+					LastSeen: rec.LastSeen,
+					Featured: r.featured[card.Name],
+				})
+			}
+		}
+		r.mu.Unlock()
+
+		for i := range lines {
+			if err := enc.Encode(&lines[i]); err != nil {
+				log.Printf("[Reg] Export aborted: %v\n", err)
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// federationTimeout bounds each forwarded query so a slow peer registry
+	// can't stall the caller's find.
+	federationTimeout = 5 * time.Second
+	// seenQueryTTL is how long a federated query ID is remembered; it only
+	// needs to outlive the fan-out of one query.
+	seenQueryTTL = time.Minute
+)
+
+// federation forwards "find" queries to peer registries and merges what
+// they return.
+type federation struct {
+	host    host.Host
+	peers   []peer.AddrInfo
+	maxHops int // Default and upper bound for a query's TTL
+
+	seenMu sync.Mutex
+	seen   map[string]time.Time // Query ID -> first seen
+}
+
+func newFederation(h host.Host, peers []peer.AddrInfo, maxHops int) *federation {
+	return &federation{host: h, peers: peers, maxHops: maxHops, seen: make(map[string]time.Time)}
+}
+
+// federatedProvider is a provider returned by a peer registry, tagged with
+// the registry it is registered at.
+type federatedProvider struct {
+	Origin   string        `json:"origin"`
+	Provider peer.AddrInfo `json:"provider"`
+}
+
+// parseFederationPeers parses a comma-separated list of registry
+// multiaddrs; each must include its /p2p/ peer ID.
+func parseFederationPeers(list string) ([]peer.AddrInfo, error) {
+	var peers []peer.AddrInfo
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		info, err := peer.AddrInfoFromString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid federated registry %q: %v", s, err)
+		}
+		peers = append(peers, *info)
+	}
+	return peers, nil
+}
+
+// seenBefore records id and reports whether it was already recorded, i.e.
+// the query has looped back to this registry.
+func (f *federation) seenBefore(id string) bool {
+	if f == nil || id == "" {
+		return false
+	}
+	f.seenMu.Lock()
+	defer f.seenMu.Unlock()
+
+	now := time.Now()
+	for k, t := range f.seen {
+		if now.Sub(t) > seenQueryTTL {
+			delete(f.seen, k)
+		}
+	}
+	if _, ok := f.seen[id]; ok {
+		return true
+	}
+	f.seen[id] = now
+	return false
+}
+
+// forward returns the request to send to peer registries for req, with a
+// query ID assigned and the TTL decremented, or false when req must not be
+// forwarded.
+func (f *federation) forward(req common.RegistryRequest) (common.RegistryRequest, bool) {
+	if f == nil || len(f.peers) == 0 || !req.Federate {
+		return req, false
+	}
+
+	ttl := f.maxHops
+	if req.QueryID != "" || req.TTL > 0 {
+		ttl = min(req.TTL, f.maxHops)
+	}
+	if ttl <= 0 {
+		return req, false
+	}
+
+	if req.QueryID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return req, false
+		}
+		req.QueryID = hex.EncodeToString(id)
+		f.seenBefore(req.QueryID)
+	}
+	req.TTL = ttl - 1
+	req.PageToken = ""
+	return req, true
+}
+
+// query forwards req (already carrying the incremented hop count) to every
+// peer registry except skip, the peer that sent it, and returns the
+// providers they found. Unreachable peers are logged and skipped.
+func (f *federation) query(ctx context.Context, req common.RegistryRequest, skip peer.ID) []federatedProvider {
+	var (
+		mu  sync.Mutex
+		out []federatedProvider
+		wg  sync.WaitGroup
+	)
+	for _, info := range f.peers {
+		if info.ID == skip || info.ID == f.host.ID() {
+			continue
+		}
+		wg.Add(1)
+		go func(info peer.AddrInfo) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, federationTimeout)
+			defer cancel()
+
+			if err := f.host.Connect(ctx, info); err != nil {
+				log.Printf("[Reg] Federation: cannot reach %s: %v\n", info.ID.ShortString(), err)
+				return
+			}
+			resp, err := common.CallRegistry(ctx, f.host, info.ID, req)
+			if err != nil {
+				log.Printf("[Reg] Federation: query to %s failed: %v\n", info.ID.ShortString(), err)
+				return
+			}
+			if !resp.Success {
+				log.Printf("[Reg] Federation: %s rejected query: %s\n", info.ID.ShortString(), resp.Error)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, p := range resp.Providers {
+				origin := resp.Origins[p.ID.String()]
+				if origin == "" {
+					origin = info.ID.String()
+				}
+				out = append(out, federatedProvider{Origin: origin, Provider: p})
+			}
+		}(info)
+	}
+	wg.Wait()
+	return out
+}
+
+// mergeFederated appends the remote providers not already listed locally,
+// cuts the result to limit (0 = no limit) and tags every provider with its
+// origin registry. total is the number of distinct providers before the cut.
+func mergeFederated(self peer.ID, local []peer.AddrInfo, remote []federatedProvider, limit int) (merged []peer.AddrInfo, origins map[string]string, total int) {
+	origins = make(map[string]string, len(local)+len(remote))
+	merged = make([]peer.AddrInfo, 0, len(local)+len(remote))
+	for _, p := range local {
+		origins[p.ID.String()] = self.String()
+		merged = append(merged, p)
+	}
+	for _, fp := range remote {
+		id := fp.Provider.ID.String()
+		if _, dup := origins[id]; dup {
+			continue
+		}
+		origins[id] = fp.Origin
+		merged = append(merged, fp.Provider)
+	}
+
+	total = len(merged)
+	if limit > 0 && total > limit {
+		for _, p := range merged[limit:] {
+			delete(origins, p.ID.String())
+		}
+		merged = merged[:limit]
+	}
+	return merged, origins, total
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// federate makes r forward federated queries to peers.
+func federate(r *RegistryNode, maxHops int, peers ...*RegistryNode) {
+	infos := make([]peer.AddrInfo, 0, len(peers))
+	for _, p := range peers {
+		infos = append(infos, peer.AddrInfo{ID: p.Host.ID(), Addrs: p.Host.Addrs()})
+	}
+	r.federation = newFederation(r.Host, infos, maxHops)
+}
+
+// findFederated runs a federated find on r and returns the providers by
+// origin registry.
+func findFederated(t *testing.T, r *RegistryNode, query string) map[peer.ID][]peer.ID {
+	t.Helper()
+	client := newTestPeer(t)
+	resp := client.call(t, r, common.RegistryRequest{Method: "find", Query: query, Federate: true})
+	if !resp.Success {
+		t.Fatalf("federated find: %s", resp.Error)
+	}
+	byOrigin := make(map[peer.ID][]peer.ID)
+	for _, p := range resp.Providers {
+		origin, err := peer.Decode(resp.Origins[p.ID.String()])
+		if err != nil {
+			t.Fatalf("provider %s has no origin: %v", p.ID, err)
+		}
+		byOrigin[origin] = append(byOrigin[origin], p.ID)
+	}
+	return byOrigin
+}
+
+func TestFederatedFind(t *testing.T) {
+	a, b := newTestRegistry(t), newTestRegistry(t)
+	federate(a, 2, b)
+
+	local := newTestPeer(t)
+	local.register(t, a, common.ServiceCard{Name: "echo"})
+	remote := newTestPeer(t)
+	remote.register(t, b, common.ServiceCard{Name: "echo"})
+	only := newTestPeer(t)
+	only.register(t, b, common.ServiceCard{Name: "translate"})
+
+	got := findFederated(t, a, "echo")
+	if len(got[a.Host.ID()]) != 1 || got[a.Host.ID()][0] != local.ID() {
+		t.Fatalf("local providers %v, want %s", got[a.Host.ID()], local.ID())
+	}
+	if len(got[b.Host.ID()]) != 1 || got[b.Host.ID()][0] != remote.ID() {
+		t.Fatalf("providers from B %v, want %s", got[b.Host.ID()], remote.ID())
+	}
+
+	// A service only B has
+	got = findFederated(t, a, "translate")
+	if len(got) != 1 || len(got[b.Host.ID()]) != 1 || got[b.Host.ID()][0] != only.ID() {
+		t.Fatalf("translate: %v, want %s from B", got, only.ID())
+	}
+
+	// Without federate=true the query stays local
+	client := newTestPeer(t)
+	if resp := client.call(t, a, common.RegistryRequest{Method: "find", Query: "translate"}); len(resp.Providers) != 0 {
+		t.Fatalf("unfederated find reached B: %+v", resp.Providers)
+	}
+}
+
+func TestFederationCycle(t *testing.T) {
+	a, b, c := newTestRegistry(t), newTestRegistry(t), newTestRegistry(t)
+	// A -> B -> C -> A, with hops to spare so only the seen set stops it
+	federate(a, 10, b)
+	federate(b, 10, c)
+	federate(c, 10, a)
+	providers := map[peer.ID]peer.ID{}
+	for _, r := range []*RegistryNode{a, b, c} {
+		p := newTestPeer(t)
+		p.register(t, r, common.ServiceCard{Name: "svc"})
+		providers[r.Host.ID()] = p.ID()
+	}
+
+	got := findFederated(t, a, "svc")
+	total := 0
+	for origin, ids := range got {
+		total += len(ids)
+		if len(ids) != 1 || ids[0] != providers[origin] {
+			t.Fatalf("providers from %s: %v, want %s", origin, ids, providers[origin])
+		}
+	}
+	if total != 3 {
+		t.Fatalf("%d providers, want one from each registry: %v", total, got)
+	}
+}
+
+func TestFederationTTL(t *testing.T) {
+	a, b, c := newTestRegistry(t), newTestRegistry(t), newTestRegistry(t)
+	// One hop: A asks B, and B must not pass the query on to C
+	federate(a, 1, b)
+	federate(b, 10, c)
+	for _, r := range []*RegistryNode{a, b, c} {
+		newTestPeer(t).register(t, r, common.ServiceCard{Name: "svc"})
+	}
+
+	got := findFederated(t, a, "svc")
+	if len(got[c.Host.ID()]) != 0 || len(got[a.Host.ID()]) != 1 || len(got[b.Host.ID()]) != 1 {
+		t.Fatalf("providers by origin %v; want A's and B's only", got)
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"prxs/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// providerFilter holds the hard filters a REST query may apply to providers.
+// Zero values disable each filter.
+type providerFilter struct {
+	Region   string
+	MinStake float64
+	// MaxAge excludes providers whose last heartbeat is older than this.
+	MaxAge time.Duration
+	// Meta requires each key to be present in the card's Metadata with
+	// exactly the given value (from ?meta.<key>=<value>).
+	Meta map[string]string
+	// Access is the caller's credentials for private services.
+	Access accessCreds
+	// Arity bounds how many inputs the service takes.
+	Arity arityFilter
+	// Exclude lists providers left out of the results.
+	Exclude []peer.ID
+	// Tags requires the card to carry every tag, case-insensitively
+	// (from ?tag=, repeated for several). Stored lowercased.
+	Tags []string
+	// MaxCost excludes providers whose card's CostPerOp exceeds it; nil =
+	// no cap (0 admits only free providers).
+	MaxCost *float64
+
+	now time.Time // r.now() when the filter was built, for MaxAge
+}
+
+// arityFilter bounds len(ServiceCard.Inputs), from ?num_inputs=,
+// ?min_inputs= and ?max_inputs=.
+type arityFilter struct {
+	Min int
+	Max *int // nil = no upper bound
+}
+
+// parseArityFilter reads the input-count filters. num_inputs=N is
+// shorthand for min_inputs=N&max_inputs=N and can't be combined with them.
+func parseArityFilter(c *gin.Context) (arityFilter, error) {
+	var f arityFilter
+	count := func(name string) (int, bool, error) {
+		v := c.Query(name)
+		if v == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, false, fmt.Errorf("invalid %s %q", name, v)
+		}
+		return n, true, nil
+	}
+
+	num, hasNum, err := count("num_inputs")
+	if err != nil {
+		return f, err
+	}
+	min, hasMin, err := count("min_inputs")
+	if err != nil {
+		return f, err
+	}
+	max, hasMax, err := count("max_inputs")
+	if err != nil {
+		return f, err
+	}
+	if hasNum {
+		if hasMin || hasMax {
+			return f, fmt.Errorf("num_inputs cannot be combined with min_inputs or max_inputs")
+		}
+		min, max, hasMax = num, num, true
+	}
+	f.Min = min
+	if hasMax {
+		f.Max = &max
+	}
+	return f, nil
+}
+
+// matches reports whether card takes an allowed number of inputs.
+func (f arityFilter) matches(card common.ServiceCard) bool {
+	n := len(card.Inputs)
+	return n >= f.Min && (f.Max == nil || n <= *f.Max)
+}
+
+// Bounds on ServiceCard.Metadata, enforced at registration.
+const (
+	maxMetadataEntries  = 32
+	maxMetadataKeyLen   = 64
+	maxMetadataValueLen = 1024
+)
+
+// checkMetadata rejects cards whose metadata exceeds the registry's bounds.
+func checkMetadata(meta map[string]string) error {
+	if len(meta) > maxMetadataEntries {
+		return fmt.Errorf("too many metadata entries (%d > %d)", len(meta), maxMetadataEntries)
+	}
+	for k, v := range meta {
+		if k == "" || len(k) > maxMetadataKeyLen {
+			return fmt.Errorf("metadata key %q must be 1-%d bytes", k, maxMetadataKeyLen)
+		}
+		if len(v) > maxMetadataValueLen {
+			return fmt.Errorf("metadata value for %q exceeds %d bytes", k, maxMetadataValueLen)
+		}
+	}
+	return nil
+}
+
+// checkRateLimit rejects a card advertising a negative or non-finite rate.
+func checkRateLimit(card common.ServiceCard) error {
+	if card.RateLimit < 0 || math.IsNaN(card.RateLimit) || math.IsInf(card.RateLimit, 0) {
+		return fmt.Errorf("invalid rate_limit %v", card.RateLimit)
+	}
+	return nil
+}
+
+// checkQueryLength rejects search queries longer than -max-query-length
+// characters, before they are lowercased, scanned against every service or
+// sent to the embedder.
+func (r *RegistryNode) checkQueryLength(q string) error {
+	if r.maxQueryLen > 0 && utf8.RuneCountInString(q) > r.maxQueryLen {
+		return fmt.Errorf("query exceeds %d characters", r.maxQueryLen)
+	}
+	return nil
+}
+
+// parseProviderFilter reads the provider filters from the query string.
+func (r *RegistryNode) parseProviderFilter(c *gin.Context) (providerFilter, error) {
+	f := providerFilter{Region: c.Query("region"), Access: restAccess(c), now: r.now()}
+
+	if v := c.Query("min_stake"); v != "" {
+		min, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(min) || math.IsInf(min, 0) || min < 0 {
+			return f, fmt.Errorf("invalid min_stake %q", v)
+		}
+		f.MinStake = min
+	}
+
+	if v := c.Query("max_age"); v != "" {
+		age, err := time.ParseDuration(v)
+		if err != nil || age <= 0 {
+			return f, fmt.Errorf("invalid max_age %q", v)
+		}
+		f.MaxAge = age
+	}
+
+	arity, err := parseArityFilter(c)
+	if err != nil {
+		return f, err
+	}
+	f.Arity = arity
+
+	maxCost, err := parseMaxCost(c)
+	if err != nil {
+		return f, err
+	}
+	f.MaxCost = maxCost
+
+	exclude, err := parseExclude(c)
+	if err != nil {
+		return f, err
+	}
+	f.Exclude = exclude
+
+	for _, tag := range c.QueryArray("tag") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !slices.Contains(f.Tags, tag) {
+			f.Tags = append(f.Tags, tag)
+		}
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		name, ok := strings.CutPrefix(key, "meta.")
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if name == "" {
+			return f, fmt.Errorf("invalid metadata filter %q", key)
+		}
+		if f.Meta == nil {
+			f.Meta = make(map[string]string)
+		}
+		f.Meta[name] = values[0]
+	}
+
+	return f, nil
+}
+
+// parseMaxCost reads ?max_cost=, nil when absent.
+func parseMaxCost(c *gin.Context) (*float64, error) {
+	v := c.Query("max_cost")
+	if v == "" {
+		return nil, nil
+	}
+	cost, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(cost) || math.IsInf(cost, 0) || cost < 0 {
+		return nil, fmt.Errorf("invalid max_cost %q: must be a non-negative number", v)
+	}
+	return &cost, nil
+}
+
+// withinCost reports whether the card's cost per op is at most maxCost
+// (nil = no cap).
+func withinCost(card common.ServiceCard, maxCost *float64) bool {
+	return maxCost == nil || card.CostPerOp <= *maxCost
+}
+
+// parseExclude reads ?exclude=, a comma-separated list of peer IDs that
+// may also be repeated.
+func parseExclude(c *gin.Context) ([]peer.ID, error) {
+	var ids []peer.ID
+	for _, v := range c.QueryArray("exclude") {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			id, err := peer.Decode(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exclude peer id %q", s)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// match reports whether a provider of the named service passes every
+// filter, including the service's visibility to the caller.
+func (f providerFilter) match(rec *RegistrationRecord, service string) bool {
+	if slices.Contains(f.Exclude, rec.AddrInfo.ID) {
+		return false
+	}
+	card, ok := rec.card(service)
+	if !ok || !f.Access.canSee(card) || !f.Arity.matches(card) || !hasTags(card, f.Tags) || !withinCost(card, f.MaxCost) {
+		return false
+	}
+	if !matchesRegion(card, f.Region) {
+		return false
+	}
+	if f.MinStake > 0 && rec.Stake < f.MinStake {
+		return false
+	}
+	if f.MaxAge > 0 {
+		if f.now.Sub(rec.LastSeen) > f.MaxAge {
+			return false
+		}
+	}
+	for k, want := range f.Meta {
+		if got, ok := card.Metadata[k]; !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTags reports whether the card carries every one of the lowercased
+// tags, ignoring case.
+func hasTags(card common.ServiceCard, tags []string) bool {
+	for _, want := range tags {
+		if !slices.ContainsFunc(card.Tags, func(tag string) bool { return strings.EqualFold(tag, want) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultPageLimit is the page size of the service listings without ?limit=.
+const defaultPageLimit = 50
+
+// listPage is a ?limit=&offset= window over a listing sorted by name.
+type listPage struct {
+	Limit  int
+	Offset int
+}
+
+// parsePage reads ?limit= (default defaultPageLimit, at most
+// -max-page-size) and ?offset=.
+func (r *RegistryNode) parsePage(c *gin.Context) (listPage, error) {
+	p := listPage{Limit: min(defaultPageLimit, r.maxPageSize)}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return p, fmt.Errorf("invalid limit %q", v)
+		}
+		if n > r.maxPageSize {
+			return p, fmt.Errorf("limit %d exceeds the maximum of %d", n, r.maxPageSize)
+		}
+		p.Limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid offset %q", v)
+		}
+		p.Offset = n
+	}
+	return p, nil
+}
+
+// slice sorts names and returns the page's share of them, and the offset
+// of the next page (nil on the last one).
+func (p listPage) slice(names []string) ([]string, interface{}) {
+	slices.Sort(names)
+	start := min(p.Offset, len(names))
+	end := min(start+p.Limit, len(names))
+	if end < len(names) {
+		return names[start:end], end
+	}
+	return names[start:end], nil
+}
+
+// providerSort orders the flattened provider list of a listing, from
+// ?sort=: every provider under each listed service it offers, across
+// services. Ties fall back to service name, then peer ID, so the order is
+// the same on every call.
+type providerSort string
+
+const (
+	sortName     providerSort = "name"      // Default; by service name, then peer ID
+	sortCostAsc  providerSort = "cost_asc"  // Card's CostPerOp, cheapest first
+	sortCostDesc providerSort = "cost_desc" // Card's CostPerOp, dearest first
+	sortLastSeen providerSort = "last_seen" // Latest heartbeat first
+)
+
+// parseSort reads ?sort=, defaulting to sortName.
+func parseSort(c *gin.Context) (providerSort, error) {
+	switch s := providerSort(c.Query("sort")); s {
+	case "":
+		return sortName, nil
+	case sortName, sortCostAsc, sortCostDesc, sortLastSeen:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid sort %q (want name, cost_asc, cost_desc or last_seen)", s)
+	}
+}
+
+// serviceProvider is one entry of a flattened listing: a provider under
+// one of the services it offers.
+type serviceProvider struct {
+	service string
+	rec     *RegistrationRecord
+}
+
+// flatten lists every provider of each of the named services.
+func flatten(names []string, records map[string][]*RegistrationRecord) []serviceProvider {
+	var flat []serviceProvider
+	for _, name := range names {
+		for _, rec := range records[name] {
+			flat = append(flat, serviceProvider{service: name, rec: rec})
+		}
+	}
+	return flat
+}
+
+// apply sorts a flattened provider list. The cost orders compare each
+// entry's card for its own service.
+func (s providerSort) apply(flat []serviceProvider) {
+	cost := func(e serviceProvider) float64 {
+		card, _ := e.rec.card(e.service)
+		return card.CostPerOp
+	}
+	sort.SliceStable(flat, func(i, j int) bool {
+		a, b := flat[i], flat[j]
+		switch s {
+		case sortCostAsc:
+			if ca, cb := cost(a), cost(b); ca != cb {
+				return ca < cb
+			}
+		case sortCostDesc:
+			if ca, cb := cost(a), cost(b); ca != cb {
+				return ca > cb
+			}
+		case sortLastSeen:
+			if !a.rec.LastSeen.Equal(b.rec.LastSeen) {
+				return a.rec.LastSeen.After(b.rec.LastSeen)
+			}
+		}
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		return a.rec.AddrInfo.ID < b.rec.AddrInfo.ID
+	})
+}
+
+// flatProvider is an entry of the "providers" list of the service
+// listings, in ?sort= order.
+type flatProvider struct {
+	Service string `json:"service"`
+	listedProvider
+}
+
+// flatProviders renders a sorted flat list for a listing's "providers".
+func (r *RegistryNode) flatProviders(flat []serviceProvider) []flatProvider {
+	out := make([]flatProvider, 0, len(flat))
+	for _, e := range flat {
+		out = append(out, flatProvider{Service: e.service, listedProvider: r.listedProvider(e.rec)})
+	}
+	return out
+}
+
+// rankFlat orders a flattened provider list best-first with rankRecords, as
+// find orders its providers. A gateway listed under several services keeps
+// its entries together. Callers must hold r.mu.
+func (r *RegistryNode) rankFlat(mode string, flat []serviceProvider) {
+	pos := make(map[*RegistrationRecord]int, len(flat))
+	records := make([]*RegistrationRecord, 0, len(flat))
+	for _, e := range flat {
+		if _, ok := pos[e.rec]; !ok {
+			pos[e.rec] = 0
+			records = append(records, e.rec)
+		}
+	}
+	r.rankRecords(mode, records)
+	for i, rec := range records {
+		pos[rec] = i
+	}
+	sort.SliceStable(flat, func(i, j int) bool {
+		return pos[flat[i].rec] < pos[flat[j].rec]
+	})
+}
+
+// group splits a sorted flat list back into per-service lists, each in the
+// flat list's order.
+func group(flat []serviceProvider) map[string][]*RegistrationRecord {
+	out := make(map[string][]*RegistrationRecord)
+	for _, e := range flat {
+		out[e.service] = append(out[e.service], e.rec)
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestSortFlattenedProviders(t *testing.T) {
+	r := newTestRegistry(t)
+	addProvider(r, peer.ID("p1"), common.ServiceCard{Name: "alpha", CostPerOp: 5})
+	addProvider(r, peer.ID("p2"), common.ServiceCard{Name: "alpha", CostPerOp: 1})
+	addProvider(r, peer.ID("p3"), common.ServiceCard{Name: "beta", CostPerOp: 3})
+	router := r.setupRESTAPI()
+	names := map[string]string{}
+	for _, id := range []string{"p1", "p2", "p3"} {
+		names[peer.ID(id).String()] = id
+	}
+
+	tests := []struct {
+		sort string
+		want []string // service/peer, in order
+	}{
+		{"", []string{"alpha/p1", "alpha/p2", "beta/p3"}},
+		{"cost_asc", []string{"alpha/p2", "beta/p3", "alpha/p1"}},
+		{"cost_desc", []string{"alpha/p1", "beta/p3", "alpha/p2"}},
+	}
+	for _, path := range []string{"/api/v1/services", "/api/v1/services_full", "/api/v1/services/search?q=a"} {
+		for _, tt := range tests {
+			url := path + "?sort=" + tt.sort
+			if strings.Contains(path, "?") {
+				url = path + "&sort=" + tt.sort
+			}
+			if got := flatOrder(t, router, url, names); !slices.Equal(got, tt.want) {
+				t.Fatalf("%s: providers %v, want %v", url, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSearchRankFlattenedProviders(t *testing.T) {
+	r := newTestRegistry(t)
+	addProvider(r, peer.ID("p1"), common.ServiceCard{Name: "alpha"}).Stake = 1
+	addProvider(r, peer.ID("p2"), common.ServiceCard{Name: "alpha"}).Stake = 10
+	addProvider(r, peer.ID("p3"), common.ServiceCard{Name: "beta"}).Stake = 5
+	names := map[string]string{}
+	for _, id := range []string{"p1", "p2", "p3"} {
+		names[peer.ID(id).String()] = id
+	}
+
+	got := flatOrder(t, r.setupRESTAPI(), "/api/v1/services/search?q=a&rank=default", names)
+	if want := []string{"alpha/p2", "beta/p3", "alpha/p1"}; !slices.Equal(got, want) {
+		t.Fatalf("providers %v, want %v", got, want)
+	}
+}
+
+// flatOrder fetches url and returns its flattened providers as
+// service/label, where names maps peer IDs to labels.
+func flatOrder(t *testing.T, router http.Handler, url string, names map[string]string) []string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	var body struct {
+		Providers []struct {
+			Service string
+			ID      string
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s: %v: %s", url, err, w.Body)
+	}
+	var got []string
+	for _, p := range body.Providers {
+		got = append(got, p.Service+"/"+names[p.ID])
+	}
+	return got
+}
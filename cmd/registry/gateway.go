@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"prxs/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	gatewayMaxBody        = 1 << 20           // Largest call body accepted, in bytes
+	gatewayProviderHeader = "X-Prxs-Provider" // Peer ID of the provider that answered
+)
+
+// gatewayCall is the body of POST /services/:name/call.
+type gatewayCall struct {
+	Method    string      `json:"method"` // Default "compute"
+	Params    interface{} `json:"params"`
+	TimeoutMs int64       `json:"timeout_ms,omitempty"`
+
+	// Payment is a ticket the client signed itself. It names one provider,
+	// so the call goes to that provider only, without failover.
+	Payment *common.PaymentTicket `json:"payment,omitempty"`
+}
+
+// gatewayTarget is a provider a gateway call may go to.
+type gatewayTarget struct {
+	info peer.AddrInfo
+	cost float64 // The card's CostPerOp, charged by gateway-signed tickets
+}
+
+// gatewayAttempt records one provider tried by a gateway call.
+type gatewayAttempt struct {
+	PeerID string `json:"peer_id"`
+	Error  string `json:"error"`
+}
+
+// callService relays a JSON-RPC call to a provider of the service, for
+// clients that can't dial libp2p themselves. Providers are tried in ranked
+// order (the /best ranking unless ?rank= is given), up to -gateway-attempts
+// of them: one that can't be reached or answers ServerBusy or RateLimited
+// is skipped for the next. The provider's JSONRPCResponse is returned as
+// is, including application errors, with its peer ID in X-Prxs-Provider.
+//
+// A client-supplied payment ticket is passed through as is. Otherwise, with
+// -gateway-key set, the gateway pays: each relayed call carries a ticket
+// for the card's cost per op, signed with the gateway's key.
+// POST /api/v1/services/:name/call
+func (r *RegistryNode) callService(c *gin.Context) {
+	if !r.gateway {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "gateway not enabled (-gateway)"})
+		return
+	}
+	serviceName := c.Param("name")
+	filter, err := r.parseProviderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var call gatewayCall
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, gatewayMaxBody)
+	if err := c.ShouldBindJSON(&call); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid call: %v", err)})
+		return
+	}
+	if call.Method == "" {
+		call.Method = executionMethod
+	}
+	if call.TimeoutMs < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timeout_ms"})
+		return
+	}
+	var payee peer.ID // Only provider tried when the client pays
+	if call.Payment != nil {
+		if err := call.Payment.Verify(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %v", common.InvalidPayment, err)})
+			return
+		}
+		if payee, err = peer.Decode(call.Payment.ProviderID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: invalid provider_id %q", common.InvalidPayment, call.Payment.ProviderID)})
+			return
+		}
+	}
+
+	r.mu.Lock()
+	records := []*RegistrationRecord{}
+	for _, pid := range r.ServiceIndex[serviceName] {
+		if payee != "" && pid != payee {
+			continue
+		}
+		if reg, ok := r.Registrations[pid]; ok && filter.match(reg, serviceName) {
+			records = append(records, reg)
+		}
+	}
+	if rank := c.Query("rank"); rank != "" {
+		r.rankRecords(rank, records)
+	} else {
+		r.rankWeights.rank(records)
+	}
+	candidates := make([]gatewayTarget, 0, min(len(records), r.gatewayAttempts))
+	for _, reg := range records {
+		if len(candidates) == r.gatewayAttempts {
+			break
+		}
+		card, _ := reg.card(serviceName)
+		candidates = append(candidates, gatewayTarget{info: reg.AddrInfo, cost: card.CostPerOp})
+	}
+	_, known := r.ServiceIndex[serviceName]
+	r.mu.Unlock()
+
+	if len(candidates) == 0 {
+		serviceNotFound(c, serviceName, known)
+		return
+	}
+
+	timeout := r.gatewayTimeout
+	if call.TimeoutMs > 0 {
+		// Leave the provider time to answer DeadlineExceeded itself
+		timeout = min(timeout, time.Duration(call.TimeoutMs)*time.Millisecond+time.Second)
+	}
+	req := common.JSONRPCRequest{Method: call.Method, Params: call.Params, ID: 1, TimeoutMs: call.TimeoutMs, Payment: call.Payment}
+
+	attempts := make([]gatewayAttempt, 0, len(candidates))
+	var retryAfterMs int64
+	for _, target := range candidates {
+		info := target.info
+		if call.Payment == nil && r.gatewayKey != nil {
+			req.Payment = &common.PaymentTicket{ProviderID: info.ID.String(), Amount: target.cost, Nonce: r.gatewayNonce.Add(1)}
+			if err := req.Payment.Sign(r.gatewayKey); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to sign payment ticket: %v", err)})
+				return
+			}
+		}
+		resp, err := r.gatewayAttempt(c.Request.Context(), info, req, timeout)
+		if err == nil && resp.Error != common.ServerBusy && resp.Error != common.RateLimited {
+			c.Header(gatewayProviderHeader, info.ID.String())
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("%s", resp.Error)
+			retryAfterMs = max(retryAfterMs, resp.RetryAfterMs)
+		}
+		log.Printf("[Reg] Gateway call to %s via %s failed: %v\n", serviceName, info.ID.ShortString(), err)
+		attempts = append(attempts, gatewayAttempt{PeerID: info.ID.String(), Error: err.Error()})
+	}
+
+	status := http.StatusBadGateway
+	if retryAfterMs > 0 {
+		// At least one provider is up but asked to back off
+		status = http.StatusServiceUnavailable
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(time.Duration(retryAfterMs)*time.Millisecond)))
+	}
+	c.JSON(status, gin.H{
+		"error":    fmt.Sprintf("no provider of '%s' could serve the call", serviceName),
+		"attempts": attempts,
+	})
+}
+
+// gatewayAttempt dials one provider and relays req to it.
+func (r *RegistryNode) gatewayAttempt(ctx context.Context, info peer.AddrInfo, req common.JSONRPCRequest, timeout time.Duration) (*common.JSONRPCResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := r.Host.Connect(ctx, info); err != nil {
+		return nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	return common.CallProvider(ctx, r.Host, info.ID, req)
+}
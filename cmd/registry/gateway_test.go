@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prxs/common"
+)
+
+func TestGatewayCall(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.gateway = true
+	reg.gatewayAttempts = 3
+	reg.gatewayTimeout = 5 * time.Second
+
+	// One provider doesn't speak the execution protocol, so whichever order
+	// they rank in, the call must end up at the echo provider
+	broken := newTestPeer(t)
+	broken.register(t, reg, common.ServiceCard{Name: "echo"})
+	echo := newTestPeer(t)
+	echo.serveStubProvider()
+	echo.register(t, reg, common.ServiceCard{Name: "echo"})
+
+	srv := httptest.NewServer(reg.setupRESTAPI())
+	defer srv.Close()
+
+	call := func(service string) *http.Response {
+		t.Helper()
+		body, _ := json.Marshal(gatewayCall{Params: []interface{}{"hi"}})
+		resp, err := http.Post(srv.URL+"/api/v1/services/"+service+"/call", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := call("echo")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get(gatewayProviderHeader); got != echo.ID().String() {
+		t.Fatalf("%s = %q, want %s", gatewayProviderHeader, got, echo.ID())
+	}
+	var rpc common.JSONRPCResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpc); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := rpc.Result.(map[string]interface{})
+	if rpc.Error != "" || result["method"] != executionMethod {
+		t.Fatalf("unexpected response %+v", rpc)
+	}
+
+	if resp := call("missing"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("call to an unknown service: status %d", resp.StatusCode)
+	}
+}
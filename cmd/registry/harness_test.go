@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"prxs/common"
+	"prxs/storage"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// The registry RPC harness runs a registry, providers and clients on
+// loopback libp2p hosts in one process, talking the real registry
+// protocol. Providers are stubs (serveStubProvider) rather than cmd/node's
+// ProviderDaemon, which lives in another main package, so execution calls
+// only cover the wire protocol, not the node's handling of them. Unit
+// tests reuse it to get a registry with the startRegistry defaults and
+// peers with real keys and stake proofs.
+
+// testPeer is a loopback host with its identity key, acting as a provider
+// or client.
+type testPeer struct {
+	host.Host
+	key crypto.PrivKey
+}
+
+func newTestPeer(t *testing.T) *testPeer {
+	t.Helper()
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	h, err := common.NewLoopbackHost(key)
+	if err != nil {
+		t.Fatalf("failed to start host: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return &testPeer{Host: h, key: key}
+}
+
+// addrInfo is the peer's own ProviderInfo.
+func (p *testPeer) addrInfo() *peer.AddrInfo {
+	return &peer.AddrInfo{ID: p.ID(), Addrs: p.Addrs()}
+}
+
+// stakeProof returns a proof of amount signed by the peer. Each nonce gives
+// a distinct stake.
+func (p *testPeer) stakeProof(t *testing.T, amount float64, nonce int64) *common.StakeProof {
+	t.Helper()
+	proof := &common.StakeProof{
+		TxHash:    fmt.Sprintf("tx-%s-%d", p.ID().ShortString(), nonce),
+		Staker:    p.ID().String(),
+		Amount:    amount,
+		Nonce:     nonce,
+		Timestamp: time.Now().Unix(),
+		ChainID:   "prxs-test",
+		Algo:      common.StakeAlgoEd25519,
+	}
+	if err := common.SignStakeProof(p.key, proof); err != nil {
+		t.Fatalf("failed to sign stake proof: %v", err)
+	}
+	return proof
+}
+
+// call sends req to the registry over a registry RPC stream.
+func (p *testPeer) call(t *testing.T, r *RegistryNode, req common.RegistryRequest) *common.RegistryResponse {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := common.ConnectHosts(ctx, r.Host, p.Host); err != nil {
+		t.Fatalf("failed to connect to registry: %v", err)
+	}
+	resp, err := common.CallRegistry(ctx, p.Host, r.Host.ID(), req)
+	if err != nil {
+		t.Fatalf("registry call %s failed: %v", req.Method, err)
+	}
+	return resp
+}
+
+// register registers card over the RPC with a fresh stake proof and fails
+// the test unless it succeeds.
+func (p *testPeer) register(t *testing.T, r *RegistryNode, card common.ServiceCard) *common.RegistryResponse {
+	t.Helper()
+	resp := p.call(t, r, common.RegistryRequest{
+		Method:       "register",
+		Card:         card,
+		ProviderInfo: p.addrInfo(),
+		StakeProof:   p.stakeProof(t, 100, time.Now().UnixNano()),
+	})
+	if !resp.Success {
+		t.Fatalf("register %s failed: %s", card.Name, resp.Error)
+	}
+	return resp
+}
+
+// serveStubProvider makes the peer a stand-in provider that answers every
+// execution call with the method and params it was sent.
+func (p *testPeer) serveStubProvider() {
+	p.SetStreamHandler(common.ProtocolID, func(s network.Stream) {
+		defer s.Close()
+		var req common.JSONRPCRequest
+		if err := json.NewDecoder(s).Decode(&req); err != nil {
+			return
+		}
+		json.NewEncoder(s).Encode(common.JSONRPCResponse{
+			ID:     req.ID,
+			Result: map[string]interface{}{"method": req.Method, "params": req.Params},
+		})
+	})
+}
+
+// newTestRegistry returns a registry with the startRegistry defaults and
+// in-memory storage, serving the registry RPC on a loopback host.
+func newTestRegistry(t *testing.T) *RegistryNode {
+	t.Helper()
+	h := newTestPeer(t)
+	r := &RegistryNode{
+		Host:              h.Host,
+		Registrations:     make(map[peer.ID]*RegistrationRecord),
+		ServiceIndex:      make(map[string][]peer.ID),
+		capabilities:      newCapabilityIndex(),
+		minStake:          10,
+		seenStakeNonces:   make(map[string]bool),
+		peerStakes:        make(map[peer.ID][]string),
+		freezedPeerStakes: make(map[peer.ID][]freezedStake),
+		freezedStakes:     make([]freezedStake, 0),
+		regStore:          storage.NewMemoryStorage(time.Hour),
+		embeddingDim:      1536,
+		heartbeatTTL:      90 * time.Second,
+		heartbeatGrace:    1,
+		retries:           newRetryQueue(1000),
+		maxStreamMessages: 100,
+		maxQueryLen:       256,
+		maxPageSize:       500,
+		adminBans:         newPeerBans(),
+		featured:          make(map[string]bool),
+	}
+	h.SetStreamHandler(common.RegistryProtocolID, r.handleStream)
+	h.SetStreamHandler(common.RegistryProtocolPB, r.handleStream)
+	return r
+}
+
+// knowPeer puts p's public key in the registry's peerstore, as connecting
+// would, so tests can call handleRequest directly on p's behalf.
+func knowPeer(t *testing.T, r *RegistryNode, p *testPeer) {
+	t.Helper()
+	if err := r.Host.Peerstore().AddPubKey(p.ID(), p.key.GetPublic()); err != nil {
+		t.Fatalf("failed to add pubkey: %v", err)
+	}
+}
+
+func TestRegisterFindCallStub(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	provider := newTestPeer(t)
+	provider.serveStubProvider()
+	provider.register(t, reg, common.ServiceCard{Name: "echo", Description: "Echoes its params"})
+
+	client := newTestPeer(t)
+	found := client.call(t, reg, common.RegistryRequest{Method: "find", Query: "echo"})
+	if !found.Success || len(found.Providers) != 1 {
+		t.Fatalf("find: want 1 provider, got %+v", found)
+	}
+	if found.Providers[0].ID != provider.ID() {
+		t.Fatalf("find returned %s, want %s", found.Providers[0].ID, provider.ID())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx, found.Providers[0]); err != nil {
+		t.Fatalf("failed to connect to provider: %v", err)
+	}
+	resp, err := common.CallProvider(ctx, client.Host, provider.ID(), common.JSONRPCRequest{Method: executionMethod, Params: []interface{}{"hi"}, ID: 7})
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	result, _ := resp.Result.(map[string]interface{})
+	if resp.ID != 7 || resp.Error != "" || result["method"] != executionMethod {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+}
+
+func TestRegisterFindProtobuf(t *testing.T) {
+	reg := newTestRegistry(t)
+	provider := newTestPeer(t)
+	provider.register(t, reg, common.ServiceCard{Name: "echo"})
+
+	client := newTestPeer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := common.ConnectHosts(ctx, reg.Host, client.Host); err != nil {
+		t.Fatalf("failed to connect to registry: %v", err)
+	}
+	resp, err := common.CallRegistryPB(ctx, client.Host, reg.Host.ID(), common.RegistryRequest{Method: "find", Query: "echo"})
+	if err != nil {
+		t.Fatalf("find failed: %v", err)
+	}
+	if !resp.Success || len(resp.Providers) != 1 || resp.Providers[0].ID != provider.ID() {
+		t.Fatalf("find over protobuf: got %+v", resp)
+	}
+}
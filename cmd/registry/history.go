@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"prxs/common"
+	"prxs/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// historyReasonUnregistered and historyReasonReplaced complete the archive
+// reasons as causes of a "deregistered" history event.
+const (
+	historyReasonUnregistered = "unregistered" // The provider called "unregister"
+	historyReasonReplaced     = "replaced"     // Left out of the provider's new registration
+)
+
+// historyBuffer bounds the events waiting for historyLoop. Past it, new
+// events are dropped rather than blocking callers holding r.mu.
+const historyBuffer = 1024
+
+// historyEvent is one service event waiting to be written to Redis.
+type historyEvent struct {
+	service string
+	event   storage.ServiceEvent
+}
+
+// recordHistory queues, for each affected service's history in Redis, the
+// cards that pid gained or lost going from old to rec (either may be nil).
+// Heartbeats and re-registrations of the same cards record nothing, and
+// private cards are never recorded. historyLoop does the writes, so this
+// is safe to call under r.mu.
+func (r *RegistryNode) recordHistory(pid peer.ID, old, rec *RegistrationRecord, reason string) {
+	if r.storage == nil || r.historyLen <= 0 || r.history == nil {
+		return
+	}
+	names := func(rec *RegistrationRecord) map[string]bool {
+		set := make(map[string]bool)
+		if rec != nil {
+			for _, card := range rec.cards() {
+				if card.Visibility != common.VisibilityPrivate {
+					set[card.Name] = true
+				}
+			}
+		}
+		return set
+	}
+	before, after := names(old), names(rec)
+
+	now := r.now().Unix()
+	record := func(service string, ev storage.ServiceEvent) {
+		select {
+		case r.history <- historyEvent{service: service, event: ev}:
+		default:
+			log.Printf("[Reg] Warning: History queue full, dropped %s event of %s\n", ev.Event, service)
+		}
+	}
+	for name := range after {
+		if !before[name] {
+			record(name, storage.ServiceEvent{Event: storage.ServiceEventRegistered, PeerID: pid.String(), At: now})
+		}
+	}
+	if rec != nil {
+		reason = historyReasonReplaced
+	}
+	for name := range before {
+		if !after[name] {
+			record(name, storage.ServiceEvent{Event: storage.ServiceEventDeregistered, PeerID: pid.String(), Reason: reason, At: now})
+		}
+	}
+}
+
+// historyLoop writes queued service events to Redis in order.
+func (r *RegistryNode) historyLoop() {
+	for h := range r.history {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := r.storage.RecordServiceEvent(ctx, h.service, h.event, r.historyLen); err != nil {
+			log.Printf("[Reg] Warning: %v\n", err)
+		}
+		cancel()
+	}
+}
+
+// getServiceHistory returns a service's registration and deregistration
+// events, newest first.
+// GET /api/v1/services/:name/history?limit=100
+func (r *RegistryNode) getServiceHistory(c *gin.Context) {
+	if r.storage == nil || r.historyLen <= 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "service history not enabled (requires Redis and -history-max-len)"})
+		return
+	}
+	serviceName := c.Param("name")
+	limit := r.historyLen
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit %q", v)})
+			return
+		}
+		limit = min(n, r.historyLen)
+	}
+
+	events, err := r.storage.ServiceHistory(c.Request.Context(), serviceName, limit)
+	if err != nil {
+		log.Printf("[Reg] Failed to load history of %s: %v\n", serviceName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"service": serviceName, "events": events, "count": len(events)})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"prxs/common"
+	"prxs/storage"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRecordHistory(t *testing.T) {
+	r := newTestRegistry(t)
+	rs, err := storage.NewRedisStorage(miniredis.RunT(t).Addr(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	r.storage = rs
+	r.historyLen = 10
+	r.history = make(chan historyEvent, historyBuffer)
+
+	p := newTestPeer(t)
+	registerAs(t, r, p, common.ServiceCard{Name: "svc"})
+	r.mu.Lock()
+	r.dropRegistration(p.ID(), archiveReasonAdmin)
+	r.mu.Unlock()
+
+	// Nothing is written until historyLoop drains the queue
+	if events, err := rs.ServiceHistory(context.Background(), "svc", 10); err != nil || len(events) != 0 {
+		t.Fatalf("history written before historyLoop ran: %v, %v", events, err)
+	}
+	close(r.history)
+	r.historyLoop()
+
+	events, err := rs.ServiceHistory(context.Background(), "svc", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Event != storage.ServiceEventDeregistered || events[0].Reason != archiveReasonAdmin || events[1].Event != storage.ServiceEventRegistered {
+		t.Fatalf("history %+v, want registered then deregistered (admin)", events)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// openStream connects p to the registry host and opens a RegistryStream.
+func openStream(t *testing.T, registry, p *testPeer) *common.RegistryStream {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := common.ConnectHosts(ctx, registry.Host, p.Host); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	rs, err := common.OpenRegistryStream(ctx, p.Host, registry.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rs.Close() })
+	return rs
+}
+
+func TestKeepAlivePingPong(t *testing.T) {
+	r := newTestRegistry(t)
+	r.maxStreamMessages = 1
+	client := newTestPeer(t)
+	rs := openStream(t, &testPeer{Host: r.Host}, client)
+
+	// Pings are answered promptly and don't use up the message cap
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		if err := rs.Ping(time.Second); err != nil {
+			t.Fatalf("ping %d: %v", i, err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Fatalf("pong took %s", elapsed)
+		}
+	}
+	if resp, err := rs.Call(common.RegistryRequest{Method: "find", Query: "x"}, time.Second); err != nil || resp.Error != "" {
+		t.Fatalf("find after pings: %+v, %v", resp, err)
+	}
+
+	// KeepAlive runs until the stream is closed, and the stream survives it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- rs.KeepAlive(ctx, 10*time.Millisecond, time.Second) }()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("KeepAlive stopped on a live stream: %v", err)
+	case <-rs.Done():
+		t.Fatal("live stream closed")
+	default:
+	}
+	rs.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("KeepAlive after Close: %v", err)
+	}
+}
+
+func TestKeepAliveClosesDeadStream(t *testing.T) {
+	// A registry that reads requests and never answers
+	dead := newTestPeer(t)
+	dead.SetStreamHandler(common.RegistryProtocolPB, func(s network.Stream) {
+		io.Copy(io.Discard, s)
+	})
+	client := newTestPeer(t)
+	rs := openStream(t, dead, client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := rs.KeepAlive(ctx, 10*time.Millisecond, 50*time.Millisecond); err == nil {
+		t.Fatal("KeepAlive returned nil for a stream that never pongs")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("dead stream noticed after %s", elapsed)
+	}
+	select {
+	case <-rs.Done():
+	default:
+		t.Fatal("stream left open after a missed pong")
+	}
+	if _, err := rs.Call(common.RegistryRequest{Method: "find"}, time.Second); err == nil {
+		t.Fatal("call succeeded on the closed stream")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat hint tuning. At or below these loads providers are asked to
+// heartbeat every heartbeatTTL/3; above them the interval grows in
+// proportion to whichever load signal is furthest over its budget.
+const (
+	hintProviderBudget = 1000 // registered providers
+	hintRPSBudget      = 50.0 // registry RPCs per second
+	loadSampleInterval = 10 * time.Second
+)
+
+// loadTracker estimates the registry's RPC rate over the last sample window.
+type loadTracker struct {
+	requests atomic.Int64
+	rps      atomic.Uint64 // math.Float64bits of the last sampled rate
+}
+
+// observe counts one RPC.
+func (l *loadTracker) observe() {
+	l.requests.Add(1)
+}
+
+// rate returns RPCs per second over the last sample window.
+func (l *loadTracker) rate() float64 {
+	return math.Float64frombits(l.rps.Load())
+}
+
+// loop samples the request counter every loadSampleInterval.
+func (l *loadTracker) loop() {
+	ticker := time.NewTicker(loadSampleInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n := l.requests.Swap(0)
+		l.rps.Store(math.Float64bits(float64(n) / loadSampleInterval.Seconds()))
+	}
+}
+
+// heartbeatHint recommends how often providers should heartbeat given the
+// current provider count and request rate. The hint never exceeds 80% of
+// heartbeatTTL, so providers that follow it are never counted as missing;
+// operators expecting heavier load should raise -heartbeat-ttl.
+func (r *RegistryNode) heartbeatHint(providers int) time.Duration {
+	factor := math.Max(1, math.Max(
+		float64(providers)/hintProviderBudget,
+		r.load.rate()/hintRPSBudget,
+	))
+	hint := time.Duration(float64(r.heartbeatTTL/3) * factor)
+	if ceiling := r.heartbeatTTL * 4 / 5; hint > ceiling {
+		hint = ceiling
+	}
+	return hint.Truncate(time.Second)
+}
@@ -6,17 +6,24 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -28,6 +35,7 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
 	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"prxs/common"
 	"prxs/storage"
@@ -39,6 +47,24 @@ type RegistrationRecord struct {
 	ServiceCard common.ServiceCard
 	StakeProof  *common.StakeProof
 	AddrInfo    peer.AddrInfo
+
+	// Extra holds a gateway's further services, registered together with
+	// ServiceCard through "register_batch".
+	Extra []common.ServiceCard
+
+	// MissedHeartbeats counts consecutive heartbeat windows the provider has
+	// missed. It is runtime-only and reset on every accepted heartbeat.
+	MissedHeartbeats int
+
+	// Latency is the last measured round-trip to the provider (0 = not measured).
+	Latency time.Duration
+
+	// Stake is StakeProof.Amount converted to the registry's base unit.
+	Stake float64
+
+	// SuppliedEmbeddings names the cards whose Embedding the provider sent
+	// itself; a reindex keeps those instead of recomputing them.
+	SuppliedEmbeddings []string
 }
 
 // freezedStake represents a stake that is temporarily frozen during unregistration.
@@ -48,6 +74,9 @@ type freezedStake struct {
 	CreatedAt int64 // Unix timestamp
 }
 
+// streamIdleTimeout bounds how long a registry stream may sit idle between requests.
+const streamIdleTimeout = 60 * time.Second
+
 // UNFREEZE_DELAY is the duration (in seconds) a stake must remain frozen before unfreezing.
 const UNFREEZE_DELAY = 7 * 86400 // 7 days
 
@@ -59,10 +88,15 @@ type RegistryNode struct {
 	Registrations map[peer.ID]*RegistrationRecord
 	// Lookup index: ServiceName -> PeerIDs
 	ServiceIndex map[string][]peer.ID
+	// Lookup index: input/output name -> PeerIDs
+	capabilities *capabilityIndex
 
 	mu sync.Mutex
 
 	minStake          float64
+	stakeDenoms       denomTable                 // Denomination -> base-unit conversion rate
+	maxStake          float64                    // Sanity cap on claimed stake (0 = no cap)
+	maxPerStaker      int                        // Providers per stake identity per service (0 = unlimited)
 	seenStakeNonces   map[string]bool            // Replay protection for stake nonces
 	peerStakes        map[peer.ID][]string       // PeerID -> list of stake IDs
 	freezedPeerStakes map[peer.ID][]freezedStake // PeerID -> list of frozen stakes
@@ -70,9 +104,159 @@ type RegistryNode struct {
 	stakeMu           sync.Mutex
 
 	qdrant       *QdrantClient
-	storage      *storage.RedisStorage
+	regStore     storage.Storage       // Registration persistence (Redis, or in-memory without it)
+	storage      *storage.RedisStorage // Stake bookkeeping, rate windows, featured set (nil without Redis)
 	embeddingDim int
 	embedder     *EmbeddingClient
+	embedCache   *embeddingCache // nil when -embedding-cache-size is 0
+
+	heartbeatTTL   time.Duration // Window in which a provider is expected to heartbeat
+	heartbeatGrace int           // Consecutive missed windows tolerated before pruning
+	minHeartbeat   time.Duration // Heartbeats sooner than this after the last accepted one are ignored
+
+	restoring atomic.Bool // True while the startup restore from storage is running
+
+	viewGen atomic.Uint64 // Bumped on every change the cached listings show
+	views   *viewCache    // Rendered /services listings (nil = disabled)
+
+	rankWeights     RankWeights // Weights for ?rank=score ordering
+	freshnessWeight float64     // Share of provider freshness in semantic search scores (0-1)
+
+	retries *retryQueue // Failed Redis/Qdrant writes awaiting replay
+	load    loadTracker // RPC rate, feeds the heartbeat interval hint
+
+	maxStreamMessages int  // Requests accepted per stream before forcing a reconnect (0 = unlimited)
+	requireAddrs      bool // Reject registrations whose ProviderInfo lists no addresses
+	maxServices       int  // Services one provider may register in a batch (0 = unlimited)
+	maxRegistrations  int  // Providers held before the least recently seen is evicted (0 = unlimited)
+	maxConcurrent     int  // In-flight REST API requests before new ones get 503 (0 = unlimited)
+	maxQueryLen       int  // Longest search query accepted, in characters (0 = unlimited)
+	maxPageSize       int  // Largest ?limit= accepted by the service listings
+	historyLen        int  // Events kept per service history list in Redis (0 = disabled)
+	qdrantMaxTags     int  // Tags of a card included in its Qdrant payload (0 = up to qdrantMaxListItems)
+	foldText          bool // NFKC + diacritic folding before matching and embedding
+	stemWords         bool // Suffix-strip words before embedding
+
+	stopwords map[string]bool // Words dropped before embedding (nil = keep all)
+
+	history chan historyEvent // Service events awaiting historyLoop
+
+	archive    storage.Archive // Where dropped registrations are kept (nil = discard)
+	archiveTTL time.Duration   // How long archived registrations are kept
+
+	highStake    float64       // Stake earning the longer storage TTL (0 = disabled)
+	highStakeTTL time.Duration // Extra storage TTL for high-stake records
+
+	popularity   *popularity // Find hits per service (nil = disabled)
+	popularGrace int         // Extra missed windows tolerated for popular services
+
+	adminToken string          // Bearer token for /api/v1/admin (empty = disabled)
+	featured   map[string]bool // Service names pinned by an operator (guarded by mu)
+
+	federation *federation // Peer registries "find" may fan out to (nil = none)
+
+	prober *prober // Measures provider latency (nil = disabled)
+
+	// clock times heartbeats, pruning, restore, the registration rate, stake
+	// freezing, bans, admin nonces, popularity, filter ages and the view
+	// cache (nil = wall clock); tests swap in a common.MockClock. Network
+	// deadlines and metrics stay on the wall clock.
+	clock common.Clock
+
+	rotation *keyRotation // Previous key still honoured (nil = no rotation)
+
+	stakeBans *stakeBlocklist // Peers banned for repeated invalid stakes (nil = disabled)
+
+	adminAuth *adminAuth // Keys allowed to sign admin RPC commands (nil = disabled)
+	adminBans *peerBans  // Peers banned through the admin RPC
+
+	gateway         bool           // Serve POST /services/:name/call
+	gatewayAttempts int            // Providers a gateway call tries before giving up
+	gatewayTimeout  time.Duration  // Per-provider limit on a gateway call
+	gatewayKey      crypto.PrivKey // Signs payment tickets for relayed calls (nil = unsigned)
+	gatewayNonce    atomic.Int64   // Last gateway ticket nonce
+
+	maxRegsPerMin int         // Global new-registration cap per minute (0 = unlimited)
+	localRegLog   []time.Time // Sliding window used when Redis is not configured
+	regLogMu      sync.Mutex
+}
+
+// registryConfig collects the command-line options for startRegistry.
+type registryConfig struct {
+	Port             int
+	APIPort          int
+	BootstrapAddr    string
+	DevMode          bool
+	MinStake         float64
+	MaxStake         float64
+	MaxPerStaker     int
+	QdrantURL        string
+	QdrantCollection string
+	QdrantEnabled    bool
+	RedisAddr        string
+	EmbeddingDim     int
+	EmbeddingModel   string
+	EmbeddingBaseURL string
+	EmbeddingAPIKey  string
+	HeartbeatTTL     time.Duration
+	HeartbeatGrace   int
+	MinHeartbeat     time.Duration
+	MaxRegsPerMin    int
+	ListenAddrs      []ma.Multiaddr
+	AnnounceAddrs    []ma.Multiaddr // Advertised in addition to (or, with AnnounceReplace, instead of) the observed addrs
+	AnnounceReplace  bool
+	RankWeights      RankWeights
+	FreshnessWeight  float64
+	RetryQueueSize   int
+	AdminToken       string
+	EmbedCacheSize   int
+	QdrantMaxWrites  int
+	QdrantDistance   string
+	QdrantShards     int
+	QdrantReplicas   int
+	QdrantMaxTags    int
+	QdrantRequired   bool
+	MaxStreamMsgs    int
+	RequireAddrs     bool
+	StakeDenoms      denomTable
+	StorageBackend   string // "redis", "bolt", "memory" or "" (auto)
+	StoragePath      string // Bolt database file
+	SyncInterval     time.Duration
+	BanThreshold     int
+	HighStake        float64
+	FoldText         bool
+	Stopwords        map[string]bool
+	StemWords        bool
+	ArchiveStale     bool
+	ArchiveTTL       time.Duration
+	HighStakeTTL     time.Duration
+	BanWindow        time.Duration
+	BanDuration      time.Duration
+	MaxServices      int
+	MaxRegistrations int
+	MaxConcurrent    int
+	MaxQueryLen      int
+	MaxPageSize      int
+	HistoryLen       int
+	ReadCacheTTL     time.Duration
+	PopularFinds     int
+	PopularWindow    time.Duration
+	PopularGrace     int
+	ProbeInterval    time.Duration
+	ProbeWorkers     int
+	ProbeDeadline    time.Duration
+	ProbeSample      int
+	Gateway          bool
+	GatewayAttempts  int
+	GatewayTimeout   time.Duration
+	GatewayKey       crypto.PrivKey
+	FederatePeers    []peer.AddrInfo
+	FederateMaxHops  int
+	DHTPrefix        string
+	PreviousKey      crypto.PrivKey // Key being rotated out (nil = none)
+	RotationUntil    time.Time      // End of the previous key's window
+	PreviousPort     int            // Port serving the previous identity
+	AdminKeys        []peer.ID      // Peer IDs of keys allowed to sign admin RPCs
 }
 
 func main() {
@@ -82,22 +266,129 @@ func main() {
 	port := flag.Int("port", 4001, "port")
 	apiPort := flag.Int("api-port", 8080, "REST API port (default: 8080, avoid restricted ports like 6000)")
 	bootstrap := flag.String("bootstrap", "", "bootstrap multiaddr")
+	dhtPrefix := flag.String("dht-prefix", common.DefaultDHTPrefix, "DHT protocol prefix; nodes must use the same one (isolates separate deployments)")
 	keyFile := flag.String("key", "", "path to key file (e.g. registry.key)")
+	previousKeyFile := flag.String("previous-key", "", "path to the key being rotated out; it stays valid until -key-rotation-until")
+	rotationUntil := flag.String("key-rotation-until", "", "RFC3339 end of the previous key's window (default: 24h from start)")
+	previousPort := flag.Int("previous-key-port", 0, "port serving the previous identity during rotation (default: -port + 1)")
 	devMode := flag.Bool("dev", true, "Enable LAN/Dev mode")
 	minStake := flag.Float64("min-stake", 10.0, "minimum stake required to register")
+	maxStake := flag.Float64("max-stake", 1e9, "maximum stake accepted in a proof; larger claims are rejected (0 disables the cap)")
+	stakeDenoms := flag.String("stake-denoms", "", "stake denomination conversion table to the -min-stake unit, e.g. prxs=1,uprxs=0.000001 (undenominated proofs use the base unit)")
+	foldText := flag.Bool("fold-text", false, "apply Unicode NFKC normalization and diacritic folding before keyword matching and embedding (reindex after changing)")
+	stopwords := flag.String("embedding-stopwords", "", "comma-separated words dropped from card and query text before embedding, or \"default\" for the built-in list (reindex after changing)")
+	archiveStale := flag.Bool("archive-stale", false, "keep pruned, evicted and stale-on-restore registrations in an archive (GET /api/v1/admin/archive) instead of discarding them")
+	archiveTTL := flag.Duration("archive-ttl", 30*24*time.Hour, "how long archived registrations are kept (0 = forever)")
+	stemWords := flag.Bool("embedding-stem", false, "strip common English suffixes from words before embedding (reindex after changing)")
+	highStake := flag.Float64("high-stake-threshold", 0, "stake (base unit) at which a provider's stored record gets -high-stake-ttl extra expiry (0 disables)")
+	highStakeTTL := flag.Duration("high-stake-ttl", 10*time.Minute, "extra Redis/bolt expiry for high-stake records")
+	banThreshold := flag.Int("stake-ban-threshold", 5, "invalid or replayed stake proofs within -stake-ban-window that get a peer temporarily blocked (0 disables)")
+	banWindow := flag.Duration("stake-ban-window", 10*time.Minute, "window in which invalid stake attempts are counted")
+	banDuration := flag.Duration("stake-ban-duration", 30*time.Minute, "how long a peer stays blocked")
+	maxPerStaker := flag.Int("max-providers-per-staker", 0, "maximum providers one stake owner may register for the same service (0 = unlimited)")
 	qdrantEnabled := flag.Bool("qdrant-enabled", false, "enable Qdrant semantic index")
 	qdrantURL := flag.String("qdrant-url", "http://localhost:6333", "Qdrant base URL")
 	qdrantCollection := flag.String("qdrant-collection", "prxs_services", "Qdrant collection name")
+	qdrantShards := flag.Int("qdrant-shards", 1, "shards of the Qdrant collection when the registry creates it")
+	qdrantReplicas := flag.Int("qdrant-replicas", 1, "replication factor of the Qdrant collection when the registry creates it")
+	qdrantMaxTags := flag.Int("qdrant-max-tags", 32, fmt.Sprintf("tags of a card included in its Qdrant payload; the registry keeps the rest (0 = up to %d)", qdrantMaxListItems))
+	qdrantDistance := flag.String("qdrant-distance", "Cosine", "Qdrant collection metric: Cosine, Dot or Euclid (must match an existing collection)")
+	qdrantRequired := flag.Bool("qdrant-required", false, "exit at startup if Qdrant is unreachable instead of disabling semantic search")
+	qdrantMaxWrites := flag.Int("qdrant-max-concurrent-writes", 4, "max concurrent Qdrant upserts/deletes; others queue (0 = unlimited)")
+	storageBackend := flag.String("storage", "", "registration storage backend: redis, bolt or memory (default: redis when -redis is set, else memory)")
+	storagePath := flag.String("storage-path", "registry.db", "database file for -storage=bolt")
+	syncInterval := flag.Duration("sync-interval", 5*time.Minute, "how often registrations are reconciled with persistent storage (0 disables)")
 	redisAddr := flag.String("redis", "", "Redis address (e.g., localhost:6379) - if set, registrations are stored in both memory and Redis")
 	embeddingDim := flag.Int("embedding-dim", 1536, "Embedding dimension (e.g., 1536 for text-embedding-3-small)")
 	embeddingModel := flag.String("embedding-model", "text-embedding-3-small", "Embedding model name (used for query embeddings)")
 	embeddingBaseURL := flag.String("embedding-base-url", "https://api.openai.com/v1", "Embedding API base URL")
 	embeddingAPIKey := flag.String("embedding-api-key", "", "Embedding API key (default: OPENAI_API_KEY env)")
+	heartbeatTTL := flag.Duration("heartbeat-ttl", 90*time.Second, "window in which a provider must heartbeat before it counts as missed")
+	maxRegsPerMin := flag.Int("max-registrations-per-min", 0, "global cap on new registrations per minute, shared through Redis when enabled (0 = unlimited)")
+	rankCost := flag.Float64("rank-weight-cost", 1, "ranking weight for low cost per op (rank=score)")
+	rankStake := flag.Float64("rank-weight-stake", 1, "ranking weight for high stake (rank=score)")
+	rankLatency := flag.Float64("rank-weight-latency", 1, "ranking weight for low measured latency (rank=score)")
+	rankReputation := flag.Float64("rank-weight-reputation", 1, "ranking weight for heartbeat reliability (rank=score)")
+	freshnessWeight := flag.Float64("search-freshness-weight", 0.2, "share (0-1) of provider freshness, against relevance, in semantic search scores")
+	retryQueueSize := flag.Int("retry-queue-size", 1000, "max failed Redis/Qdrant writes kept for replay")
+	embedCacheSize := flag.Int("embedding-cache-size", 1024, "card embeddings kept in the LRU cache (0 disables)")
+	requireAddrs := flag.Bool("require-provider-addrs", true, "reject registrations whose provider info lists no addresses")
+	maxServices := flag.Int("max-services-per-provider", 64, "services one provider (gateway) may register with register_batch (0 = unlimited)")
+	readCacheTTL := flag.Duration("read-cache-ttl", 2*time.Second, "how long /services and /services_full responses are reused while nothing changes (0 disables)")
+	historyLen := flag.Int("history-max-len", 100, "registration/deregistration events kept per service in Redis for /services/:name/history (0 disables)")
+	maxPageSize := flag.Int("max-page-size", 500, "largest ?limit= accepted by /services and /services_full")
+	maxQueryLen := flag.Int("max-query-length", 256, "longest search query accepted by find, find_best and the search endpoints, in characters (0 = unlimited)")
+	maxConcurrent := flag.Int("max-concurrent-requests", 0, "in-flight REST API requests; more are refused with 503 and Retry-After (0 = unlimited)")
+	maxRegistrations := flag.Int("max-registrations", 0, "providers held in memory; a new one evicts the least recently seen when full (0 = unlimited)")
+	maxStreamMsgs := flag.Int("max-stream-messages", 100, "registry requests accepted on one stream before it must reconnect (0 = unlimited)")
+	adminToken := flag.String("admin-token", "", "bearer token enabling the /api/v1/admin endpoints (default: REGISTRY_ADMIN_TOKEN env)")
+	adminKeys := flag.String("admin-keys", "", "comma-separated peer IDs of keys allowed to sign admin RPC commands (empty = admin RPC disabled)")
+	gateway := flag.Bool("gateway", false, "relay execution calls from HTTP clients to providers via POST /api/v1/services/:name/call")
+	gatewayAttempts := flag.Int("gateway-attempts", 3, "providers a gateway call tries, in ranked order, before failing")
+	gatewayTimeout := flag.Duration("gateway-timeout", 30*time.Second, "limit on each provider a gateway call tries")
+	gatewayKeyFile := flag.String("gateway-key", "", "key file (created if missing) whose identity signs payment tickets on gateway calls that don't carry the client's own (empty = relay unsigned)")
+	listen := flag.String("listen", "", "comma-separated listen multiaddrs; overrides the -port defaults")
+	announce := flag.String("announce-addrs", "", "comma-separated public multiaddrs (without /p2p/) advertised to peers, the DHT and /registry/info, e.g. behind NAT or a load balancer")
+	announceReplace := flag.Bool("announce-replace", false, "advertise only -announce-addrs instead of adding them to the listen/observed addrs")
+	federatePeers := flag.String("federate-peers", "", "comma-separated multiaddrs (with /p2p/ IDs) of peer registries that federated find/search queries fan out to")
+	federateMaxHops := flag.Int("federation-max-hops", 2, "registries a federated query may pass through before it is no longer forwarded")
+	heartbeatGrace := flag.Int("heartbeat-grace", 1, "consecutive missed heartbeat windows tolerated before a provider is pruned")
+	minHeartbeat := flag.Duration("min-heartbeat-interval", 5*time.Second, "heartbeats arriving sooner than this after a provider's last accepted one are acknowledged but ignored (0 disables)")
+	popularFinds := flag.Int("popular-find-threshold", 0, "find hits within -popular-window that make a service popular, extending its providers' grace by -popular-grace (0 disables)")
+	popularWindow := flag.Duration("popular-window", 10*time.Minute, "window in which find hits are counted towards -popular-find-threshold")
+	popularGrace := flag.Int("popular-grace", 1, fmt.Sprintf("extra missed heartbeat windows tolerated for providers of popular services (max %d)", maxPopularGrace))
+	probeInterval := flag.Duration("probe-interval", 0, "how often providers are pinged to measure the latency used by rank=score (0 disables)")
+	probeWorkers := flag.Int("probe-workers", 32, "providers pinged in parallel during a probe cycle")
+	probeDeadline := flag.Duration("probe-deadline", 30*time.Second, "time limit of a probe cycle; providers not reached by then keep their last latency (at most -probe-interval)")
+	probeSample := flag.Int("probe-sample", 1000, "most providers probed per cycle, chosen at random (0 = all)")
 	flag.Parse()
 
+	listenAddrs, err := common.ParseListenAddrs(strings.Split(*listen, ","))
+	if err != nil {
+		log.Fatalf("Invalid -listen: %v", err)
+	}
+	announceAddrs, err := common.ParseListenAddrs(strings.Split(*announce, ","))
+	if err != nil {
+		log.Fatalf("Invalid -announce-addrs: %v", err)
+	}
+	for _, addr := range announceAddrs {
+		if _, err := addr.ValueForProtocol(ma.P_P2P); err == nil {
+			log.Fatalf("Invalid -announce-addrs: %s must not include /p2p/", addr)
+		}
+	}
+	if *announceReplace && len(announceAddrs) == 0 {
+		log.Fatalf("-announce-replace requires -announce-addrs")
+	}
+
+	denoms, err := parseDenomTable(*stakeDenoms)
+	if err != nil {
+		log.Fatalf("Invalid -stake-denoms: %v", err)
+	}
+
+	if *freshnessWeight < 0 || *freshnessWeight > 1 {
+		log.Fatalf("Invalid -search-freshness-weight %v: must be between 0 and 1", *freshnessWeight)
+	}
+
+	distance, err := parseQdrantDistance(*qdrantDistance)
+	if err != nil {
+		log.Fatalf("Invalid -qdrant-distance: %v", err)
+	}
+	if *qdrantShards <= 0 || *qdrantReplicas <= 0 {
+		log.Fatalf("-qdrant-shards and -qdrant-replicas must be positive")
+	}
+
+	fedPeers, err := parseFederationPeers(*federatePeers)
+	if err != nil {
+		log.Fatalf("Invalid -federate-peers: %v", err)
+	}
+
+	admins, err := parseAdminKeys(*adminKeys)
+	if err != nil {
+		log.Fatalf("Invalid -admin-keys: %v", err)
+	}
+
 	// Load Key if specified, otherwise generate ephemeral
 	var privKey crypto.PrivKey
-	var err error
 
 	if *keyFile != "" {
 		privKey, err = common.LoadOrGenerateKey(*keyFile)
@@ -109,6 +400,36 @@ func main() {
 		privKey, _, _ = crypto.GenerateKeyPairWithReader(crypto.RSA, 2048, rand.Reader)
 	}
 
+	var gatewayKey crypto.PrivKey
+	if *gatewayKeyFile != "" {
+		gatewayKey, err = common.LoadOrGenerateKey(*gatewayKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load gateway key: %v", err)
+		}
+	}
+
+	var previousKey crypto.PrivKey
+	var until time.Time
+	if *previousKeyFile != "" {
+		if *keyFile == "" {
+			log.Fatalf("-previous-key requires -key")
+		}
+		previousKey, err = common.LoadKey(*previousKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load previous key: %v", err)
+		}
+		until = time.Now().Add(defaultRotationWindow)
+		if *rotationUntil != "" {
+			until, err = time.Parse(time.RFC3339, *rotationUntil)
+			if err != nil {
+				log.Fatalf("Invalid -key-rotation-until: %v", err)
+			}
+		}
+	}
+	if *previousPort == 0 {
+		*previousPort = *port + 1
+	}
+
 	// Get LLM configuration from environment (LLM_API_KEY > OPENAI_API_KEY)
 	key := *embeddingAPIKey
 	if key == "" {
@@ -118,88 +439,334 @@ func main() {
 		}
 	}
 
+	if *adminToken == "" {
+		*adminToken = os.Getenv("REGISTRY_ADMIN_TOKEN")
+	}
+
 	// Auto-detect base URL for OpenRouter if key starts with sk-or-
 	baseURL := *embeddingBaseURL
 	if *embeddingBaseURL == "https://api.openai.com/v1" && strings.HasPrefix(key, "sk-or-") {
 		baseURL = "https://openrouter.ai/api/v1"
 	}
 
-	startRegistry(*port, *apiPort, *bootstrap, *devMode, *minStake, privKey, *qdrantURL, *qdrantCollection, *qdrantEnabled, *redisAddr, *embeddingDim, *embeddingModel, baseURL, key)
+	startRegistry(registryConfig{
+		Port:             *port,
+		APIPort:          *apiPort,
+		BootstrapAddr:    *bootstrap,
+		DevMode:          *devMode,
+		MinStake:         *minStake,
+		MaxStake:         *maxStake,
+		MaxPerStaker:     *maxPerStaker,
+		QdrantURL:        *qdrantURL,
+		QdrantCollection: *qdrantCollection,
+		QdrantEnabled:    *qdrantEnabled,
+		RedisAddr:        *redisAddr,
+		EmbeddingDim:     *embeddingDim,
+		EmbeddingModel:   *embeddingModel,
+		EmbeddingBaseURL: baseURL,
+		EmbeddingAPIKey:  key,
+		HeartbeatTTL:     *heartbeatTTL,
+		HeartbeatGrace:   *heartbeatGrace,
+		MinHeartbeat:     *minHeartbeat,
+		MaxRegsPerMin:    *maxRegsPerMin,
+		ListenAddrs:      listenAddrs,
+		AnnounceAddrs:    announceAddrs,
+		AnnounceReplace:  *announceReplace,
+		RetryQueueSize:   *retryQueueSize,
+		AdminToken:       *adminToken,
+		AdminKeys:        admins,
+		EmbedCacheSize:   *embedCacheSize,
+		QdrantMaxWrites:  *qdrantMaxWrites,
+		QdrantDistance:   distance,
+		QdrantShards:     *qdrantShards,
+		QdrantReplicas:   *qdrantReplicas,
+		QdrantMaxTags:    *qdrantMaxTags,
+		QdrantRequired:   *qdrantRequired,
+		MaxStreamMsgs:    *maxStreamMsgs,
+		RequireAddrs:     *requireAddrs,
+		StakeDenoms:      denoms,
+		StorageBackend:   *storageBackend,
+		StoragePath:      *storagePath,
+		SyncInterval:     *syncInterval,
+		BanThreshold:     *banThreshold,
+		HighStake:        *highStake,
+		FoldText:         *foldText,
+		Stopwords:        parseStopwords(*stopwords),
+		StemWords:        *stemWords,
+		ArchiveStale:     *archiveStale,
+		ArchiveTTL:       *archiveTTL,
+		HighStakeTTL:     *highStakeTTL,
+		BanWindow:        *banWindow,
+		BanDuration:      *banDuration,
+		MaxServices:      *maxServices,
+		MaxRegistrations: *maxRegistrations,
+		MaxConcurrent:    *maxConcurrent,
+		MaxQueryLen:      *maxQueryLen,
+		MaxPageSize:      *maxPageSize,
+		HistoryLen:       *historyLen,
+		ReadCacheTTL:     *readCacheTTL,
+		PopularFinds:     *popularFinds,
+		PopularWindow:    *popularWindow,
+		PopularGrace:     *popularGrace,
+		ProbeInterval:    *probeInterval,
+		ProbeWorkers:     *probeWorkers,
+		ProbeDeadline:    *probeDeadline,
+		ProbeSample:      *probeSample,
+		Gateway:          *gateway,
+		GatewayAttempts:  *gatewayAttempts,
+		GatewayTimeout:   *gatewayTimeout,
+		GatewayKey:       gatewayKey,
+		FederatePeers:    fedPeers,
+		FederateMaxHops:  *federateMaxHops,
+		DHTPrefix:        *dhtPrefix,
+		PreviousKey:      previousKey,
+		RotationUntil:    until,
+		PreviousPort:     *previousPort,
+		FreshnessWeight:  *freshnessWeight,
+		RankWeights: RankWeights{
+			Cost:       *rankCost,
+			Stake:      *rankStake,
+			Latency:    *rankLatency,
+			Reputation: *rankReputation,
+		},
+	}, privKey)
 }
 
-func startRegistry(port int, apiPort int, bootstrapAddr string, devMode bool, minStake float64, privKey crypto.PrivKey, qdrantURL, qdrantCollection string, qdrantEnabled bool, redisAddr string, embeddingDim int, embeddingModel, embeddingBaseURL, embeddingAPIKey string) {
+func startRegistry(cfg registryConfig, privKey crypto.PrivKey) {
 	ctx := context.Background()
 
-	h, err := libp2p.New(common.CommonLibp2pOptions(port, privKey)...)
+	opts := common.CommonLibp2pOptions(cfg.Port, privKey, cfg.ListenAddrs)
+	if len(cfg.AnnounceAddrs) > 0 {
+		opts = append(opts, libp2p.AddrsFactory(common.AnnounceAddrsFactory(cfg.AnnounceAddrs, cfg.AnnounceReplace)))
+	}
+	h, err := libp2p.New(opts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if embeddingDim <= 0 {
-		log.Fatalf("embedding-dim must be > 0 (got %d)", embeddingDim)
+	if cfg.EmbeddingDim <= 0 {
+		log.Fatalf("embedding-dim must be > 0 (got %d)", cfg.EmbeddingDim)
+	}
+	if cfg.MaxStake < 0 || (cfg.MaxStake > 0 && cfg.MaxStake < cfg.MinStake) {
+		log.Fatalf("max-stake must be 0 (disabled) or >= min-stake (got %.2f)", cfg.MaxStake)
+	}
+	if w := cfg.RankWeights; w.Cost < 0 || w.Stake < 0 || w.Latency < 0 || w.Reputation < 0 {
+		log.Fatalf("rank weights must be >= 0 (got %+v)", w)
+	}
+	if cfg.HeartbeatTTL <= 0 {
+		log.Fatalf("heartbeat-ttl must be > 0 (got %s)", cfg.HeartbeatTTL)
+	}
+	if cfg.HeartbeatGrace < 0 {
+		log.Fatalf("heartbeat-grace must be >= 0 (got %d)", cfg.HeartbeatGrace)
+	}
+	if cfg.MinHeartbeat < 0 || cfg.MinHeartbeat >= cfg.HeartbeatTTL/2 {
+		log.Fatalf("min-heartbeat-interval must be >= 0 and less than half of heartbeat-ttl (got %s)", cfg.MinHeartbeat)
+	}
+	if cfg.Gateway && (cfg.GatewayAttempts <= 0 || cfg.GatewayTimeout <= 0) {
+		log.Fatalf("gateway-attempts and gateway-timeout must be > 0 when gateway is set")
+	}
+	if cfg.PopularFinds > 0 && (cfg.PopularWindow <= 0 || cfg.PopularGrace < 0 || cfg.PopularGrace > maxPopularGrace) {
+		log.Fatalf("popular-window must be > 0 and popular-grace between 0 and %d when popular-find-threshold is set", maxPopularGrace)
+	}
+	if cfg.ProbeInterval > 0 && (cfg.ProbeWorkers <= 0 || cfg.ProbeDeadline <= 0 || cfg.ProbeDeadline > cfg.ProbeInterval || cfg.ProbeSample < 0) {
+		log.Fatalf("probe-workers and probe-deadline must be > 0, probe-deadline at most probe-interval and probe-sample >= 0 when probe-interval is set")
+	}
+	if cfg.MaxPageSize <= 0 {
+		log.Fatalf("max-page-size must be > 0 (got %d)", cfg.MaxPageSize)
+	}
+	if cfg.QdrantMaxTags < 0 {
+		log.Fatalf("qdrant-max-tags must be >= 0 (got %d)", cfg.QdrantMaxTags)
+	}
+	if cfg.FederateMaxHops < 0 {
+		log.Fatalf("federation-max-hops must be >= 0 (got %d)", cfg.FederateMaxHops)
+	}
+	if cfg.BanThreshold > 0 && (cfg.BanWindow <= 0 || cfg.BanDuration <= 0) {
+		log.Fatalf("stake-ban-window and stake-ban-duration must be > 0 when stake-ban-threshold is set")
 	}
 
 	var qdrant *QdrantClient
-	if qdrantEnabled && qdrantURL != "" && qdrantCollection != "" {
-		qdrant = NewQdrantClient(qdrantURL, qdrantCollection)
-		fmt.Printf("[Reg] Qdrant enabled: url=%s collection=%s dim=%d\n", qdrantURL, qdrantCollection, embeddingDim)
+	if cfg.QdrantEnabled && cfg.QdrantURL != "" && cfg.QdrantCollection != "" {
+		qdrant = NewQdrantClient(cfg.QdrantURL, cfg.QdrantCollection, cfg.QdrantDistance, cfg.QdrantMaxWrites)
+		qdrant.Shards, qdrant.Replicas = cfg.QdrantShards, cfg.QdrantReplicas
+
+		// Probe Qdrant now rather than failing every upsert later
+		if err := qdrant.ensureCollection(cfg.EmbeddingDim); err != nil {
+			if cfg.QdrantRequired || errors.Is(err, errQdrantDistance) {
+				log.Fatalf("Qdrant unavailable: %v", err)
+			}
+			log.Printf("[Reg] Warning: Qdrant unavailable at startup, semantic search disabled (keyword fallback): %v", err)
+			qdrant = nil
+		} else {
+			fmt.Printf("[Reg] Qdrant enabled: url=%s collection=%s dim=%d distance=%s shards=%d replicas=%d\n", cfg.QdrantURL, cfg.QdrantCollection, cfg.EmbeddingDim, cfg.QdrantDistance, cfg.QdrantShards, cfg.QdrantReplicas)
+		}
 	}
 
 	var embedder *EmbeddingClient
-	if qdrantEnabled {
-		if embeddingAPIKey == "" {
+	if cfg.QdrantEnabled {
+		if cfg.EmbeddingAPIKey == "" {
 			log.Fatalf("embedding API key required for semantic search (set -embedding-api-key or OPENAI_API_KEY)")
 		}
-		embedder = NewEmbeddingClient(embeddingAPIKey, embeddingModel, embeddingBaseURL, embeddingDim)
+		embedder = NewEmbeddingClient(cfg.EmbeddingAPIKey, cfg.EmbeddingModel, cfg.EmbeddingBaseURL, cfg.EmbeddingDim)
 	}
 
+	// Redis keys outlive the prune window slightly so a restart right after
+	// the last heartbeat can still restore the record.
+	pruneAfter := cfg.HeartbeatTTL * time.Duration(cfg.HeartbeatGrace+1)
+
 	// Initialize Redis storage if address is provided
-	redisStorage, err := storage.NewRedisStorage(redisAddr, 120*time.Second)
+	redisStorage, err := storage.NewRedisStorage(cfg.RedisAddr, pruneAfter+30*time.Second)
 	if err != nil {
 		log.Printf("[Reg] Warning: Failed to initialize Redis storage: %v", err)
 		log.Printf("[Reg] Continuing without Redis persistence (in-memory only)")
 		redisStorage = nil
 	}
 
+	// Pick the registration backend: explicit -storage, else Redis when
+	// configured, else in-memory.
+	backend := cfg.StorageBackend
+	if backend == "" {
+		backend = "memory"
+		if redisStorage != nil {
+			backend = "redis"
+		}
+	}
+	var regStore storage.Storage
+	switch backend {
+	case "redis":
+		if redisStorage == nil {
+			log.Fatalf("-storage=redis requires a reachable -redis address")
+		}
+		regStore = redisStorage
+	case "bolt":
+		boltStorage, err := storage.NewBoltStorage(cfg.StoragePath, pruneAfter+30*time.Second)
+		if err != nil {
+			log.Fatalf("Failed to open bolt storage: %v", err)
+		}
+		regStore = boltStorage
+	case "memory":
+		regStore = storage.NewMemoryStorage(pruneAfter + 30*time.Second)
+	default:
+		log.Fatalf("unknown -storage %q (want redis, bolt or memory)", backend)
+	}
+	log.Printf("[Reg] Registration storage: %s\n", backend)
+
 	reg := &RegistryNode{
 		Host:              h,
 		Registrations:     make(map[peer.ID]*RegistrationRecord),
 		ServiceIndex:      make(map[string][]peer.ID),
-		minStake:          minStake,
+		capabilities:      newCapabilityIndex(),
+		minStake:          cfg.MinStake,
+		stakeDenoms:       cfg.StakeDenoms,
+		maxStake:          cfg.MaxStake,
+		maxPerStaker:      cfg.MaxPerStaker,
 		seenStakeNonces:   make(map[string]bool),
 		peerStakes:        make(map[peer.ID][]string),
 		freezedPeerStakes: make(map[peer.ID][]freezedStake),
 		freezedStakes:     make([]freezedStake, 0),
 		qdrant:            qdrant,
+		qdrantMaxTags:     cfg.QdrantMaxTags,
+		regStore:          regStore,
 		storage:           redisStorage,
-		embeddingDim:      embeddingDim,
+		embeddingDim:      cfg.EmbeddingDim,
 		embedder:          embedder,
-	}
-
-	// Restore state from Redis if enabled
-	if redisStorage != nil {
-		if err := reg.restoreStateFromRedis(ctx); err != nil {
-			log.Printf("[Reg] Warning: Failed to restore state from Redis: %v", err)
+		heartbeatTTL:      cfg.HeartbeatTTL,
+		heartbeatGrace:    cfg.HeartbeatGrace,
+		minHeartbeat:      cfg.MinHeartbeat,
+		maxRegsPerMin:     cfg.MaxRegsPerMin,
+		rankWeights:       cfg.RankWeights,
+		freshnessWeight:   cfg.FreshnessWeight,
+		retries:           newRetryQueue(cfg.RetryQueueSize),
+		adminToken:        cfg.AdminToken,
+		maxStreamMessages: cfg.MaxStreamMsgs,
+		requireAddrs:      cfg.RequireAddrs,
+		maxServices:       cfg.MaxServices,
+		maxRegistrations:  cfg.MaxRegistrations,
+		maxConcurrent:     cfg.MaxConcurrent,
+		maxQueryLen:       cfg.MaxQueryLen,
+		maxPageSize:       cfg.MaxPageSize,
+		historyLen:        cfg.HistoryLen,
+		history:           make(chan historyEvent, historyBuffer),
+		foldText:          cfg.FoldText,
+		stemWords:         cfg.StemWords,
+		stopwords:         cfg.Stopwords,
+		highStake:         cfg.HighStake,
+		highStakeTTL:      cfg.HighStakeTTL,
+		popularity:        newPopularity(cfg.PopularFinds, cfg.PopularWindow),
+		popularGrace:      cfg.PopularGrace,
+		prober:            newProber(h, cfg.ProbeInterval, cfg.ProbeWorkers, cfg.ProbeDeadline, cfg.ProbeSample),
+		stakeBans:         newStakeBlocklist(cfg.BanThreshold, cfg.BanWindow, cfg.BanDuration),
+		adminAuth:         newAdminAuth(cfg.AdminKeys),
+		adminBans:         newPeerBans(),
+		gateway:           cfg.Gateway,
+		gatewayAttempts:   cfg.GatewayAttempts,
+		gatewayTimeout:    cfg.GatewayTimeout,
+		gatewayKey:        cfg.GatewayKey,
+		featured:          make(map[string]bool),
+	}
+	if cfg.EmbedCacheSize > 0 {
+		reg.embedCache = newEmbeddingCache(cfg.EmbedCacheSize)
+	}
+	if cfg.ReadCacheTTL > 0 {
+		reg.views = newViewCache(cfg.ReadCacheTTL)
+	}
+	if cfg.Gateway && cfg.GatewayKey != nil {
+		// Time-seeded so tickets stay unique across restarts
+		reg.gatewayNonce.Store(time.Now().UnixNano())
+		id, _ := peer.IDFromPrivateKey(cfg.GatewayKey)
+		log.Printf("[Reg] Gateway calls pay with tickets signed by %s\n", id)
+	}
+	if cfg.ArchiveStale {
+		archive, ok := regStore.(storage.Archive)
+		if !ok {
+			log.Fatalf("-archive-stale is not supported by the %s storage backend", backend)
 		}
+		reg.archive, reg.archiveTTL = archive, cfg.ArchiveTTL
+		log.Printf("[Reg] Archiving dropped registrations in %s storage (ttl %s)\n", backend, cfg.ArchiveTTL)
+	}
+	if len(cfg.FederatePeers) > 0 {
+		reg.federation = newFederation(h, cfg.FederatePeers, cfg.FederateMaxHops)
+		log.Printf("[Reg] Federating with %d peer registries (max hops %d)\n", len(cfg.FederatePeers), cfg.FederateMaxHops)
+	}
+
+	// Restore state in the background so the RPC handlers and the REST API
+	// come up immediately; /health reports progress.
+	if backend != "memory" || redisStorage != nil {
+		reg.restoring.Store(true)
+		go func() {
+			defer reg.restoring.Store(false)
+			if err := reg.restoreState(ctx); err != nil {
+				log.Printf("[Reg] Warning: Failed to restore state: %v", err)
+			}
 
-		// Rebuild Qdrant index from restored registrations
-		if reg.qdrant != nil {
-			if err := reg.reindexQdrant(ctx); err != nil {
-				log.Printf("[Reg] Warning: Failed to reindex Qdrant: %v", err)
+			// Rebuild Qdrant index from restored registrations
+			if reg.qdrant != nil {
+				if err := reg.reindexQdrant(ctx); err != nil {
+					log.Printf("[Reg] Warning: Failed to reindex Qdrant: %v", err)
+				}
 			}
+		}()
+	}
+
+	peers := []string{}
+	if cfg.BootstrapAddr != "" {
+		peers = append(peers, cfg.BootstrapAddr)
+	}
+
+	// The rotation proof must be in place before either identity serves
+	// requests, since handlers read it unlocked.
+	if cfg.PreviousKey != nil {
+		if err := reg.startKeyRotation(ctx, cfg.PreviousKey, cfg.RotationUntil, cfg.PreviousPort, peers, cfg.DevMode, cfg.DHTPrefix); err != nil {
+			log.Fatalf("Key rotation failed: %v", err)
 		}
 	}
 
-	// Set Stream Handler for Registry Interactions
+	// Set Stream Handler for Registry Interactions (JSON by default, protobuf when negotiated)
 	h.SetStreamHandler(common.RegistryProtocolID, reg.handleStream)
+	h.SetStreamHandler(common.RegistryProtocolPB, reg.handleStream)
 
 	// Setup DHT to advertise "I AM THE REGISTRY"
-	peers := []string{}
-	if bootstrapAddr != "" {
-		peers = append(peers, bootstrapAddr)
-	}
 
-	kademliaDHT, err := common.SetupDHT(ctx, h, peers, devMode)
+	kademliaDHT, err := common.SetupDHT(ctx, h, peers, cfg.DevMode, cfg.DHTPrefix)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -221,13 +788,42 @@ func startRegistry(port int, apiPort int, bootstrapAddr string, devMode bool, mi
 	// Garbage Collection Loop (Remove dead providers)
 	go reg.gcLoop()
 
+	// Redis service set compaction (drop members whose registration expired)
+	if redisStorage != nil {
+		go reg.compactLoop(10 * time.Minute)
+	}
+
+	// Service history writes, kept off the request path
+	if redisStorage != nil && cfg.HistoryLen > 0 {
+		go reg.historyLoop()
+	}
+
+	// Anti-entropy between memory and persistent storage
+	if backend != "memory" && cfg.SyncInterval > 0 {
+		go reg.syncLoop(cfg.SyncInterval)
+	}
+
 	// Stake Unfreezer Loop (Unfreeze stakes after delay)
 	go reg.stakeUnfreezer()
 
+	// Replay failed Redis/Qdrant writes
+	go reg.retries.loop(15 * time.Second)
+
+	// Sample RPC rate for heartbeat hints
+	go reg.load.loop()
+
+	// Stake distribution gauges for /metrics
+	go reg.stakeMetricsLoop()
+
+	// Latency measurements for rank=score
+	if reg.prober != nil {
+		go reg.probeLoop()
+	}
+
 	// Start REST API server
 	go func() {
 		router := reg.setupRESTAPI()
-		apiPortStr := fmt.Sprintf(":%d", apiPort)
+		apiPortStr := fmt.Sprintf(":%d", cfg.APIPort)
 		fmt.Printf("[Reg] Starting REST API server on %s\n", apiPortStr)
 		if err := router.Run(apiPortStr); err != nil {
 			log.Printf("[Reg] REST API server error: %v\n", err)
@@ -237,25 +833,134 @@ func startRegistry(port int, apiPort int, bootstrapAddr string, devMode bool, mi
 	select {}
 }
 
-// gcLoop removes providers who haven't sent a heartbeat in 90 seconds.
+// now reads the registry's clock.
+func (r *RegistryNode) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
+
+// pruneAfter is how long a provider may stay silent before gcLoop prunes it:
+// one heartbeat window plus the configured grace windows.
+func (r *RegistryNode) pruneAfter() time.Duration {
+	return r.heartbeatTTL * time.Duration(r.heartbeatGrace+1)
+}
+
+// compactLoop periodically removes orphaned members from the Redis service sets.
+func (r *RegistryNode) compactLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := r.storage.CompactServiceSets(context.Background()); err != nil {
+			log.Printf("[Reg] Warning: Failed to compact Redis service sets: %v", err)
+		}
+	}
+}
+
+// syncLoop periodically reconciles persistent storage with the in-memory
+// registrations, repairing writes that were lost without an error.
+func (r *RegistryNode) syncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if r.restoring.Load() {
+			continue
+		}
+		saved, deleted, err := r.syncStorage(context.Background())
+		if err != nil {
+			log.Printf("[Reg] Warning: Storage sync failed: %v", err)
+			continue
+		}
+		if saved+deleted > 0 {
+			log.Printf("[Reg] Storage sync: %d corrections (%d re-saved, %d deleted)\n", saved+deleted, saved, deleted)
+		}
+	}
+}
+
+// syncStorage re-saves live registrations missing from storage and deletes
+// stored ones with no live registration. Storage is read before the live
+// snapshot, so a registration that changes in between is at worst written
+// again. The corrections are decided under r.mu and written after releasing
+// it; one made stale by a registration changing meanwhile is undone by the
+// next pass.
+func (r *RegistryNode) syncStorage(ctx context.Context) (saved, deleted int, err error) {
+	stored, err := r.regStore.RestoreAllRegistrations(ctx, r.pruneAfter())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type save struct {
+		pid    peer.ID
+		record *storage.RegistrationRecord
+		ttl    time.Duration
+	}
+	var saves []save
+	var deletes []peer.ID
+
+	r.mu.Lock()
+	for pid, record := range r.Registrations {
+		if _, ok := stored[pid]; !ok {
+			saves = append(saves, save{pid, r.convertToStorageRecord(record), r.storageTTL(record)})
+		}
+	}
+	for pid := range stored {
+		if _, ok := r.Registrations[pid]; !ok {
+			deletes = append(deletes, pid)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, s := range saves {
+		r.storeRegistration(s.pid, s.record, s.ttl)
+	}
+	for _, pid := range deletes {
+		r.deleteRegistration(pid, stored[pid].ServiceCard.Name)
+	}
+	return len(saves), len(deletes), nil
+}
+
+// gcLoop removes providers who have missed more consecutive heartbeat windows
+// than the configured grace allows, so a single dropped heartbeat doesn't
+// cause a healthy provider to flap out of the index.
 func (r *RegistryNode) gcLoop() {
 	ticker := time.NewTicker(10 * time.Second)
 	for range ticker.C {
-		r.mu.Lock()
-		now := time.Now()
-		for pid, record := range r.Registrations {
-			if now.Sub(record.LastSeen) > 90*time.Second {
-				log.Printf("[Reg] Pruning dead provider: %s (last seen %s)\n", pid.ShortString(), record.LastSeen.Format(time.RFC3339))
-				delete(r.Registrations, pid)
-				r.removeFromIndex(pid, record.ServiceCard.Name)
-
-				// Also delete from Redis if enabled
-				if err := r.storage.DeleteRegistration(context.Background(), pid, record.ServiceCard.Name); err != nil {
-					log.Printf("[Reg] Warning: Failed to delete registration from Redis: %v", err)
-				}
+		r.pruneDead()
+
+		now := r.now()
+		r.stakeBans.prune(now)
+		r.adminBans.prune(now)
+		r.popularity.prune(now)
+	}
+}
+
+// pruneDead is one gcLoop pass over the registrations, as of r.now(). A
+// provider is pruned once more than its grace of heartbeat windows have
+// fully elapsed since it was last seen.
+func (r *RegistryNode) pruneDead() {
+	var pruned []droppedRecord
+	r.mu.Lock()
+	defer func() {
+		r.mu.Unlock()
+		r.finishDrops(pruned)
+	}()
+
+	now := r.now()
+	for pid, record := range r.Registrations {
+		grace := r.effectiveGrace(record)
+		missed := int(now.Sub(record.LastSeen) / r.heartbeatTTL)
+		if missed > record.MissedHeartbeats {
+			record.MissedHeartbeats = missed
+			r.touchView()
+			if missed <= grace {
+				log.Printf("[Reg] Provider %s missed %d heartbeat(s), within grace of %d\n", pid.ShortString(), missed, grace)
 			}
 		}
-		r.mu.Unlock()
+		if record.MissedHeartbeats > grace {
+			log.Printf("[Reg] Pruning dead provider: %s (last seen %s, missed %d heartbeats)\n", pid.ShortString(), record.LastSeen.Format(time.RFC3339), record.MissedHeartbeats)
+			pruned = append(pruned, r.dropRegistration(pid, archiveReasonPruned))
+		}
 	}
 }
 
@@ -264,7 +969,7 @@ func (r *RegistryNode) stakeUnfreezer() {
 	ticker := time.NewTicker(5 * time.Minute)
 	for range ticker.C {
 		r.stakeMu.Lock()
-		now := time.Now().Unix()
+		now := r.now().Unix()
 
 		// Find stakes that can be unfrozen
 		newFreezedStakes := make([]freezedStake, 0)
@@ -352,6 +1057,40 @@ func (r *RegistryNode) removeFromIndex(pid peer.ID, serviceName string) {
 	r.ServiceIndex[serviceName] = newList
 }
 
+// saveRegistration persists a registration to Redis, queueing it for retry
+// on failure.
+func (r *RegistryNode) saveRegistration(pid peer.ID, record *RegistrationRecord) {
+	r.storeRegistration(pid, r.convertToStorageRecord(record), r.storageTTL(record))
+}
+
+// storeRegistration writes an already converted record, so callers can
+// snapshot under r.mu and write after releasing it.
+func (r *RegistryNode) storeRegistration(pid peer.ID, stored *storage.RegistrationRecord, ttl time.Duration) {
+	r.retries.do("redis:registration:"+pid.String(), "Redis save of registration "+pid.ShortString(), func() error {
+		return r.regStore.SaveRegistration(context.Background(), pid, stored, ttl)
+	})
+}
+
+// storageTTL is how long a saved record outlives its last save: the prune
+// window plus slack, extended by popularGrace windows for providers of
+// popular services and by highStakeTTL for providers staking at least
+// highStake that haven't missed a heartbeat.
+func (r *RegistryNode) storageTTL(record *RegistrationRecord) time.Duration {
+	ttl := r.heartbeatTTL*time.Duration(r.effectiveGrace(record)+1) + 30*time.Second
+	if r.highStake > 0 && record.Stake >= r.highStake && record.MissedHeartbeats == 0 {
+		ttl += r.highStakeTTL
+	}
+	return ttl
+}
+
+// deleteRegistration removes a registration from Redis, queueing it for
+// retry on failure. It supersedes any pending save for the same peer.
+func (r *RegistryNode) deleteRegistration(pid peer.ID, serviceName string) error {
+	return r.retries.do("redis:registration:"+pid.String(), "Redis delete of registration "+pid.ShortString(), func() error {
+		return r.regStore.DeleteRegistration(context.Background(), pid, serviceName)
+	})
+}
+
 // --- Storage conversion helpers ---
 
 // convertToStorageRecord converts main.RegistrationRecord to storage.RegistrationRecord
@@ -364,6 +1103,9 @@ func (r *RegistryNode) convertToStorageRecord(record *RegistrationRecord) *stora
 		ServiceCard: record.ServiceCard,
 		StakeProof:  record.StakeProof,
 		AddrInfo:    record.AddrInfo,
+		Extra:       record.Extra,
+
+		SuppliedEmbeddings: record.SuppliedEmbeddings,
 	}
 }
 
@@ -377,7 +1119,24 @@ func (r *RegistryNode) convertFromStorageRecord(record *storage.RegistrationReco
 		ServiceCard: record.ServiceCard,
 		StakeProof:  record.StakeProof,
 		AddrInfo:    record.AddrInfo,
+		Extra:       record.Extra,
+		Stake:       r.stakeValue(record.StakeProof),
+
+		SuppliedEmbeddings: record.SuppliedEmbeddings,
+	}
+}
+
+// stakeValue is a proof's amount in base units, or 0 when it has no proof
+// or an unknown denomination (e.g. one removed from -stake-denoms).
+func (r *RegistryNode) stakeValue(proof *common.StakeProof) float64 {
+	if proof == nil {
+		return 0
+	}
+	amount, err := r.stakeDenoms.normalize(proof)
+	if err != nil {
+		return 0
 	}
+	return amount
 }
 
 // convertToStorageFreezedStake converts main.freezedStake to storage.FreezedStake
@@ -425,60 +1184,104 @@ func convertFromStorageFreezedStakeSlice(sfsList []storage.FreezedStake) ([]free
 	return result, nil
 }
 
-// restoreStateFromRedis restores the registry state from Redis on startup.
-// It loads all registrations, rebuilds the ServiceIndex, and restores stake data.
-func (r *RegistryNode) restoreStateFromRedis(ctx context.Context) error {
-	if r.storage == nil {
+// restoreState restores the registry state on startup. It loads all
+// registrations from the registration store, rebuilds the ServiceIndex, and
+// restores stake data and the featured set from Redis when configured.
+//
+// Everything is read and converted without holding the registry locks; the
+// results are then merged in under a brief lock. Restore runs while the
+// registry is already serving, so entries that arrived live since startup
+// take precedence over their persisted copies.
+func (r *RegistryNode) restoreState(ctx context.Context) error {
+	if r.regStore == nil {
 		return nil
 	}
 
-	log.Println("[Reg] Restoring state from Redis...")
+	log.Println("[Reg] Restoring state from storage...")
 
-	// Load all registrations from Redis
-	storageRecords, err := r.storage.RestoreAllRegistrations(ctx)
+	// Load all registrations from storage
+	storageRecords, err := r.regStore.RestoreAllRegistrations(ctx, r.restoreMaxAge())
 	if err != nil {
 		return fmt.Errorf("failed to restore registrations: %v", err)
 	}
 
-	// Convert storage records to main records and rebuild the index
-	r.mu.Lock()
+	restored := make(map[peer.ID]*RegistrationRecord, len(storageRecords))
+	stale := make(map[peer.ID]*RegistrationRecord)
 	for pid, storageRecord := range storageRecords {
 		record := r.convertFromStorageRecord(storageRecord)
+		if r.now().Sub(record.LastSeen) > r.pruneAfter() {
+			// Only reachable with -archive-stale; see restoreMaxAge
+			stale[pid] = record
+			continue
+		}
+		restored[pid] = record
+	}
+
+	var featured []string
+	if r.storage != nil {
+		featured, err = r.storage.LoadFeatured(ctx)
+		if err != nil {
+			log.Printf("[Reg] Warning: Failed to restore featured services from Redis: %v", err)
+		}
+	}
+
+	// Swap the restored records in under a brief lock
+	r.mu.Lock()
+	for _, name := range featured {
+		r.featured[name] = true
+	}
+	r.touchView()
+	for pid, record := range restored {
+		if _, live := r.Registrations[pid]; live {
+			continue
+		}
 		r.Registrations[pid] = record
-		r.addToIndex(pid, record.ServiceCard.Name)
+		r.indexRecord(pid, record)
+	}
+	var dropped []droppedRecord
+	for pid, record := range stale {
+		if _, live := r.Registrations[pid]; live {
+			continue
+		}
+		dropped = append(dropped, droppedRecord{pid: pid, rec: record, reason: archiveReasonRestored})
+	}
+	if len(dropped) > 0 {
+		log.Printf("[Reg] Archived %d stale registrations found on restore", len(dropped))
+	}
+	evicted := r.evictForCapacity(0, "")
+	if len(evicted) > 0 {
+		log.Printf("[Reg] Evicted %d restored registrations over -max-registrations", len(evicted))
 	}
+	serviceCount := len(r.ServiceIndex)
 	r.mu.Unlock()
+	r.finishDrops(append(dropped, evicted...))
 
-	if len(storageRecords) > 0 {
-		log.Printf("[Reg] Restored %d active registrations", len(storageRecords))
-		serviceCount := len(r.ServiceIndex)
+	if len(restored) > 0 {
+		log.Printf("[Reg] Restored %d active registrations", len(restored))
 		if serviceCount > 0 {
 			log.Printf("[Reg] Services available: %d unique services", serviceCount)
 		}
 	} else {
-		log.Println("[Reg] No registrations found in Redis")
+		log.Println("[Reg] No registrations found in storage")
 	}
 
-	// Load stake data from Redis
-	r.stakeMu.Lock()
-	defer r.stakeMu.Unlock()
+	// Stake bookkeeping lives in Redis only
+	if r.storage == nil {
+		return nil
+	}
 
-	// Restore peerStakes
-	peerStakes, err := r.storage.RestoreAllPeerStakes(ctx)
-	if err != nil {
-		log.Printf("[Reg] Warning: Failed to restore peer stakes from Redis: %v", err)
-	} else {
-		r.peerStakes = peerStakes
-		log.Printf("[Reg] Restored stakes for %d peers", len(peerStakes))
+	if _, err := r.storage.CompactServiceSets(ctx); err != nil {
+		log.Printf("[Reg] Warning: Failed to compact Redis service sets: %v", err)
 	}
 
-	// Restore freezedPeerStakes
-	freezedPeerStakes, err := r.storage.RestoreAllFreezedPeerStakes(ctx)
-	if err != nil {
-		log.Printf("[Reg] Warning: Failed to restore freezed peer stakes from Redis: %v", err)
-	} else {
-		// Convert storage.FreezedStake to main.freezedStake
-		convertedFreezedPeerStakes := make(map[peer.ID][]freezedStake)
+	// Load stake data from Redis before taking the stake lock
+	peerStakes, peerStakesErr := r.storage.RestoreAllPeerStakes(ctx)
+	freezedPeerStakes, freezedPeerErr := r.storage.RestoreAllFreezedPeerStakes(ctx)
+	freezedStakes, freezedErr := r.storage.LoadFreezedStakes(ctx)
+
+	// Convert storage.FreezedStake to main.freezedStake
+	convertedFreezedPeerStakes := make(map[peer.ID][]freezedStake)
+	if freezedPeerErr == nil {
 		for pid, sfsList := range freezedPeerStakes {
 			fsList, err := convertFromStorageFreezedStakeSlice(sfsList)
 			if err != nil {
@@ -487,33 +1290,82 @@ func (r *RegistryNode) restoreStateFromRedis(ctx context.Context) error {
 			}
 			convertedFreezedPeerStakes[pid] = fsList
 		}
-		r.freezedPeerStakes = convertedFreezedPeerStakes
+	}
+	var convertedFreezedStakes []freezedStake
+	if freezedErr == nil {
+		convertedFreezedStakes, freezedErr = convertFromStorageFreezedStakeSlice(freezedStakes)
+	}
+
+	r.stakeMu.Lock()
+	defer r.stakeMu.Unlock()
+
+	// Restore peerStakes (union with anything recorded since startup)
+	if peerStakesErr != nil {
+		log.Printf("[Reg] Warning: Failed to restore peer stakes from Redis: %v", peerStakesErr)
+	} else {
+		for pid, stakes := range peerStakes {
+			r.peerStakes[pid] = mergeStakeKeys(stakes, r.peerStakes[pid])
+		}
+		log.Printf("[Reg] Restored stakes for %d peers", len(peerStakes))
+	}
+
+	// Restore freezedPeerStakes
+	if freezedPeerErr != nil {
+		log.Printf("[Reg] Warning: Failed to restore freezed peer stakes from Redis: %v", freezedPeerErr)
+	} else {
+		for pid, fsList := range convertedFreezedPeerStakes {
+			r.freezedPeerStakes[pid] = mergeFreezedStakes(fsList, r.freezedPeerStakes[pid])
+		}
 		log.Printf("[Reg] Restored freezed stakes for %d peers", len(convertedFreezedPeerStakes))
 	}
 
 	// Restore freezedStakes (global list)
-	freezedStakes, err := r.storage.LoadFreezedStakes(ctx)
-	if err != nil {
-		log.Printf("[Reg] Warning: Failed to restore global freezed stakes from Redis: %v", err)
+	if freezedErr != nil {
+		log.Printf("[Reg] Warning: Failed to restore global freezed stakes from Redis: %v", freezedErr)
 	} else {
-		fsList, err := convertFromStorageFreezedStakeSlice(freezedStakes)
-		if err != nil {
-			log.Printf("[Reg] Warning: Error converting global freezed stakes: %v", err)
-		} else {
-			r.freezedStakes = fsList
-			log.Printf("[Reg] Restored %d global freezed stakes", len(fsList))
-		}
+		r.freezedStakes = mergeFreezedStakes(convertedFreezedStakes, r.freezedStakes)
+		log.Printf("[Reg] Restored %d global freezed stakes", len(convertedFreezedStakes))
 	}
 
 	return nil
 }
 
+// mergeStakeKeys appends the keys of live that are not already in restored.
+func mergeStakeKeys(restored, live []string) []string {
+	seen := make(map[string]bool, len(restored))
+	for _, k := range restored {
+		seen[k] = true
+	}
+	for _, k := range live {
+		if !seen[k] {
+			restored = append(restored, k)
+		}
+	}
+	return restored
+}
+
+// mergeFreezedStakes appends the frozen stakes of live not already in restored.
+func mergeFreezedStakes(restored, live []freezedStake) []freezedStake {
+	seen := make(map[string]bool, len(restored))
+	for _, fs := range restored {
+		seen[fs.ID] = true
+	}
+	for _, fs := range live {
+		if !seen[fs.ID] {
+			restored = append(restored, fs)
+		}
+	}
+	return restored
+}
+
+// validateEmbedding checks vec against -embedding-dim, the dimension of
+// the Qdrant collection.
 func (r *RegistryNode) validateEmbedding(vec []float32) error {
 	if r.embeddingDim <= 0 {
 		return fmt.Errorf("registry embedding dim not configured")
 	}
 	if len(vec) != r.embeddingDim {
-		return fmt.Errorf("embedding length %d does not match required %d", len(vec), r.embeddingDim)
+		return fmt.Errorf("embedding has %d dimensions, registry expects %d (-embedding-dim)", len(vec), r.embeddingDim)
 	}
 	return nil
 }
@@ -537,38 +1389,84 @@ func (r *RegistryNode) reindexQdrant(ctx context.Context) error {
 	r.mu.Unlock()
 
 	for _, it := range entries {
-		if err := r.validateEmbedding(it.record.ServiceCard.Embedding); err != nil {
-			log.Printf("[Reg] Skipping Qdrant reindex for %s: %v\n", it.pid.ShortString(), err)
-			continue
-		}
+		for _, card := range it.record.cards() {
+			if err := r.validateEmbedding(card.Embedding); err != nil {
+				log.Printf("[Reg] Skipping Qdrant reindex for %s (%s): %v\n", it.pid.ShortString(), card.Name, err)
+				continue
+			}
 
-		payload := map[string]interface{}{
-			"service_name": it.record.ServiceCard.Name,
-			"peer_id":      it.pid.String(),
-			"description":  it.record.ServiceCard.Description,
-			"tags":         it.record.ServiceCard.Tags,
-			"version":      it.record.ServiceCard.Version,
-			"cost_per_op":  it.record.ServiceCard.CostPerOp,
-		}
-		pointID := fmt.Sprintf("%s:%s", it.pid.String(), it.record.ServiceCard.Name)
+			payload := r.qdrantPayload(it.pid, card)
+			pointID := fmt.Sprintf("%s:%s", it.pid.String(), card.Name)
 
-		if err := r.qdrant.UpsertService(pointID, it.record.ServiceCard.Embedding, payload); err != nil {
-			log.Printf("[Reg] Qdrant upsert failed for %s: %v\n", pointID, err)
+			if err := r.qdrant.UpsertService(pointID, card.Embedding, payload); err != nil {
+				log.Printf("[Reg] Qdrant upsert failed for %s: %v\n", pointID, err)
+			}
 		}
 	}
 
 	return nil
 }
 
-// checkStakeValidity verifies signature and amount, but DOES NOT check replay/nonce.
-// This is used for both new registrations and verifying stored heartbeats.
-func (r *RegistryNode) checkStakeValidity(remote peer.ID, proof *common.StakeProof) error {
-	if proof == nil {
-		return fmt.Errorf("stake proof required (min %.2f)", r.minStake)
+// qdrantPayload is the Qdrant payload stored alongside a provider's vector.
+// Only the first qdrantMaxTags tags are included; the card keeps them all.
+func (r *RegistryNode) qdrantPayload(pid peer.ID, card common.ServiceCard) map[string]interface{} {
+	tags := card.Tags
+	if r.qdrantMaxTags > 0 && len(tags) > r.qdrantMaxTags {
+		tags = tags[:r.qdrantMaxTags]
+	}
+	return map[string]interface{}{
+		"service_name": card.Name,
+		"peer_id":      pid.String(),
+		"description":  card.Description,
+		"tags":         tags,
+		"version":      card.Version,
+		"cost_per_op":  card.CostPerOp,
+		"region":       card.Region,
+		"metadata":     card.Metadata,
+		"rate_limit":   card.RateLimit,
 	}
+}
 
-	if proof.Amount < r.minStake {
-		return fmt.Errorf("stake too low: have %.2f need %.2f", proof.Amount, r.minStake)
+// checkProviderInfo rejects registrations that could never be discovered:
+// provider info is always required, and with -require-provider-addrs it
+// must list at least one address.
+func (r *RegistryNode) checkProviderInfo(info *peer.AddrInfo) error {
+	if info == nil {
+		return fmt.Errorf("provider address info required")
+	}
+	if r.requireAddrs && len(info.Addrs) == 0 {
+		return fmt.Errorf("provider address info has no addresses")
+	}
+	return nil
+}
+
+// checkStakeValidity verifies signature and amount, but DOES NOT check replay/nonce.
+// This is used for both new registrations and verifying stored heartbeats.
+func (r *RegistryNode) checkStakeValidity(remote peer.ID, proof *common.StakeProof) error {
+	if proof == nil {
+		return fmt.Errorf("stake proof required (min %.2f)", r.minStake)
+	}
+
+	if math.IsNaN(proof.Amount) || math.IsInf(proof.Amount, 0) {
+		return fmt.Errorf("stake amount is not a finite number")
+	}
+
+	if proof.Amount < 0 {
+		return fmt.Errorf("stake amount cannot be negative (got %.2f)", proof.Amount)
+	}
+
+	// Compare in base units so stakes in different denominations are comparable
+	amount, err := r.stakeDenoms.normalize(proof)
+	if err != nil {
+		return err
+	}
+
+	if r.maxStake > 0 && amount > r.maxStake {
+		return fmt.Errorf("stake too high: have %.2f max %.2f", amount, r.maxStake)
+	}
+
+	if amount < r.minStake {
+		return fmt.Errorf("stake too low: have %.2f need %.2f", amount, r.minStake)
 	}
 
 	if proof.Staker != "" && proof.Staker != remote.String() {
@@ -580,9 +1478,11 @@ func (r *RegistryNode) checkStakeValidity(remote peer.ID, proof *common.StakePro
 		return fmt.Errorf("missing pubkey for %s", remote.ShortString())
 	}
 
-	payload := fmt.Sprintf("%s|%f|%d|%d|%s", proof.TxHash, proof.Amount, proof.Nonce, proof.Timestamp, proof.ChainID)
-	digest := sha256.Sum256([]byte(payload))
-	if ok, err := pubKey.Verify(digest[:], proof.Signature); err != nil || !ok {
+	if err := common.CheckStakeAlgo(proof, pubKey); err != nil {
+		return err
+	}
+
+	if ok, err := common.VerifyStakeSignature(pubKey, proof); err != nil || !ok {
 		if err != nil {
 			return fmt.Errorf("stake signature verify failed: %v", err)
 		}
@@ -592,20 +1492,142 @@ func (r *RegistryNode) checkStakeValidity(remote peer.ID, proof *common.StakePro
 	return nil
 }
 
+// checkRegistrationRate enforces the global new-registration rate. With
+// Redis the window is shared by every registry using it; otherwise it is
+// process-local. A Redis failure falls back to the local window rather than
+// failing open. Over the limit it returns a retryLaterError timed to when the
+// window frees a slot.
+func (r *RegistryNode) checkRegistrationRate() error {
+	if r.maxRegsPerMin <= 0 {
+		return nil
+	}
+	throttled := func(wait time.Duration) error {
+		return &retryLaterError{
+			Reason: fmt.Sprintf("registration throttled: more than %d registrations per minute", r.maxRegsPerMin),
+			Wait:   wait,
+		}
+	}
+
+	if r.storage != nil {
+		ok, wait, err := r.storage.AllowInWindow(context.Background(), "registrations", r.maxRegsPerMin, time.Minute)
+		if err == nil {
+			if !ok {
+				return throttled(wait)
+			}
+			return nil
+		}
+		log.Printf("[Reg] Warning: Redis rate window failed, using local window: %v", err)
+	}
+
+	r.regLogMu.Lock()
+	defer r.regLogMu.Unlock()
+
+	now := r.now()
+	cutoff := now.Add(-time.Minute)
+	kept := r.localRegLog[:0]
+	for _, t := range r.localRegLog {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	r.localRegLog = kept
+	if len(r.localRegLog) >= r.maxRegsPerMin {
+		return throttled(r.localRegLog[0].Add(time.Minute).Sub(now))
+	}
+	r.localRegLog = append(r.localRegLog, now)
+	return nil
+}
+
+// checkStakerDiversity rejects a registration when the stake identity behind
+// it already backs maxPerStaker other providers of the same service.
+func (r *RegistryNode) checkStakerDiversity(remote peer.ID, serviceName string, proof *common.StakeProof) error {
+	if r.maxPerStaker <= 0 {
+		return nil
+	}
+	identity := common.StakeIdentity(proof)
+	if identity == "" {
+		identity = remote.String()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, pid := range r.ServiceIndex[serviceName] {
+		if pid == remote {
+			continue
+		}
+		reg, ok := r.Registrations[pid]
+		if !ok {
+			continue
+		}
+		other := common.StakeIdentity(reg.StakeProof)
+		if other == "" {
+			other = pid.String()
+		}
+		if other == identity {
+			count++
+		}
+	}
+
+	if count >= r.maxPerStaker {
+		return fmt.Errorf("stake owner %s already backs %d provider(s) for %s (max %d)", identity, count, serviceName, r.maxPerStaker)
+	}
+	return nil
+}
+
 func (r *RegistryNode) handleStream(stream network.Stream) {
 	defer stream.Close()
 	rw := bufio.NewReadWriter(bufio.NewReader(stream), bufio.NewWriter(stream))
+	codec := common.RegistryCodecFor(stream.Protocol())
+	remotePeer := stream.Conn().RemotePeer()
 
-	var req common.RegistryRequest
-	if err := json.NewDecoder(rw).Decode(&req); err != nil {
-		return
+	// A stream may carry several framed requests, up to maxStreamMessages;
+	// past the cap the request is refused and the client must reconnect.
+	// Pings keep an idle stream open without counting toward the cap.
+	for n := 0; ; n++ {
+		_ = stream.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+		var req common.RegistryRequest
+		if err := codec.ReadRequest(rw.Reader, &req); err != nil {
+			return
+		}
+
+		var resp common.RegistryResponse
+		if req.Method == common.RegistryMethodPing {
+			resp = common.RegistryResponse{Success: true, Pong: true}
+			n--
+		} else if r.maxStreamMessages > 0 && n >= r.maxStreamMessages {
+			resp.Error = fmt.Sprintf("stream message limit (%d) reached, open a new stream", r.maxStreamMessages)
+		} else {
+			start := time.Now()
+			resp = r.handleRequest(remotePeer, req)
+			rpcLatency.WithLabelValues(metricMethod(req.Method)).Observe(time.Since(start).Seconds())
+		}
+
+		if err := codec.WriteResponse(rw, &resp); err != nil {
+			return
+		}
+		if err := rw.Flush(); err != nil {
+			return
+		}
+		if r.maxStreamMessages > 0 && n >= r.maxStreamMessages {
+			return
+		}
 	}
+}
 
+// handleRequest executes one registry RPC on behalf of remotePeer.
+func (r *RegistryNode) handleRequest(remotePeer peer.ID, req common.RegistryRequest) common.RegistryResponse {
 	resp := common.RegistryResponse{Success: false}
-	remotePeer := stream.Conn().RemotePeer()
+	r.load.observe()
 
 	switch req.Method {
 	case "register":
+		if err := r.checkBlocked(remotePeer); err != nil {
+			rejectCall(&resp, err)
+			break
+		}
+
 		// Decide whether this is a new registration or a heartbeat
 		r.mu.Lock()
 		existing, isRegistered := r.Registrations[remotePeer]
@@ -619,31 +1641,108 @@ func (r *RegistryNode) handleStream(stream network.Stream) {
 
 		if isHeartbeat {
 			// Heartbeat: update LastSeen and optionally AddrInfo
+			var stored *storage.RegistrationRecord
+			var ttl time.Duration
 			r.mu.Lock()
-			if entry, ok := r.Registrations[remotePeer]; ok {
-				entry.LastSeen = time.Now()
+			if entry, ok := r.Registrations[remotePeer]; ok && r.now().Sub(entry.LastSeen) < r.minHeartbeat {
+				// Too soon after the last one: acknowledge it so the provider
+				// doesn't retry, but leave the record and storage alone
+				resp.Success = true
+			} else if ok {
+				entry.LastSeen = r.now()
+				entry.MissedHeartbeats = 0
 				if req.ProviderInfo != nil {
 					entry.AddrInfo = *req.ProviderInfo
 				}
+				// ?sort=last_seen orders the listings by it
+				r.touchView()
 				log.Printf("[Reg] Heartbeat received: %s\n", remotePeer.ShortString())
 				resp.Success = true
 
-				// Save to Redis if enabled
-				storageRecord := r.convertToStorageRecord(entry)
-				if err := r.storage.SaveRegistration(context.Background(), remotePeer, storageRecord); err != nil {
-					log.Printf("[Reg] Warning: Failed to save heartbeat to Redis: %v", err)
-				}
+				// Save to Redis if enabled, once r.mu is released
+				stored, ttl = r.convertToStorageRecord(entry), r.storageTTL(entry)
 			}
 			r.mu.Unlock()
+			if stored != nil {
+				r.storeRegistration(remotePeer, stored, ttl)
+			}
 		} else {
-			// New registration or stake changed
+			// New registration or stake changed. Reject unreachable providers
+			// before the throttle and stake checks consume anything.
+			if err := r.checkProviderInfo(req.ProviderInfo); err != nil {
+				resp.Error = err.Error()
+				log.Printf("[Reg] Rejected registration from %s: %v\n", remotePeer.ShortString(), err)
+				break
+			}
+			if err := checkMetadata(req.Card.Metadata); err != nil {
+				resp.Error = err.Error()
+				log.Printf("[Reg] Rejected registration from %s: %v\n", remotePeer.ShortString(), err)
+				break
+			}
+			if err := checkRateLimit(req.Card); err != nil {
+				resp.Error = err.Error()
+				log.Printf("[Reg] Rejected registration from %s: %v\n", remotePeer.ShortString(), err)
+				break
+			}
+			if err := checkVisibility(req.Card); err != nil {
+				resp.Error = err.Error()
+				log.Printf("[Reg] Rejected registration from %s: %v\n", remotePeer.ShortString(), err)
+				break
+			}
+
+			if err := r.checkRegistrationRate(); err != nil {
+				rejectCall(&resp, err)
+				log.Printf("[Reg] Throttled registration from %s\n", remotePeer.ShortString())
+				break
+			}
+
 			if err := r.checkStakeValidity(remotePeer, req.StakeProof); err != nil {
 				resp.Error = err.Error()
 				log.Printf("[Reg] Stake Invalid: %v\n", err)
+				r.stakeFailure(remotePeer)
+				break
+			}
+
+			// Sybil protection: cap how many peers one stake owner runs per service
+			if err := r.checkStakerDiversity(remotePeer, req.Card.Name, req.StakeProof); err != nil {
+				resp.Error = err.Error()
+				log.Printf("[Reg] Diversity check failed: %v\n", err)
 				break
 			}
 
-			// Replay protection: check if this stake is already used by this peer
+			var embedding []float32
+			var supplied []string // The card, if it brings its own vector
+			if len(req.Card.Embedding) > 0 {
+				// Checked with or without Qdrant: a stored vector of the
+				// wrong length would otherwise only fail at reindex
+				if err := r.validateEmbedding(req.Card.Embedding); err != nil {
+					resp.Error = fmt.Sprintf("invalid embedding for %s: %v", req.Card.Name, err)
+					log.Printf("[Reg] Rejected embedding from %s: %v\n", remotePeer.ShortString(), err)
+					break
+				}
+				supplied = []string{req.Card.Name}
+			}
+			if r.qdrant != nil {
+				// Cards without their own vector are embedded by the registry
+				if len(req.Card.Embedding) == 0 && r.embedder != nil {
+					vec, err := r.embedCard(context.Background(), req.Card)
+					if err != nil {
+						resp.Error = fmt.Sprintf("failed to embed service card: %v", err)
+						log.Printf("[Reg] Embedding failed: %v\n", err)
+						break
+					}
+					req.Card.Embedding = vec
+				}
+				if err := r.validateEmbedding(req.Card.Embedding); err != nil {
+					resp.Error = fmt.Sprintf("invalid embedding: %v", err)
+					log.Printf("[Reg] Embedding invalid: %v\n", err)
+					break
+				}
+				embedding = req.Card.Embedding
+			}
+
+			// Replay protection, once the card has passed every check: a rejected
+			// registration must not burn the stake
 			key := fmt.Sprintf("%s|%d", req.StakeProof.TxHash, req.StakeProof.Nonce)
 			r.stakeMu.Lock()
 			stakes := r.peerStakes[remotePeer]
@@ -658,6 +1757,7 @@ func (r *RegistryNode) handleStream(stream network.Stream) {
 				r.stakeMu.Unlock()
 				resp.Error = "stake proof already used (replay detected)"
 				log.Printf("[Reg] Replay Attack: %s\n", resp.Error)
+				r.stakeFailure(remotePeer)
 				break
 			}
 			r.peerStakes[remotePeer] = append(stakes, key)
@@ -669,81 +1769,196 @@ func (r *RegistryNode) handleStream(stream network.Stream) {
 
 			r.stakeMu.Unlock()
 
-			var embedding []float32
-			if r.qdrant != nil {
-				if err := r.validateEmbedding(req.Card.Embedding); err != nil {
-					resp.Error = fmt.Sprintf("invalid embedding: %v", err)
-					log.Printf("[Reg] Embedding invalid: %v\n", err)
-					break
-				}
-				embedding = req.Card.Embedding
-			}
-
+			var evicted []droppedRecord
+			var stored *storage.RegistrationRecord
+			var ttl time.Duration
 			r.mu.Lock()
 
-			// Remove old index entry if service name changed
-			if isRegistered && existing.ServiceCard.Name != req.Card.Name {
-				r.removeFromIndex(remotePeer, existing.ServiceCard.Name)
-			}
-
 			if req.ProviderInfo != nil {
 				newRecord := &RegistrationRecord{
-					LastSeen:    time.Now(),
+					LastSeen:    r.now(),
 					ServiceCard: req.Card,
 					StakeProof:  req.StakeProof,
 					AddrInfo:    *req.ProviderInfo,
+					Stake:       r.stakeValue(req.StakeProof),
+
+					SuppliedEmbeddings: supplied,
+				}
+				// Replaces everything the peer had registered, including a
+				// gateway's batch
+				old, ok := r.Registrations[remotePeer]
+				if ok {
+					r.unindexRecord(remotePeer, old)
+				} else {
+					evicted = r.evictForCapacity(1, remotePeer)
 				}
 				r.Registrations[remotePeer] = newRecord
-				r.addToIndex(remotePeer, req.Card.Name)
+				r.indexRecord(remotePeer, newRecord)
+				r.recordHistory(remotePeer, old, newRecord, "")
 
-				// Save to Redis if enabled
-				storageRecord := r.convertToStorageRecord(newRecord)
-				if err := r.storage.SaveRegistration(context.Background(), remotePeer, storageRecord); err != nil {
-					log.Printf("[Reg] Warning: Failed to save registration to Redis: %v", err)
-				}
-			}
+				// Save to Redis if enabled, once r.mu is released
+				stored, ttl = r.convertToStorageRecord(newRecord), r.storageTTL(newRecord)
 
-			log.Printf("[Reg] New Registration: %s (Service: %s)\n", remotePeer.ShortString(), req.Card.Name)
-			resp.Success = true
+				log.Printf("[Reg] New Registration: %s (Service: %s)\n", remotePeer.ShortString(), req.Card.Name)
+				resp.Success = true
+				r.stakeBans.reset(remotePeer)
+			} else {
+				// Only reachable if checkProviderInfo is bypassed; never report
+				// success for a registration that created no record.
+				resp.Error = "provider address info required"
+			}
 
 			r.mu.Unlock()
+			if stored != nil {
+				r.storeRegistration(remotePeer, stored, ttl)
+			}
+			r.finishDrops(evicted)
 
 			// Optional: index in Qdrant for semantic search
-			if r.qdrant != nil && len(embedding) > 0 {
-				payload := map[string]interface{}{
-					"service_name": req.Card.Name,
-					"peer_id":      remotePeer.String(),
-					"description":  req.Card.Description,
-					"tags":         req.Card.Tags,
-					"version":      req.Card.Version,
-					"cost_per_op":  req.Card.CostPerOp,
-				}
+			if resp.Success && r.qdrant != nil && len(embedding) > 0 {
+				payload := r.qdrantPayload(remotePeer, req.Card)
 				pointID := fmt.Sprintf("%s:%s", remotePeer.String(), req.Card.Name)
-				if err := r.qdrant.UpsertService(pointID, embedding, payload); err != nil {
-					log.Printf("[Reg] Qdrant upsert error: %v\n", err)
-				}
+				r.retries.do("qdrant:"+pointID, "Qdrant upsert of "+pointID, func() error {
+					return r.qdrant.UpsertService(pointID, embedding, payload)
+				})
 			}
 		}
 
+		if resp.Success {
+			r.mu.Lock()
+			providers := len(r.Registrations)
+			r.mu.Unlock()
+			resp.HeartbeatInterval = int(r.heartbeatHint(providers) / time.Second)
+		}
+
+	case "register_batch":
+		if err := r.checkBlocked(remotePeer); err != nil {
+			rejectCall(&resp, err)
+			break
+		}
+		resp = r.registerBatch(remotePeer, req)
+		if !resp.Success {
+			log.Printf("[Reg] Batch registration from %s rejected: %s\n", remotePeer.ShortString(), resp.Error)
+		}
+
 	case "find":
+		if err := r.checkQueryLength(req.Query); err != nil {
+			resp.Error = err.Error()
+			break
+		}
+		after, err := decodeFindToken(req.PageToken, req.Query)
+		if err != nil {
+			resp.Error = err.Error()
+			break
+		}
+
+		if req.MaxAge < 0 {
+			resp.Error = "invalid max_age"
+			break
+		}
+		if req.Federate && r.federation.seenBefore(req.QueryID) {
+			// Looped back through a federation cycle: answered already
+			resp.Success = true
+			log.Printf("[Reg] Dropped looped federated query %s\n", req.QueryID)
+			break
+		}
+		filter := providerFilter{
+			MaxAge:  time.Duration(req.MaxAge) * time.Second,
+			Access:  accessCreds{Peer: remotePeer, Token: req.Token},
+			Exclude: req.Exclude,
+			now:     r.now(),
+		}
+
 		r.mu.Lock()
-		results := []peer.AddrInfo{}
-		query := strings.ToLower(req.Query)
+		records := []*RegistrationRecord{}
+		query := r.matchText(req.Query)
+		// A batch provider indexed under several matching names is
+		// returned once
+		added := make(map[peer.ID]bool)
 
 		for name, peerIDs := range r.ServiceIndex {
-			if strings.Contains(strings.ToLower(name), query) {
+			if strings.Contains(r.matchText(name), query) {
+				hit := false
 				for _, pid := range peerIDs {
-					if reg, ok := r.Registrations[pid]; ok {
-						results = append(results, reg.AddrInfo)
+					if reg, ok := r.Registrations[pid]; ok && filter.match(reg, name) {
+						if !added[pid] {
+							added[pid] = true
+							records = append(records, reg)
+						}
+						hit = true
 					}
 				}
+				if hit {
+					r.popularity.hit(name, r.now())
+				}
 			}
 		}
-		resp.Providers = results
+
+		r.rankRecords(req.Rank, records)
+		results := make([]peer.AddrInfo, 0, len(records))
+		for _, reg := range records {
+			results = append(results, reg.AddrInfo)
+		}
+		r.mu.Unlock()
+
+		resp.Matched = len(results)
+		if fwd, ok := r.federation.forward(req); ok {
+			// Federated results aren't paginated: local matches first, then
+			// peer registries' providers, cut to Limit.
+			remote := r.federation.query(context.Background(), fwd, remotePeer)
+			resp.Providers, resp.Origins, resp.Matched = mergeFederated(r.Host.ID(), results, remote, req.Limit)
+		} else if rankedMode(req.Rank) {
+			if req.Limit > 0 && len(results) > req.Limit {
+				results = results[:req.Limit]
+			}
+			resp.Providers = results
+		} else {
+			resp.Providers, resp.NextToken = paginateProviders(results, req.Query, after, req.Limit)
+		}
+		if req.RequireMatch && resp.Matched == 0 {
+			resp.Error = common.NoMatch
+			break
+		}
 		resp.Success = true
-		log.Printf("[Reg] Served query '%s' -> %d providers\n", req.Query, len(results))
+		r.attest(req.Query, &resp)
+		log.Printf("[Reg] Served query '%s' -> %d providers\n", req.Query, len(resp.Providers))
+
+	case "find_best":
+		// Query is an exact service name; the configured ranking picks one
+		// provider. No match is a successful, empty response unless
+		// RequireMatch is set.
+		if err := r.checkQueryLength(req.Query); err != nil {
+			resp.Error = err.Error()
+			break
+		}
+		if req.MaxAge < 0 {
+			resp.Error = "invalid max_age"
+			break
+		}
+		filter := providerFilter{
+			MaxAge:  time.Duration(req.MaxAge) * time.Second,
+			Access:  accessCreds{Peer: remotePeer, Token: req.Token},
+			Exclude: req.Exclude,
+			now:     r.now(),
+		}
+
+		r.mu.Lock()
+		best, card, matched := r.bestProvider(req.Query, filter)
+		if best != nil {
+			resp.Providers = []peer.AddrInfo{best.AddrInfo}
+			resp.Card = &card
+			r.popularity.hit(card.Name, r.now())
+		}
 		r.mu.Unlock()
 
+		resp.Matched = matched
+		if req.RequireMatch && matched == 0 {
+			resp.Error = common.NoMatch
+			break
+		}
+		resp.Success = true
+		r.attest(req.Query, &resp)
+
 	case "unregister":
 		if req.StakeProof == nil {
 			resp.Error = "stake proof required for unregister"
@@ -751,37 +1966,65 @@ func (r *RegistryNode) handleStream(stream network.Stream) {
 			break
 		}
 
+		if req.ProviderInfo != nil && req.ProviderInfo.ID != remotePeer {
+			// Only the stream's own peer is ever removed; say so rather
+			// than silently unregistering the caller
+			resp.Error = "a provider can only unregister itself"
+			log.Printf("[Reg] Unregister failed: %s asked to remove %s\n", remotePeer.ShortString(), req.ProviderInfo.ID.ShortString())
+			break
+		}
+
 		// Get the stake key from the provided StakeProof
 		stakeKey := fmt.Sprintf("%s|%d", req.StakeProof.TxHash, req.StakeProof.Nonce)
 
+		// Check the stake before touching anything
 		r.stakeMu.Lock()
-
-		// Find and remove the stake from peerStakes
 		stakes, exists := r.peerStakes[remotePeer]
+		r.stakeMu.Unlock()
 		if !exists {
-			r.stakeMu.Unlock()
 			resp.Error = "no stakes found for peer"
 			log.Printf("[Reg] Unregister failed: no stakes for %s\n", remotePeer.ShortString())
 			break
 		}
+		if !slices.Contains(stakes, stakeKey) {
+			resp.Error = "stake not found for this peer"
+			log.Printf("[Reg] Unregister failed: stake %s not found for %s\n", stakeKey, remotePeer.ShortString())
+			break
+		}
 
-		// Check if the stake exists and remove it from peerStakes
-		found := false
-		newStakes := make([]string, 0, len(stakes))
-		for _, existingKey := range stakes {
-			if existingKey == stakeKey {
-				found = true
-			} else {
-				newStakes = append(newStakes, existingKey)
+		// Clean the backing stores first, without holding r.mu. If one
+		// can't be reached nothing else changes so the provider can retry;
+		// the failed deletes stay queued in the meantime.
+		r.mu.Lock()
+		registration, registered := r.Registrations[remotePeer]
+		r.mu.Unlock()
+		if registered {
+			if err := r.purgeStores(remotePeer, registration); err != nil {
+				resp.Error = fmt.Sprintf("failed to remove registration: %v", err)
+				log.Printf("[Reg] Unregister of %s failed: %v\n", remotePeer.ShortString(), err)
+				break
 			}
+
+			r.mu.Lock()
+			if r.Registrations[remotePeer] == registration {
+				delete(r.Registrations, remotePeer)
+				r.unindexRecord(remotePeer, registration)
+				r.recordHistory(remotePeer, registration, nil, historyReasonUnregistered)
+			}
+			r.mu.Unlock()
+			log.Printf("[Reg] Removed service %s for peer %s\n", registration.ServiceCard.Name, remotePeer.ShortString())
 		}
 
-		if !found {
+		// Take the stake; a concurrent unregister may have got there first
+		r.stakeMu.Lock()
+		stakes = r.peerStakes[remotePeer]
+		if !slices.Contains(stakes, stakeKey) {
 			r.stakeMu.Unlock()
 			resp.Error = "stake not found for this peer"
-			log.Printf("[Reg] Unregister failed: stake %s not found for %s\n", stakeKey, remotePeer.ShortString())
+			log.Printf("[Reg] Unregister failed: stake %s already taken for %s\n", stakeKey, remotePeer.ShortString())
 			break
 		}
+		newStakes := slices.DeleteFunc(slices.Clone(stakes), func(k string) bool { return k == stakeKey })
 
 		// Update peerStakes (or delete if no stakes left)
 		if len(newStakes) == 0 {
@@ -799,7 +2042,7 @@ func (r *RegistryNode) handleStream(stream network.Stream) {
 		}
 
 		// Create frozen stake
-		now := time.Now().Unix()
+		now := r.now().Unix()
 		frozen := freezedStake{
 			ID:        stakeKey,
 			PeerID:    remotePeer,
@@ -824,44 +2067,102 @@ func (r *RegistryNode) handleStream(stream network.Stream) {
 
 		r.stakeMu.Unlock()
 
-		// Remove service from registrations and index
-		r.mu.Lock()
-		if registration, exists := r.Registrations[remotePeer]; exists {
-			serviceName := registration.ServiceCard.Name
+		resp.Success = true
+		log.Printf("[Reg] Unregistered stake %s for %s: frozen until %s\n",
+			stakeKey, remotePeer.ShortString(), time.Unix(now+UNFREEZE_DELAY, 0).Format(time.RFC3339))
 
-			// Remove from the service index
-			r.removeFromIndex(remotePeer, serviceName)
+	case "find_by_capability":
+		if len(req.Inputs) == 0 && len(req.Outputs) == 0 {
+			resp.Error = "find_by_capability requires inputs or outputs"
+			break
+		}
 
-			// Remove from registrations
-			delete(r.Registrations, remotePeer)
+		access := accessCreds{Peer: remotePeer, Token: req.Token}
 
-			// Remove from Redis storage
-			if err := r.storage.DeleteRegistration(context.Background(), remotePeer, serviceName); err != nil {
-				log.Printf("[Reg] Warning: Failed to delete registration from Redis: %v", err)
+		r.mu.Lock()
+		results := []peer.AddrInfo{}
+		for _, pid := range r.capabilities.match(req.Inputs, req.Outputs) {
+			reg, ok := r.Registrations[pid]
+			if !ok {
+				continue
 			}
-
-			// Remove from Qdrant if enabled
-			if r.qdrant != nil {
-				pointID := fmt.Sprintf("%s:%s", remotePeer.String(), serviceName)
-				if err := r.qdrant.RemoveService(pointID); err != nil {
-					log.Printf("[Reg] Warning: Qdrant remove error: %v\n", err)
+			for _, card := range reg.cards() {
+				if declaresAll(card, req.Inputs, req.Outputs) && access.canSee(card) {
+					results = append(results, reg.AddrInfo)
+					break
 				}
 			}
-
-			log.Printf("[Reg] Removed service %s for peer %s\n", serviceName, remotePeer.ShortString())
 		}
 		r.mu.Unlock()
 
+		if req.Limit > 0 && len(results) > req.Limit {
+			results = results[:req.Limit]
+		}
+		resp.Providers = results
 		resp.Success = true
-		log.Printf("[Reg] Unregistered stake %s for %s: frozen until %s\n",
-			stakeKey, remotePeer.ShortString(), time.Unix(now+UNFREEZE_DELAY, 0).Format(time.RFC3339))
+
+	case common.RegistryMethodAdminChallenge:
+		resp = r.adminChallenge(remotePeer)
+
+	case common.RegistryMethodAdmin:
+		resp = r.adminCommand(remotePeer, req.Admin)
 
 	default:
 		resp.Error = "Unknown method"
 	}
 
-	_ = json.NewEncoder(rw).Encode(resp)
-	_ = rw.Flush()
+	return resp
+}
+
+// findToken is the decoded form of a find continuation token.
+type findToken struct {
+	Query string `json:"q"`
+	After string `json:"after"`
+}
+
+// decodeFindToken returns the peer ID string after which the next page starts.
+// Tokens are bound to the query that produced them.
+func decodeFindToken(token, query string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("invalid page token")
+	}
+	var t findToken
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return "", fmt.Errorf("invalid page token")
+	}
+	if t.Query != query {
+		return "", fmt.Errorf("page token does not match query")
+	}
+	return t.After, nil
+}
+
+// paginateProviders orders providers by peer ID and returns the page that
+// starts after the given peer ID. Keying the cursor on the peer ID (rather
+// than an offset) keeps pages stable while providers join or leave: a
+// provider that disappears is simply skipped, and none is returned twice.
+func paginateProviders(providers []peer.AddrInfo, query, after string, limit int) ([]peer.AddrInfo, string) {
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].ID.String() < providers[j].ID.String()
+	})
+
+	start := 0
+	if after != "" {
+		start = sort.Search(len(providers), func(i int) bool {
+			return providers[i].ID.String() > after
+		})
+	}
+	page := providers[start:]
+
+	if limit <= 0 || len(page) <= limit {
+		return page, ""
+	}
+	page = page[:limit]
+	raw, _ := json.Marshal(findToken{Query: query, After: page[len(page)-1].ID.String()})
+	return page, base64.RawURLEncoding.EncodeToString(raw)
 }
 
 // setupRESTAPI configures the Gin router with read-only endpoints for Services
@@ -872,18 +2173,22 @@ func (r *RegistryNode) setupRESTAPI() *gin.Engine {
 	// Enable CORS for frontend
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000", "http://127.0.0.1:5173"},
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", accessTokenHeader},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", gatewayProviderHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "restoring": r.restoring.Load()})
 	})
 
-	api := router.Group("/api/v1")
+	// Prometheus metrics
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Shed load past -max-concurrent-requests with a retry hint
+	api := router.Group("/api/v1", limitConcurrency(r.maxConcurrent))
 	{
 		api.GET("/services", r.getAllServices)
 		api.GET("/services_full", r.getAllServicesFull)
@@ -891,142 +2196,705 @@ func (r *RegistryNode) setupRESTAPI() *gin.Engine {
 		// GET services by name (query parameter)
 		api.GET("/services/search", r.searchServices)
 
+		// GET every provider as streamed NDJSON
+		api.GET("/services/export.ndjson", r.exportServices)
+
+		// GET services by declared inputs/outputs
+		api.GET("/services/by_capability", r.servicesByCapability)
+
+		// GET a random sample of services, for discovery
+		api.GET("/services/random", r.getRandomServices)
+
+		// GET service and provider counts
+		api.GET("/services/count", r.countServices)
+
 		// GET specific service by exact name
 		api.GET("/services/:name", r.getServiceByName)
 
+		// GET per-provider detail for one service
+		api.GET("/services/:name/providers", r.getServiceProviders)
+
+		// GET the single top-ranked provider of a service
+		api.GET("/services/:name/best", r.getBestProvider)
+
+		// GET a service's provider registration history
+		api.GET("/services/:name/history", r.getServiceHistory)
+
+		// GET how to call a service, for clients without libp2p
+		api.GET("/services/:name/manifest", r.getServiceManifest)
+
+		// POST an execution call, relayed to a provider (-gateway)
+		api.POST("/services/:name/call", r.callService)
+
 		// GET semantic search (optional; Qdrant-backed)
 		api.GET("/services/semantic_search", r.semanticSearchServices)
 
-		// GET registry info (Peer ID and multiaddr)
-		api.GET("/registry/info", r.getRegistryInfo)
+		// GET one provider by peer ID
+		api.GET("/providers/:peerid", r.getProvider)
+
+		// GET registry info (Peer ID and multiaddr)
+		api.GET("/registry/info", r.getRegistryInfo)
+	}
+
+	admin := api.Group("/admin", r.requireAdmin)
+	{
+		admin.GET("/featured", r.listFeatured)
+		admin.PUT("/featured/:name", r.setFeatured)
+		admin.DELETE("/featured/:name", r.setFeatured)
+		admin.POST("/reindex", r.adminReindex)
+		admin.GET("/archive", r.listArchived)
+		admin.POST("/deregister_staker/:staker", r.deregisterStaker)
+	}
+
+	return router
+}
+
+// getAllServices returns a page of the registered services visible to the caller
+// and their providers, flattened into one list in ?sort= order.
+// GET /api/v1/services?limit=50&offset=0
+func (r *RegistryNode) getAllServices(c *gin.Context) {
+	access := restAccess(c)
+	page, err := r.parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := parseSort(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r.writeView(c, func() gin.H {
+		all := make(map[string][]*RegistrationRecord)
+		names := []string{}
+		for _, reg := range r.Registrations {
+			for _, card := range reg.cards() {
+				if !access.canSee(card) {
+					continue
+				}
+				name := card.Name
+				if _, ok := all[name]; !ok {
+					names = append(names, name)
+				}
+				all[name] = append(all[name], reg)
+			}
+		}
+
+		names, next := page.slice(names)
+		flat := flatten(names, all)
+		order.apply(flat)
+		view := make(map[string][]peer.AddrInfo, len(names))
+		for _, e := range flat {
+			view[e.service] = append(view[e.service], e.rec.AddrInfo)
+		}
+		resp := gin.H{
+			"services":    view,
+			"providers":   r.flatProviders(flat),
+			"count":       len(view),
+			"total":       len(all),
+			"next_offset": next,
+		}
+		r.annotateFeatured(c, names, resp)
+		return resp
+	})
+}
+
+// getAllServicesFull returns all services with their ServiceCard and providers.
+// ?max_cost= leaves out providers charging more per op, and services left
+// with none. Providers are in ?sort= order; the card is the first one's.
+// GET /api/v1/services_full?limit=50&offset=0
+func (r *RegistryNode) getAllServicesFull(c *gin.Context) {
+	access := restAccess(c)
+	page, err := r.parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	maxCost, err := parseMaxCost(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := parseSort(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r.writeView(c, func() gin.H {
+		all := make(map[string][]*RegistrationRecord)
+		for _, reg := range r.Registrations {
+			for _, card := range reg.cards() {
+				if !access.canSee(card) || !withinCost(card, maxCost) {
+					continue
+				}
+				all[card.Name] = append(all[card.Name], reg)
+			}
+		}
+
+		names := make([]string, 0, len(all))
+		for name := range all {
+			names = append(names, name)
+		}
+
+		names, next := page.slice(names)
+		flat := flatten(names, all)
+		order.apply(flat)
+		sorted := group(flat)
+		view := make(map[string]gin.H, len(names))
+		for _, name := range names {
+			records := sorted[name]
+			card, _ := records[0].card(name)
+			providers := make([]peer.AddrInfo, 0, len(records))
+			for _, reg := range records {
+				providers = append(providers, reg.AddrInfo)
+			}
+			view[name] = gin.H{
+				"card":      card,
+				"featured":  r.featured[name],
+				"providers": providers,
+			}
+		}
+		resp := gin.H{
+			"services":    view,
+			"providers":   r.flatProviders(flat),
+			"count":       len(view),
+			"total":       len(all),
+			"next_offset": next,
+		}
+		r.annotateFeatured(c, names, resp)
+		return resp
+	})
+}
+
+// countServices returns how many services and providers the caller can see,
+// without building the listing. ?by_tag=true adds the number of services
+// carrying each tag (lowercased).
+// GET /api/v1/services/count
+func (r *RegistryNode) countServices(c *gin.Context) {
+	access := restAccess(c)
+	byTag := c.Query("by_tag") == "true"
+
+	r.mu.Lock()
+	services := make(map[string]bool)
+	tags := make(map[string]map[string]bool) // Tag -> services carrying it
+	providers := 0
+	for _, reg := range r.Registrations {
+		visible := false
+		for _, card := range reg.cards() {
+			if !access.canSee(card) {
+				continue
+			}
+			visible = true
+			services[card.Name] = true
+			if !byTag {
+				continue
+			}
+			for _, tag := range card.Tags {
+				tag = strings.ToLower(tag)
+				if tags[tag] == nil {
+					tags[tag] = make(map[string]bool)
+				}
+				tags[tag][card.Name] = true
+			}
+		}
+		if visible {
+			providers++
+		}
+	}
+	r.mu.Unlock()
+
+	resp := gin.H{
+		"services":  len(services),
+		"providers": providers,
+	}
+	if byTag {
+		counts := make(map[string]int, len(tags))
+		for tag, names := range tags {
+			counts[tag] = len(names)
+		}
+		resp["by_tag"] = counts
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// searchServices searches for services by name (partial match).
+// An optional ?region= restricts results to providers advertising that region,
+// and ?tag= (repeatable) to providers whose card carries every tag; with a
+// tag, q may be left out.
+func (r *RegistryNode) searchServices(c *gin.Context) {
+	query := c.Query("q")
+	if err := r.checkQueryLength(query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := r.parseProviderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Without q, search is a pure tag filter
+	if query == "" && len(filter.Tags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "query parameter 'q' or 'tag' is required",
+		})
+		return
+	}
+	rank := c.Query("rank")
+	order, err := parseSort(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rank != "" && c.Query("sort") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rank and sort can't be combined"})
+		return
+	}
+	demote := c.Query("demote_stale") == "true"
+
+	// Ask peer registries before taking the lock. find needs a query, so
+	// a tag-only search stays local.
+	var remote []federatedProvider
+	if c.Query("federate") == "true" && query != "" {
+		fwd, ok := r.federation.forward(common.RegistryRequest{
+			Method:   "find",
+			Query:    query,
+			Rank:     rank,
+			MaxAge:   int(math.Ceil(filter.MaxAge.Seconds())),
+			Federate: true,
+			Token:    filter.Access.Token,
+			Exclude:  filter.Exclude,
+		})
+		if ok {
+			remote = r.federation.query(c.Request.Context(), fwd, "")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matched := make(map[string][]*RegistrationRecord)
+	queryLower := r.matchText(query)
+
+	for name, peerIDs := range r.ServiceIndex {
+		if strings.Contains(r.matchText(name), queryLower) {
+			for _, pid := range peerIDs {
+				if reg, ok := r.Registrations[pid]; ok {
+					if !filter.match(reg, name) {
+						continue
+					}
+					matched[name] = append(matched[name], reg)
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(matched))
+	for name := range matched {
+		names = append(names, name)
+	}
+	flat := flatten(names, matched)
+	order.apply(flat)
+	if rank == "" {
+		matched = group(flat)
+	} else {
+		r.rankFlat(rank, flat)
+	}
+
+	results := make(map[string][]listedProvider, len(matched))
+	explain := c.Query("explain") == "true"
+	explained := make(map[string]gin.H)
+	for _, name := range names {
+		records := matched[name]
+		if rank != "" {
+			r.rankRecords(rank, records)
+		}
+		if demote {
+			r.demoteStale(records)
+		}
+		for _, reg := range records {
+			results[name] = append(results[name], r.listedProvider(reg))
+		}
+		if explain {
+			matches := []termMatch{}
+			if query != "" {
+				matches = append(matches, termMatch{Term: queryLower, Field: "name", Position: strings.Index(r.matchText(name), queryLower)})
+			}
+			explained[name] = gin.H{
+				"matches":   matches,
+				"providers": r.explainRanking(rank, records),
+			}
+		}
+	}
+
+	resp := gin.H{
+		"query":     query,
+		"region":    filter.Region,
+		"services":  results,
+		"providers": r.flatProviders(flat),
+		"count":     len(results),
+	}
+	if len(filter.Tags) > 0 {
+		resp["tags"] = filter.Tags
+	}
+	if explain {
+		resp["explain"] = gin.H{
+			"rank":     rank,
+			"weights":  r.rankWeightsView(rank),
+			"services": explained,
+		}
+	}
+	if remote != nil {
+		// Peer registries return bare providers, so they're listed apart
+		// from the per-service map, minus any already found here.
+		local := make(map[peer.ID]bool)
+		for _, infos := range results {
+			for _, info := range infos {
+				local[info.ID] = true
+			}
+		}
+		federated := make([]federatedProvider, 0, len(remote))
+		for _, fp := range remote {
+			if !local[fp.Provider.ID] {
+				local[fp.Provider.ID] = true
+				federated = append(federated, fp)
+			}
+		}
+		resp["federated"] = federated
+	}
+	r.annotateFeatured(c, names, resp)
+	c.JSON(http.StatusOK, resp)
+}
+
+// servicesByCapability finds services declaring every requested input and
+// output, e.g. ?input=prompt&output=image. Params may repeat or be
+// comma-separated.
+func (r *RegistryNode) servicesByCapability(c *gin.Context) {
+	inputs := splitQueryList(c.QueryArray("input"))
+	outputs := splitQueryList(c.QueryArray("output"))
+	if len(inputs) == 0 && len(outputs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "at least one input or output parameter is required",
+		})
+		return
 	}
 
-	return router
-}
+	access := restAccess(c)
 
-// getAllServices returns all registered services
-func (r *RegistryNode) getAllServices(c *gin.Context) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	view := make(map[string][]peer.AddrInfo)
-	for _, reg := range r.Registrations {
-		name := reg.ServiceCard.Name
-		view[name] = append(view[name], reg.AddrInfo)
+	results := make(map[string][]peer.AddrInfo)
+	for _, pid := range r.capabilities.match(inputs, outputs) {
+		reg, ok := r.Registrations[pid]
+		if !ok {
+			continue
+		}
+		for _, card := range reg.cards() {
+			if declaresAll(card, inputs, outputs) && access.canSee(card) {
+				results[card.Name] = append(results[card.Name], reg.AddrInfo)
+			}
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"services": view,
-		"count":    len(view),
+		"inputs":   inputs,
+		"outputs":  outputs,
+		"services": results,
+		"count":    len(results),
 	})
 }
 
-// getAllServicesFull returns all services with their ServiceCard and providers.
-func (r *RegistryNode) getAllServicesFull(c *gin.Context) {
+// splitQueryList flattens repeated and comma-separated query values.
+func splitQueryList(values []string) []string {
+	out := []string{}
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// matchesRegion reports whether a card belongs to the requested region.
+// An empty region matches every card.
+func matchesRegion(card common.ServiceCard, region string) bool {
+	if region == "" {
+		return true
+	}
+	return strings.EqualFold(card.Region, region)
+}
+
+// Reasons given with a 404 for a service that has no matching provider.
+const (
+	reasonUnknownService  = "unknown_service"   // Never registered since the registry started
+	reasonNoLiveProviders = "no_live_providers" // Registered, but no live provider passes the filters
+)
+
+// serviceNotFound answers a 404 for a service with no matching provider.
+// known is whether the service is in r.ServiceIndex, which keeps a name
+// after its last provider is gone.
+func serviceNotFound(c *gin.Context, serviceName string, known bool) {
+	if !known {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  fmt.Sprintf("service '%s' not found", serviceName),
+			"reason": reasonUnknownService,
+		})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"error":  fmt.Sprintf("service '%s' has no live providers matching the request", serviceName),
+		"reason": reasonNoLiveProviders,
+	})
+}
+
+// getServiceByName returns providers for a specific service name, with when
+// each was last seen.
+// An optional ?prefer_region= moves providers in that region to the front
+// while keeping the relative order of the rest.
+func (r *RegistryNode) getServiceByName(c *gin.Context) {
+	serviceName := c.Param("name")
+	preferRegion := c.Query("prefer_region")
+	rank := c.Query("rank")
+	filter, err := r.parseProviderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	view := make(map[string]gin.H)
-	for _, reg := range r.Registrations {
-		name := reg.ServiceCard.Name
-		entry, ok := view[name]
-		if !ok {
-			entry = gin.H{
-				"card":      reg.ServiceCard,
-				"providers": []peer.AddrInfo{},
+	records := []*RegistrationRecord{}
+	if peerIDs, ok := r.ServiceIndex[serviceName]; ok {
+		for _, pid := range peerIDs {
+			if reg, ok := r.Registrations[pid]; ok && filter.match(reg, serviceName) {
+				records = append(records, reg)
 			}
 		}
-		providers := entry["providers"].([]peer.AddrInfo)
-		providers = append(providers, reg.AddrInfo)
-		entry["providers"] = providers
-		view[name] = entry
+	}
+
+	r.rankRecords(rank, records)
+	if preferRegion != "" {
+		inRegion := func(rec *RegistrationRecord) bool {
+			card, _ := rec.card(serviceName)
+			return matchesRegion(card, preferRegion)
+		}
+		sort.SliceStable(records, func(i, j int) bool {
+			return inRegion(records[i]) && !inRegion(records[j])
+		})
+	}
+
+	providers := make([]listedProvider, 0, len(records))
+	for _, reg := range records {
+		providers = append(providers, r.listedProvider(reg))
+	}
+
+	if len(providers) == 0 {
+		_, known := r.ServiceIndex[serviceName]
+		serviceNotFound(c, serviceName, known)
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"services": view,
-		"count":    len(view),
+		"service":   serviceName,
+		"featured":  r.featured[serviceName],
+		"providers": providers,
+		"count":     len(providers),
 	})
 }
 
-// searchServices searches for services by name (partial match)
-func (r *RegistryNode) searchServices(c *gin.Context) {
-	query := c.Query("q")
-	if query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "query parameter 'q' is required",
-		})
+// getBestProvider returns the top-ranked provider of a service (under the
+// configured rank weights) and its card. Provider filters apply.
+func (r *RegistryNode) getBestProvider(c *gin.Context) {
+	serviceName := c.Param("name")
+	filter, err := r.parseProviderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	results := make(map[string][]peer.AddrInfo)
-	queryLower := strings.ToLower(query)
-
-	for name, peerIDs := range r.ServiceIndex {
-		if strings.Contains(strings.ToLower(name), queryLower) {
-			for _, pid := range peerIDs {
-				if reg, ok := r.Registrations[pid]; ok {
-					results[name] = append(results[name], reg.AddrInfo)
-				}
-			}
-		}
+	best, card, _ := r.bestProvider(serviceName, filter)
+	if best == nil {
+		_, known := r.ServiceIndex[serviceName]
+		serviceNotFound(c, serviceName, known)
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"query":    query,
-		"services": results,
-		"count":    len(results),
+		"service":  serviceName,
+		"provider": best.AddrInfo,
+		"card":     card,
 	})
 }
 
-// getServiceByName returns providers for a specific service name
-func (r *RegistryNode) getServiceByName(c *gin.Context) {
+// stakeView is the public part of a stake proof; the signature is omitted.
+type stakeView struct {
+	TxHash           string  `json:"tx_hash"`
+	Staker           string  `json:"staker"`
+	Owner            string  `json:"owner,omitempty"`
+	Amount           float64 `json:"amount"`
+	Denom            string  `json:"denom,omitempty"`
+	NormalizedAmount float64 `json:"normalized_amount"` // Amount in the registry's base unit
+	ChainID          string  `json:"chain_id"`
+	Timestamp        int64   `json:"timestamp"`
+}
+
+// listedProvider is a provider entry of /services/:name and search: the
+// peer.AddrInfo fields as before, plus when it was last seen.
+type listedProvider struct {
+	ID               peer.ID  `json:"ID"`
+	Addrs            []string `json:"Addrs"`
+	LastSeen         string   `json:"last_seen"` // RFC3339
+	SecondsSinceSeen int64    `json:"seconds_since_seen"`
+}
+
+func (r *RegistryNode) listedProvider(rec *RegistrationRecord) listedProvider {
+	p := listedProvider{
+		ID:               rec.AddrInfo.ID,
+		Addrs:            make([]string, 0, len(rec.AddrInfo.Addrs)),
+		LastSeen:         rec.LastSeen.UTC().Format(time.RFC3339),
+		SecondsSinceSeen: max(0, int64(r.now().Sub(rec.LastSeen)/time.Second)),
+	}
+	for _, addr := range rec.AddrInfo.Addrs {
+		p.Addrs = append(p.Addrs, addr.String())
+	}
+	return p
+}
+
+// providerDetail is one row of a provider comparison for a service.
+type providerDetail struct {
+	PeerID           string             `json:"peer_id"`
+	AddrInfo         peer.AddrInfo      `json:"addr_info"`
+	Card             common.ServiceCard `json:"card"`
+	LastSeen         time.Time          `json:"last_seen"`
+	Stake            *stakeView         `json:"stake,omitempty"`
+	LatencyMs        float64            `json:"latency_ms,omitempty"` // omitted until measured
+	MissedHeartbeats int                `json:"missed_heartbeats"`
+	Reputation       float64            `json:"reputation"` // 1/(1+missed heartbeats), as in ranking
+}
+
+func newProviderDetail(pid peer.ID, rec *RegistrationRecord, serviceName string) providerDetail {
+	card, _ := rec.card(serviceName)
+	d := providerDetail{
+		PeerID:           pid.String(),
+		AddrInfo:         rec.AddrInfo,
+		Card:             card,
+		LastSeen:         rec.LastSeen,
+		MissedHeartbeats: rec.MissedHeartbeats,
+		Reputation:       1 / float64(1+rec.MissedHeartbeats),
+	}
+	d.Card.Embedding = nil
+	if rec.Latency > 0 {
+		d.LatencyMs = float64(rec.Latency) / float64(time.Millisecond)
+	}
+	if p := rec.StakeProof; p != nil {
+		d.Stake = &stakeView{
+			TxHash:           p.TxHash,
+			Staker:           p.Staker,
+			Owner:            p.Owner,
+			Amount:           p.Amount,
+			Denom:            p.Denom,
+			NormalizedAmount: rec.Stake,
+			ChainID:          p.ChainID,
+			Timestamp:        p.Timestamp,
+		}
+	}
+	return d
+}
+
+// getServiceProviders returns full per-provider detail for one service,
+// for rendering a provider comparison. Accepts the same provider filters
+// and ?rank=score as getServiceByName.
+// GET /api/v1/services/:name/providers
+func (r *RegistryNode) getServiceProviders(c *gin.Context) {
 	serviceName := c.Param("name")
+	filter, err := r.parseProviderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	providers := []peer.AddrInfo{}
-	if peerIDs, ok := r.ServiceIndex[serviceName]; ok {
-		for _, pid := range peerIDs {
-			if reg, ok := r.Registrations[pid]; ok {
-				providers = append(providers, reg.AddrInfo)
-			}
+	records := []*RegistrationRecord{}
+	ids := map[*RegistrationRecord]peer.ID{}
+	for _, pid := range r.ServiceIndex[serviceName] {
+		if reg, ok := r.Registrations[pid]; ok && filter.match(reg, serviceName) {
+			records = append(records, reg)
+			ids[reg] = pid
 		}
 	}
 
-	if len(providers) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": fmt.Sprintf("service '%s' not found", serviceName),
-		})
+	if len(records) == 0 {
+		_, known := r.ServiceIndex[serviceName]
+		serviceNotFound(c, serviceName, known)
 		return
 	}
 
+	r.rankRecords(c.Query("rank"), records)
+
+	providers := make([]providerDetail, 0, len(records))
+	for _, reg := range records {
+		providers = append(providers, newProviderDetail(ids[reg], reg, serviceName))
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"service":   serviceName,
+		"featured":  r.featured[serviceName],
 		"providers": providers,
 		"count":     len(providers),
 	})
 }
 
-// semanticSearchServices exposes a Qdrant-backed semantic search endpoint.
-// GET /api/v1/services/semantic_search?q=...&k=5
-func (r *RegistryNode) semanticSearchServices(c *gin.Context) {
-	if r.qdrant == nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "semantic search is not enabled (no Qdrant configured)",
-		})
+// getProvider returns the detail of one registered provider: its first
+// card visible to the caller, addresses, last heartbeat and public stake,
+// plus every visible card under "services" (a gateway registered with
+// "register_batch" has several). 404 when the peer isn't registered or
+// has nothing the caller may see.
+// GET /api/v1/providers/:peerid
+func (r *RegistryNode) getProvider(c *gin.Context) {
+	pid, err := peer.Decode(c.Param("peerid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid peer id %q", c.Param("peerid"))})
 		return
 	}
-	if r.embedder == nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "semantic search is not configured with an embedder (set embedding API key/model)",
-		})
-		return
+	access := restAccess(c)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var services []common.ServiceCard
+	if rec, ok := r.Registrations[pid]; ok {
+		for _, card := range rec.cards() {
+			if access.canSee(card) {
+				card.Embedding = nil
+				services = append(services, card)
+			}
+		}
+		if len(services) > 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"provider": newProviderDetail(pid, rec, services[0].Name),
+				"services": services,
+			})
+			return
+		}
 	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": fmt.Sprintf("provider '%s' not registered", pid),
+	})
+}
 
+// semanticSearchServices exposes a Qdrant-backed semantic search endpoint.
+// GET /api/v1/services/semantic_search?q=...&k=5
+func (r *RegistryNode) semanticSearchServices(c *gin.Context) {
 	query := c.Query("q")
 	if strings.TrimSpace(query) == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -1034,14 +2902,45 @@ func (r *RegistryNode) semanticSearchServices(c *gin.Context) {
 		})
 		return
 	}
+	if err := r.checkQueryLength(query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	kStr := c.DefaultQuery("k", "5")
 	k, err := strconv.Atoi(kStr)
 	if err != nil || k <= 0 {
 		k = 5
 	}
+	access := restAccess(c)
+	arity, err := parseArityFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	explain := c.Query("explain") == "true"
+	demote := c.Query("demote_stale") == "true"
+
+	// Without Qdrant (disabled, or unreachable at startup) degrade to a
+	// keyword match over the live registrations.
+	if r.qdrant == nil || r.embedder == nil {
+		r.mu.Lock()
+		apiResults := r.keywordSearch(query, k, access, arity, explain, demote)
+		if c.Query("featured_first") == "true" {
+			sortFeaturedFirst(apiResults)
+		}
+		r.mu.Unlock()
+
+		c.JSON(http.StatusOK, gin.H{
+			"query":   query,
+			"mode":    "keyword",
+			"results": apiResults,
+			"count":   len(apiResults),
+		})
+		return
+	}
 
-	vector, err := r.embedder.EmbedText(c.Request.Context(), query)
+	vector, err := r.embedder.EmbedText(c.Request.Context(), r.embeddingInput(query))
 	if err != nil {
 		log.Printf("[Reg] Embed error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1050,7 +2949,9 @@ func (r *RegistryNode) semanticSearchServices(c *gin.Context) {
 		return
 	}
 
-	results, err := r.qdrant.Search(vector, k)
+	// Over-fetch so fresh hits just below the cut can be promoted and
+	// stale ones dropped without coming up short
+	results, err := r.qdrant.Search(vector, 2*k)
 	if err != nil {
 		log.Printf("[Reg] Qdrant search error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1062,14 +2963,7 @@ func (r *RegistryNode) semanticSearchServices(c *gin.Context) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	type apiResult struct {
-		ServiceName string             `json:"service_name"`
-		Score       float64            `json:"score"`
-		Card        common.ServiceCard `json:"card"`
-		Providers   []peer.AddrInfo    `json:"providers"`
-	}
-
-	apiResults := make([]apiResult, 0, len(results))
+	apiResults := make([]searchResult, 0, len(results))
 
 	for _, hit := range results {
 		payload := hit.Payload
@@ -1085,25 +2979,123 @@ func (r *RegistryNode) semanticSearchServices(c *gin.Context) {
 		}
 
 		reg, ok := r.Registrations[pid]
-		if !ok || reg.ServiceCard.Name != serviceName {
+		if !ok {
+			continue
+		}
+		card, ok := reg.card(serviceName)
+		if !ok || !access.canSee(card) || !arity.matches(card) {
+			continue
+		}
+		fresh, ok := r.freshness(reg)
+		if !ok && !demote {
 			continue
 		}
+		relevance := r.qdrant.similarity(hit.Score)
 
-		apiResults = append(apiResults, apiResult{
+		result := searchResult{
 			ServiceName: serviceName,
-			Score:       hit.Score,
-			Card:        reg.ServiceCard,
+			Score:       r.demotedScore(reg, r.searchScore(relevance, fresh), demote),
+			Relevance:   relevance,
+			Freshness:   fresh,
+			Card:        card,
+			Featured:    r.featured[serviceName],
 			Providers:   []peer.AddrInfo{reg.AddrInfo},
-		})
+		}
+		if explain {
+			result.Explain = r.explainSearch(reg, card, query, relevance, fresh)
+			result.Explain.VectorScore = &hit.Score
+		}
+		apiResults = append(apiResults, result)
+	}
+
+	sortSearchResults(apiResults)
+	if len(apiResults) > k {
+		apiResults = apiResults[:k]
+	}
+
+	if c.Query("featured_first") == "true" {
+		sortFeaturedFirst(apiResults)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"query":   query,
+		"mode":    "semantic",
 		"results": apiResults,
 		"count":   len(apiResults),
 	})
 }
 
+// searchResult is one provider hit of semanticSearchServices. Score is the
+// Relevance (vector similarity or keyword fraction) blended with Freshness.
+type searchResult struct {
+	ServiceName string             `json:"service_name"`
+	Score       float64            `json:"score"`
+	Relevance   float64            `json:"relevance"`
+	Freshness   float64            `json:"freshness"`
+	Card        common.ServiceCard `json:"card"`
+	Featured    bool               `json:"featured"`
+	Providers   []peer.AddrInfo    `json:"providers"`
+	Explain     *searchExplain     `json:"explain,omitempty"` // With ?explain=true
+}
+
+func sortFeaturedFirst(results []searchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Featured && !results[j].Featured
+	})
+}
+
+// keywordSearch is the fallback for semantic search when Qdrant is not
+// available: providers score by the fraction of query words found in their
+// card's name, description and tags, blended with freshness as semantic hits
+// are. Returns the best k the caller may see that pass arity, explained when
+// asked, and with demote, stale providers demoted rather than left out.
+// Callers must hold r.mu.
+func (r *RegistryNode) keywordSearch(query string, k int, access accessCreds, arity arityFilter, explain, demote bool) []searchResult {
+	words := strings.Fields(r.matchText(query))
+	results := []searchResult{}
+	for _, reg := range r.Registrations {
+		fresh, ok := r.freshness(reg)
+		if !ok && !demote {
+			continue
+		}
+		for _, card := range reg.cards() {
+			if !access.canSee(card) || !arity.matches(card) {
+				continue
+			}
+			text := r.matchText(card.Name + " " + card.Description + " " + strings.Join(card.Tags, " "))
+			matched := 0
+			for _, w := range words {
+				if strings.Contains(text, w) {
+					matched++
+				}
+			}
+			if matched == 0 {
+				continue
+			}
+			relevance := float64(matched) / float64(len(words))
+			result := searchResult{
+				ServiceName: card.Name,
+				Score:       r.demotedScore(reg, r.searchScore(relevance, fresh), demote),
+				Relevance:   relevance,
+				Freshness:   fresh,
+				Card:        card,
+				Featured:    r.featured[card.Name],
+				Providers:   []peer.AddrInfo{reg.AddrInfo},
+			}
+			if explain {
+				result.Explain = r.explainSearch(reg, card, query, relevance, fresh)
+			}
+			results = append(results, result)
+		}
+	}
+
+	sortSearchResults(results)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
 // getRegistryInfo returns the registry's Peer ID and multiaddrs
 // GET /api/v1/registry/info
 func (r *RegistryNode) getRegistryInfo(c *gin.Context) {
@@ -1132,11 +3124,23 @@ func (r *RegistryNode) getRegistryInfo(c *gin.Context) {
 		bootstrapAddr = addrs[0]
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	info := gin.H{
 		"peer_id":    r.Host.ID().String(),
 		"multiaddrs": addrs,
 		"bootstrap":  bootstrapAddr,
-	})
+	}
+	// During a key rotation also advertise the previous identity, so
+	// clients can still reach and verify the registry under the old ID.
+	if rot := r.rotation; rot.active(r.now()) {
+		prevAddrs := make([]string, 0, len(rot.host.Addrs()))
+		for _, addr := range rot.host.Addrs() {
+			prevAddrs = append(prevAddrs, fmt.Sprintf("%s/p2p/%s", addr, rot.host.ID()))
+		}
+		info["previous_peer_id"] = rot.host.ID().String()
+		info["previous_multiaddrs"] = prevAddrs
+		info["rotation_expires"] = time.Unix(rot.proof.Expires, 0).UTC().Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, info)
 }
 
 // --- Embedding client (OpenAI-compatible) ---
@@ -1226,19 +3230,42 @@ func (ec *EmbeddingClient) EmbedText(ctx context.Context, text string) ([]float3
 type QdrantClient struct {
 	BaseURL    string
 	Collection string
+	Distance   string // Qdrant metric name: "Cosine", "Dot" or "Euclid"
+	Shards     int    // shard_number for a newly created collection
+	Replicas   int    // replication_factor for a newly created collection
 	HTTP       *http.Client
 	VectorSize int
+
+	writes chan struct{} // Semaphore bounding concurrent writes (nil = unbounded)
 }
 
-func NewQdrantClient(baseURL, collection string) *QdrantClient {
-	return &QdrantClient{
+// NewQdrantClient creates a client allowing at most maxWrites concurrent
+// upserts/deletes; further writes queue until a slot frees (0 = unbounded).
+// distance is the collection's metric, as returned by parseQdrantDistance.
+func NewQdrantClient(baseURL, collection, distance string, maxWrites int) *QdrantClient {
+	qc := &QdrantClient{
 		BaseURL:    strings.TrimRight(baseURL, "/"),
 		Collection: collection,
+		Distance:   distance,
 		HTTP:       &http.Client{Timeout: 5 * time.Second},
 	}
+	if maxWrites > 0 {
+		qc.writes = make(chan struct{}, maxWrites)
+	}
+	return qc
 }
 
-// ensureCollection creates the collection if it does not exist yet.
+// acquireWrite blocks until a write slot is free and returns its release.
+func (qc *QdrantClient) acquireWrite() func() {
+	if qc.writes == nil {
+		return func() {}
+	}
+	qc.writes <- struct{}{}
+	return func() { <-qc.writes }
+}
+
+// ensureCollection creates the collection if it does not exist yet. Shards
+// and Replicas only apply on creation; an existing collection keeps its own.
 func (qc *QdrantClient) ensureCollection(dim int) error {
 	if qc == nil {
 		return nil
@@ -1250,9 +3277,15 @@ func (qc *QdrantClient) ensureCollection(dim int) error {
 	body := map[string]interface{}{
 		"vectors": map[string]interface{}{
 			"size":     dim,
-			"distance": "Cosine",
+			"distance": qc.Distance,
 		},
 	}
+	if qc.Shards > 0 {
+		body["shard_number"] = qc.Shards
+	}
+	if qc.Replicas > 0 {
+		body["replication_factor"] = qc.Replicas
+	}
 
 	b, _ := json.Marshal(body)
 	url := fmt.Sprintf("%s/collections/%s", qc.BaseURL, qc.Collection)
@@ -1275,34 +3308,128 @@ func (qc *QdrantClient) ensureCollection(dim int) error {
 		return fmt.Errorf("qdrant create collection failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
 	}
 
+	// An existing collection keeps the metric it was created with
+	if resp.StatusCode == http.StatusConflict {
+		existing, err := qc.collectionDistance()
+		if err != nil {
+			return err
+		}
+		if existing != qc.Distance {
+			return fmt.Errorf("%w: collection %s uses %s, -qdrant-distance is %s", errQdrantDistance, qc.Collection, existing, qc.Distance)
+		}
+	}
+
 	qc.VectorSize = dim
 	return nil
 }
 
+// errQdrantDistance reports an existing collection created with a different
+// metric than -qdrant-distance; its scores would not mean what we expect.
+var errQdrantDistance = errors.New("qdrant distance mismatch")
+
+// qdrantDistances maps accepted -qdrant-distance values (lowercased) to
+// Qdrant's metric names.
+var qdrantDistances = map[string]string{
+	"cosine":    "Cosine",
+	"dot":       "Dot",
+	"euclid":    "Euclid",
+	"euclidean": "Euclid",
+}
+
+// parseQdrantDistance validates a -qdrant-distance value, case-insensitively.
+func parseQdrantDistance(s string) (string, error) {
+	d, ok := qdrantDistances[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return "", fmt.Errorf("unknown distance %q (want Cosine, Dot or Euclid)", s)
+	}
+	return d, nil
+}
+
+// collectionDistance reads the metric of the existing collection.
+func (qc *QdrantClient) collectionDistance() (string, error) {
+	url := fmt.Sprintf("%s/collections/%s", qc.BaseURL, qc.Collection)
+	resp, err := qc.HTTP.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("qdrant get collection failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var info struct {
+		Result struct {
+			Config struct {
+				Params struct {
+					Vectors struct {
+						Distance string `json:"distance"`
+					} `json:"vectors"`
+				} `json:"params"`
+			} `json:"config"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("qdrant get collection: %v", err)
+	}
+	return info.Result.Config.Params.Vectors.Distance, nil
+}
+
+// similarity maps a search hit's score to "higher is more similar". Qdrant
+// returns the raw distance for Euclid, so it becomes 1/(1+distance).
+func (qc *QdrantClient) similarity(score float64) float64 {
+	if qc.Distance == "Euclid" {
+		return 1 / (1 + score)
+	}
+	return score
+}
+
 // UpsertService stores or updates a single service vector in Qdrant.
 func (qc *QdrantClient) UpsertService(id string, vector []float32, payload map[string]interface{}) error {
+	if len(vector) == 0 {
+		return nil
+	}
+	return qc.UpsertServices([]qdrantPoint{{ID: id, Vector: vector, Payload: payload}})
+}
+
+// qdrantPoint is one service vector for a batched upsert.
+type qdrantPoint struct {
+	ID      string
+	Vector  []float32
+	Payload map[string]interface{}
+}
+
+// UpsertServices stores or updates several service vectors in one request.
+// All vectors must share the collection's dimension.
+func (qc *QdrantClient) UpsertServices(points []qdrantPoint) error {
 	if qc == nil {
 		return nil
 	}
-	if len(vector) == 0 {
+	if len(points) == 0 {
 		return nil
 	}
-	if err := qc.ensureCollection(len(vector)); err != nil {
+
+	release := qc.acquireWrite()
+	defer release()
+
+	if err := qc.ensureCollection(len(points[0].Vector)); err != nil {
 		return err
 	}
 
-	// Qdrant in this config expects numeric or UUID IDs.
-	// We hash the provided string into a uint64 for demo purposes.
-	numID := hashToUint64(id)
+	batch := make([]map[string]interface{}, 0, len(points))
+	for _, p := range points {
+		// Qdrant in this config expects numeric or UUID IDs.
+		// We hash the provided string into a uint64 for demo purposes.
+		batch = append(batch, map[string]interface{}{
+			"id":      hashToUint64(p.ID),
+			"vector":  p.Vector,
+			"payload": limitPayload(p.ID, p.Payload),
+		})
+	}
 
 	body := map[string]interface{}{
-		"points": []map[string]interface{}{
-			{
-				"id":      numID,
-				"vector":  vector,
-				"payload": payload,
-			},
-		},
+		"points": batch,
 	}
 
 	b, _ := json.Marshal(body)
@@ -1328,6 +3455,80 @@ func (qc *QdrantClient) UpsertService(id string, vector []float32, payload map[s
 	return nil
 }
 
+// Qdrant payload limits. Cards are user-supplied, so a huge description or
+// tag list must not push the upsert past Qdrant's request-size limit.
+const (
+	qdrantMaxStringField = 4 << 10  // bytes per string value
+	qdrantMaxListItems   = 64       // entries per list value
+	qdrantMaxPayload     = 64 << 10 // bytes for the encoded payload
+)
+
+// qdrantEssentialFields are never dropped from a payload: search results
+// are resolved back to live registrations through them.
+var qdrantEssentialFields = map[string]bool{"service_name": true, "peer_id": true}
+
+// limitPayload returns a copy of payload that fits the Qdrant limits:
+// long strings are truncated, long lists are cut, and if the payload is
+// still too large the non-essential fields are dropped (largest first).
+// Every change is logged against the point id.
+func limitPayload(id string, payload map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		switch val := v.(type) {
+		case string:
+			if len(val) > qdrantMaxStringField {
+				log.Printf("[Reg] Qdrant payload for %s: truncated %q from %d bytes\n", id, k, len(val))
+				val = truncateUTF8(val, qdrantMaxStringField)
+			}
+			out[k] = val
+		case []string:
+			if len(val) > qdrantMaxListItems {
+				log.Printf("[Reg] Qdrant payload for %s: cut %q from %d to %d items\n", id, k, len(val), qdrantMaxListItems)
+				val = val[:qdrantMaxListItems]
+			}
+			items := make([]string, len(val))
+			for i, item := range val {
+				items[i] = truncateUTF8(item, qdrantMaxStringField)
+			}
+			out[k] = items
+		default:
+			out[k] = v
+		}
+	}
+
+	for {
+		b, err := json.Marshal(out)
+		if err != nil || len(b) <= qdrantMaxPayload {
+			return out
+		}
+		largest, size := "", 0
+		for k, v := range out {
+			if qdrantEssentialFields[k] {
+				continue
+			}
+			if vb, _ := json.Marshal(v); len(vb) > size {
+				largest, size = k, len(vb)
+			}
+		}
+		if largest == "" {
+			return out
+		}
+		log.Printf("[Reg] Qdrant payload for %s: dropped %q (%d bytes) to fit %d byte limit\n", id, largest, size, qdrantMaxPayload)
+		delete(out, largest)
+	}
+}
+
+// truncateUTF8 cuts s to at most max bytes without splitting a rune.
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
 // hashToUint64 deterministically maps a string to a uint64.
 func hashToUint64(s string) uint64 {
 	sum := sha256.Sum256([]byte(s))
@@ -1354,6 +3555,9 @@ func (qc *QdrantClient) RemoveService(id string) error {
 		return nil
 	}
 
+	release := qc.acquireWrite()
+	defer release()
+
 	// Hash the ID to match what was used in UpsertService
 	numID := hashToUint64(id)
 
@@ -0,0 +1,756 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"prxs/common"
+	"prxs/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// registerAs registers card on p's behalf through handleRequest, without a
+// stream, and fails the test unless it succeeds.
+func registerAs(t *testing.T, r *RegistryNode, p *testPeer, card common.ServiceCard) common.RegistryRequest {
+	t.Helper()
+	knowPeer(t, r, p)
+	req := common.RegistryRequest{
+		Method:       "register",
+		Card:         card,
+		ProviderInfo: p.addrInfo(),
+		StakeProof:   p.stakeProof(t, 100, time.Now().UnixNano()),
+	}
+	if resp := r.handleRequest(p.ID(), req); !resp.Success {
+		t.Fatalf("register %s failed: %s", card.Name, resp.Error)
+	}
+	return req
+}
+
+// addProvider puts a provider of card straight into r's state, seen now,
+// for tests that need many providers without registering each.
+func addProvider(r *RegistryNode, pid peer.ID, card common.ServiceCard) *RegistrationRecord {
+	rec := &RegistrationRecord{
+		LastSeen:    r.now(),
+		ServiceCard: card,
+		AddrInfo:    peer.AddrInfo{ID: pid},
+	}
+	r.mu.Lock()
+	r.Registrations[pid] = rec
+	r.indexRecord(pid, rec)
+	r.mu.Unlock()
+	return rec
+}
+
+func TestHeartbeatGrace(t *testing.T) {
+	r := newTestRegistry(t)
+	clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+	r.clock = clock
+
+	p := newTestPeer(t)
+	req := registerAs(t, r, p, common.ServiceCard{Name: "svc"})
+
+	// One missed window is within the default grace of 1
+	clock.Advance(r.heartbeatTTL + time.Second)
+	r.pruneDead()
+	if _, ok := r.Registrations[p.ID()]; !ok {
+		t.Fatal("pruned after one missed heartbeat")
+	}
+
+	// A heartbeat clears the count, so another single miss is tolerated
+	if resp := r.handleRequest(p.ID(), req); !resp.Success {
+		t.Fatalf("heartbeat failed: %s", resp.Error)
+	}
+	clock.Advance(r.heartbeatTTL + time.Second)
+	r.pruneDead()
+	if rec, ok := r.Registrations[p.ID()]; !ok || rec.MissedHeartbeats != 1 {
+		t.Fatalf("after heartbeat and one miss: registered=%v", ok)
+	}
+
+	// The second consecutive miss prunes it
+	clock.Advance(r.heartbeatTTL)
+	r.pruneDead()
+	if _, ok := r.Registrations[p.ID()]; ok {
+		t.Fatal("not pruned after two consecutive missed heartbeats")
+	}
+	if len(r.ServiceIndex["svc"]) != 0 {
+		t.Fatalf("pruned provider still indexed: %v", r.ServiceIndex["svc"])
+	}
+}
+
+func TestHeartbeatTTLBoundary(t *testing.T) {
+	for _, grace := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("grace %d", grace), func(t *testing.T) {
+			r := newTestRegistry(t)
+			r.heartbeatGrace = grace
+			clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+			r.clock = clock
+			pid := newTestPeer(t).ID()
+			addProvider(r, pid, common.ServiceCard{Name: "svc"})
+
+			// Pruned once grace+1 windows have fully elapsed, not a moment before
+			deadline := r.heartbeatTTL * time.Duration(grace+1)
+			clock.Advance(deadline - time.Nanosecond)
+			r.pruneDead()
+			if _, ok := r.Registrations[pid]; !ok {
+				t.Fatalf("pruned 1ns before %s", deadline)
+			}
+			clock.Advance(time.Nanosecond)
+			r.pruneDead()
+			if _, ok := r.Registrations[pid]; ok {
+				t.Fatalf("not pruned at %s", deadline)
+			}
+		})
+	}
+}
+
+func TestStakeAmountBounds(t *testing.T) {
+	r := newTestRegistry(t)
+	r.maxStake = 1000
+	p := newTestPeer(t)
+	knowPeer(t, r, p)
+
+	tests := []struct {
+		name    string
+		amount  float64
+		wantErr string
+	}{
+		{"within bounds", 500, ""},
+		{"at the cap", 1000, ""},
+		{"above the cap", 1e12, "stake too high"},
+		{"negative", -5, "cannot be negative"},
+		{"NaN", math.NaN(), "not a finite number"},
+		{"+Inf", math.Inf(1), "not a finite number"},
+		{"-Inf", math.Inf(-1), "not a finite number"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.checkStakeValidity(p.ID(), p.stakeProof(t, tt.amount, int64(i)))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStakerDiversity(t *testing.T) {
+	r := newTestRegistry(t)
+	r.maxPerStaker = 2
+
+	register := func(p *testPeer, service string) common.RegistryResponse {
+		knowPeer(t, r, p)
+		proof := p.stakeProof(t, 100, 1)
+		proof.Owner = "0xoperator"
+		if err := common.SignStakeProof(p.key, proof); err != nil {
+			t.Fatal(err)
+		}
+		return r.handleRequest(p.ID(), common.RegistryRequest{
+			Method:       "register",
+			Card:         common.ServiceCard{Name: service},
+			ProviderInfo: p.addrInfo(),
+			StakeProof:   proof,
+		})
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := register(newTestPeer(t), "svc"); !resp.Success {
+			t.Fatalf("provider %d rejected: %s", i+1, resp.Error)
+		}
+	}
+	resp := register(newTestPeer(t), "svc")
+	if resp.Success || !strings.Contains(resp.Error, "already backs 2 provider(s)") {
+		t.Fatalf("third provider of the same owner: %+v", resp)
+	}
+	if resp := register(newTestPeer(t), "other"); !resp.Success {
+		t.Fatalf("same owner, another service rejected: %s", resp.Error)
+	}
+}
+
+func TestFindPagination(t *testing.T) {
+	r := newTestRegistry(t)
+	for i := 0; i < 120; i++ {
+		addProvider(r, peer.ID(fmt.Sprintf("provider-%03d", i)), common.ServiceCard{Name: "svc"})
+	}
+
+	seen := map[peer.ID]bool{}
+	var gone peer.ID
+	token := ""
+	for pages := 0; ; pages++ {
+		resp := r.handleRequest("client", common.RegistryRequest{Method: "find", Query: "svc", Limit: 25, PageToken: token})
+		if !resp.Success {
+			t.Fatalf("page %d: %s", pages, resp.Error)
+		}
+		if len(resp.Providers) > 25 {
+			t.Fatalf("page %d has %d providers", pages, len(resp.Providers))
+		}
+		for _, p := range resp.Providers {
+			if seen[p.ID] {
+				t.Fatalf("%s returned twice", p.ID)
+			}
+			seen[p.ID] = true
+		}
+		if pages == 0 {
+			// Churn between pages: one provider not yet returned leaves
+			r.mu.Lock()
+			for pid := range r.Registrations {
+				if !seen[pid] {
+					gone = pid
+					break
+				}
+			}
+			r.unindexRecord(gone, r.Registrations[gone])
+			delete(r.Registrations, gone)
+			r.mu.Unlock()
+		}
+		if resp.NextToken == "" {
+			break
+		}
+		token = resp.NextToken
+	}
+	if len(seen) != 119 || seen[gone] {
+		t.Fatalf("paged through %d providers (removed one seen: %v), want the 119 remaining", len(seen), seen[gone])
+	}
+
+	resp := r.handleRequest("client", common.RegistryRequest{Method: "find", Query: "other", Limit: 25, PageToken: token})
+	if resp.Success || resp.Error != "page token does not match query" {
+		t.Fatalf("token reused for another query: %+v", resp)
+	}
+}
+
+func TestGlobalRegistrationThrottle(t *testing.T) {
+	r := newTestRegistry(t)
+	mr := miniredis.RunT(t)
+	rs, err := storage.NewRedisStorage(mr.Addr(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	r.storage = rs
+	r.maxRegsPerMin = 3
+
+	for i := 0; i < 3; i++ {
+		registerAs(t, r, newTestPeer(t), common.ServiceCard{Name: "svc"})
+	}
+
+	p := newTestPeer(t)
+	knowPeer(t, r, p)
+	resp := r.handleRequest(p.ID(), common.RegistryRequest{
+		Method:       "register",
+		Card:         common.ServiceCard{Name: "svc"},
+		ProviderInfo: p.addrInfo(),
+		StakeProof:   p.stakeProof(t, 100, 1),
+	})
+	if resp.Success || !strings.Contains(resp.Error, "registration throttled") || resp.RetryAfter <= 0 {
+		t.Fatalf("4th registration in the window: %+v", resp)
+	}
+	if _, ok := r.Registrations[p.ID()]; ok {
+		t.Fatal("throttled provider was registered")
+	}
+}
+
+func TestProviderFilterBatchCard(t *testing.T) {
+	rec := &RegistrationRecord{
+		ServiceCard: common.ServiceCard{Name: "primary", Region: "us-east", Metadata: map[string]string{"gpu": "none"}},
+		Extra:       []common.ServiceCard{{Name: "second", Region: "eu-west", Metadata: map[string]string{"gpu": "a100"}}},
+	}
+
+	tests := []struct {
+		name   string
+		filter providerFilter
+		want   bool
+	}{
+		{"region of the batch card", providerFilter{Region: "eu-west"}, true},
+		{"region of the primary card", providerFilter{Region: "us-east"}, false},
+		{"metadata of the batch card", providerFilter{Meta: map[string]string{"gpu": "a100"}}, true},
+		{"metadata of the primary card", providerFilter{Meta: map[string]string{"gpu": "none"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.match(rec, "second"); got != tt.want {
+				t.Fatalf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterBatch(t *testing.T) {
+	r := newTestRegistry(t)
+	r.maxServices = 5
+	p := newTestPeer(t)
+	knowPeer(t, r, p)
+
+	batch := func(names ...string) common.RegistryRequest {
+		req := common.RegistryRequest{
+			Method:       "register_batch",
+			ProviderInfo: p.addrInfo(),
+			StakeProof:   p.stakeProof(t, 100, time.Now().UnixNano()),
+		}
+		for _, n := range names {
+			req.Cards = append(req.Cards, common.ServiceCard{Name: n})
+		}
+		return req
+	}
+
+	resp := r.handleRequest(p.ID(), batch("tool-a", "tool-b", "tool-c", "tool-d", "tool-e", "tool-f"))
+	if resp.Success || !strings.Contains(resp.Error, "exceeds the limit of 5") {
+		t.Fatalf("batch over the cap: %+v", resp)
+	}
+	resp = r.handleRequest(p.ID(), batch("tool-a", "tool-b", "tool-a"))
+	if resp.Success || !strings.Contains(resp.Error, `duplicate service "tool-a"`) {
+		t.Fatalf("batch with a duplicate name: %+v", resp)
+	}
+	if _, ok := r.Registrations[p.ID()]; ok {
+		t.Fatal("rejected batch registered the peer")
+	}
+
+	names := []string{"tool-a", "tool-b", "tool-c", "tool-d", "tool-e"}
+	if resp := r.handleRequest(p.ID(), batch(names...)); !resp.Success {
+		t.Fatalf("register_batch failed: %s", resp.Error)
+	}
+	for _, name := range names {
+		resp := r.handleRequest(p.ID(), common.RegistryRequest{Method: "find", Query: name})
+		if !resp.Success || len(resp.Providers) != 1 || resp.Providers[0].ID != p.ID() {
+			t.Fatalf("find %s: %+v", name, resp)
+		}
+	}
+
+	// A query matching every card still returns the gateway once
+	resp = r.handleRequest(p.ID(), common.RegistryRequest{Method: "find", Query: "tool"})
+	if !resp.Success || len(resp.Providers) != 1 {
+		t.Fatalf("find tool: got %d providers, want 1", len(resp.Providers))
+	}
+}
+
+func TestSyncStorage(t *testing.T) {
+	r := newTestRegistry(t)
+	ctx := context.Background()
+	live := newTestPeer(t)
+	registerAs(t, r, live, common.ServiceCard{Name: "svc"})
+	if err := r.regStore.DeleteRegistration(ctx, live.ID(), "svc"); err != nil {
+		t.Fatal(err)
+	}
+	orphan := newTestPeer(t).ID()
+	if err := r.regStore.SaveRegistration(ctx, orphan, &storage.RegistrationRecord{LastSeen: r.now(), ServiceCard: common.ServiceCard{Name: "svc"}}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, deleted, err := r.syncStorage(ctx)
+	if err != nil || saved != 1 || deleted != 1 {
+		t.Fatalf("syncStorage = %d, %d, %v; want 1 re-saved and 1 deleted", saved, deleted, err)
+	}
+	if _, err := r.regStore.LoadRegistration(ctx, live.ID()); err != nil {
+		t.Fatalf("live registration not re-saved: %v", err)
+	}
+	if _, err := r.regStore.LoadRegistration(ctx, orphan); err == nil {
+		t.Fatal("orphaned record not deleted")
+	}
+}
+
+func TestStakeBan(t *testing.T) {
+	r := newTestRegistry(t)
+	r.stakeBans = newStakeBlocklist(3, time.Minute, time.Hour)
+	clock := common.NewMockClock(time.Now())
+	r.clock = clock
+	p := newTestPeer(t)
+	knowPeer(t, r, p)
+
+	register := func(amount float64) common.RegistryResponse {
+		return r.handleRequest(p.ID(), common.RegistryRequest{
+			Method:       "register",
+			Card:         common.ServiceCard{Name: "svc"},
+			ProviderInfo: p.addrInfo(),
+			StakeProof:   p.stakeProof(t, amount, time.Now().UnixNano()),
+		})
+	}
+	invalid := func() {
+		t.Helper()
+		if resp := register(1); resp.Success || !strings.Contains(resp.Error, "stake too low") {
+			t.Fatalf("stake below the minimum: %+v", resp)
+		}
+	}
+
+	// A valid registration clears the failures counted so far
+	invalid()
+	invalid()
+	if resp := register(100); !resp.Success {
+		t.Fatalf("valid registration rejected: %s", resp.Error)
+	}
+	invalid()
+	invalid()
+
+	// The third failure in the window bans the peer, valid stake or not
+	invalid()
+	resp := register(100)
+	if resp.Success || !strings.Contains(resp.Error, "temporarily blocked") || resp.RetryAfter != 3600 {
+		t.Fatalf("registration while banned: %+v", resp)
+	}
+
+	// The ban lifts exactly when it expires
+	clock.Advance(time.Hour)
+	if resp := register(100); resp.Success {
+		t.Fatal("registration accepted before the ban expired")
+	}
+	clock.Advance(time.Nanosecond)
+	if resp := register(100); !resp.Success {
+		t.Fatalf("registration after the ban expired: %s", resp.Error)
+	}
+}
+
+func TestEvictForCapacity(t *testing.T) {
+	r := newTestRegistry(t)
+	r.maxRegistrations = 2
+	clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+	r.clock = clock
+
+	oldest := newTestPeer(t)
+	registerAs(t, r, oldest, common.ServiceCard{Name: "svc"})
+	clock.Advance(time.Second)
+	registerAs(t, r, newTestPeer(t), common.ServiceCard{Name: "svc"})
+	clock.Advance(time.Second)
+	registerAs(t, r, newTestPeer(t), common.ServiceCard{Name: "svc"})
+
+	if len(r.Registrations) != 2 {
+		t.Fatalf("%d registrations, want 2", len(r.Registrations))
+	}
+	if _, ok := r.Registrations[oldest.ID()]; ok {
+		t.Fatal("least recently seen provider not evicted")
+	}
+	if _, err := r.regStore.LoadRegistration(context.Background(), oldest.ID()); err == nil {
+		t.Fatal("evicted provider still in storage")
+	}
+}
+
+func TestQueryLength(t *testing.T) {
+	r := newTestRegistry(t)
+	r.maxQueryLen = 8
+	for _, method := range []string{"find", "find_best"} {
+		resp := r.handleRequest("client", common.RegistryRequest{Method: method, Query: strings.Repeat("x", 9)})
+		if resp.Success || resp.Error != "query exceeds 8 characters" {
+			t.Fatalf("%s with an overlong query: %+v", method, resp)
+		}
+	}
+}
+
+func TestRejectedRegistrationKeepsStake(t *testing.T) {
+	r := newTestRegistry(t)
+	p := newTestPeer(t)
+	knowPeer(t, r, p)
+	req := common.RegistryRequest{
+		Method:       "register",
+		Card:         common.ServiceCard{Name: "svc", Embedding: []float32{1, 2, 3}},
+		ProviderInfo: p.addrInfo(),
+		StakeProof:   p.stakeProof(t, 100, 1),
+	}
+	if resp := r.handleRequest(p.ID(), req); resp.Success || !strings.Contains(resp.Error, "invalid embedding") {
+		t.Fatalf("card with a short embedding: %+v", resp)
+	}
+
+	// The stake wasn't consumed by the rejected card, so it can be reused
+	req.Card.Embedding = nil
+	if resp := r.handleRequest(p.ID(), req); !resp.Success {
+		t.Fatalf("retry with the same stake: %s", resp.Error)
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	r := newTestRegistry(t)
+	p := newTestPeer(t)
+	req := registerAs(t, r, p, common.ServiceCard{Name: "svc"})
+
+	other := newTestPeer(t)
+	resp := r.handleRequest(p.ID(), common.RegistryRequest{Method: "unregister", StakeProof: req.StakeProof, ProviderInfo: other.addrInfo()})
+	if resp.Success || resp.Error != "a provider can only unregister itself" {
+		t.Fatalf("unregistering another peer: %+v", resp)
+	}
+
+	unregister := common.RegistryRequest{Method: "unregister", StakeProof: req.StakeProof}
+	if resp := r.handleRequest(p.ID(), unregister); !resp.Success {
+		t.Fatalf("unregister failed: %s", resp.Error)
+	}
+	if _, ok := r.Registrations[p.ID()]; ok {
+		t.Fatal("still registered")
+	}
+	if _, err := r.regStore.LoadRegistration(context.Background(), p.ID()); err == nil {
+		t.Fatal("still in storage")
+	}
+	if len(r.freezedPeerStakes[p.ID()]) != 1 {
+		t.Fatalf("frozen stakes %v, want the unregistered one", r.freezedPeerStakes[p.ID()])
+	}
+
+	// The stake was taken by the first call
+	if resp := r.handleRequest(p.ID(), unregister); resp.Success || resp.Error != "no stakes found for peer" {
+		t.Fatalf("second unregister: %+v", resp)
+	}
+}
+
+// failingDeleteStore fails every delete while down is set.
+type failingDeleteStore struct {
+	storage.Storage
+	down bool
+}
+
+func (s *failingDeleteStore) DeleteRegistration(ctx context.Context, pid peer.ID, serviceName string) error {
+	if s.down {
+		return errors.New("store unreachable")
+	}
+	return s.Storage.DeleteRegistration(ctx, pid, serviceName)
+}
+
+func TestUnregisterStoreFailure(t *testing.T) {
+	r := newTestRegistry(t)
+	store := &failingDeleteStore{Storage: r.regStore, down: true}
+	r.regStore = store
+	p := newTestPeer(t)
+	req := registerAs(t, r, p, common.ServiceCard{Name: "svc"})
+
+	unregister := common.RegistryRequest{Method: "unregister", StakeProof: req.StakeProof}
+	if resp := r.handleRequest(p.ID(), unregister); resp.Success || resp.Error == "" {
+		t.Fatalf("unregister with the store down: %+v", resp)
+	}
+	if _, ok := r.Registrations[p.ID()]; !ok {
+		t.Fatal("registration dropped although the store wasn't cleaned")
+	}
+	if len(r.freezedPeerStakes[p.ID()]) != 0 || len(r.peerStakes[p.ID()]) != 1 {
+		t.Fatalf("stake changed: active %v, frozen %v", r.peerStakes[p.ID()], r.freezedPeerStakes[p.ID()])
+	}
+
+	// Once the store is back the provider can retry
+	store.down = false
+	if resp := r.handleRequest(p.ID(), unregister); !resp.Success {
+		t.Fatalf("retried unregister failed: %s", resp.Error)
+	}
+	if _, ok := r.Registrations[p.ID()]; ok {
+		t.Fatal("still registered")
+	}
+	if len(r.freezedPeerStakes[p.ID()]) != 1 {
+		t.Fatalf("frozen stakes %v, want the unregistered one", r.freezedPeerStakes[p.ID()])
+	}
+}
+
+// slowRestoreStore holds RestoreAllRegistrations until release is closed,
+// standing in for a large restore.
+type slowRestoreStore struct {
+	storage.Storage
+	started, release chan struct{}
+}
+
+func (s *slowRestoreStore) RestoreAllRegistrations(ctx context.Context, maxAge time.Duration) (map[peer.ID]*storage.RegistrationRecord, error) {
+	close(s.started)
+	<-s.release
+	return s.Storage.RestoreAllRegistrations(ctx, maxAge)
+}
+
+func TestHealthDuringRestore(t *testing.T) {
+	r := newTestRegistry(t)
+	ctx := context.Background()
+	const records = 2000
+	for i := 0; i < records; i++ {
+		pid := peer.ID(fmt.Sprintf("restored-%d", i))
+		rec := &storage.RegistrationRecord{LastSeen: r.now(), ServiceCard: common.ServiceCard{Name: fmt.Sprintf("svc-%d", i%50)}, AddrInfo: peer.AddrInfo{ID: pid}}
+		if err := r.regStore.SaveRegistration(ctx, pid, rec, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := &slowRestoreStore{Storage: r.regStore, started: make(chan struct{}), release: make(chan struct{})}
+	r.regStore = store
+	router := r.setupRESTAPI()
+
+	r.restoring.Store(true)
+	done := make(chan error, 1)
+	go func() {
+		err := r.restoreState(ctx)
+		r.restoring.Store(false)
+		done <- err
+	}()
+	<-store.started
+
+	get := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		served := make(chan struct{})
+		go func() {
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			close(served)
+		}()
+		select {
+		case <-served:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s blocked during restore", path)
+		}
+		return w
+	}
+	w := get("/health")
+	var health struct {
+		Status    string
+		Restoring bool
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil || w.Code != http.StatusOK || !health.Restoring {
+		t.Fatalf("/health during restore: %d %s", w.Code, w.Body)
+	}
+	if w := get("/api/v1/services"); w.Code != http.StatusOK {
+		t.Fatalf("/api/v1/services during restore: %d %s", w.Code, w.Body)
+	}
+
+	close(store.release)
+	if err := <-done; err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if len(r.Registrations) != records {
+		t.Fatalf("restored %d registrations, want %d", len(r.Registrations), records)
+	}
+	if err := json.Unmarshal(get("/health").Body.Bytes(), &health); err != nil || health.Restoring {
+		t.Fatalf("/health after restore: %+v, %v", health, err)
+	}
+}
+
+func TestStreamMessageCap(t *testing.T) {
+	r := newTestRegistry(t)
+	r.maxStreamMessages = 3
+	client := newTestPeer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := common.ConnectHosts(ctx, r.Host, client.Host); err != nil {
+		t.Fatal(err)
+	}
+	s, err := client.NewStream(ctx, r.Host.ID(), common.RegistryProtocolID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(s), bufio.NewWriter(s))
+	codec := common.JSONCodec{}
+	send := func(method string) common.RegistryResponse {
+		t.Helper()
+		req := common.RegistryRequest{Method: method, Query: "svc"}
+		if err := codec.WriteRequest(rw, &req); err != nil {
+			t.Fatal(err)
+		}
+		if err := rw.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		var resp common.RegistryResponse
+		if err := codec.ReadResponse(rw.Reader, &resp); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		return resp
+	}
+
+	// Pings don't count toward the cap
+	for i := 0; i < r.maxStreamMessages; i++ {
+		if resp := send(common.RegistryMethodPing); !resp.Pong {
+			t.Fatalf("ping %d: %+v", i, resp)
+		}
+		if resp := send("find"); strings.Contains(resp.Error, "stream message limit") {
+			t.Fatalf("request %d refused under the cap: %s", i+1, resp.Error)
+		}
+	}
+	resp := send("find")
+	if resp.Success || resp.Error != "stream message limit (3) reached, open a new stream" {
+		t.Fatalf("request past the cap: %+v", resp)
+	}
+	var next common.RegistryResponse
+	if err := codec.ReadResponse(rw.Reader, &next); err == nil {
+		t.Fatal("stream still open past the cap")
+	}
+}
+
+func TestRateLimitDiscovery(t *testing.T) {
+	r := newTestRegistry(t)
+	router := r.setupRESTAPI()
+	slow, fast := newTestPeer(t), newTestPeer(t)
+	registerAs(t, r, slow, common.ServiceCard{Name: "svc", RateLimit: 2.5})
+	registerAs(t, r, fast, common.ServiceCard{Name: "svc", RateLimit: 20})
+	registerAs(t, r, newTestPeer(t), common.ServiceCard{Name: "open"})
+
+	get := func(url string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", url, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+
+	// /services_full shows the card's rate_limit, and leaves it out for
+	// cards without one
+	var full struct {
+		Services map[string]struct{ Card map[string]interface{} }
+	}
+	if err := json.Unmarshal([]byte(get("/api/v1/services_full")), &full); err != nil {
+		t.Fatal(err)
+	}
+	if rate, ok := full.Services["svc"].Card["rate_limit"].(float64); !ok || (rate != 2.5 && rate != 20) {
+		t.Errorf("svc card rate_limit = %v", full.Services["svc"].Card["rate_limit"])
+	}
+	if _, ok := full.Services["open"].Card["rate_limit"]; ok {
+		t.Errorf("open card has a rate_limit: %v", full.Services["open"].Card)
+	}
+
+	// The manifest spans every provider's limit
+	var manifest struct {
+		RateLimit *struct{ Min, Max float64 } `json:"rate_limit"`
+	}
+	if err := json.Unmarshal([]byte(get("/api/v1/services/svc/manifest")), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.RateLimit == nil || manifest.RateLimit.Min != 2.5 || manifest.RateLimit.Max != 20 {
+		t.Errorf("manifest rate_limit = %+v, want {2.5 20}", manifest.RateLimit)
+	}
+	if strings.Contains(get("/api/v1/services/open/manifest"), "rate_limit") {
+		t.Error("manifest of a service without limits has a rate_limit")
+	}
+
+	// find_best carries it in the card over both codecs
+	client := newTestPeer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := common.ConnectHosts(ctx, r.Host, client.Host); err != nil {
+		t.Fatal(err)
+	}
+	req := common.RegistryRequest{Method: "find_best", Query: "svc"}
+	for name, callFn := range map[string]func(context.Context, host.Host, peer.ID, common.RegistryRequest) (*common.RegistryResponse, error){
+		"json":     common.CallRegistry,
+		"protobuf": common.CallRegistryPB,
+	} {
+		resp, err := callFn(ctx, client.Host, r.Host.ID(), req)
+		if err != nil || !resp.Success || resp.Card == nil {
+			t.Fatalf("%s find_best: %+v, %v", name, resp, err)
+		}
+		if want := map[peer.ID]float64{slow.ID(): 2.5, fast.ID(): 20}[resp.Providers[0].ID]; resp.Card.RateLimit != want {
+			t.Errorf("%s find_best: rate_limit %v, want %v", name, resp.Card.RateLimit, want)
+		}
+	}
+
+	// A negative or non-finite limit is refused at registration
+	for _, rate := range []float64{-1, math.Inf(1), math.NaN()} {
+		p := newTestPeer(t)
+		knowPeer(t, r, p)
+		resp := r.handleRequest(p.ID(), common.RegistryRequest{
+			Method:       "register",
+			Card:         common.ServiceCard{Name: "bad", RateLimit: rate},
+			ProviderInfo: p.addrInfo(),
+			StakeProof:   p.stakeProof(t, 100, time.Now().UnixNano()),
+		})
+		if resp.Success || !strings.Contains(resp.Error, "rate_limit") {
+			t.Errorf("rate_limit %v: %+v", rate, resp)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"prxs/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// executionMethod is the JSON-RPC method providers serve calls on.
+const executionMethod = "compute"
+
+// serviceManifest describes how to call a service, aggregated from its
+// providers' cards, for clients that read the REST API but don't speak
+// libp2p.
+type serviceManifest struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"` // From the most recently seen provider
+	Protocol    string           `json:"protocol"`    // libp2p protocol ID of the execution RPC
+	Versions    []string         `json:"versions"`
+	Methods     []manifestMethod `json:"methods"`
+	CostPerOp   valueRange       `json:"cost_per_op"`
+	RateLimit   *valueRange      `json:"rate_limit,omitempty"` // Per provider, calls/s; omitted when none advertise one
+	Tags        []string         `json:"tags"`
+	Regions     []string         `json:"regions"`
+	Providers   int              `json:"providers"`
+}
+
+// manifestMethod is one call signature; params are conventionally passed
+// positionally in Inputs order, as the MCP bridge does. Providers whose
+// cards differ in inputs or outputs get separate entries.
+type manifestMethod struct {
+	Name      string   `json:"name"`
+	Inputs    []string `json:"inputs"`
+	Outputs   []string `json:"outputs"`
+	Versions  []string `json:"versions"`
+	Providers int      `json:"providers"`
+}
+
+// valueRange is the spread of a value across providers.
+type valueRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+func (v *valueRange) add(x float64, first bool) {
+	if first {
+		v.Min, v.Max = x, x
+		return
+	}
+	v.Min, v.Max = min(v.Min, x), max(v.Max, x)
+}
+
+// buildManifest aggregates the cards of one service.
+func buildManifest(name string, cards []common.ServiceCard, description string) serviceManifest {
+	m := serviceManifest{
+		Name:        name,
+		Description: description,
+		Protocol:    common.ProtocolID,
+		Versions:    []string{},
+		Methods:     []manifestMethod{},
+		Tags:        []string{},
+		Regions:     []string{},
+		Providers:   len(cards),
+	}
+	addUnique := func(list []string, s string) []string {
+		if s == "" || slices.Contains(list, s) {
+			return list
+		}
+		return append(list, s)
+	}
+
+	methods := map[string]int{} // Signature -> index in m.Methods
+	rates := 0
+	for i, card := range cards {
+		m.Versions = addUnique(m.Versions, card.Version)
+		m.Regions = addUnique(m.Regions, card.Region)
+		for _, tag := range card.Tags {
+			m.Tags = addUnique(m.Tags, tag)
+		}
+		m.CostPerOp.add(card.CostPerOp, i == 0)
+		if card.RateLimit > 0 {
+			if m.RateLimit == nil {
+				m.RateLimit = &valueRange{}
+			}
+			m.RateLimit.add(card.RateLimit, rates == 0)
+			rates++
+		}
+
+		inputs, outputs := card.Inputs, card.Outputs
+		if inputs == nil {
+			inputs = []string{}
+		}
+		if outputs == nil {
+			outputs = []string{}
+		}
+		sig := strings.Join(inputs, ",") + "->" + strings.Join(outputs, ",")
+		j, ok := methods[sig]
+		if !ok {
+			j = len(m.Methods)
+			methods[sig] = j
+			m.Methods = append(m.Methods, manifestMethod{Name: executionMethod, Inputs: inputs, Outputs: outputs, Versions: []string{}})
+		}
+		m.Methods[j].Versions = addUnique(m.Methods[j].Versions, card.Version)
+		m.Methods[j].Providers++
+	}
+
+	sort.Strings(m.Versions)
+	sort.Strings(m.Tags)
+	sort.Strings(m.Regions)
+	sort.SliceStable(m.Methods, func(i, j int) bool { return m.Methods[i].Providers > m.Methods[j].Providers })
+	for _, method := range m.Methods {
+		sort.Strings(method.Versions)
+	}
+	return m
+}
+
+// getServiceManifest returns the service's call manifest, over the providers
+// matching the usual provider filters.
+// GET /api/v1/services/:name/manifest
+func (r *RegistryNode) getServiceManifest(c *gin.Context) {
+	serviceName := c.Param("name")
+	filter, err := r.parseProviderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r.mu.Lock()
+	var cards []common.ServiceCard
+	var newest *RegistrationRecord
+	for _, pid := range r.ServiceIndex[serviceName] {
+		reg, ok := r.Registrations[pid]
+		if !ok || !filter.match(reg, serviceName) {
+			continue
+		}
+		if card, ok := reg.card(serviceName); ok {
+			cards = append(cards, card)
+			if newest == nil || reg.LastSeen.After(newest.LastSeen) {
+				newest = reg
+			}
+		}
+	}
+	var description string
+	if newest != nil {
+		card, _ := newest.card(serviceName)
+		description = card.Description
+	}
+	_, known := r.ServiceIndex[serviceName]
+	r.mu.Unlock()
+
+	if len(cards) == 0 {
+		serviceNotFound(c, serviceName, known)
+		return
+	}
+	c.JSON(http.StatusOK, buildManifest(serviceName, cards, description))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus collectors exposed on the REST API at /metrics.
+
+var rpcLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "prxs",
+	Subsystem: "registry",
+	Name:      "rpc_duration_seconds",
+	Help:      "Latency of registry RPC handling in handleStream, by method.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method"})
+
+var retryQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "prxs",
+	Subsystem: "registry",
+	Name:      "retry_queue_depth",
+	Help:      "Failed Redis/Qdrant writes waiting to be replayed.",
+})
+
+var (
+	embeddingCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prxs",
+		Subsystem: "registry",
+		Name:      "embedding_cache_hits_total",
+		Help:      "Card embeddings served from the embedding cache.",
+	})
+	embeddingCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prxs",
+		Subsystem: "registry",
+		Name:      "embedding_cache_misses_total",
+		Help:      "Card embeddings computed by the embedder after a cache miss.",
+	})
+	registrationsEvicted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prxs",
+		Subsystem: "registry",
+		Name:      "registrations_evicted_total",
+		Help:      "Least recently seen providers dropped to stay under -max-registrations.",
+	})
+)
+
+// Stake gauges are recomputed by stakeMetricsLoop rather than on the
+// registration path. They use the normalized stake amount only.
+var (
+	stakedTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "prxs",
+		Subsystem: "registry",
+		Name:      "staked_total",
+		Help:      "Stake across all registered providers, in the registry's base unit.",
+	})
+	serviceStaked = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "prxs",
+		Subsystem: "registry",
+		Name:      "service_staked",
+		Help:      "Stake of the providers registered for each service, in the registry's base unit.",
+	}, []string{"service"})
+)
+
+func init() {
+	prometheus.MustRegister(rpcLatency, retryQueueDepth, embeddingCacheHits, embeddingCacheMisses, registrationsEvicted, stakedTotal, serviceStaked)
+}
+
+// stakeMetricsInterval is how often the stake gauges are recomputed.
+const stakeMetricsInterval = 30 * time.Second
+
+// stakeMetricsLoop keeps the stake gauges current.
+func (r *RegistryNode) stakeMetricsLoop() {
+	ticker := time.NewTicker(stakeMetricsInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		r.updateStakeMetrics()
+	}
+}
+
+// updateStakeMetrics recomputes the stake gauges from the live
+// registrations. A gateway's stake counts once in the total and once for
+// each of its services.
+func (r *RegistryNode) updateStakeMetrics() {
+	r.mu.Lock()
+	total := 0.0
+	perService := make(map[string]float64)
+	for _, rec := range r.Registrations {
+		total += rec.Stake
+		for _, card := range rec.cards() {
+			perService[card.Name] += rec.Stake
+		}
+	}
+	r.mu.Unlock()
+
+	stakedTotal.Set(total)
+	serviceStaked.Reset()
+	for name, stake := range perService {
+		serviceStaked.WithLabelValues(name).Set(stake)
+	}
+}
+
+// metricMethod maps an RPC method onto a bounded label set so arbitrary
+// client-supplied method names can't blow up metric cardinality.
+func metricMethod(method string) string {
+	switch method {
+	case "register", "register_batch", "find", "find_best", "find_by_capability", "unregister",
+		"admin_challenge", "admin":
+		return method
+	default:
+		return "other"
+	}
+}
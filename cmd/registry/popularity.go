@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxPopularGrace caps -popular-grace so a popular service can't keep a
+// silent provider listed for long.
+const maxPopularGrace = 3
+
+// popularity counts "find" hits per service over a sliding window. A
+// service is popular once it has been hit threshold times within the
+// window. Only the last threshold hit times are kept per service. A nil
+// *popularity finds nothing popular.
+type popularity struct {
+	threshold int
+	window    time.Duration
+
+	mu   sync.Mutex
+	hits map[string][]time.Time // Service -> recent hits, oldest first
+}
+
+// newPopularity returns nil, disabling popularity tracking, for threshold <= 0.
+func newPopularity(threshold int, window time.Duration) *popularity {
+	if threshold <= 0 || window <= 0 {
+		return nil
+	}
+	return &popularity{threshold: threshold, window: window, hits: make(map[string][]time.Time)}
+}
+
+// hit records a find hit on service at now.
+func (p *popularity) hit(service string, now time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h := append(p.hits[service], now)
+	if len(h) > p.threshold {
+		h = h[len(h)-p.threshold:]
+	}
+	p.hits[service] = h
+}
+
+// popular reports whether service reached the threshold within the window
+// ending at now.
+func (p *popularity) popular(service string, now time.Time) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h := p.hits[service]
+	return len(h) >= p.threshold && now.Sub(h[0]) <= p.window
+}
+
+// prune forgets services with no hit within the window ending at now.
+func (p *popularity) prune(now time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for service, h := range p.hits {
+		if now.Sub(h[len(h)-1]) > p.window {
+			delete(p.hits, service)
+		}
+	}
+}
+
+// effectiveGrace is how many missed heartbeat windows record is allowed
+// before gcLoop prunes it: -heartbeat-grace, plus -popular-grace if any of
+// its services is popular. The extension is fixed, not renewed by
+// further hits, so a provider that stays silent is still pruned.
+func (r *RegistryNode) effectiveGrace(record *RegistrationRecord) int {
+	if r.popularity != nil && r.popularGrace > 0 {
+		now := r.now()
+		for _, card := range record.cards() {
+			if r.popularity.popular(card.Name, now) {
+				return r.heartbeatGrace + r.popularGrace
+			}
+		}
+	}
+	return r.heartbeatGrace
+}
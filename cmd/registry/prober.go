@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+// probeTimeout bounds a single provider's dial and ping within a cycle.
+const probeTimeout = 5 * time.Second
+
+// probeResult is the outcome of pinging one provider.
+type probeResult struct {
+	rtt time.Duration
+	err error
+}
+
+// prober measures provider round-trips for the latency ranking signal.
+// Each cycle pings up to sample providers, chosen at random, with workers
+// pings in flight, and stops at deadline; providers not reached by then
+// are left as they were.
+type prober struct {
+	interval time.Duration
+	workers  int
+	deadline time.Duration
+	sample   int // 0 = every provider
+
+	ping func(ctx context.Context, info peer.AddrInfo) (time.Duration, error)
+}
+
+// newProber returns nil, disabling probing, for interval <= 0.
+func newProber(h host.Host, interval time.Duration, workers int, deadline time.Duration, sample int) *prober {
+	if interval <= 0 {
+		return nil
+	}
+	return &prober{interval: interval, workers: workers, deadline: deadline, sample: sample, ping: hostPing(h)}
+}
+
+// hostPing dials the provider and times one libp2p ping.
+func hostPing(h host.Host) func(ctx context.Context, info peer.AddrInfo) (time.Duration, error) {
+	return func(ctx context.Context, info peer.AddrInfo) (time.Duration, error) {
+		ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+		defer cancel()
+
+		if err := h.Connect(ctx, info); err != nil {
+			return 0, fmt.Errorf("failed to connect: %v", err)
+		}
+		res := <-ping.Ping(ctx, h, info.ID)
+		return res.RTT, res.Error
+	}
+}
+
+// run probes targets and returns the results of the pings that finished
+// before the deadline.
+func (p *prober) run(targets []peer.AddrInfo) map[peer.ID]probeResult {
+	if p.sample > 0 && len(targets) > p.sample {
+		rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+		targets = targets[:p.sample]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.deadline)
+	defer cancel()
+
+	jobs := make(chan peer.AddrInfo)
+	var mu sync.Mutex
+	results := make(map[peer.ID]probeResult, len(targets))
+	var wg sync.WaitGroup
+	for range min(p.workers, len(targets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for info := range jobs {
+				rtt, err := p.ping(ctx, info)
+				if ctx.Err() != nil {
+					return // Cut off by the deadline, not a provider failure
+				}
+				mu.Lock()
+				results[info.ID] = probeResult{rtt: rtt, err: err}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, info := range targets {
+		select {
+		case jobs <- info:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// probeLoop measures provider latency every prober interval. Results of
+// a cycle are applied together under mu: a provider that answered gets
+// its round-trip as Latency, one that didn't is reset to unmeasured.
+func (r *RegistryNode) probeLoop() {
+	ticker := time.NewTicker(r.prober.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.mu.Lock()
+		targets := make([]peer.AddrInfo, 0, len(r.Registrations))
+		for _, record := range r.Registrations {
+			targets = append(targets, record.AddrInfo)
+		}
+		r.mu.Unlock()
+		if len(targets) == 0 {
+			continue
+		}
+
+		start := time.Now()
+		results := r.prober.run(targets)
+
+		failed := 0
+		r.mu.Lock()
+		for pid, res := range results {
+			record, ok := r.Registrations[pid]
+			if !ok {
+				continue
+			}
+			if res.err != nil {
+				failed++
+				record.Latency = 0
+				continue
+			}
+			record.Latency = res.rtt
+		}
+		r.mu.Unlock()
+		log.Printf("[Reg] Probed %d of %d providers in %s (%d failed)\n", len(results), len(targets), time.Since(start).Round(time.Millisecond), failed)
+	}
+}
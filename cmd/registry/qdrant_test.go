@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeQdrant is an httptest stand-in for the Qdrant endpoints the registry
+// uses. It records what it is sent.
+type fakeQdrant struct {
+	*httptest.Server
+	mu      sync.Mutex
+	created []map[string]interface{} // create-collection bodies
+	points  map[uint64]fakeQdrantPoint
+	deleted []uint64
+	hits    []qdrantSearchResult // Returned by every search
+
+	// existing is the distance of an already created collection; "" means
+	// there is none yet and creating one succeeds.
+	existing string
+}
+
+type fakeQdrantPoint struct {
+	ID      uint64                 `json:"id"`
+	Vector  []float32              `json:"vector"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+func newFakeQdrant(t *testing.T) *fakeQdrant {
+	t.Helper()
+	f := &fakeQdrant{points: make(map[uint64]fakeQdrantPoint)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// client returns a QdrantClient for the fake's "services" collection.
+func (f *fakeQdrant) client() *QdrantClient {
+	return NewQdrantClient(f.URL, "services", "Cosine", 0)
+}
+
+func (f *fakeQdrant) serve(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case req.Method == http.MethodPut && strings.HasSuffix(req.URL.Path, "/points"):
+		var body struct{ Points []fakeQdrantPoint }
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, p := range body.Points {
+			f.points[p.ID] = p
+		}
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/points/delete"):
+		var body struct{ Points []uint64 }
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, id := range body.Points {
+			delete(f.points, id)
+			f.deleted = append(f.deleted, id)
+		}
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/points/search"):
+		json.NewEncoder(w).Encode(qdrantSearchResponse{Result: f.hits})
+		return
+	case req.Method == http.MethodPut:
+		var body map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.created = append(f.created, body)
+		if f.existing != "" {
+			http.Error(w, `{"status":{"error":"already exists"}}`, http.StatusConflict)
+			return
+		}
+	case req.Method == http.MethodGet && f.existing != "":
+		fmt.Fprintf(w, `{"result":{"config":{"params":{"vectors":{"size":3,"distance":%q}}}}}`, f.existing)
+		return
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// creates returns the create-collection bodies received so far.
+func (f *fakeQdrant) creates() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}(nil), f.created...)
+}
+
+// point returns the stored point for a registry point ID ("pid:service").
+func (f *fakeQdrant) point(id string) (fakeQdrantPoint, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.points[hashToUint64(id)]
+	return p, ok
+}
+
+func TestUpsertTruncatesOversizedPayload(t *testing.T) {
+	f := newFakeQdrant(t)
+	qc := f.client()
+
+	vector := []float32{0.25, -0.5, 1}
+	payload := map[string]interface{}{
+		"service_name": "svc",
+		"peer_id":      "peer",
+		"description":  strings.Repeat("é", qdrantMaxStringField),
+		"tags":         make([]string, qdrantMaxListItems+10),
+	}
+	if err := qc.UpsertService("peer:svc", vector, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok := f.point("peer:svc")
+	if !ok {
+		t.Fatal("point not upserted")
+	}
+	desc, _ := p.Payload["description"].(string)
+	if len(desc) > qdrantMaxStringField || !strings.HasPrefix(strings.Repeat("é", qdrantMaxStringField), desc) || desc == "" {
+		t.Fatalf("description is %d bytes, want a rune-aligned cut to at most %d", len(desc), qdrantMaxStringField)
+	}
+	if tags, _ := p.Payload["tags"].([]interface{}); len(tags) != qdrantMaxListItems {
+		t.Fatalf("%d tags, want %d", len(tags), qdrantMaxListItems)
+	}
+	if p.Payload["service_name"] != "svc" || p.Payload["peer_id"] != "peer" {
+		t.Fatalf("essential fields changed: %v", p.Payload)
+	}
+	if len(p.Vector) != len(vector) {
+		t.Fatalf("vector %v, want %v", p.Vector, vector)
+	}
+	for i := range vector {
+		if p.Vector[i] != vector[i] {
+			t.Fatalf("vector %v, want %v", p.Vector, vector)
+		}
+	}
+}
+
+func TestLimitPayloadDropsLargestField(t *testing.T) {
+	payload := map[string]interface{}{
+		"service_name": "svc",
+		"peer_id":      "peer",
+	}
+	// Many fields each under the string limit, together over the payload limit
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p", "q"} {
+		payload[k] = strings.Repeat("x", qdrantMaxStringField)
+	}
+
+	out := limitPayload("peer:svc", payload)
+	b, _ := json.Marshal(out)
+	if len(b) > qdrantMaxPayload {
+		t.Fatalf("payload is %d bytes, want at most %d", len(b), qdrantMaxPayload)
+	}
+	if out["service_name"] != "svc" || out["peer_id"] != "peer" {
+		t.Fatalf("essential fields dropped: %v", out)
+	}
+}
+
+func TestQdrantWriteConcurrency(t *testing.T) {
+	const limit = 2
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+	qc := NewQdrantClient(srv.URL, "services", "Cosine", limit)
+	qc.VectorSize = 3 // Collection exists
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		id := string(rune('a' + i))
+		go func() {
+			defer wg.Done()
+			if err := qc.UpsertService(id, []float32{1, 2, 3}, nil); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := qc.RemoveService(id); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > limit {
+		t.Fatalf("%d concurrent writes, limit %d", got, limit)
+	} else if got < limit {
+		t.Fatalf("peak of %d concurrent writes never reached the limit %d; writes serialized", got, limit)
+	}
+}
+
+func TestCreateCollectionDistance(t *testing.T) {
+	for _, distance := range []string{"Cosine", "Dot", "Euclid"} {
+		f := newFakeQdrant(t)
+		qc := NewQdrantClient(f.URL, "services", distance, 0)
+		if err := qc.ensureCollection(3); err != nil {
+			t.Fatal(err)
+		}
+		created := f.creates()
+		if len(created) != 1 {
+			t.Fatalf("%d create requests, want 1", len(created))
+		}
+		vectors, _ := created[0]["vectors"].(map[string]interface{})
+		if vectors["distance"] != distance || vectors["size"] != float64(3) {
+			t.Fatalf("create body %v, want %s vectors of size 3", created[0], distance)
+		}
+	}
+}
+
+func TestExistingCollectionDistance(t *testing.T) {
+	f := newFakeQdrant(t)
+	f.existing = "Dot"
+
+	if err := NewQdrantClient(f.URL, "services", "Dot", 0).ensureCollection(3); err != nil {
+		t.Fatalf("matching metric: %v", err)
+	}
+	err := NewQdrantClient(f.URL, "services", "Cosine", 0).ensureCollection(3)
+	if !errors.Is(err, errQdrantDistance) {
+		t.Fatalf("mismatched metric: %v, want errQdrantDistance", err)
+	}
+}
+
+func TestCreateCollectionSharding(t *testing.T) {
+	tests := []struct {
+		shards, replicas int
+		want             map[string]interface{} // Expected top-level fields besides vectors
+	}{
+		{0, 0, map[string]interface{}{}},
+		{4, 0, map[string]interface{}{"shard_number": float64(4)}},
+		{3, 2, map[string]interface{}{"shard_number": float64(3), "replication_factor": float64(2)}},
+	}
+	for _, tt := range tests {
+		f := newFakeQdrant(t)
+		qc := f.client()
+		qc.Shards, qc.Replicas = tt.shards, tt.replicas
+		if err := qc.ensureCollection(3); err != nil {
+			t.Fatal(err)
+		}
+		body := f.creates()[0]
+		delete(body, "vectors")
+		if len(body) != len(tt.want) {
+			t.Fatalf("shards %d replicas %d: body %v, want %v", tt.shards, tt.replicas, body, tt.want)
+		}
+		for k, v := range tt.want {
+			if body[k] != v {
+				t.Fatalf("shards %d replicas %d: %s = %v, want %v", tt.shards, tt.replicas, k, body[k], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"prxs/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// defaultRandomSample is the number of services /services/random returns
+// without ?n=.
+const defaultRandomSample = 10
+
+// sampledService is one entry of a /services/random response.
+type sampledService struct {
+	Name     string             `json:"name"`
+	Card     common.ServiceCard `json:"card"`
+	Provider peer.AddrInfo      `json:"provider"`
+}
+
+// sampleServices picks up to n distinct services from candidates (service
+// name -> providers, each providing that service) and one provider of
+// each, using rng. Names and providers are put in a fixed order first, so
+// the same seed over the same registrations gives the same sample.
+func sampleServices(rng *rand.Rand, candidates map[string][]*RegistrationRecord, n int) []sampledService {
+	names := make([]string, 0, len(candidates))
+	for name := range candidates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	n = min(n, len(names))
+	sample := make([]sampledService, 0, n)
+	for _, i := range rng.Perm(len(names))[:n] {
+		name := names[i]
+		records := candidates[name]
+		sort.Slice(records, func(i, j int) bool { return records[i].AddrInfo.ID < records[j].AddrInfo.ID })
+		rec := records[rng.Intn(len(records))]
+		card, _ := rec.card(name)
+		card.Embedding = nil
+		sample = append(sample, sampledService{Name: name, Card: card, Provider: rec.AddrInfo})
+	}
+	return sample
+}
+
+// getRandomServices returns a random sample of distinct services, each with
+// one of its providers, for discovery. ?n= sets the sample size (default
+// 10, at most -max-page-size); fewer are returned when fewer services match.
+// ?seed= makes the sample reproducible. The usual provider filters apply.
+// GET /api/v1/services/random?n=10
+func (r *RegistryNode) getRandomServices(c *gin.Context) {
+	filter, err := r.parseProviderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	n := min(defaultRandomSample, r.maxPageSize)
+	if v := c.Query("n"); v != "" {
+		n, err = strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid n %q", v)})
+			return
+		}
+		if n > r.maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("n %d exceeds the maximum of %d", n, r.maxPageSize)})
+			return
+		}
+	}
+	seed := time.Now().UnixNano()
+	if v := c.Query("seed"); v != "" {
+		seed, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid seed %q", v)})
+			return
+		}
+	}
+
+	r.mu.Lock()
+	candidates := make(map[string][]*RegistrationRecord)
+	for name, peerIDs := range r.ServiceIndex {
+		for _, pid := range peerIDs {
+			if reg, ok := r.Registrations[pid]; ok && filter.match(reg, name) {
+				candidates[name] = append(candidates[name], reg)
+			}
+		}
+	}
+	sample := sampleServices(rand.New(rand.NewSource(seed)), candidates, n)
+	r.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"services": sample,
+		"count":    len(sample),
+		"seed":     seed,
+	})
+}
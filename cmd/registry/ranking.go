@@ -0,0 +1,278 @@
+package main
+
+import (
+	"sort"
+
+	"prxs/common"
+)
+
+// RankWeights are the operator-configured weights of the provider ranking
+// engine used when a query asks for ?rank=score (or Rank: "score" on find).
+//
+// Each signal is normalized to [0,1] across the candidate set before
+// weighting, so weights express relative importance independent of units:
+//
+//   - cost:       min-max over candidates, inverted (cheapest = 1, priciest = 0)
+//   - stake:      min-max over candidates' base-unit stake (largest = 1)
+//   - latency:    min-max over providers with a measurement, inverted
+//     (fastest = 1); providers never measured score a neutral 0.5
+//   - reputation: heartbeat reliability, 1/(1+missed heartbeats), so a
+//     provider currently inside its grace window ranks below a punctual one
+//
+// When every candidate has the same value for a signal it scores 1 for all
+// of them. The final score is the weighted mean of the four signals.
+type RankWeights struct {
+	Cost       float64
+	Stake      float64
+	Latency    float64
+	Reputation float64
+}
+
+// Ranking modes a query may ask for. Without one, providers keep index
+// order (and find paginates them).
+const (
+	rankModeScore   = "score"   // Weighted engine, see RankWeights
+	rankModeDefault = "default" // Freshness + stake composite, see defaultScore
+)
+
+// rankedMode reports whether mode orders providers by a score.
+func rankedMode(mode string) bool {
+	return mode == rankModeScore || mode == rankModeDefault
+}
+
+// rankRecords sorts records best-first for the given mode; other modes
+// leave them as they are. Callers must hold r.mu.
+func (r *RegistryNode) rankRecords(mode string, records []*RegistrationRecord) {
+	switch mode {
+	case rankModeScore:
+		r.rankWeights.rank(records)
+	case rankModeDefault:
+		scores := make(map[*RegistrationRecord]float64, len(records))
+		maxStake := 0.0
+		for _, rec := range records {
+			maxStake = max(maxStake, rec.Stake)
+		}
+		for _, rec := range records {
+			scores[rec] = r.defaultScore(rec, maxStake)
+		}
+		sort.SliceStable(records, func(i, j int) bool {
+			return scores[records[i]] > scores[records[j]]
+		})
+	}
+}
+
+// defaultScore is the rank=default composite, an even blend of freshness and
+// stake:
+//
+//	0.5 * (1 - age/prune window) + 0.5 * stake/max stake
+//
+// where age is the time since the last heartbeat, the prune window is
+// -heartbeat-ttl * (-heartbeat-grace + 1), and max stake is the largest
+// base-unit stake among the candidates (the stake term is 0 when none has
+// stake). Both terms are clamped to [0,1].
+func (r *RegistryNode) defaultScore(rec *RegistrationRecord, maxStake float64) float64 {
+	fresh, stake := r.defaultSignals(rec, maxStake)
+	return 0.5*fresh + 0.5*stake
+}
+
+// defaultSignals returns the two clamped terms of defaultScore.
+func (r *RegistryNode) defaultSignals(rec *RegistrationRecord, maxStake float64) (fresh, stake float64) {
+	fresh = 1 - float64(r.now().Sub(rec.LastSeen))/float64(r.pruneAfter())
+	fresh = min(max(fresh, 0), 1)
+	if maxStake > 0 {
+		stake = min(max(rec.Stake/maxStake, 0), 1)
+	}
+	return fresh, stake
+}
+
+// rankSignals are one candidate's normalized inputs to the weighted score.
+type rankSignals struct {
+	Cost, Stake, Latency, Reputation float64
+}
+
+// score returns the weighted score of every record, index-aligned.
+// Callers must hold r.mu since records are live registry entries.
+func (w RankWeights) score(records []*RegistrationRecord) []float64 {
+	signals := w.signals(records)
+	scores := make([]float64, len(records))
+	for i := range records {
+		scores[i] = w.combine(signals[i])
+	}
+	return scores
+}
+
+// combine is the weighted mean of one candidate's signals (0 when every
+// weight is 0).
+func (w RankWeights) combine(s rankSignals) float64 {
+	total := w.Cost + w.Stake + w.Latency + w.Reputation
+	if total <= 0 {
+		return 0
+	}
+	return (w.Cost*s.Cost + w.Stake*s.Stake + w.Latency*s.Latency + w.Reputation*s.Reputation) / total
+}
+
+// signals normalizes every record's ranking inputs across the candidate
+// set, index-aligned. Callers must hold r.mu.
+func (w RankWeights) signals(records []*RegistrationRecord) []rankSignals {
+	n := len(records)
+	cost := make([]float64, n)
+	stake := make([]float64, n)
+	latency := make([]float64, n)
+	measured := make([]bool, n)
+	reputation := make([]float64, n)
+
+	for i, rec := range records {
+		cost[i] = rec.ServiceCard.CostPerOp
+		stake[i] = rec.Stake
+		if rec.Latency > 0 {
+			latency[i] = rec.Latency.Seconds()
+			measured[i] = true
+		}
+		reputation[i] = 1 / float64(1+rec.MissedHeartbeats)
+	}
+
+	costN := normalize(cost, nil, true)
+	stakeN := normalize(stake, nil, false)
+	latencyN := normalize(latency, measured, true)
+
+	out := make([]rankSignals, n)
+	for i := range records {
+		out[i] = rankSignals{Cost: costN[i], Stake: stakeN[i], Latency: latencyN[i], Reputation: reputation[i]}
+	}
+	return out
+}
+
+// rank sorts records best-first by weighted score. Ties keep their order.
+func (w RankWeights) rank(records []*RegistrationRecord) {
+	scores := w.score(records)
+	idx := make([]int, len(records))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return scores[idx[a]] > scores[idx[b]]
+	})
+	sorted := make([]*RegistrationRecord, len(records))
+	for i, j := range idx {
+		sorted[i] = records[j]
+	}
+	copy(records, sorted)
+}
+
+// normalize min-max scales values to [0,1]. Entries with present[i] == false
+// (when present is non-nil) get a neutral 0.5 and don't affect the range.
+// With invert, the smallest value maps to 1.
+func normalize(values []float64, present []bool, invert bool) []float64 {
+	out := make([]float64, len(values))
+	lo, hi, seen := 0.0, 0.0, false
+	for i, v := range values {
+		if present != nil && !present[i] {
+			continue
+		}
+		if !seen || v < lo {
+			lo = v
+		}
+		if !seen || v > hi {
+			hi = v
+		}
+		seen = true
+	}
+	for i, v := range values {
+		switch {
+		case present != nil && !present[i]:
+			out[i] = 0.5
+		case hi == lo:
+			out[i] = 1
+		case invert:
+			out[i] = (hi - v) / (hi - lo)
+		default:
+			out[i] = (v - lo) / (hi - lo)
+		}
+	}
+	return out
+}
+
+// bestProvider returns the top-ranked provider of serviceName that passes
+// filter, its card for that service, and how many providers passed; best
+// is nil when none did. Callers must hold r.mu.
+func (r *RegistryNode) bestProvider(serviceName string, filter providerFilter) (*RegistrationRecord, common.ServiceCard, int) {
+	records := []*RegistrationRecord{}
+	for _, pid := range r.ServiceIndex[serviceName] {
+		if reg, ok := r.Registrations[pid]; ok && filter.match(reg, serviceName) {
+			records = append(records, reg)
+		}
+	}
+	if len(records) == 0 {
+		return nil, common.ServiceCard{}, 0
+	}
+	r.rankWeights.rank(records)
+
+	card, _ := records[0].card(serviceName)
+	card.Embedding = nil
+	return records[0], card, len(records)
+}
+
+// freshness scores how recently a provider heartbeated for semantic search:
+// 1 just after a heartbeat, falling linearly to 0 at the heartbeat TTL.
+// ok is false once the TTL has passed; search leaves such providers out
+// even while they wait out their grace windows or linger in Qdrant, unless
+// asked to demote them instead (?demote_stale=true).
+func (r *RegistryNode) freshness(rec *RegistrationRecord) (float64, bool) {
+	age := r.now().Sub(rec.LastSeen)
+	if age > r.heartbeatTTL {
+		return 0, false
+	}
+	if age < 0 {
+		age = 0
+	}
+	return 1 - float64(age)/float64(r.heartbeatTTL), true
+}
+
+// staleness is how far a provider is through its prune window: 0 just
+// after a heartbeat, rising linearly to 1 when gcLoop may prune it.
+func (r *RegistryNode) staleness(rec *RegistrationRecord) float64 {
+	window := r.pruneAfter()
+	if window <= 0 {
+		return 0
+	}
+	return min(1, max(0, float64(r.now().Sub(rec.LastSeen))/float64(window)))
+}
+
+// demoteStale reorders records, already ranked or sorted, for
+// ?demote_stale=true: each provider's standing (1 at the top, falling by
+// position) is scaled by 1 - staleness, so stale providers sink below
+// fresher ones in proportion to their staleness but stay listed.
+func (r *RegistryNode) demoteStale(records []*RegistrationRecord) {
+	standing := make(map[*RegistrationRecord]float64, len(records))
+	for i, rec := range records {
+		standing[rec] = (1 - float64(i)/float64(len(records))) * (1 - r.staleness(rec))
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return standing[records[i]] > standing[records[j]]
+	})
+}
+
+// demotedScore scales a search score by 1 - staleness when demote is set.
+func (r *RegistryNode) demotedScore(rec *RegistrationRecord, score float64, demote bool) float64 {
+	if !demote {
+		return score
+	}
+	return score * (1 - r.staleness(rec))
+}
+
+// searchScore blends a hit's relevance with its provider's freshness using
+// -search-freshness-weight.
+func (r *RegistryNode) searchScore(relevance, fresh float64) float64 {
+	return (1-r.freshnessWeight)*relevance + r.freshnessWeight*fresh
+}
+
+// sortSearchResults orders hits by blended score, best first, breaking ties
+// by service name.
+func sortSearchResults(results []searchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ServiceName < results[j].ServiceName
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"prxs/common"
+)
+
+func TestSemanticSearchFreshness(t *testing.T) {
+	r := newTestRegistry(t)
+	clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+	r.clock = clock
+	r.freshnessWeight = 0.5
+	qdrant, _ := withEmbedding(t, r)
+	router := r.setupRESTAPI()
+
+	// The stale provider is the closest match, the expired one closer
+	// still; both last heartbeated before the fresh one
+	providers := []struct {
+		service string
+		age     time.Duration
+		score   float64
+	}{
+		{"fresh", 0, 0.85},
+		{"stale", 72 * time.Second, 0.95},    // Freshness 0.2
+		{"expired", 120 * time.Second, 0.99}, // Past the 90s heartbeat TTL
+	}
+	for _, p := range providers {
+		pid := newTestPeer(t).ID()
+		addProvider(r, pid, common.ServiceCard{Name: p.service}).LastSeen = clock.Now().Add(-p.age)
+		qdrant.hits = append(qdrant.hits, qdrantSearchResult{
+			Score:   p.score,
+			Payload: map[string]interface{}{"service_name": p.service, "peer_id": pid.String()},
+		})
+	}
+
+	search := func(query string) []string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/services/semantic_search?q=x"+query, nil))
+		var body struct{ Results []searchResult }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %s", err, w.Body)
+		}
+		var names []string
+		for _, res := range body.Results {
+			names = append(names, res.ServiceName)
+		}
+		return names
+	}
+	if got, want := search(""), []string{"fresh", "stale"}; !slices.Equal(got, want) {
+		t.Fatalf("results %v, want %v", got, want)
+	}
+	// Demoting keeps the expired provider, below the others
+	if got, want := search("&demote_stale=true"), []string{"fresh", "stale", "expired"}; !slices.Equal(got, want) {
+		t.Fatalf("results with demote_stale %v, want %v", got, want)
+	}
+}
+
+func TestDemotedScore(t *testing.T) {
+	r := newTestRegistry(t)
+	clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+	r.clock = clock
+	window := r.pruneAfter()
+
+	tests := []struct {
+		age  time.Duration
+		want float64
+	}{
+		{0, 0.8},
+		{window / 4, 0.6},
+		{window / 2, 0.4},
+		{window, 0},
+		{2 * window, 0},
+	}
+	for _, tt := range tests {
+		rec := &RegistrationRecord{LastSeen: clock.Now().Add(-tt.age)}
+		if got := r.demotedScore(rec, 0.8, true); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("age %s: demotedScore = %v, want %v", tt.age, got, tt.want)
+		}
+		if got := r.demotedScore(rec, 0.8, false); got != 0.8 {
+			t.Errorf("age %s: score changed without demote: %v", tt.age, got)
+		}
+	}
+}
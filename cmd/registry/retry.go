@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// retryQueue is a dead-letter queue for writes to Redis and Qdrant that
+// failed. Instead of logging and forgetting them, failed writes are kept and
+// replayed by a background loop until the dependency recovers.
+//
+// Entries are keyed by the state they write (e.g. one Redis registration),
+// so a newer write for the same key replaces a pending one and a successful
+// write clears it; replay can therefore never resurrect stale state. The
+// queue is bounded in memory: when full the oldest entry is dropped and
+// logged, and the reconciliation on the next restore/heartbeat repairs it.
+type retryQueue struct {
+	mu      sync.Mutex
+	entries map[string]*retryEntry
+	order   []string // insertion order, oldest first
+	max     int
+}
+
+type retryEntry struct {
+	desc     string
+	fn       func() error
+	attempts int
+}
+
+func newRetryQueue(max int) *retryQueue {
+	return &retryQueue{
+		entries: make(map[string]*retryEntry),
+		max:     max,
+	}
+}
+
+// do runs fn once and returns its error. On failure the write is queued
+// under key for replay; on success any pending write for key is discarded
+// since it is superseded.
+func (q *retryQueue) do(key, desc string, fn func() error) error {
+	err := fn()
+	if q == nil {
+		if err != nil {
+			log.Printf("[Reg] Warning: %s failed: %v", desc, err)
+		}
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err == nil {
+		q.remove(key)
+		return nil
+	}
+
+	log.Printf("[Reg] Warning: %s failed, queued for retry: %v", desc, err)
+	q.remove(key)
+	if q.max > 0 && len(q.order) >= q.max {
+		oldest := q.order[0]
+		log.Printf("[Reg] Warning: retry queue full, dropping %s", q.entries[oldest].desc)
+		q.remove(oldest)
+	}
+	q.entries[key] = &retryEntry{desc: desc, fn: fn, attempts: 1}
+	q.order = append(q.order, key)
+	retryQueueDepth.Set(float64(len(q.order)))
+	return err
+}
+
+// remove deletes key from the queue. Callers must hold q.mu.
+func (q *retryQueue) remove(key string) {
+	if _, ok := q.entries[key]; !ok {
+		return
+	}
+	delete(q.entries, key)
+	for i, k := range q.order {
+		if k == key {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+	retryQueueDepth.Set(float64(len(q.order)))
+}
+
+// replay retries every queued write once, oldest first.
+func (q *retryQueue) replay() {
+	q.mu.Lock()
+	keys := append([]string(nil), q.order...)
+	q.mu.Unlock()
+
+	for _, key := range keys {
+		q.mu.Lock()
+		entry, ok := q.entries[key]
+		q.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		err := entry.fn()
+
+		q.mu.Lock()
+		// Skip bookkeeping if a newer write replaced the entry meanwhile.
+		if q.entries[key] == entry {
+			if err == nil {
+				log.Printf("[Reg] Retried %s successfully after %d attempt(s)", entry.desc, entry.attempts)
+				q.remove(key)
+			} else {
+				entry.attempts++
+			}
+		}
+		q.mu.Unlock()
+	}
+}
+
+// loop replays the queue every interval.
+func (q *retryQueue) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		q.replay()
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"prxs/common"
+	"prxs/storage"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// flakySaveStore fails the first failures saves, then behaves like the
+// wrapped store.
+type flakySaveStore struct {
+	storage.Storage
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (s *flakySaveStore) SaveRegistration(ctx context.Context, pid peer.ID, rec *storage.RegistrationRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	s.attempts++
+	fail := s.attempts <= s.failures
+	s.mu.Unlock()
+	if fail {
+		return errors.New("redis unavailable")
+	}
+	return s.Storage.SaveRegistration(ctx, pid, rec, ttl)
+}
+
+func TestRetryQueueReplaysFailedSave(t *testing.T) {
+	r := newTestRegistry(t)
+	store := &flakySaveStore{Storage: r.regStore, failures: 2}
+	r.regStore = store
+	p := newTestPeer(t)
+	registerAs(t, r, p, common.ServiceCard{Name: "svc"})
+
+	ctx := context.Background()
+	if _, err := r.regStore.LoadRegistration(ctx, p.ID()); err == nil {
+		t.Fatal("failed save persisted")
+	}
+	if len(r.retries.order) != 1 {
+		t.Fatalf("retry queue holds %d writes, want 1", len(r.retries.order))
+	}
+
+	// The second attempt fails too and stays queued; the third lands
+	r.retries.replay()
+	if len(r.retries.order) != 1 || r.retries.entries[r.retries.order[0]].attempts != 2 {
+		t.Fatalf("after a failed replay: %v", r.retries.order)
+	}
+	r.retries.replay()
+	if len(r.retries.order) != 0 {
+		t.Fatalf("retry queue holds %v after the write succeeded", r.retries.order)
+	}
+	stored, err := r.regStore.LoadRegistration(ctx, p.ID())
+	if err != nil || stored.ServiceCard.Name != "svc" {
+		t.Fatalf("registration not persisted after replay: %+v, %v", stored, err)
+	}
+}
+
+func TestRetryQueueNewerWriteSupersedes(t *testing.T) {
+	q := newRetryQueue(10)
+	stale := 0
+	q.do("key", "stale write", func() error {
+		stale++
+		return errors.New("down")
+	})
+	if err := q.do("key", "fresh write", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	q.replay()
+	if stale != 1 || len(q.order) != 0 {
+		t.Fatalf("stale write replayed %d times, queue %v", stale, q.order)
+	}
+}
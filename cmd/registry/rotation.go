@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+)
+
+// defaultRotationWindow is how long the previous key stays valid when
+// -previous-key is given without -key-rotation-until.
+const defaultRotationWindow = 24 * time.Hour
+
+// keyRotation is an in-progress move from a previous registry key to the
+// current one. Until the proof expires, a second host keeps answering under
+// the previous identity and every attestation carries the proof, so clients
+// that pinned the old peer ID keep verifying responses.
+type keyRotation struct {
+	proof *common.KeyRotation
+	host  host.Host // Serves the previous identity; closed on expiry
+}
+
+// active reports whether the rotation window is still open at now.
+func (k *keyRotation) active(now time.Time) bool {
+	return k != nil && now.Unix() <= k.proof.Expires
+}
+
+// startKeyRotation signs the rotation proof with prev and brings up the
+// previous identity on port until the window closes.
+func (r *RegistryNode) startKeyRotation(ctx context.Context, prev crypto.PrivKey, until time.Time, port int, bootstrap []string, devMode bool, dhtPrefix string) error {
+	cur := r.Host.Peerstore().PrivKey(r.Host.ID())
+	proof, err := common.NewKeyRotation(prev, cur, until)
+	if err != nil {
+		return fmt.Errorf("failed to sign key rotation: %v", err)
+	}
+	if !until.After(time.Now()) {
+		return fmt.Errorf("key rotation window already ended at %s", until.Format(time.RFC3339))
+	}
+
+	h, err := libp2p.New(common.CommonLibp2pOptions(port, prev, nil)...)
+	if err != nil {
+		return fmt.Errorf("failed to start previous identity: %v", err)
+	}
+	r.rotation = &keyRotation{proof: proof, host: h}
+	h.SetStreamHandler(common.RegistryProtocolID, r.handleStream)
+	h.SetStreamHandler(common.RegistryProtocolPB, r.handleStream)
+
+	ctx, cancel := context.WithDeadline(ctx, until)
+	kademliaDHT, err := common.SetupDHT(ctx, h, bootstrap, devMode, dhtPrefix)
+	if err != nil {
+		cancel()
+		h.Close()
+		return fmt.Errorf("failed to set up DHT for previous identity: %v", err)
+	}
+
+	log.Printf("[Reg] Key rotation: previous identity %s served until %s\n", h.ID(), until.Format(time.RFC3339))
+	common.PrintMyAddresses(h)
+
+	go func() {
+		defer cancel()
+		rd := routing.NewRoutingDiscovery(kademliaDHT)
+		for {
+			dutil.Advertise(ctx, rd, common.RegistryRendezvous)
+			select {
+			case <-ctx.Done():
+				kademliaDHT.Close()
+				h.Close()
+				log.Printf("[Reg] Key rotation window ended; previous identity %s retired\n", h.ID().ShortString())
+				return
+			case <-time.After(time.Minute):
+			}
+		}
+	}()
+	return nil
+}
+
+// attest signs a find response with the current key, attaching the rotation
+// proof while the previous key is still being honoured.
+func (r *RegistryNode) attest(query string, resp *common.RegistryResponse) {
+	if err := common.AttestFindResponse(r.Host.Peerstore().PrivKey(r.Host.ID()), query, resp); err != nil {
+		log.Printf("[Reg] Failed to attest find response: %v\n", err)
+		return
+	}
+	if r.rotation.active(r.now()) {
+		resp.Attestation.Rotation = r.rotation.proof
+	}
+}
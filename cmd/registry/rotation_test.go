@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+func TestKeyRotationWindow(t *testing.T) {
+	r := newTestRegistry(t)
+	clock := common.NewMockClock(time.Now())
+	r.clock = clock
+	cur := r.Host.Peerstore().PrivKey(r.Host.ID())
+	prev, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := common.NewKeyRotation(prev, cur, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.rotation = &keyRotation{proof: proof}
+
+	p := newTestPeer(t)
+	registerAs(t, r, p, common.ServiceCard{Name: "svc"})
+	find := func() *common.RegistryResponse {
+		t.Helper()
+		resp := r.handleRequest(p.ID(), common.RegistryRequest{Method: "find", Query: "svc"})
+		if !resp.Success || resp.Attestation == nil {
+			t.Fatalf("find: %+v", resp)
+		}
+		return &resp
+	}
+
+	// Inside the window: the new key signs, and clients pinned to the old
+	// one accept it through the attached proof
+	resp := find()
+	if err := common.VerifyFindResponse(cur.GetPublic(), "svc", resp, time.Minute); err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	if err := common.VerifyFindResponse(prev.GetPublic(), "svc", resp, time.Minute); err != nil {
+		t.Fatalf("previous key during the window: %v", err)
+	}
+
+	// Past the window the proof is no longer attached
+	clock.Advance(time.Hour + time.Second)
+	resp = find()
+	if resp.Attestation.Rotation != nil {
+		t.Fatal("rotation proof attached after the window closed")
+	}
+	if err := common.VerifyFindResponse(cur.GetPublic(), "svc", resp, time.Minute); err != nil {
+		t.Fatalf("new key after the window: %v", err)
+	}
+	if err := common.VerifyFindResponse(prev.GetPublic(), "svc", resp, time.Minute); err == nil {
+		t.Fatal("previous key accepted after the window")
+	}
+}
+
+func TestKeyRotationVerifyExpiry(t *testing.T) {
+	prev, _, _ := crypto.GenerateEd25519Key(rand.Reader)
+	cur, _, _ := crypto.GenerateEd25519Key(rand.Reader)
+	expires := time.Unix(1_700_000_000, 0)
+	proof, err := common.NewKeyRotation(prev, cur, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := proof.Verify(prev.GetPublic(), expires); err != nil {
+		t.Fatalf("at expiry: %v", err)
+	}
+	if _, err := proof.Verify(prev.GetPublic(), expires.Add(time.Second)); err == nil {
+		t.Fatal("accepted after expiry")
+	}
+	if _, err := proof.Verify(cur.GetPublic(), expires); err == nil {
+		t.Fatal("accepted against the wrong previous key")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// defaultStopwords is used for -embedding-stopwords=default: English
+// function words plus terms nearly every card contains, which only pull
+// unrelated services' vectors together.
+var defaultStopwords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "by", "for", "from", "in",
+	"into", "is", "it", "its", "of", "on", "or", "that", "the", "this", "to",
+	"with", "your", "you", "can", "will", "given", "using", "via",
+	"service", "services", "tool", "agent", "inputs", "outputs", "tags",
+}
+
+// parseStopwords turns the -embedding-stopwords value into a set: "" disables
+// removal, "default" selects defaultStopwords, anything else is a
+// comma-separated list.
+func parseStopwords(s string) map[string]bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	words := defaultStopwords
+	if s != "default" {
+		words = strings.Split(s, ",")
+	}
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			set[w] = true
+		}
+	}
+	return set
+}
+
+// stemWord strips a few common English suffixes so "translating",
+// "translated" and "translates" embed alike. It is deliberately crude; stems
+// shorter than three letters are left alone.
+func stemWord(w string) string {
+	for _, suffix := range []string{"ing", "ed", "es", "ly", "s"} {
+		if strings.HasSuffix(w, suffix) && len(w)-len(suffix) >= 3 {
+			if suffix == "s" && strings.HasSuffix(w, "ss") {
+				return w
+			}
+			return strings.TrimSuffix(w, suffix)
+		}
+	}
+	return w
+}
+
+// preprocessTokens lowercases s, splits it into words, drops stopwords and
+// optionally stems the rest. Text made up only of stopwords is returned
+// lowercased rather than emptied, so it still embeds to something.
+func preprocessTokens(s string, stopwords map[string]bool, stem bool) string {
+	s = strings.ToLower(s)
+	words := strings.FieldsFunc(s, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+	kept := words[:0]
+	for _, w := range words {
+		if stopwords[w] {
+			continue
+		}
+		if stem {
+			w = stemWord(w)
+		}
+		kept = append(kept, w)
+	}
+	if len(kept) == 0 {
+		return s
+	}
+	return strings.Join(kept, " ")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"prxs/common"
+)
+
+func TestParseStopwords(t *testing.T) {
+	if set := parseStopwords("  "); set != nil {
+		t.Errorf("blank value: %v, want nil", set)
+	}
+	if set := parseStopwords("default"); len(set) != len(defaultStopwords) || !set["the"] || !set["service"] {
+		t.Errorf("default: %v", set)
+	}
+	set := parseStopwords(" Foo, bar ,,BAZ")
+	if len(set) != 3 || !set["foo"] || !set["bar"] || !set["baz"] {
+		t.Errorf("custom list: %v", set)
+	}
+}
+
+func TestPreprocessTokens(t *testing.T) {
+	stop := parseStopwords("default")
+	for _, tt := range []struct {
+		in   string
+		stem bool
+		want string
+	}{
+		{"Translate the text into French", false, "translate text french"},
+		{"A service for translating documents", true, "translat document"},
+		{"translated, translates; translating!", true, "translat translat translat"},
+		{"class glass bus", true, "class glass bus"},
+		{"The Tool", false, "the tool"}, // All stopwords: kept, lowercased
+	} {
+		if got := preprocessTokens(tt.in, stop, tt.stem); got != tt.want {
+			t.Errorf("preprocessTokens(%q, stem=%v) = %q, want %q", tt.in, tt.stem, got, tt.want)
+		}
+	}
+}
+
+func TestStopwordsEmbeddingInput(t *testing.T) {
+	r := newTestRegistry(t)
+	r.stopwords = parseStopwords("default")
+	_, embedder := withEmbedding(t, r)
+
+	// Filler around a card's name doesn't change what gets embedded
+	for _, name := range []string{"weather forecast", "The weather forecast service"} {
+		if _, err := r.embedCard(context.Background(), common.ServiceCard{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := embedder.calls(); calls[0] != "weather forecast" || calls[1] != calls[0] {
+		t.Fatalf("embedder saw %q", calls)
+	}
+	if got, want := r.embeddingInput("Forecast for the weather"), "forecast weather"; got != want {
+		t.Errorf("query input = %q, want %q", got, want)
+	}
+
+	// Without a stopword list the text passes through untouched
+	r.stopwords = nil
+	if got := r.embeddingInput("The Weather"); got != "The Weather" {
+		t.Errorf("stopwords disabled: %q", got)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldText applies NFKC normalization and strips diacritics, so "Café",
+// "Cafe" and the compatibility forms of either compare equal once
+// lowercased.
+func foldText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFKC)
+	out, _, err := transform.String(t, s)
+	if err != nil {
+		return s
+	}
+	return out
+}
+
+// matchText is the form of s used for keyword and name matching:
+// lowercased, and folded when -fold-text is enabled.
+func (r *RegistryNode) matchText(s string) string {
+	if r.foldText {
+		s = foldText(s)
+	}
+	return strings.ToLower(s)
+}
+
+// embeddingInput is the form of s sent to the embedder: folded and
+// lowercased when -fold-text is enabled, then stripped of stopwords and
+// stemmed when -embedding-stopwords / -embedding-stem are set. Cards and
+// queries both go through it so they stay comparable.
+func (r *RegistryNode) embeddingInput(s string) string {
+	if r.foldText {
+		s = strings.ToLower(foldText(s))
+	}
+	if r.stopwords != nil || r.stemWords {
+		s = preprocessTokens(s, r.stopwords, r.stemWords)
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"prxs/common"
+)
+
+func TestFoldTextMatching(t *testing.T) {
+	for _, fold := range []bool{false, true} {
+		r := newTestRegistry(t)
+		r.foldText = fold
+		p := newTestPeer(t)
+		registerAs(t, r, p, common.ServiceCard{Name: "Café Finder"})
+
+		for _, tt := range []struct {
+			query string
+			plain bool // Matches without folding too
+		}{
+			{"cafe", false},
+			{"ｃａｆｅ", false},
+			{"CAFÉ", true},
+		} {
+			resp := r.handleRequest(p.ID(), common.RegistryRequest{Method: "find", Query: tt.query})
+			if found := len(resp.Providers) == 1; found != (fold || tt.plain) {
+				t.Errorf("fold=%v: find %q matched %v", fold, tt.query, found)
+			}
+		}
+	}
+}
+
+func TestFoldTextEmbeddingInput(t *testing.T) {
+	r := newTestRegistry(t)
+	r.foldText = true
+	want := r.embeddingInput("cafe")
+	for _, s := range []string{"café", "Café", "CAFÉ", "ｃａｆｅ"} {
+		if got := r.embeddingInput(s); got != want {
+			t.Errorf("embeddingInput(%q) = %q, want %q", s, got, want)
+		}
+	}
+
+	// Identical inputs embed identically, so the vectors' similarity is 1
+	_, embedder := withEmbedding(t, r)
+	a, err := r.embedCard(context.Background(), common.ServiceCard{Name: "café"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.embedCard(context.Background(), common.ServiceCard{Name: "cafe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := embedder.calls(); calls[0] != calls[1] {
+		t.Fatalf("embedder saw %q and %q", calls[0], calls[1])
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("vectors differ: %v and %v", a, b)
+		}
+	}
+}
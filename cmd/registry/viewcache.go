@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCachedViews bounds the cache; query strings are caller-controlled, so
+// once full it is simply emptied.
+const maxCachedViews = 64
+
+// viewCache keeps rendered responses of the full listings (/services,
+// /services_full) for -read-cache-ttl, so a burst of identical reads walks
+// the registrations once. An entry is only served while the registry's
+// view generation is unchanged, so any state change busts it immediately.
+// Only anonymous callers are cached: an access token changes what a caller
+// may see.
+type viewCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedView
+}
+
+type cachedView struct {
+	gen   uint64
+	built time.Time
+	body  []byte
+}
+
+func newViewCache(ttl time.Duration) *viewCache {
+	return &viewCache{ttl: ttl, entries: make(map[string]cachedView)}
+}
+
+func (vc *viewCache) get(key string, gen uint64, now time.Time) ([]byte, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	v, ok := vc.entries[key]
+	if !ok || v.gen != gen || now.Sub(v.built) > vc.ttl {
+		return nil, false
+	}
+	return v.body, true
+}
+
+func (vc *viewCache) put(key string, gen uint64, body []byte, now time.Time) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if len(vc.entries) >= maxCachedViews {
+		vc.entries = make(map[string]cachedView)
+	}
+	vc.entries[key] = cachedView{gen: gen, built: now, body: body}
+}
+
+// touchView records a change to anything the cached listings show.
+// Callers must hold r.mu.
+func (r *RegistryNode) touchView() {
+	r.viewGen.Add(1)
+}
+
+// writeView responds with the listing produced by build, which runs under
+// r.mu, reusing a cached rendering when one is still valid.
+func (r *RegistryNode) writeView(c *gin.Context, build func() gin.H) {
+	key := ""
+	if r.views != nil && restAccess(c).Token == "" {
+		key = c.Request.URL.Path + "?" + c.Request.URL.RawQuery
+		if body, ok := r.views.get(key, r.viewGen.Load(), r.now()); ok {
+			c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+			return
+		}
+	}
+
+	r.mu.Lock()
+	gen := r.viewGen.Load()
+	resp := build()
+	r.mu.Unlock()
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if key != "" {
+		r.views.put(key, gen, body, r.now())
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestViewCacheHeartbeat(t *testing.T) {
+	r := newTestRegistry(t)
+	r.views = newViewCache(time.Minute)
+	clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+	r.clock = clock
+	router := r.setupRESTAPI()
+
+	first, second := newTestPeer(t), newTestPeer(t)
+	heartbeat := registerAs(t, r, first, common.ServiceCard{Name: "svc"})
+	clock.Advance(time.Second)
+	registerAs(t, r, second, common.ServiceCard{Name: "svc"})
+
+	newest := func() string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/services_full?sort=last_seen", nil))
+		var body struct {
+			Services map[string]struct{ Providers []struct{ ID string } }
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Services["svc"].Providers) != 2 {
+			t.Fatalf("listing: %s", w.Body)
+		}
+		return body.Services["svc"].Providers[0].ID
+	}
+	if got := newest(); got != second.ID().String() {
+		t.Fatalf("newest provider %s, want %s", got, second.ID())
+	}
+
+	// A heartbeat without ProviderInfo only moves LastSeen, which must
+	// still bust the cached listing
+	clock.Advance(time.Second)
+	heartbeat.ProviderInfo = nil
+	if resp := r.handleRequest(first.ID(), heartbeat); !resp.Success {
+		t.Fatalf("heartbeat failed: %s", resp.Error)
+	}
+	if got := newest(); got != first.ID().String() {
+		t.Fatalf("newest provider after heartbeat %s, want %s", got, first.ID())
+	}
+}
+
+func TestViewCacheGet(t *testing.T) {
+	vc := newViewCache(time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	vc.put("/services?", 3, []byte("body"), now)
+
+	for _, tt := range []struct {
+		name string
+		key  string
+		gen  uint64
+		at   time.Time
+		hit  bool
+	}{
+		{"fresh", "/services?", 3, now.Add(time.Minute), true},
+		{"other query", "/services?sort=name", 3, now, false},
+		{"newer generation", "/services?", 4, now, false},
+		{"expired", "/services?", 3, now.Add(time.Minute + time.Second), false},
+	} {
+		if body, ok := vc.get(tt.key, tt.gen, tt.at); ok != tt.hit || (ok && string(body) != "body") {
+			t.Errorf("%s: got %q, %v; want hit=%v", tt.name, body, ok, tt.hit)
+		}
+	}
+
+	// A full cache starts over rather than growing
+	for i := 0; i < maxCachedViews; i++ {
+		vc.put(time.Duration(i).String(), 3, nil, now)
+	}
+	if len(vc.entries) > maxCachedViews {
+		t.Fatalf("%d entries, want at most %d", len(vc.entries), maxCachedViews)
+	}
+}
+
+func TestViewCacheTouchView(t *testing.T) {
+	r := newTestRegistry(t)
+	r.views = newViewCache(time.Minute)
+	clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+	r.clock = clock
+	router := r.setupRESTAPI()
+
+	total := func() int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/services", nil))
+		var body struct{ Total int }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("listing: %v: %s", err, w.Body)
+		}
+		return body.Total
+	}
+
+	// sneak adds a registration without touching the view
+	sneak := func(name string) {
+		pid := newTestPeer(t).ID()
+		r.mu.Lock()
+		r.Registrations[pid] = &RegistrationRecord{LastSeen: r.now(), ServiceCard: common.ServiceCard{Name: name}, AddrInfo: peer.AddrInfo{ID: pid}}
+		r.mu.Unlock()
+	}
+
+	addProvider(r, newTestPeer(t).ID(), common.ServiceCard{Name: "a"})
+	if got := total(); got != 1 {
+		t.Fatalf("total = %d, want 1", got)
+	}
+
+	// Until the view is touched the cached listing is served
+	sneak("b")
+	if got := total(); got != 1 {
+		t.Fatalf("total = %d, want the cached 1", got)
+	}
+
+	r.mu.Lock()
+	r.touchView()
+	r.mu.Unlock()
+	if got := total(); got != 2 {
+		t.Fatalf("total after touchView = %d, want 2", got)
+	}
+
+	// Untouched changes still show once the TTL runs out
+	sneak("c")
+	clock.Advance(time.Minute + time.Second)
+	if got := total(); got != 3 {
+		t.Fatalf("total after the TTL = %d, want 3", got)
+	}
+}
@@ -0,0 +1,20 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Service visibility values for ServiceCard.Visibility.
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// HashAccessToken is the form of an access token a provider publishes in
+// ServiceCard.TokenHashes: hex-encoded SHA-256, so cards never carry the
+// token itself.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
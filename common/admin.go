@@ -0,0 +1,123 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Admin RPC methods. An operator first asks for a challenge, then sends an
+// AdminCommand signed over the returned nonce with one of the registry's
+// authorized admin keys. Nonces are single-use and short-lived.
+const (
+	RegistryMethodAdminChallenge = "admin_challenge"
+	RegistryMethodAdmin          = "admin"
+)
+
+// Admin actions. Target is a provider peer ID for prune and ban, and a
+// stake owner for deregister_staker.
+const (
+	AdminActionPrune            = "prune"             // Drop a provider's registration
+	AdminActionBan              = "ban"               // Drop it and refuse its registrations for Duration
+	AdminActionDeregisterStaker = "deregister_staker" // Drop every provider the staker backs
+)
+
+// adminPurpose domain-separates admin commands from every other payload a
+// key signs.
+const adminPurpose = "prxs-registry-admin"
+
+// AdminCommand is a privileged registry operation, signed by an admin key
+// over the nonce the registry issued for it.
+type AdminCommand struct {
+	Action   string `json:"action"`
+	Target   string `json:"target"`
+	Duration int    `json:"duration,omitempty"` // Ban length in seconds
+	Nonce    string `json:"nonce"`
+
+	PubKey    []byte `json:"pub_key"`
+	Signature []byte `json:"signature"`
+}
+
+// adminSigningPayload is the canonical form covered by the command
+// signature; fields are in alphabetical order like the other payloads.
+// Registry binds the command to the registry that issued the nonce.
+type adminSigningPayload struct {
+	Action   string `json:"action"`
+	Duration int    `json:"duration"`
+	Nonce    string `json:"nonce"`
+	Purpose  string `json:"purpose"`
+	Registry string `json:"registry"`
+	Target   string `json:"target"`
+}
+
+func (cmd *AdminCommand) digest(registry peer.ID) [32]byte {
+	b, _ := json.Marshal(adminSigningPayload{
+		Action:   cmd.Action,
+		Duration: cmd.Duration,
+		Nonce:    cmd.Nonce,
+		Purpose:  adminPurpose,
+		Registry: registry.String(),
+		Target:   cmd.Target,
+	})
+	return sha256.Sum256(b)
+}
+
+// Sign signs cmd for registry with key.
+func (cmd *AdminCommand) Sign(key crypto.PrivKey, registry peer.ID) error {
+	pub, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		return err
+	}
+	cmd.PubKey = pub
+	digest := cmd.digest(registry)
+	sig, err := key.Sign(digest[:])
+	if err != nil {
+		return err
+	}
+	cmd.Signature = sig
+	return nil
+}
+
+// Verify checks cmd's signature for registry and returns the peer ID of the
+// key that signed it. Whether that key is authorized, and whether the nonce
+// is one the registry issued, is up to the caller.
+func (cmd *AdminCommand) Verify(registry peer.ID) (peer.ID, error) {
+	pub, err := crypto.UnmarshalPublicKey(cmd.PubKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid admin key: %v", err)
+	}
+	signer, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	digest := cmd.digest(registry)
+	ok, err := pub.Verify(digest[:], cmd.Signature)
+	if err != nil {
+		return "", fmt.Errorf("admin signature check failed: %v", err)
+	}
+	if !ok {
+		return "", fmt.Errorf("invalid admin signature")
+	}
+	return signer, nil
+}
+
+// RunAdminCommand performs the challenge handshake on rs and executes cmd
+// (Action, Target and Duration set) signed with key.
+func RunAdminCommand(rs *RegistryStream, registry peer.ID, key crypto.PrivKey, cmd AdminCommand, timeout time.Duration) (*RegistryResponse, error) {
+	challenge, err := rs.Call(RegistryRequest{Method: RegistryMethodAdminChallenge}, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if !challenge.Success {
+		return nil, fmt.Errorf("admin challenge refused: %s", challenge.Error)
+	}
+	cmd.Nonce = challenge.Nonce
+	if err := cmd.Sign(key, registry); err != nil {
+		return nil, fmt.Errorf("failed to sign admin command: %v", err)
+	}
+	return rs.Call(RegistryRequest{Method: RegistryMethodAdmin, Admin: &cmd}, timeout)
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// FindAttestation is the registry's signature over a "find" result. It lets
+// a client detect a relay that added, dropped or rewrote providers between
+// the registry and itself.
+type FindAttestation struct {
+	Registry  string `json:"registry"`
+	Query     string `json:"query"`
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+	Signature []byte `json:"signature"`
+
+	// Rotation, when set, lets clients that know the registry by its
+	// previous key accept a signature made with the new one. It is not
+	// covered by Signature; it carries its own.
+	Rotation *KeyRotation `json:"rotation,omitempty"`
+}
+
+type attestedProvider struct {
+	Addrs []string `json:"addrs"`
+	ID    string   `json:"id"`
+}
+
+// findSigningPayload is the canonical form covered by the attestation
+// signature. As with stakeSigningPayload, fields are in alphabetical order
+// so the JSON encoding is stable.
+type findSigningPayload struct {
+	Nonce     string             `json:"nonce"`
+	Providers []attestedProvider `json:"providers"`
+	Query     string             `json:"query"`
+	Registry  string             `json:"registry"`
+	Timestamp int64              `json:"timestamp"`
+}
+
+// CanonicalFindPayload returns the bytes a registry signs for a "find"
+// result. Providers are sorted by peer ID and their addresses sorted, so
+// the payload doesn't depend on ranking or map iteration order.
+func CanonicalFindPayload(att *FindAttestation, providers []peer.AddrInfo) []byte {
+	list := make([]attestedProvider, 0, len(providers))
+	for _, p := range providers {
+		addrs := make([]string, 0, len(p.Addrs))
+		for _, a := range p.Addrs {
+			addrs = append(addrs, a.String())
+		}
+		sort.Strings(addrs)
+		list = append(list, attestedProvider{Addrs: addrs, ID: p.ID.String()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	b, _ := json.Marshal(findSigningPayload{
+		Nonce:     att.Nonce,
+		Providers: list,
+		Query:     att.Query,
+		Registry:  att.Registry,
+		Timestamp: att.Timestamp,
+	})
+	return b
+}
+
+// AttestFindResponse signs resp.Providers with the registry's host key and
+// stores the attestation on resp.
+func AttestFindResponse(priv crypto.PrivKey, query string, resp *RegistryResponse) error {
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	att := &FindAttestation{
+		Registry:  id.String(),
+		Query:     query,
+		Timestamp: time.Now().Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	digest := sha256.Sum256(CanonicalFindPayload(att, resp.Providers))
+	sig, err := priv.Sign(digest[:])
+	if err != nil {
+		return err
+	}
+	att.Signature = sig
+	resp.Attestation = att
+	return nil
+}
+
+// VerifyFindResponse checks that resp carries a valid attestation from the
+// registry identified by pub for the given query. maxAge bounds how old the
+// attestation may be (0 disables the check). A signature from a different
+// key is accepted only if the attestation carries an unexpired rotation
+// proof from pub naming that key.
+func VerifyFindResponse(pub crypto.PubKey, query string, resp *RegistryResponse, maxAge time.Duration) error {
+	att := resp.Attestation
+	if att == nil {
+		return fmt.Errorf("response is not attested")
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	signer := pub
+	if att.Registry != id.String() {
+		rot := att.Rotation
+		if rot == nil || rot.Current != att.Registry {
+			return fmt.Errorf("attestation signed by %s, expected %s", att.Registry, id)
+		}
+		if signer, err = rot.Verify(pub, time.Now()); err != nil {
+			return fmt.Errorf("attestation signed by %s: %v", att.Registry, err)
+		}
+	}
+	if att.Query != query {
+		return fmt.Errorf("attestation is for query %q, expected %q", att.Query, query)
+	}
+	if maxAge > 0 {
+		age := time.Since(time.Unix(att.Timestamp, 0))
+		if age > maxAge || age < -maxAge {
+			return fmt.Errorf("attestation timestamp outside allowed window (age %s)", age.Round(time.Second))
+		}
+	}
+	digest := sha256.Sum256(CanonicalFindPayload(att, resp.Providers))
+	ok, err := signer.Verify(digest[:], att.Signature)
+	if err != nil {
+		return fmt.Errorf("attestation signature check failed: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("invalid attestation signature")
+	}
+	return nil
+}
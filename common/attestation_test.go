@@ -0,0 +1,75 @@
+package common
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestVerifyFindResponse(t *testing.T) {
+	registry, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := func(port string) peer.AddrInfo {
+		key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := peer.IDFromPrivateKey(key)
+		return peer.AddrInfo{ID: id, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/10.0.0.1/tcp/" + port)}}
+	}
+	a, b, c := provider("4001"), provider("4002"), provider("4003")
+
+	signed := func() *RegistryResponse {
+		resp := &RegistryResponse{Success: true, Providers: []peer.AddrInfo{a, b}}
+		if err := AttestFindResponse(registry, "echo", resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(resp *RegistryResponse)
+		key     crypto.PubKey
+		query   string
+		wantErr bool
+	}{
+		{"valid", func(*RegistryResponse) {}, registry.GetPublic(), "echo", false},
+		{"reordered providers", func(r *RegistryResponse) { r.Providers[0], r.Providers[1] = r.Providers[1], r.Providers[0] }, registry.GetPublic(), "echo", false},
+		{"provider added", func(r *RegistryResponse) { r.Providers = append(r.Providers, c) }, registry.GetPublic(), "echo", true},
+		{"provider dropped", func(r *RegistryResponse) { r.Providers = r.Providers[:1] }, registry.GetPublic(), "echo", true},
+		{"address rewritten", func(r *RegistryResponse) { r.Providers[0].Addrs = c.Addrs }, registry.GetPublic(), "echo", true},
+		{"timestamp changed", func(r *RegistryResponse) { r.Attestation.Timestamp-- }, registry.GetPublic(), "echo", true},
+		{"nonce changed", func(r *RegistryResponse) { r.Attestation.Nonce = "00" }, registry.GetPublic(), "echo", true},
+		{"signature stripped", func(r *RegistryResponse) { r.Attestation = nil }, registry.GetPublic(), "echo", true},
+		{"other query", func(*RegistryResponse) {}, registry.GetPublic(), "other", true},
+		{"other registry", func(*RegistryResponse) {}, other.GetPublic(), "echo", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := signed()
+			tt.tamper(resp)
+			err := VerifyFindResponse(tt.key, tt.query, resp, time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyFindResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A stale attestation fails the age check
+	resp := signed()
+	resp.Attestation.Timestamp -= 3600
+	if err := VerifyFindResponse(registry.GetPublic(), "echo", resp, time.Minute); err == nil {
+		t.Fatal("hour-old attestation accepted with a one-minute window")
+	}
+}
@@ -0,0 +1,390 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	"prxs/common/pb"
+)
+
+// RegistryCodec reads and writes registry RPC messages on a stream. The codec
+// is chosen by the negotiated sub-protocol: RegistryProtocolID carries JSON,
+// RegistryProtocolPB carries varint length-delimited protobuf.
+type RegistryCodec interface {
+	ReadRequest(r *bufio.Reader, req *RegistryRequest) error
+	WriteRequest(w io.Writer, req *RegistryRequest) error
+	ReadResponse(r *bufio.Reader, resp *RegistryResponse) error
+	WriteResponse(w io.Writer, resp *RegistryResponse) error
+}
+
+// RegistryCodecFor returns the codec for a negotiated registry protocol.
+// Anything other than the protobuf protocol uses JSON.
+func RegistryCodecFor(proto protocol.ID) RegistryCodec {
+	if proto == RegistryProtocolPB {
+		return ProtoCodec{}
+	}
+	return JSONCodec{}
+}
+
+// JSONCodec is the default newline-delimited JSON encoding.
+type JSONCodec struct{}
+
+// ReadRequest reads exactly one line so that further requests pipelined on
+// the same stream stay in r (a json.Decoder would buffer past the message).
+func (JSONCodec) ReadRequest(r *bufio.Reader, req *RegistryRequest) error {
+	line, err := readJSONLine(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(line, req)
+}
+
+func (JSONCodec) WriteRequest(w io.Writer, req *RegistryRequest) error {
+	return json.NewEncoder(w).Encode(req)
+}
+
+func (JSONCodec) ReadResponse(r *bufio.Reader, resp *RegistryResponse) error {
+	line, err := readJSONLine(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(line, resp)
+}
+
+// readJSONLine returns the next newline-terminated message. A final message
+// without a trailing newline is accepted at EOF.
+func readJSONLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err == io.EOF && len(bytes.TrimSpace(line)) > 0 {
+		return line, nil
+	}
+	return line, err
+}
+
+func (JSONCodec) WriteResponse(w io.Writer, resp *RegistryResponse) error {
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// ProtoCodec is the compact protobuf encoding (see common/pb/registry.proto).
+type ProtoCodec struct{}
+
+func (ProtoCodec) ReadRequest(r *bufio.Reader, req *RegistryRequest) error {
+	var m pb.RegistryRequest
+	if err := protodelim.UnmarshalFrom(r, &m); err != nil {
+		return err
+	}
+	out, err := RegistryRequestFromPB(&m)
+	if err != nil {
+		return err
+	}
+	*req = *out
+	return nil
+}
+
+func (ProtoCodec) WriteRequest(w io.Writer, req *RegistryRequest) error {
+	_, err := protodelim.MarshalTo(w, RegistryRequestToPB(req))
+	return err
+}
+
+func (ProtoCodec) ReadResponse(r *bufio.Reader, resp *RegistryResponse) error {
+	var m pb.RegistryResponse
+	if err := protodelim.UnmarshalFrom(r, &m); err != nil {
+		return err
+	}
+	out, err := RegistryResponseFromPB(&m)
+	if err != nil {
+		return err
+	}
+	*resp = *out
+	return nil
+}
+
+func (ProtoCodec) WriteResponse(w io.Writer, resp *RegistryResponse) error {
+	_, err := protodelim.MarshalTo(w, RegistryResponseToPB(resp))
+	return err
+}
+
+// --- JSON model <-> protobuf conversion ---
+
+func RegistryRequestToPB(req *RegistryRequest) *pb.RegistryRequest {
+	m := &pb.RegistryRequest{
+		Method:    req.Method,
+		Card:      serviceCardToPB(&req.Card),
+		Query:     req.Query,
+		Limit:     int32(req.Limit),
+		PageToken: req.PageToken,
+		Rank:      req.Rank,
+		Inputs:    req.Inputs,
+		Outputs:   req.Outputs,
+		MaxAge:    int32(req.MaxAge),
+		Federate:  req.Federate,
+		Ttl:       int32(req.TTL),
+		QueryId:   req.QueryID,
+		Token:     req.Token,
+
+		RequireMatch: req.RequireMatch,
+	}
+	for i := range req.Cards {
+		m.Cards = append(m.Cards, serviceCardToPB(&req.Cards[i]))
+	}
+	for _, id := range req.Exclude {
+		m.Exclude = append(m.Exclude, []byte(id))
+	}
+	if a := req.Admin; a != nil {
+		m.Admin = &pb.AdminCommand{
+			Action:    a.Action,
+			Target:    a.Target,
+			Duration:  int32(a.Duration),
+			Nonce:     a.Nonce,
+			PubKey:    a.PubKey,
+			Signature: a.Signature,
+		}
+	}
+	if req.StakeProof != nil {
+		m.StakeProof = stakeProofToPB(req.StakeProof)
+	}
+	if req.ProviderInfo != nil {
+		m.ProviderInfo = addrInfoToPB(*req.ProviderInfo)
+	}
+	return m
+}
+
+func RegistryRequestFromPB(m *pb.RegistryRequest) (*RegistryRequest, error) {
+	req := &RegistryRequest{
+		Method:    m.GetMethod(),
+		Query:     m.GetQuery(),
+		Limit:     int(m.GetLimit()),
+		PageToken: m.GetPageToken(),
+		Rank:      m.GetRank(),
+		Inputs:    m.GetInputs(),
+		Outputs:   m.GetOutputs(),
+		MaxAge:    int(m.GetMaxAge()),
+		Federate:  m.GetFederate(),
+		TTL:       int(m.GetTtl()),
+		QueryID:   m.GetQueryId(),
+		Token:     m.GetToken(),
+
+		RequireMatch: m.GetRequireMatch(),
+	}
+	for _, c := range m.GetCards() {
+		req.Cards = append(req.Cards, serviceCardFromPB(c))
+	}
+	for _, b := range m.GetExclude() {
+		id, err := peer.IDFromBytes(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid excluded peer id: %v", err)
+		}
+		req.Exclude = append(req.Exclude, id)
+	}
+	if a := m.GetAdmin(); a != nil {
+		req.Admin = &AdminCommand{
+			Action:    a.GetAction(),
+			Target:    a.GetTarget(),
+			Duration:  int(a.GetDuration()),
+			Nonce:     a.GetNonce(),
+			PubKey:    a.GetPubKey(),
+			Signature: a.GetSignature(),
+		}
+	}
+	if m.Card != nil {
+		req.Card = serviceCardFromPB(m.Card)
+	}
+	if m.StakeProof != nil {
+		req.StakeProof = stakeProofFromPB(m.StakeProof)
+	}
+	if m.ProviderInfo != nil {
+		info, err := addrInfoFromPB(m.ProviderInfo)
+		if err != nil {
+			return nil, err
+		}
+		req.ProviderInfo = &info
+	}
+	return req, nil
+}
+
+func RegistryResponseToPB(resp *RegistryResponse) *pb.RegistryResponse {
+	m := &pb.RegistryResponse{
+		Success:   resp.Success,
+		Error:     resp.Error,
+		NextToken: resp.NextToken,
+
+		HeartbeatInterval: int32(resp.HeartbeatInterval),
+		Origins:           resp.Origins,
+		RetryAfter:        int32(resp.RetryAfter),
+		Pong:              resp.Pong,
+		Nonce:             resp.Nonce,
+		Matched:           int32(resp.Matched),
+	}
+	if resp.Card != nil {
+		m.Card = serviceCardToPB(resp.Card)
+	}
+	for _, p := range resp.Providers {
+		m.Providers = append(m.Providers, addrInfoToPB(p))
+	}
+	if a := resp.Attestation; a != nil {
+		m.Attestation = &pb.FindAttestation{
+			Registry:  a.Registry,
+			Query:     a.Query,
+			Timestamp: a.Timestamp,
+			Nonce:     a.Nonce,
+			Signature: a.Signature,
+		}
+		if kr := a.Rotation; kr != nil {
+			m.Attestation.Rotation = &pb.KeyRotation{
+				Previous:  kr.Previous,
+				Current:   kr.Current,
+				PubKey:    kr.PubKey,
+				Expires:   kr.Expires,
+				Signature: kr.Signature,
+			}
+		}
+	}
+	return m
+}
+
+func RegistryResponseFromPB(m *pb.RegistryResponse) (*RegistryResponse, error) {
+	resp := &RegistryResponse{
+		Success:   m.GetSuccess(),
+		Error:     m.GetError(),
+		NextToken: m.GetNextToken(),
+
+		HeartbeatInterval: int(m.GetHeartbeatInterval()),
+		Origins:           m.GetOrigins(),
+		RetryAfter:        int(m.GetRetryAfter()),
+		Pong:              m.GetPong(),
+		Nonce:             m.GetNonce(),
+		Matched:           int(m.GetMatched()),
+	}
+	if m.Card != nil {
+		card := serviceCardFromPB(m.Card)
+		resp.Card = &card
+	}
+	for _, p := range m.GetProviders() {
+		info, err := addrInfoFromPB(p)
+		if err != nil {
+			return nil, err
+		}
+		resp.Providers = append(resp.Providers, info)
+	}
+	if a := m.GetAttestation(); a != nil {
+		resp.Attestation = &FindAttestation{
+			Registry:  a.GetRegistry(),
+			Query:     a.GetQuery(),
+			Timestamp: a.GetTimestamp(),
+			Nonce:     a.GetNonce(),
+			Signature: a.GetSignature(),
+		}
+		if kr := a.GetRotation(); kr != nil {
+			resp.Attestation.Rotation = &KeyRotation{
+				Previous:  kr.GetPrevious(),
+				Current:   kr.GetCurrent(),
+				PubKey:    kr.GetPubKey(),
+				Expires:   kr.GetExpires(),
+				Signature: kr.GetSignature(),
+			}
+		}
+	}
+	return resp, nil
+}
+
+func serviceCardToPB(c *ServiceCard) *pb.ServiceCard {
+	return &pb.ServiceCard{
+		Name:        c.Name,
+		Description: c.Description,
+		Inputs:      c.Inputs,
+		Outputs:     c.Outputs,
+		CostPerOp:   c.CostPerOp,
+		Version:     c.Version,
+		Tags:        c.Tags,
+		Embedding:   c.Embedding,
+		Region:      c.Region,
+		Hardware:    c.Hardware,
+		Metadata:    c.Metadata,
+		Visibility:  c.Visibility,
+		AllowPeers:  c.AllowPeers,
+		TokenHashes: c.TokenHashes,
+		RateLimit:   c.RateLimit,
+	}
+}
+
+func serviceCardFromPB(m *pb.ServiceCard) ServiceCard {
+	return ServiceCard{
+		Name:        m.GetName(),
+		Description: m.GetDescription(),
+		Inputs:      m.GetInputs(),
+		Outputs:     m.GetOutputs(),
+		CostPerOp:   m.GetCostPerOp(),
+		Version:     m.GetVersion(),
+		Tags:        m.GetTags(),
+		Embedding:   m.GetEmbedding(),
+		Region:      m.GetRegion(),
+		Hardware:    m.GetHardware(),
+		Metadata:    m.GetMetadata(),
+		Visibility:  m.GetVisibility(),
+		AllowPeers:  m.GetAllowPeers(),
+		TokenHashes: m.GetTokenHashes(),
+		RateLimit:   m.GetRateLimit(),
+	}
+}
+
+func stakeProofToPB(p *StakeProof) *pb.StakeProof {
+	return &pb.StakeProof{
+		TxHash:    p.TxHash,
+		Staker:    p.Staker,
+		Amount:    p.Amount,
+		Nonce:     p.Nonce,
+		Timestamp: p.Timestamp,
+		ChainId:   p.ChainID,
+		Signature: p.Signature,
+		Algo:      p.Algo,
+		Owner:     p.Owner,
+		Denom:     p.Denom,
+	}
+}
+
+func stakeProofFromPB(m *pb.StakeProof) *StakeProof {
+	return &StakeProof{
+		TxHash:    m.GetTxHash(),
+		Staker:    m.GetStaker(),
+		Amount:    m.GetAmount(),
+		Nonce:     m.GetNonce(),
+		Timestamp: m.GetTimestamp(),
+		ChainID:   m.GetChainId(),
+		Signature: m.GetSignature(),
+		Algo:      m.GetAlgo(),
+		Owner:     m.GetOwner(),
+		Denom:     m.GetDenom(),
+	}
+}
+
+func addrInfoToPB(info peer.AddrInfo) *pb.AddrInfo {
+	m := &pb.AddrInfo{Id: []byte(info.ID)}
+	for _, a := range info.Addrs {
+		m.Addrs = append(m.Addrs, a.Bytes())
+	}
+	return m
+}
+
+func addrInfoFromPB(m *pb.AddrInfo) (peer.AddrInfo, error) {
+	id, err := peer.IDFromBytes(m.GetId())
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("invalid peer id: %v", err)
+	}
+	info := peer.AddrInfo{ID: id}
+	for _, b := range m.GetAddrs() {
+		a, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			return peer.AddrInfo{}, fmt.Errorf("invalid multiaddr: %v", err)
+		}
+		info.Addrs = append(info.Addrs, a)
+	}
+	return info, nil
+}
@@ -0,0 +1,126 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func testPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// sameJSON fails the test unless got and want marshal to the same JSON.
+func sameJSON(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	g, _ := json.Marshal(got)
+	w, _ := json.Marshal(want)
+	if !bytes.Equal(g, w) {
+		t.Fatalf("%s differs\n got %s\nwant %s", what, g, w)
+	}
+}
+
+func TestRegistryCodecRoundTrip(t *testing.T) {
+	provider := peer.AddrInfo{ID: testPeerID(t), Addrs: []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/4001")}}
+	card := ServiceCard{
+		Name:        "image-gen",
+		Description: "Generates images",
+		Inputs:      []string{"prompt", "style"},
+		Outputs:     []string{"image"},
+		CostPerOp:   0.25,
+		Version:     "1.2.0",
+		Tags:        []string{"image"},
+		Embedding:   []float32{0.1, 0.2},
+		Region:      "eu-west",
+		Hardware:    map[string]string{"gpu": "A100"},
+		Metadata:    map[string]string{"license": "mit"},
+		Visibility:  "private",
+		AllowPeers:  []string{provider.ID.String()},
+		TokenHashes: []string{HashAccessToken("secret")},
+		RateLimit:   5,
+	}
+	req := RegistryRequest{
+		Method:       "find",
+		Card:         card,
+		Query:        "image",
+		StakeProof:   &StakeProof{TxHash: "0xabc", Staker: provider.ID.String(), Amount: 10.1234567, Nonce: 3, Timestamp: 1700000000, ChainID: "prxs-test", Denom: "uprxs", Owner: "0xowner", Algo: StakeAlgoEd25519, Signature: []byte{1, 2, 3}},
+		ProviderInfo: &provider,
+		Limit:        10,
+		PageToken:    "token",
+		Rank:         "score",
+		Inputs:       []string{"prompt"},
+		Outputs:      []string{"image"},
+		MaxAge:       30,
+		Federate:     true,
+		TTL:          2,
+		QueryID:      "q1",
+		Cards:        []ServiceCard{card, {Name: "second"}},
+		Token:        "secret",
+		Exclude:      []peer.ID{testPeerID(t)},
+		RequireMatch: true,
+		Admin:        &AdminCommand{Action: "ban", Target: provider.ID.String(), Duration: 60, Nonce: "n", PubKey: []byte{4}, Signature: []byte{5}},
+	}
+	resp := RegistryResponse{
+		Success:           true,
+		Providers:         []peer.AddrInfo{provider},
+		Error:             "partial",
+		NextToken:         "next",
+		HeartbeatInterval: 30,
+		Attestation:       &FindAttestation{Registry: testPeerID(t).String(), Query: "image", Timestamp: 1700000000, Nonce: "n", Signature: []byte{6}},
+		Origins:           map[string]string{provider.ID.String(): "registry"},
+		Card:              &card,
+		RetryAfter:        4,
+		Pong:              true,
+		Nonce:             "challenge",
+		Matched:           12,
+	}
+
+	var decoded [2]struct {
+		req  RegistryRequest
+		resp RegistryResponse
+	}
+	for i, codec := range []RegistryCodec{JSONCodec{}, ProtoCodec{}} {
+		var buf bytes.Buffer
+		if err := codec.WriteRequest(&buf, &req); err != nil {
+			t.Fatalf("%T: write request: %v", codec, err)
+		}
+		if err := codec.WriteResponse(&buf, &resp); err != nil {
+			t.Fatalf("%T: write response: %v", codec, err)
+		}
+		r := bufio.NewReader(&buf)
+		if err := codec.ReadRequest(r, &decoded[i].req); err != nil {
+			t.Fatalf("%T: read request: %v", codec, err)
+		}
+		if err := codec.ReadResponse(r, &decoded[i].resp); err != nil {
+			t.Fatalf("%T: read response: %v", codec, err)
+		}
+		sameJSON(t, "request", decoded[i].req, req)
+		sameJSON(t, "response", decoded[i].resp, resp)
+	}
+	sameJSON(t, "request across codecs", decoded[1].req, decoded[0].req)
+	sameJSON(t, "response across codecs", decoded[1].resp, decoded[0].resp)
+}
+
+func TestRegistryCodecFor(t *testing.T) {
+	if _, ok := RegistryCodecFor(RegistryProtocolPB).(ProtoCodec); !ok {
+		t.Fatal("protobuf sub-protocol doesn't select ProtoCodec")
+	}
+	if _, ok := RegistryCodecFor(RegistryProtocolID).(JSONCodec); !ok {
+		t.Fatal("default protocol doesn't select JSONCodec")
+	}
+}
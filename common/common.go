@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/libp2p/go-libp2p"
@@ -15,18 +16,65 @@ import (
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
-func CommonLibp2pOptions(port int, key crypto.PrivKey) []libp2p.Option {
+// ParseListenAddrs validates a list of listen multiaddrs (e.g. from a
+// comma-separated -listen flag). Blank entries are ignored.
+func ParseListenAddrs(addrs []string) ([]ma.Multiaddr, error) {
+	var out []ma.Multiaddr
+	for _, s := range addrs {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %q: %v", s, err)
+		}
+		out = append(out, addr)
+	}
+	return out, nil
+}
+
+// AnnounceAddrsFactory returns a libp2p.AddrsFactory advertising announce
+// (e.g. the public endpoint of a NAT or load balancer) in addition to the
+// host's own addresses, or instead of them when replace is set. Everything
+// built on Host.Addrs, such as identify and DHT provider records, picks
+// them up.
+func AnnounceAddrsFactory(announce []ma.Multiaddr, replace bool) func([]ma.Multiaddr) []ma.Multiaddr {
+	return func(addrs []ma.Multiaddr) []ma.Multiaddr {
+		out := append([]ma.Multiaddr(nil), announce...)
+		if replace {
+			return out
+		}
+		for _, addr := range addrs {
+			if !ma.Contains(out, addr) {
+				out = append(out, addr)
+			}
+		}
+		return out
+	}
+}
+
+// CommonLibp2pOptions builds the shared host options. When listenAddrs is
+// non-empty it replaces the default port-based listeners entirely, so
+// deployments can bind each transport to its own port or interface.
+func CommonLibp2pOptions(port int, key crypto.PrivKey, listenAddrs []ma.Multiaddr) []libp2p.Option {
+	listen := libp2p.ListenAddrStrings(
+		fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port),
+		fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", port),
+		fmt.Sprintf("/ip6/::/tcp/%d", port),         // RESTORED IPv6 TCP
+		fmt.Sprintf("/ip6/::/udp/%d/quic-v1", port), // RESTORED IPv6 QUIC
+	)
+	if len(listenAddrs) > 0 {
+		listen = libp2p.ListenAddrs(listenAddrs...)
+	}
+
 	options := []libp2p.Option{
 		// LISTENERS: IPv6 support helps bypass IPv4 CGNAT
-		libp2p.ListenAddrStrings(
-			fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port),
-			fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", port),
-			fmt.Sprintf("/ip6/::/tcp/%d", port),         // RESTORED IPv6 TCP
-			fmt.Sprintf("/ip6/::/udp/%d/quic-v1", port), // RESTORED IPv6 QUIC
-		),
+		listen,
 		libp2p.EnableNATService(),
 		libp2p.EnableHolePunching(),
 		libp2p.EnableRelay(), // Ensure relay support is active
@@ -38,10 +86,24 @@ func CommonLibp2pOptions(port int, key crypto.PrivKey) []libp2p.Option {
 	return options
 }
 
-func SetupDHT(ctx context.Context, h host.Host, bootstrapPeers []string, devMode bool) (*dht.IpfsDHT, error) {
+// DefaultDHTPrefix is the DHT protocol prefix of the shared PRAXIS network.
+const DefaultDHTPrefix = "/prxs/kad/1.0"
+
+// DHTOptions builds the DHT options for SetupDHT. Nodes only exchange DHT
+// records with peers using the same prefix, so separate deployments pick
+// their own to keep their DHTs (and registry/service advertisements) apart.
+// An empty prefix means DefaultDHTPrefix.
+func DHTOptions(prefix string, devMode bool) ([]dht.Option, error) {
+	if prefix == "" {
+		prefix = DefaultDHTPrefix
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		return nil, fmt.Errorf("DHT prefix %q must start with /", prefix)
+	}
+
 	var opts []dht.Option
 	opts = append(opts, dht.Mode(dht.ModeServer))
-	opts = append(opts, dht.ProtocolPrefix("/prxs/kad/1.0"))
+	opts = append(opts, dht.ProtocolPrefix(protocol.ID(prefix)))
 
 	if devMode {
 		// In DevMode (LAN), we accept any peer in the routing table
@@ -49,6 +111,14 @@ func SetupDHT(ctx context.Context, h host.Host, bootstrapPeers []string, devMode
 		opts = append(opts, dht.RoutingTableFilter(allowAll))
 		opts = append(opts, dht.QueryFilter(dht.PublicQueryFilter))
 	}
+	return opts, nil
+}
+
+func SetupDHT(ctx context.Context, h host.Host, bootstrapPeers []string, devMode bool, prefix string) (*dht.IpfsDHT, error) {
+	opts, err := DHTOptions(prefix, devMode)
+	if err != nil {
+		return nil, err
+	}
 
 	kademliaDHT, err := dht.New(ctx, h, opts...)
 	if err != nil {
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Keepalive defaults for RegistryStream. The interval stays well under the
+// registry's 60s idle timeout and typical NAT mapping timeouts.
+const (
+	DefaultPingInterval = 20 * time.Second
+	DefaultPingTimeout  = 10 * time.Second
+)
+
+// RegistryStream is a long-lived stream to a registry that carries several
+// requests in turn. KeepAlive pings it while idle so NATs don't drop the
+// mapping, and closes it when a pong doesn't arrive in time, so a dead
+// stream is noticed before the next real call hangs on it.
+type RegistryStream struct {
+	s     network.Stream
+	codec RegistryCodec
+	rw    *bufio.ReadWriter
+
+	mu     sync.Mutex // One request/response exchange at a time
+	closed chan struct{}
+	once   sync.Once
+}
+
+// OpenRegistryStream opens a stream to registry, preferring protobuf.
+func OpenRegistryStream(ctx context.Context, h host.Host, registry peer.ID) (*RegistryStream, error) {
+	s, err := h.NewStream(ctx, registry, RegistryProtocolPB, RegistryProtocolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %v", err)
+	}
+	return NewRegistryStream(s), nil
+}
+
+// NewRegistryStream wraps an open registry stream.
+func NewRegistryStream(s network.Stream) *RegistryStream {
+	return &RegistryStream{
+		s:      s,
+		codec:  RegistryCodecFor(s.Protocol()),
+		rw:     bufio.NewReadWriter(bufio.NewReader(s), bufio.NewWriter(s)),
+		closed: make(chan struct{}),
+	}
+}
+
+// Call sends req and waits for its response. timeout bounds the exchange
+// (0 = no bound).
+func (rs *RegistryStream) Call(req RegistryRequest, timeout time.Duration) (*RegistryResponse, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	_ = rs.s.SetDeadline(deadline)
+	defer rs.s.SetDeadline(time.Time{})
+
+	if err := rs.codec.WriteRequest(rs.rw, &req); err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	if err := rs.rw.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush request: %v", err)
+	}
+	var resp RegistryResponse
+	if err := rs.codec.ReadResponse(rs.rw.Reader, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	return &resp, nil
+}
+
+// Ping sends a keepalive and waits up to timeout for the pong.
+func (rs *RegistryStream) Ping(timeout time.Duration) error {
+	resp, err := rs.Call(RegistryRequest{Method: RegistryMethodPing}, timeout)
+	if err != nil {
+		return fmt.Errorf("ping failed: %v", err)
+	}
+	if !resp.Pong {
+		return fmt.Errorf("registry did not answer ping: %s", resp.Error)
+	}
+	return nil
+}
+
+// KeepAlive pings every interval until ctx ends or the stream is closed.
+// If a ping fails or its pong takes longer than timeout, the stream is
+// closed and the error returned. Run it in its own goroutine.
+func (rs *RegistryStream) KeepAlive(ctx context.Context, interval, timeout time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-rs.closed:
+			return nil
+		case <-ticker.C:
+			if err := rs.Ping(timeout); err != nil {
+				select {
+				case <-rs.closed:
+					return nil // Closed mid-ping; not a dead stream
+				default:
+				}
+				rs.shutdown(rs.s.Reset)
+				return err
+			}
+		}
+	}
+}
+
+// Done is closed once the stream is closed, by Close or a failed keepalive.
+func (rs *RegistryStream) Done() <-chan struct{} {
+	return rs.closed
+}
+
+// Close closes the stream.
+func (rs *RegistryStream) Close() error {
+	return rs.shutdown(rs.s.Close)
+}
+
+func (rs *RegistryStream) shutdown(closeFn func() error) error {
+	var err error
+	rs.once.Do(func() {
+		close(rs.closed)
+		err = closeFn()
+	})
+	return err
+}
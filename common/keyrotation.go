@@ -0,0 +1,130 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// keyRotationPurpose domain-separates rotation proofs from every other
+// payload a registry key signs.
+const keyRotationPurpose = "prxs-registry-key-rotation"
+
+// KeyRotation is a statement, signed by a registry's previous key, that
+// Current is its new identity until Expires. Clients that pinned the old
+// identity use it to accept attestations signed with the new key while the
+// rotation window is open.
+type KeyRotation struct {
+	Previous  string `json:"previous"`
+	Current   string `json:"current"`
+	PubKey    []byte `json:"pub_key"`
+	Expires   int64  `json:"expires"`
+	Signature []byte `json:"signature"`
+}
+
+// keyRotationSigningPayload is the canonical form covered by the rotation
+// signature; fields are in alphabetical order like the other payloads.
+type keyRotationSigningPayload struct {
+	Current  string `json:"current"`
+	Expires  int64  `json:"expires"`
+	Previous string `json:"previous"`
+	PubKey   []byte `json:"pub_key"`
+	Purpose  string `json:"purpose"`
+}
+
+func (kr *KeyRotation) digest() [32]byte {
+	b, _ := json.Marshal(keyRotationSigningPayload{
+		Current:  kr.Current,
+		Expires:  kr.Expires,
+		Previous: kr.Previous,
+		PubKey:   kr.PubKey,
+		Purpose:  keyRotationPurpose,
+	})
+	return sha256.Sum256(b)
+}
+
+// NewKeyRotation has prev vouch for cur until expires.
+func NewKeyRotation(prev, cur crypto.PrivKey, expires time.Time) (*KeyRotation, error) {
+	prevID, err := peer.IDFromPrivateKey(prev)
+	if err != nil {
+		return nil, err
+	}
+	curID, err := peer.IDFromPrivateKey(cur)
+	if err != nil {
+		return nil, err
+	}
+	if prevID == curID {
+		return nil, fmt.Errorf("previous and current keys are the same")
+	}
+	pub, err := crypto.MarshalPublicKey(cur.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	kr := &KeyRotation{
+		Previous: prevID.String(),
+		Current:  curID.String(),
+		PubKey:   pub,
+		Expires:  expires.Unix(),
+	}
+	digest := kr.digest()
+	sig, err := prev.Sign(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	kr.Signature = sig
+	return kr, nil
+}
+
+// Verify checks that kr was signed by prevPub and is still valid at now,
+// and returns the current key it vouches for.
+func (kr *KeyRotation) Verify(prevPub crypto.PubKey, now time.Time) (crypto.PubKey, error) {
+	prevID, err := peer.IDFromPublicKey(prevPub)
+	if err != nil {
+		return nil, err
+	}
+	if kr.Previous != prevID.String() {
+		return nil, fmt.Errorf("key rotation is from %s, expected %s", kr.Previous, prevID)
+	}
+	if now.Unix() > kr.Expires {
+		return nil, fmt.Errorf("key rotation expired at %s", time.Unix(kr.Expires, 0).UTC().Format(time.RFC3339))
+	}
+	cur, err := crypto.UnmarshalPublicKey(kr.PubKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rotated key: %v", err)
+	}
+	curID, err := peer.IDFromPublicKey(cur)
+	if err != nil {
+		return nil, err
+	}
+	if kr.Current != curID.String() {
+		return nil, fmt.Errorf("rotated key does not match %s", kr.Current)
+	}
+	digest := kr.digest()
+	ok, err := prevPub.Verify(digest[:], kr.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("key rotation signature check failed: %v", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid key rotation signature")
+	}
+	return cur, nil
+}
+
+// LoadKey reads a private key written by LoadOrGenerateKey. Unlike that
+// function it never generates one, so a mistyped path is an error.
+func LoadKey(keyFile string) (crypto.PrivKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %v", err)
+	}
+	key, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key: %v", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,4 @@
+// Package pb holds the protobuf messages for the binary registry RPC encoding.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative registry.proto
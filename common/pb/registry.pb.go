@@ -0,0 +1,1099 @@
+// Protobuf encoding of the registry RPC (Node <-> Registry).
+//
+// Mirrors the JSON types in common/protocol.go and is selected by dialing
+// common.RegistryProtocolPB instead of common.RegistryProtocolID.
+// Regenerate with `go generate ./common/pb`.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: registry.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ServiceCard struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Description   string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	Inputs        []string               `protobuf:"bytes,3,rep,name=inputs,proto3" json:"inputs,omitempty"`
+	CostPerOp     float64                `protobuf:"fixed64,4,opt,name=cost_per_op,json=costPerOp,proto3" json:"cost_per_op,omitempty"`
+	Version       string                 `protobuf:"bytes,5,opt,name=version,proto3" json:"version,omitempty"`
+	Tags          []string               `protobuf:"bytes,6,rep,name=tags,proto3" json:"tags,omitempty"`
+	Embedding     []float32              `protobuf:"fixed32,7,rep,packed,name=embedding,proto3" json:"embedding,omitempty"`
+	Region        string                 `protobuf:"bytes,8,opt,name=region,proto3" json:"region,omitempty"`
+	Hardware      map[string]string      `protobuf:"bytes,9,rep,name=hardware,proto3" json:"hardware,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Outputs       []string               `protobuf:"bytes,10,rep,name=outputs,proto3" json:"outputs,omitempty"`
+	Metadata      map[string]string      `protobuf:"bytes,11,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Visibility    string                 `protobuf:"bytes,12,opt,name=visibility,proto3" json:"visibility,omitempty"`
+	AllowPeers    []string               `protobuf:"bytes,13,rep,name=allow_peers,json=allowPeers,proto3" json:"allow_peers,omitempty"`
+	TokenHashes   []string               `protobuf:"bytes,14,rep,name=token_hashes,json=tokenHashes,proto3" json:"token_hashes,omitempty"`
+	RateLimit     float64                `protobuf:"fixed64,15,opt,name=rate_limit,json=rateLimit,proto3" json:"rate_limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServiceCard) Reset() {
+	*x = ServiceCard{}
+	mi := &file_registry_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServiceCard) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServiceCard) ProtoMessage() {}
+
+func (x *ServiceCard) ProtoReflect() protoreflect.Message {
+	mi := &file_registry_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServiceCard.ProtoReflect.Descriptor instead.
+func (*ServiceCard) Descriptor() ([]byte, []int) {
+	return file_registry_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ServiceCard) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ServiceCard) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *ServiceCard) GetInputs() []string {
+	if x != nil {
+		return x.Inputs
+	}
+	return nil
+}
+
+func (x *ServiceCard) GetCostPerOp() float64 {
+	if x != nil {
+		return x.CostPerOp
+	}
+	return 0
+}
+
+func (x *ServiceCard) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *ServiceCard) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *ServiceCard) GetEmbedding() []float32 {
+	if x != nil {
+		return x.Embedding
+	}
+	return nil
+}
+
+func (x *ServiceCard) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *ServiceCard) GetHardware() map[string]string {
+	if x != nil {
+		return x.Hardware
+	}
+	return nil
+}
+
+func (x *ServiceCard) GetOutputs() []string {
+	if x != nil {
+		return x.Outputs
+	}
+	return nil
+}
+
+func (x *ServiceCard) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *ServiceCard) GetVisibility() string {
+	if x != nil {
+		return x.Visibility
+	}
+	return ""
+}
+
+func (x *ServiceCard) GetAllowPeers() []string {
+	if x != nil {
+		return x.AllowPeers
+	}
+	return nil
+}
+
+func (x *ServiceCard) GetTokenHashes() []string {
+	if x != nil {
+		return x.TokenHashes
+	}
+	return nil
+}
+
+func (x *ServiceCard) GetRateLimit() float64 {
+	if x != nil {
+		return x.RateLimit
+	}
+	return 0
+}
+
+type StakeProof struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TxHash        string                 `protobuf:"bytes,1,opt,name=tx_hash,json=txHash,proto3" json:"tx_hash,omitempty"`
+	Staker        string                 `protobuf:"bytes,2,opt,name=staker,proto3" json:"staker,omitempty"`
+	Amount        float64                `protobuf:"fixed64,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	Nonce         int64                  `protobuf:"varint,4,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	ChainId       string                 `protobuf:"bytes,6,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`
+	Signature     []byte                 `protobuf:"bytes,7,opt,name=signature,proto3" json:"signature,omitempty"`
+	Algo          string                 `protobuf:"bytes,8,opt,name=algo,proto3" json:"algo,omitempty"`
+	Owner         string                 `protobuf:"bytes,9,opt,name=owner,proto3" json:"owner,omitempty"`
+	Denom         string                 `protobuf:"bytes,10,opt,name=denom,proto3" json:"denom,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StakeProof) Reset() {
+	*x = StakeProof{}
+	mi := &file_registry_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StakeProof) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StakeProof) ProtoMessage() {}
+
+func (x *StakeProof) ProtoReflect() protoreflect.Message {
+	mi := &file_registry_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StakeProof.ProtoReflect.Descriptor instead.
+func (*StakeProof) Descriptor() ([]byte, []int) {
+	return file_registry_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StakeProof) GetTxHash() string {
+	if x != nil {
+		return x.TxHash
+	}
+	return ""
+}
+
+func (x *StakeProof) GetStaker() string {
+	if x != nil {
+		return x.Staker
+	}
+	return ""
+}
+
+func (x *StakeProof) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *StakeProof) GetNonce() int64 {
+	if x != nil {
+		return x.Nonce
+	}
+	return 0
+}
+
+func (x *StakeProof) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *StakeProof) GetChainId() string {
+	if x != nil {
+		return x.ChainId
+	}
+	return ""
+}
+
+func (x *StakeProof) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *StakeProof) GetAlgo() string {
+	if x != nil {
+		return x.Algo
+	}
+	return ""
+}
+
+func (x *StakeProof) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *StakeProof) GetDenom() string {
+	if x != nil {
+		return x.Denom
+	}
+	return ""
+}
+
+type AddrInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Binary peer ID.
+	Id []byte `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Binary multiaddrs.
+	Addrs         [][]byte `protobuf:"bytes,2,rep,name=addrs,proto3" json:"addrs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddrInfo) Reset() {
+	*x = AddrInfo{}
+	mi := &file_registry_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddrInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddrInfo) ProtoMessage() {}
+
+func (x *AddrInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_registry_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddrInfo.ProtoReflect.Descriptor instead.
+func (*AddrInfo) Descriptor() ([]byte, []int) {
+	return file_registry_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AddrInfo) GetId() []byte {
+	if x != nil {
+		return x.Id
+	}
+	return nil
+}
+
+func (x *AddrInfo) GetAddrs() [][]byte {
+	if x != nil {
+		return x.Addrs
+	}
+	return nil
+}
+
+type RegistryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Method        string                 `protobuf:"bytes,1,opt,name=method,proto3" json:"method,omitempty"`
+	Card          *ServiceCard           `protobuf:"bytes,2,opt,name=card,proto3" json:"card,omitempty"`
+	Query         string                 `protobuf:"bytes,3,opt,name=query,proto3" json:"query,omitempty"`
+	StakeProof    *StakeProof            `protobuf:"bytes,4,opt,name=stake_proof,json=stakeProof,proto3" json:"stake_proof,omitempty"`
+	ProviderInfo  *AddrInfo              `protobuf:"bytes,5,opt,name=provider_info,json=providerInfo,proto3" json:"provider_info,omitempty"`
+	Limit         int32                  `protobuf:"varint,6,opt,name=limit,proto3" json:"limit,omitempty"`
+	PageToken     string                 `protobuf:"bytes,7,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	Rank          string                 `protobuf:"bytes,8,opt,name=rank,proto3" json:"rank,omitempty"`
+	Inputs        []string               `protobuf:"bytes,9,rep,name=inputs,proto3" json:"inputs,omitempty"`
+	Outputs       []string               `protobuf:"bytes,10,rep,name=outputs,proto3" json:"outputs,omitempty"`
+	MaxAge        int32                  `protobuf:"varint,11,opt,name=max_age,json=maxAge,proto3" json:"max_age,omitempty"`
+	Federate      bool                   `protobuf:"varint,12,opt,name=federate,proto3" json:"federate,omitempty"`
+	Ttl           int32                  `protobuf:"varint,13,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	QueryId       string                 `protobuf:"bytes,14,opt,name=query_id,json=queryId,proto3" json:"query_id,omitempty"`
+	Cards         []*ServiceCard         `protobuf:"bytes,15,rep,name=cards,proto3" json:"cards,omitempty"`
+	Token         string                 `protobuf:"bytes,16,opt,name=token,proto3" json:"token,omitempty"`
+	Exclude       [][]byte               `protobuf:"bytes,17,rep,name=exclude,proto3" json:"exclude,omitempty"`
+	Admin         *AdminCommand          `protobuf:"bytes,18,opt,name=admin,proto3" json:"admin,omitempty"`
+	RequireMatch  bool                   `protobuf:"varint,19,opt,name=require_match,json=requireMatch,proto3" json:"require_match,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegistryRequest) Reset() {
+	*x = RegistryRequest{}
+	mi := &file_registry_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegistryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistryRequest) ProtoMessage() {}
+
+func (x *RegistryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_registry_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistryRequest.ProtoReflect.Descriptor instead.
+func (*RegistryRequest) Descriptor() ([]byte, []int) {
+	return file_registry_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RegistryRequest) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *RegistryRequest) GetCard() *ServiceCard {
+	if x != nil {
+		return x.Card
+	}
+	return nil
+}
+
+func (x *RegistryRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *RegistryRequest) GetStakeProof() *StakeProof {
+	if x != nil {
+		return x.StakeProof
+	}
+	return nil
+}
+
+func (x *RegistryRequest) GetProviderInfo() *AddrInfo {
+	if x != nil {
+		return x.ProviderInfo
+	}
+	return nil
+}
+
+func (x *RegistryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *RegistryRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *RegistryRequest) GetRank() string {
+	if x != nil {
+		return x.Rank
+	}
+	return ""
+}
+
+func (x *RegistryRequest) GetInputs() []string {
+	if x != nil {
+		return x.Inputs
+	}
+	return nil
+}
+
+func (x *RegistryRequest) GetOutputs() []string {
+	if x != nil {
+		return x.Outputs
+	}
+	return nil
+}
+
+func (x *RegistryRequest) GetMaxAge() int32 {
+	if x != nil {
+		return x.MaxAge
+	}
+	return 0
+}
+
+func (x *RegistryRequest) GetFederate() bool {
+	if x != nil {
+		return x.Federate
+	}
+	return false
+}
+
+func (x *RegistryRequest) GetTtl() int32 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *RegistryRequest) GetQueryId() string {
+	if x != nil {
+		return x.QueryId
+	}
+	return ""
+}
+
+func (x *RegistryRequest) GetCards() []*ServiceCard {
+	if x != nil {
+		return x.Cards
+	}
+	return nil
+}
+
+func (x *RegistryRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *RegistryRequest) GetExclude() [][]byte {
+	if x != nil {
+		return x.Exclude
+	}
+	return nil
+}
+
+func (x *RegistryRequest) GetAdmin() *AdminCommand {
+	if x != nil {
+		return x.Admin
+	}
+	return nil
+}
+
+func (x *RegistryRequest) GetRequireMatch() bool {
+	if x != nil {
+		return x.RequireMatch
+	}
+	return false
+}
+
+type RegistryResponse struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Success           bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Providers         []*AddrInfo            `protobuf:"bytes,2,rep,name=providers,proto3" json:"providers,omitempty"`
+	Error             string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	NextToken         string                 `protobuf:"bytes,4,opt,name=next_token,json=nextToken,proto3" json:"next_token,omitempty"`
+	HeartbeatInterval int32                  `protobuf:"varint,5,opt,name=heartbeat_interval,json=heartbeatInterval,proto3" json:"heartbeat_interval,omitempty"`
+	Attestation       *FindAttestation       `protobuf:"bytes,6,opt,name=attestation,proto3" json:"attestation,omitempty"`
+	Origins           map[string]string      `protobuf:"bytes,7,rep,name=origins,proto3" json:"origins,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Card              *ServiceCard           `protobuf:"bytes,8,opt,name=card,proto3" json:"card,omitempty"`
+	RetryAfter        int32                  `protobuf:"varint,9,opt,name=retry_after,json=retryAfter,proto3" json:"retry_after,omitempty"`
+	Pong              bool                   `protobuf:"varint,10,opt,name=pong,proto3" json:"pong,omitempty"`
+	Nonce             string                 `protobuf:"bytes,11,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Matched           int32                  `protobuf:"varint,12,opt,name=matched,proto3" json:"matched,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *RegistryResponse) Reset() {
+	*x = RegistryResponse{}
+	mi := &file_registry_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegistryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistryResponse) ProtoMessage() {}
+
+func (x *RegistryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_registry_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistryResponse.ProtoReflect.Descriptor instead.
+func (*RegistryResponse) Descriptor() ([]byte, []int) {
+	return file_registry_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RegistryResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *RegistryResponse) GetProviders() []*AddrInfo {
+	if x != nil {
+		return x.Providers
+	}
+	return nil
+}
+
+func (x *RegistryResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *RegistryResponse) GetNextToken() string {
+	if x != nil {
+		return x.NextToken
+	}
+	return ""
+}
+
+func (x *RegistryResponse) GetHeartbeatInterval() int32 {
+	if x != nil {
+		return x.HeartbeatInterval
+	}
+	return 0
+}
+
+func (x *RegistryResponse) GetAttestation() *FindAttestation {
+	if x != nil {
+		return x.Attestation
+	}
+	return nil
+}
+
+func (x *RegistryResponse) GetOrigins() map[string]string {
+	if x != nil {
+		return x.Origins
+	}
+	return nil
+}
+
+func (x *RegistryResponse) GetCard() *ServiceCard {
+	if x != nil {
+		return x.Card
+	}
+	return nil
+}
+
+func (x *RegistryResponse) GetRetryAfter() int32 {
+	if x != nil {
+		return x.RetryAfter
+	}
+	return 0
+}
+
+func (x *RegistryResponse) GetPong() bool {
+	if x != nil {
+		return x.Pong
+	}
+	return false
+}
+
+func (x *RegistryResponse) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
+func (x *RegistryResponse) GetMatched() int32 {
+	if x != nil {
+		return x.Matched
+	}
+	return 0
+}
+
+type FindAttestation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Registry      string                 `protobuf:"bytes,1,opt,name=registry,proto3" json:"registry,omitempty"`
+	Query         string                 `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Nonce         string                 `protobuf:"bytes,4,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Signature     []byte                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
+	Rotation      *KeyRotation           `protobuf:"bytes,6,opt,name=rotation,proto3" json:"rotation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FindAttestation) Reset() {
+	*x = FindAttestation{}
+	mi := &file_registry_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FindAttestation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FindAttestation) ProtoMessage() {}
+
+func (x *FindAttestation) ProtoReflect() protoreflect.Message {
+	mi := &file_registry_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FindAttestation.ProtoReflect.Descriptor instead.
+func (*FindAttestation) Descriptor() ([]byte, []int) {
+	return file_registry_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *FindAttestation) GetRegistry() string {
+	if x != nil {
+		return x.Registry
+	}
+	return ""
+}
+
+func (x *FindAttestation) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *FindAttestation) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *FindAttestation) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
+func (x *FindAttestation) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *FindAttestation) GetRotation() *KeyRotation {
+	if x != nil {
+		return x.Rotation
+	}
+	return nil
+}
+
+type AdminCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Action        string                 `protobuf:"bytes,1,opt,name=action,proto3" json:"action,omitempty"`
+	Target        string                 `protobuf:"bytes,2,opt,name=target,proto3" json:"target,omitempty"`
+	Duration      int32                  `protobuf:"varint,3,opt,name=duration,proto3" json:"duration,omitempty"`
+	Nonce         string                 `protobuf:"bytes,4,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	PubKey        []byte                 `protobuf:"bytes,5,opt,name=pub_key,json=pubKey,proto3" json:"pub_key,omitempty"`
+	Signature     []byte                 `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AdminCommand) Reset() {
+	*x = AdminCommand{}
+	mi := &file_registry_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AdminCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AdminCommand) ProtoMessage() {}
+
+func (x *AdminCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_registry_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AdminCommand.ProtoReflect.Descriptor instead.
+func (*AdminCommand) Descriptor() ([]byte, []int) {
+	return file_registry_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AdminCommand) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *AdminCommand) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *AdminCommand) GetDuration() int32 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+func (x *AdminCommand) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
+func (x *AdminCommand) GetPubKey() []byte {
+	if x != nil {
+		return x.PubKey
+	}
+	return nil
+}
+
+func (x *AdminCommand) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type KeyRotation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Previous      string                 `protobuf:"bytes,1,opt,name=previous,proto3" json:"previous,omitempty"`
+	Current       string                 `protobuf:"bytes,2,opt,name=current,proto3" json:"current,omitempty"`
+	PubKey        []byte                 `protobuf:"bytes,3,opt,name=pub_key,json=pubKey,proto3" json:"pub_key,omitempty"`
+	Expires       int64                  `protobuf:"varint,4,opt,name=expires,proto3" json:"expires,omitempty"`
+	Signature     []byte                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyRotation) Reset() {
+	*x = KeyRotation{}
+	mi := &file_registry_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyRotation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyRotation) ProtoMessage() {}
+
+func (x *KeyRotation) ProtoReflect() protoreflect.Message {
+	mi := &file_registry_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyRotation.ProtoReflect.Descriptor instead.
+func (*KeyRotation) Descriptor() ([]byte, []int) {
+	return file_registry_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *KeyRotation) GetPrevious() string {
+	if x != nil {
+		return x.Previous
+	}
+	return ""
+}
+
+func (x *KeyRotation) GetCurrent() string {
+	if x != nil {
+		return x.Current
+	}
+	return ""
+}
+
+func (x *KeyRotation) GetPubKey() []byte {
+	if x != nil {
+		return x.PubKey
+	}
+	return nil
+}
+
+func (x *KeyRotation) GetExpires() int64 {
+	if x != nil {
+		return x.Expires
+	}
+	return 0
+}
+
+func (x *KeyRotation) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+var File_registry_proto protoreflect.FileDescriptor
+
+const file_registry_proto_rawDesc = "" +
+	"\n" +
+	"\x0eregistry.proto\x12\x10prxs.registry.v1\"\x88\x05\n" +
+	"\vServiceCard\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12\x16\n" +
+	"\x06inputs\x18\x03 \x03(\tR\x06inputs\x12\x1e\n" +
+	"\vcost_per_op\x18\x04 \x01(\x01R\tcostPerOp\x12\x18\n" +
+	"\aversion\x18\x05 \x01(\tR\aversion\x12\x12\n" +
+	"\x04tags\x18\x06 \x03(\tR\x04tags\x12\x1c\n" +
+	"\tembedding\x18\a \x03(\x02R\tembedding\x12\x16\n" +
+	"\x06region\x18\b \x01(\tR\x06region\x12G\n" +
+	"\bhardware\x18\t \x03(\v2+.prxs.registry.v1.ServiceCard.HardwareEntryR\bhardware\x12\x18\n" +
+	"\aoutputs\x18\n" +
+	" \x03(\tR\aoutputs\x12G\n" +
+	"\bmetadata\x18\v \x03(\v2+.prxs.registry.v1.ServiceCard.MetadataEntryR\bmetadata\x12\x1e\n" +
+	"\n" +
+	"visibility\x18\f \x01(\tR\n" +
+	"visibility\x12\x1f\n" +
+	"\vallow_peers\x18\r \x03(\tR\n" +
+	"allowPeers\x12!\n" +
+	"\ftoken_hashes\x18\x0e \x03(\tR\vtokenHashes\x12\x1d\n" +
+	"\n" +
+	"rate_limit\x18\x0f \x01(\x01R\trateLimit\x1a;\n" +
+	"\rHardwareEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x82\x02\n" +
+	"\n" +
+	"StakeProof\x12\x17\n" +
+	"\atx_hash\x18\x01 \x01(\tR\x06txHash\x12\x16\n" +
+	"\x06staker\x18\x02 \x01(\tR\x06staker\x12\x16\n" +
+	"\x06amount\x18\x03 \x01(\x01R\x06amount\x12\x14\n" +
+	"\x05nonce\x18\x04 \x01(\x03R\x05nonce\x12\x1c\n" +
+	"\ttimestamp\x18\x05 \x01(\x03R\ttimestamp\x12\x19\n" +
+	"\bchain_id\x18\x06 \x01(\tR\achainId\x12\x1c\n" +
+	"\tsignature\x18\a \x01(\fR\tsignature\x12\x12\n" +
+	"\x04algo\x18\b \x01(\tR\x04algo\x12\x14\n" +
+	"\x05owner\x18\t \x01(\tR\x05owner\x12\x14\n" +
+	"\x05denom\x18\n" +
+	" \x01(\tR\x05denom\"0\n" +
+	"\bAddrInfo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\fR\x02id\x12\x14\n" +
+	"\x05addrs\x18\x02 \x03(\fR\x05addrs\"\x8f\x05\n" +
+	"\x0fRegistryRequest\x12\x16\n" +
+	"\x06method\x18\x01 \x01(\tR\x06method\x121\n" +
+	"\x04card\x18\x02 \x01(\v2\x1d.prxs.registry.v1.ServiceCardR\x04card\x12\x14\n" +
+	"\x05query\x18\x03 \x01(\tR\x05query\x12=\n" +
+	"\vstake_proof\x18\x04 \x01(\v2\x1c.prxs.registry.v1.StakeProofR\n" +
+	"stakeProof\x12?\n" +
+	"\rprovider_info\x18\x05 \x01(\v2\x1a.prxs.registry.v1.AddrInfoR\fproviderInfo\x12\x14\n" +
+	"\x05limit\x18\x06 \x01(\x05R\x05limit\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\a \x01(\tR\tpageToken\x12\x12\n" +
+	"\x04rank\x18\b \x01(\tR\x04rank\x12\x16\n" +
+	"\x06inputs\x18\t \x03(\tR\x06inputs\x12\x18\n" +
+	"\aoutputs\x18\n" +
+	" \x03(\tR\aoutputs\x12\x17\n" +
+	"\amax_age\x18\v \x01(\x05R\x06maxAge\x12\x1a\n" +
+	"\bfederate\x18\f \x01(\bR\bfederate\x12\x10\n" +
+	"\x03ttl\x18\r \x01(\x05R\x03ttl\x12\x19\n" +
+	"\bquery_id\x18\x0e \x01(\tR\aqueryId\x123\n" +
+	"\x05cards\x18\x0f \x03(\v2\x1d.prxs.registry.v1.ServiceCardR\x05cards\x12\x14\n" +
+	"\x05token\x18\x10 \x01(\tR\x05token\x12\x18\n" +
+	"\aexclude\x18\x11 \x03(\fR\aexclude\x124\n" +
+	"\x05admin\x18\x12 \x01(\v2\x1e.prxs.registry.v1.AdminCommandR\x05admin\x12#\n" +
+	"\rrequire_match\x18\x13 \x01(\bR\frequireMatch\"\xae\x04\n" +
+	"\x10RegistryResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x128\n" +
+	"\tproviders\x18\x02 \x03(\v2\x1a.prxs.registry.v1.AddrInfoR\tproviders\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"next_token\x18\x04 \x01(\tR\tnextToken\x12-\n" +
+	"\x12heartbeat_interval\x18\x05 \x01(\x05R\x11heartbeatInterval\x12C\n" +
+	"\vattestation\x18\x06 \x01(\v2!.prxs.registry.v1.FindAttestationR\vattestation\x12I\n" +
+	"\aorigins\x18\a \x03(\v2/.prxs.registry.v1.RegistryResponse.OriginsEntryR\aorigins\x121\n" +
+	"\x04card\x18\b \x01(\v2\x1d.prxs.registry.v1.ServiceCardR\x04card\x12\x1f\n" +
+	"\vretry_after\x18\t \x01(\x05R\n" +
+	"retryAfter\x12\x12\n" +
+	"\x04pong\x18\n" +
+	" \x01(\bR\x04pong\x12\x14\n" +
+	"\x05nonce\x18\v \x01(\tR\x05nonce\x12\x18\n" +
+	"\amatched\x18\f \x01(\x05R\amatched\x1a:\n" +
+	"\fOriginsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xd0\x01\n" +
+	"\x0fFindAttestation\x12\x1a\n" +
+	"\bregistry\x18\x01 \x01(\tR\bregistry\x12\x14\n" +
+	"\x05query\x18\x02 \x01(\tR\x05query\x12\x1c\n" +
+	"\ttimestamp\x18\x03 \x01(\x03R\ttimestamp\x12\x14\n" +
+	"\x05nonce\x18\x04 \x01(\tR\x05nonce\x12\x1c\n" +
+	"\tsignature\x18\x05 \x01(\fR\tsignature\x129\n" +
+	"\brotation\x18\x06 \x01(\v2\x1d.prxs.registry.v1.KeyRotationR\brotation\"\xa7\x01\n" +
+	"\fAdminCommand\x12\x16\n" +
+	"\x06action\x18\x01 \x01(\tR\x06action\x12\x16\n" +
+	"\x06target\x18\x02 \x01(\tR\x06target\x12\x1a\n" +
+	"\bduration\x18\x03 \x01(\x05R\bduration\x12\x14\n" +
+	"\x05nonce\x18\x04 \x01(\tR\x05nonce\x12\x17\n" +
+	"\apub_key\x18\x05 \x01(\fR\x06pubKey\x12\x1c\n" +
+	"\tsignature\x18\x06 \x01(\fR\tsignature\"\x94\x01\n" +
+	"\vKeyRotation\x12\x1a\n" +
+	"\bprevious\x18\x01 \x01(\tR\bprevious\x12\x18\n" +
+	"\acurrent\x18\x02 \x01(\tR\acurrent\x12\x17\n" +
+	"\apub_key\x18\x03 \x01(\fR\x06pubKey\x12\x18\n" +
+	"\aexpires\x18\x04 \x01(\x03R\aexpires\x12\x1c\n" +
+	"\tsignature\x18\x05 \x01(\fR\tsignatureB\x10Z\x0eprxs/common/pbb\x06proto3"
+
+var (
+	file_registry_proto_rawDescOnce sync.Once
+	file_registry_proto_rawDescData []byte
+)
+
+func file_registry_proto_rawDescGZIP() []byte {
+	file_registry_proto_rawDescOnce.Do(func() {
+		file_registry_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_registry_proto_rawDesc), len(file_registry_proto_rawDesc)))
+	})
+	return file_registry_proto_rawDescData
+}
+
+var file_registry_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_registry_proto_goTypes = []any{
+	(*ServiceCard)(nil),      // 0: prxs.registry.v1.ServiceCard
+	(*StakeProof)(nil),       // 1: prxs.registry.v1.StakeProof
+	(*AddrInfo)(nil),         // 2: prxs.registry.v1.AddrInfo
+	(*RegistryRequest)(nil),  // 3: prxs.registry.v1.RegistryRequest
+	(*RegistryResponse)(nil), // 4: prxs.registry.v1.RegistryResponse
+	(*FindAttestation)(nil),  // 5: prxs.registry.v1.FindAttestation
+	(*AdminCommand)(nil),     // 6: prxs.registry.v1.AdminCommand
+	(*KeyRotation)(nil),      // 7: prxs.registry.v1.KeyRotation
+	nil,                      // 8: prxs.registry.v1.ServiceCard.HardwareEntry
+	nil,                      // 9: prxs.registry.v1.ServiceCard.MetadataEntry
+	nil,                      // 10: prxs.registry.v1.RegistryResponse.OriginsEntry
+}
+var file_registry_proto_depIdxs = []int32{
+	8,  // 0: prxs.registry.v1.ServiceCard.hardware:type_name -> prxs.registry.v1.ServiceCard.HardwareEntry
+	9,  // 1: prxs.registry.v1.ServiceCard.metadata:type_name -> prxs.registry.v1.ServiceCard.MetadataEntry
+	0,  // 2: prxs.registry.v1.RegistryRequest.card:type_name -> prxs.registry.v1.ServiceCard
+	1,  // 3: prxs.registry.v1.RegistryRequest.stake_proof:type_name -> prxs.registry.v1.StakeProof
+	2,  // 4: prxs.registry.v1.RegistryRequest.provider_info:type_name -> prxs.registry.v1.AddrInfo
+	0,  // 5: prxs.registry.v1.RegistryRequest.cards:type_name -> prxs.registry.v1.ServiceCard
+	6,  // 6: prxs.registry.v1.RegistryRequest.admin:type_name -> prxs.registry.v1.AdminCommand
+	2,  // 7: prxs.registry.v1.RegistryResponse.providers:type_name -> prxs.registry.v1.AddrInfo
+	5,  // 8: prxs.registry.v1.RegistryResponse.attestation:type_name -> prxs.registry.v1.FindAttestation
+	10, // 9: prxs.registry.v1.RegistryResponse.origins:type_name -> prxs.registry.v1.RegistryResponse.OriginsEntry
+	0,  // 10: prxs.registry.v1.RegistryResponse.card:type_name -> prxs.registry.v1.ServiceCard
+	7,  // 11: prxs.registry.v1.FindAttestation.rotation:type_name -> prxs.registry.v1.KeyRotation
+	12, // [12:12] is the sub-list for method output_type
+	12, // [12:12] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_registry_proto_init() }
+func file_registry_proto_init() {
+	if File_registry_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_registry_proto_rawDesc), len(file_registry_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_registry_proto_goTypes,
+		DependencyIndexes: file_registry_proto_depIdxs,
+		MessageInfos:      file_registry_proto_msgTypes,
+	}.Build()
+	File_registry_proto = out.File
+	file_registry_proto_goTypes = nil
+	file_registry_proto_depIdxs = nil
+}
@@ -9,6 +9,9 @@ const (
 	// RegistryProtocolID is the p2p protocol used for Node <-> Registry interactions
 	RegistryProtocolID = "/prxs/registry-rpc/1.0"
 
+	// RegistryProtocolPB is the same registry RPC encoded as length-delimited protobuf
+	RegistryProtocolPB = "/prxs/registry-rpc/1.0+pb"
+
 	// RegistryRendezvous is the DHT Key used ONLY to find the Registry Node.
 	// Nodes do NOT advertise services here. They only look for the Registry.
 	RegistryRendezvous = "prxs.infra.registry"
@@ -20,10 +23,31 @@ type ServiceCard struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Inputs      []string  `json:"inputs"`                 // e.g. ["prompt", "style"]
+	Outputs     []string  `json:"outputs,omitempty"`      // e.g. ["image"]
 	CostPerOp   float64   `json:"cost_per_op"`            // Fake tokens
 	Version     string    `json:"version"`
 	Tags        []string  `json:"tags,omitempty"`        // Categories / labels
 	Embedding   []float32 `json:"embedding,omitempty"`   // Optional vector for semantic search
+
+	// Optional provider placement metadata used by clients choosing for latency/cost
+	Region   string            `json:"region,omitempty"`   // e.g. "eu-west", "us-east"
+	Hardware map[string]string `json:"hardware,omitempty"` // e.g. {"gpu": "A100", "ram": "80GB"}
+
+	// Free-form provider metadata (weights hash, license, SLA tier, ...).
+	// The registry bounds the number and size of entries.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Visibility is "public" (default when empty) or "private". A private
+	// service is only returned to callers whose peer ID is in AllowPeers or
+	// who present a token whose HashAccessToken is in TokenHashes.
+	Visibility  string   `json:"visibility,omitempty"`
+	AllowPeers  []string `json:"allow_peers,omitempty"`
+	TokenHashes []string `json:"token_hashes,omitempty"`
+
+	// RateLimit is how many calls per second the provider accepts (0 = not
+	// advertised). The provider enforces it, answering excess calls with
+	// RateLimited and a RetryAfterMs hint.
+	RateLimit float64 `json:"rate_limit,omitempty"`
 }
 
 // PaymentTicket is an off-chain receipt signed by the client to pay a provider.
@@ -43,6 +67,9 @@ type StakeProof struct {
 	Nonce     int64   `json:"nonce"`
 	Timestamp int64   `json:"timestamp"`
 	ChainID   string  `json:"chain_id"`
+	Denom     string  `json:"denom,omitempty"` // Unit of Amount, e.g. "uprxs"; empty = the registry's base unit
+	Owner     string  `json:"owner,omitempty"` // On-chain identity that funded the stake (may back several peers)
+	Algo      string  `json:"algo,omitempty"`  // Signing scheme: rsa, ed25519, secp256k1 or ecdsa
 	Signature []byte  `json:"signature"`
 }
 
@@ -55,24 +82,132 @@ type RegistryRequest struct {
 	StakeProof *StakeProof `json:"stake_proof,omitempty"`
 	// Providers send their own address info so the Registry can tell Clients how to connect
 	ProviderInfo *peer.AddrInfo `json:"provider_info,omitempty"`
+
+	// Pagination for "find": at most Limit providers are returned (0 = all).
+	// PageToken is the NextToken of a previous response, passed back verbatim.
+	Limit     int    `json:"limit,omitempty"`
+	PageToken string `json:"page_token,omitempty"`
+
+	// Rank orders "find" results: "" keeps peer-ID order (paginated),
+	// "score" applies the registry's weighted ranking and "default" its
+	// freshness + stake composite; both return the top Limit providers
+	// without a continuation token.
+	Rank string `json:"rank,omitempty"`
+
+	// Inputs/Outputs select providers for "find_by_capability": every listed
+	// name must appear in the card's Inputs/Outputs.
+	Inputs  []string `json:"inputs,omitempty"`
+	Outputs []string `json:"outputs,omitempty"`
+
+	// MaxAge, in seconds, drops "find" results whose last heartbeat is older
+	// than this (0 = no limit beyond the registry's heartbeat TTL).
+	MaxAge int `json:"max_age,omitempty"`
+
+	// Federate asks the registry to also forward "find" to its federated
+	// peer registries. TTL is the number of further hops allowed (0 on a
+	// client request = the registry's default); each forward decrements it
+	// and a registry stops forwarding at zero. QueryID is assigned by the
+	// first registry so the others can drop a query that loops back.
+	Federate bool   `json:"federate,omitempty"`
+	TTL      int    `json:"ttl,omitempty"`
+	QueryID  string `json:"query_id,omitempty"`
+
+	// Cards are the services registered by "register_batch", all under the
+	// one StakeProof.
+	Cards []ServiceCard `json:"cards,omitempty"`
+
+	// Token is the access token presented to "find"/"find_best" to see
+	// private services (see ServiceCard.Visibility).
+	Token string `json:"access_token,omitempty"`
+
+	// Exclude drops these providers from "find"/"find_best" results, e.g.
+	// ones a client already tried and saw fail.
+	Exclude []peer.ID `json:"exclude,omitempty"`
+
+	// RequireMatch makes a "find"/"find_best" that matches no provider fail
+	// with NoMatch instead of succeeding with an empty list.
+	RequireMatch bool `json:"require_match,omitempty"`
+
+	// Admin is the signed command of a RegistryMethodAdmin call.
+	Admin *AdminCommand `json:"admin,omitempty"`
 }
 
 type RegistryResponse struct {
 	Success   bool            `json:"success"`
 	Providers []peer.AddrInfo `json:"providers,omitempty"`
 	Error     string          `json:"error,omitempty"`
+	// NextToken is set when more "find" results remain; empty on the last page.
+	NextToken string `json:"next_token,omitempty"`
+	// HeartbeatInterval is the registry's recommended heartbeat cadence in
+	// seconds, set on successful "register" calls (0 = no recommendation).
+	HeartbeatInterval int `json:"heartbeat_interval,omitempty"`
+	// Attestation is the registry's signature over a "find" result; see
+	// VerifyFindResponse.
+	Attestation *FindAttestation `json:"attestation,omitempty"`
+	// Origins maps each provider's peer ID to the registry it is registered
+	// at; set on federated "find" responses.
+	Origins map[string]string `json:"origins,omitempty"`
+	// Card is the chosen provider's service card on "find_best" responses.
+	Card *ServiceCard `json:"card,omitempty"`
+	// RetryAfter, in seconds, is set when the registry rejected the call for
+	// being over a rate or capacity limit: try again no sooner than this.
+	RetryAfter int `json:"retry_after,omitempty"`
+
+	// Pong answers a RegistryMethodPing.
+	Pong bool `json:"pong,omitempty"`
+	// Nonce answers a RegistryMethodAdminChallenge: the value the following
+	// AdminCommand must be signed over.
+	Nonce string `json:"nonce,omitempty"`
+	// Matched is how many providers a "find" or "find_best" matched, across
+	// all pages and before Limit. A successful find with Matched 0 ran fine
+	// and found nothing.
+	Matched int `json:"matched"`
 }
 
+// NoMatch is the RegistryResponse.Error of a "find"/"find_best" with
+// RequireMatch set that matched no provider.
+const NoMatch = "no matching providers"
+
+// RegistryMethodPing is a keepalive on a long-lived registry stream. The
+// registry answers it with Pong and doesn't count it toward the stream's
+// message limit; see RegistryStream.
+const RegistryMethodPing = "ping"
+
 // --- Execution RPC (Client <-> Provider) ---
 
 type JSONRPCRequest struct {
 	Method string      `json:"method"`
 	Params interface{} `json:"params"`
 	ID     int         `json:"id"`
+	// TimeoutMs asks the provider to give up after this many milliseconds
+	// and answer with DeadlineExceeded (0 = no deadline). It is forwarded to
+	// the agent so cancelable handlers can stop early.
+	TimeoutMs int64 `json:"timeout_ms,omitempty"`
+	// Payment is the caller's signed ticket for this call, if any. The
+	// provider rejects calls whose ticket doesn't verify or names another
+	// provider, and forwards valid ones to the agent to charge.
+	Payment *PaymentTicket `json:"payment,omitempty"`
 }
 
+// DeadlineExceeded is the JSONRPCResponse.Error for calls that ran past TimeoutMs.
+const DeadlineExceeded = "deadline exceeded"
+
+// ServerBusy is the JSONRPCResponse.Error for calls a provider refused
+// because its agent already had as many calls pending as it accepts.
+const ServerBusy = "server busy"
+
+// RateLimited is the JSONRPCResponse.Error for calls over the provider's
+// advertised ServiceCard.RateLimit; RetryAfterMs says when to try again.
+const RateLimited = "rate limit exceeded"
+
 type JSONRPCResponse struct {
 	Result interface{} `json:"result,omitempty"`
 	Error  string      `json:"error,omitempty"`
-	ID     int         `json:"id"`
+	// Code is the JSON-RPC error code classifying Error, when the agent
+	// sets one (e.g. -32601 method not found, -32700 parse error).
+	Code int `json:"code,omitempty"`
+	ID   int `json:"id"`
+	// RetryAfterMs accompanies RateLimited: the wait in milliseconds until
+	// the provider accepts another call.
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
 }
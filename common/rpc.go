@@ -0,0 +1,100 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// NewLoopbackHost creates a libp2p host that only listens on 127.0.0.1 with an
+// OS-assigned TCP port. It is meant for running registry, provider and client
+// hosts in a single process (integration harnesses, local demos).
+func NewLoopbackHost(key crypto.PrivKey) (host.Host, error) {
+	opts := []libp2p.Option{
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.DisableRelay(),
+	}
+	if key != nil {
+		opts = append(opts, libp2p.Identity(key))
+	}
+	return libp2p.New(opts...)
+}
+
+// ConnectHosts makes b aware of a's addresses and dials it.
+func ConnectHosts(ctx context.Context, a, b host.Host) error {
+	return b.Connect(ctx, peer.AddrInfo{ID: a.ID(), Addrs: a.Addrs()})
+}
+
+// RoundTrip opens a stream to target on proto, writes req as JSON and decodes
+// a single JSON reply into resp. The stream is bounded by ctx's deadline.
+func RoundTrip(ctx context.Context, h host.Host, target peer.ID, proto protocol.ID, req interface{}, resp interface{}) error {
+	s, err := h.NewStream(ctx, target, proto)
+	if err != nil {
+		return fmt.Errorf("failed to open stream: %v", err)
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	rw := bufio.NewReadWriter(bufio.NewReader(s), bufio.NewWriter(s))
+	if err := json.NewEncoder(rw).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	if err := rw.Flush(); err != nil {
+		return fmt.Errorf("failed to flush request: %v", err)
+	}
+	if err := json.NewDecoder(rw).Decode(resp); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// CallRegistry sends a RegistryRequest to the registry peer using JSON.
+func CallRegistry(ctx context.Context, h host.Host, registry peer.ID, req RegistryRequest) (*RegistryResponse, error) {
+	var resp RegistryResponse
+	if err := RoundTrip(ctx, h, registry, RegistryProtocolID, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CallRegistryPB sends a RegistryRequest preferring the protobuf encoding and
+// falling back to JSON when the registry doesn't speak it.
+func CallRegistryPB(ctx context.Context, h host.Host, registry peer.ID, req RegistryRequest) (*RegistryResponse, error) {
+	s, err := h.NewStream(ctx, registry, RegistryProtocolPB, RegistryProtocolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %v", err)
+	}
+	defer s.Close()
+
+	codec := RegistryCodecFor(s.Protocol())
+	rw := bufio.NewReadWriter(bufio.NewReader(s), bufio.NewWriter(s))
+	if err := codec.WriteRequest(rw, &req); err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	if err := rw.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush request: %v", err)
+	}
+	var resp RegistryResponse
+	if err := codec.ReadResponse(rw.Reader, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	return &resp, nil
+}
+
+// CallProvider sends a JSON-RPC execution request to a provider.
+func CallProvider(ctx context.Context, h host.Host, provider peer.ID, req JSONRPCRequest) (*JSONRPCResponse, error) {
+	var resp JSONRPCResponse
+	if err := RoundTrip(ctx, h, provider, ProtocolID, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
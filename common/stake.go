@@ -0,0 +1,162 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	pb "github.com/libp2p/go-libp2p/core/crypto/pb"
+)
+
+// Stake signature algorithms a StakeProof may declare in its Algo field.
+const (
+	StakeAlgoRSA       = "rsa"
+	StakeAlgoEd25519   = "ed25519"
+	StakeAlgoSecp256k1 = "secp256k1"
+	StakeAlgoECDSA     = "ecdsa"
+)
+
+// StakeAlgoForKey returns the stake algorithm name matching a key's type.
+func StakeAlgoForKey(key crypto.PubKey) (string, error) {
+	if key == nil {
+		return "", fmt.Errorf("nil public key")
+	}
+	switch key.Type() {
+	case pb.KeyType_RSA:
+		return StakeAlgoRSA, nil
+	case pb.KeyType_Ed25519:
+		return StakeAlgoEd25519, nil
+	case pb.KeyType_Secp256k1:
+		return StakeAlgoSecp256k1, nil
+	case pb.KeyType_ECDSA:
+		return StakeAlgoECDSA, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %s", key.Type())
+	}
+}
+
+// CheckStakeAlgo verifies that the algorithm declared by a proof matches the
+// key it will be verified with. Proofs created before Algo existed leave it
+// empty; those are accepted and verified with whatever key the peer has.
+func CheckStakeAlgo(proof *StakeProof, key crypto.PubKey) error {
+	actual, err := StakeAlgoForKey(key)
+	if err != nil {
+		return err
+	}
+	declared := strings.ToLower(proof.Algo)
+	switch declared {
+	case "":
+		return nil
+	case StakeAlgoRSA, StakeAlgoEd25519, StakeAlgoSecp256k1, StakeAlgoECDSA:
+	default:
+		return fmt.Errorf("unknown stake signature algorithm %q", proof.Algo)
+	}
+	if declared != actual {
+		return fmt.Errorf("stake signature algorithm mismatch (declared %s, key is %s)", declared, actual)
+	}
+	return nil
+}
+
+// stakeSigningPayload is the canonical form of the StakeProof fields covered
+// by the signature. Fields are declared in alphabetical order so the JSON
+// encoding is byte-for-byte stable, and the amount is carried as an exact
+// decimal string so no float formatting or locale can alter the digest.
+type stakeSigningPayload struct {
+	Algo      string `json:"algo"`
+	Amount    string `json:"amount"`
+	ChainID   string `json:"chain_id"`
+	Denom     string `json:"denom,omitempty"`
+	Nonce     int64  `json:"nonce"`
+	Owner     string `json:"owner,omitempty"`
+	Staker    string `json:"staker"`
+	Timestamp int64  `json:"timestamp"`
+	TxHash    string `json:"tx_hash"`
+}
+
+// FormatStakeAmount renders an amount as the shortest exact decimal string
+// (no exponent), e.g. 10.1234567 -> "10.1234567".
+func FormatStakeAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+// CanonicalStakePayload returns the deterministic byte serialization of a
+// proof that signers sign and verifiers check. The Signature field is not
+// part of the payload.
+func CanonicalStakePayload(proof *StakeProof) []byte {
+	b, _ := json.Marshal(stakeSigningPayload{
+		Algo:      strings.ToLower(proof.Algo),
+		Amount:    FormatStakeAmount(proof.Amount),
+		ChainID:   proof.ChainID,
+		Denom:     proof.Denom,
+		Nonce:     proof.Nonce,
+		Owner:     proof.Owner,
+		Staker:    proof.Staker,
+		Timestamp: proof.Timestamp,
+		TxHash:    proof.TxHash,
+	})
+	return b
+}
+
+// StakeDigest is the SHA-256 of the canonical payload; this is what gets signed.
+func StakeDigest(proof *StakeProof) [32]byte {
+	return sha256.Sum256(CanonicalStakePayload(proof))
+}
+
+// legacyStakeDigest reproduces the pre-canonical "tx|amount|nonce|ts|chain"
+// payload so proofs saved by older nodes keep verifying.
+func legacyStakeDigest(proof *StakeProof) [32]byte {
+	payload := fmt.Sprintf("%s|%f|%d|%d|%s", proof.TxHash, proof.Amount, proof.Nonce, proof.Timestamp, proof.ChainID)
+	return sha256.Sum256([]byte(payload))
+}
+
+// StakeIdentity returns the identity a stake is attributed to: the on-chain
+// owner when the proof declares one, otherwise the staking peer.
+func StakeIdentity(proof *StakeProof) string {
+	if proof == nil {
+		return ""
+	}
+	if proof.Owner != "" {
+		return proof.Owner
+	}
+	return proof.Staker
+}
+
+// SignStakeProof fills in proof.Signature over the canonical payload.
+func SignStakeProof(priv crypto.PrivKey, proof *StakeProof) error {
+	digest := StakeDigest(proof)
+	sig, err := priv.Sign(digest[:])
+	if err != nil {
+		return err
+	}
+	proof.Signature = sig
+	return nil
+}
+
+// legacyAmountExact reports whether the legacy "%f" rendering (six decimal
+// places) represents amount exactly. When it doesn't, the legacy digest
+// would cover a rounded value, so a signature over 10.123457 would also
+// "verify" a claimed 10.1234567.
+func legacyAmountExact(amount float64) bool {
+	rendered := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", amount), "0"), ".")
+	return rendered == FormatStakeAmount(amount)
+}
+
+// VerifyStakeSignature checks proof.Signature against pub. The canonical
+// payload is tried first; the legacy format is only accepted for amounts it
+// can represent without rounding.
+func VerifyStakeSignature(pub crypto.PubKey, proof *StakeProof) (bool, error) {
+	digest := StakeDigest(proof)
+	ok, err := pub.Verify(digest[:], proof.Signature)
+	if err == nil && ok {
+		return true, nil
+	}
+
+	if !legacyAmountExact(proof.Amount) {
+		return ok, err
+	}
+	legacy := legacyStakeDigest(proof)
+	return pub.Verify(legacy[:], proof.Signature)
+}
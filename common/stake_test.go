@@ -0,0 +1,120 @@
+package common
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+func TestStakeAlgo(t *testing.T) {
+	ed, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secp, _, err := crypto.GenerateSecp256k1Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     crypto.PrivKey
+		algo    string
+		wantErr bool
+	}{
+		{"ed25519", ed, StakeAlgoEd25519, false},
+		{"secp256k1", secp, StakeAlgoSecp256k1, false},
+		{"undeclared", secp, "", false},
+		{"declared case-insensitively", ed, "Ed25519", false},
+		{"ed25519 declared for secp256k1 key", secp, StakeAlgoEd25519, true},
+		{"secp256k1 declared for ed25519 key", ed, StakeAlgoSecp256k1, true},
+		{"unknown", ed, "dsa", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof := &StakeProof{TxHash: "0xabc", Amount: 25, Nonce: 1, Timestamp: 1700000000, ChainID: "prxs-test", Algo: tt.algo}
+			if err := SignStakeProof(tt.key, proof); err != nil {
+				t.Fatal(err)
+			}
+
+			err := CheckStakeAlgo(proof, tt.key.GetPublic())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckStakeAlgo: err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if ok, err := VerifyStakeSignature(tt.key.GetPublic(), proof); err != nil || !ok {
+				t.Fatalf("VerifyStakeSignature = %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestCanonicalStakePayload(t *testing.T) {
+	proof := &StakeProof{
+		TxHash:    "0xabc",
+		Staker:    "12D3KooW",
+		Amount:    1234.000000123,
+		Nonce:     7,
+		Timestamp: 1700000000,
+		ChainID:   "prxs-test",
+		Algo:      "ED25519",
+		Signature: []byte("ignored"),
+	}
+	want := `{"algo":"ed25519","amount":"1234.000000123","chain_id":"prxs-test","nonce":7,"staker":"12D3KooW","timestamp":1700000000,"tx_hash":"0xabc"}`
+	if got := string(CanonicalStakePayload(proof)); got != want {
+		t.Fatalf("payload\n got %s\nwant %s", got, want)
+	}
+
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignStakeProof(key, proof); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyStakeSignature(key.GetPublic(), proof); err != nil || !ok {
+		t.Fatalf("high-precision proof doesn't verify: %v, %v", ok, err)
+	}
+}
+
+func TestStakeAmountBeyondSixDecimals(t *testing.T) {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const amount = 10.1234567
+	if got := FormatStakeAmount(amount); got != "10.1234567" {
+		t.Fatalf("FormatStakeAmount = %s", got)
+	}
+
+	proof := &StakeProof{TxHash: "0xabc", Amount: amount, Nonce: 1, Timestamp: 1700000000, ChainID: "prxs-test"}
+	if err := SignStakeProof(key, proof); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyStakeSignature(key.GetPublic(), proof); err != nil || !ok {
+		t.Fatalf("proof for %v doesn't verify: %v, %v", amount, ok, err)
+	}
+
+	// A legacy "%f" signature covers 10.123457, so it must not vouch for
+	// the more precise claimed amount
+	legacy := legacyStakeDigest(proof)
+	if proof.Signature, err = key.Sign(legacy[:]); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := VerifyStakeSignature(key.GetPublic(), proof); ok {
+		t.Fatal("legacy signature accepted for an amount it rounds")
+	}
+
+	// ...while one for an amount "%f" renders exactly still verifies
+	proof.Amount = 10.5
+	legacy = legacyStakeDigest(proof)
+	if proof.Signature, err = key.Sign(legacy[:]); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyStakeSignature(key.GetPublic(), proof); err != nil || !ok {
+		t.Fatalf("legacy proof for 10.5 doesn't verify: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// ArchivedRegistration is a registration the registry dropped (pruned for
+// missed heartbeats, evicted, or found stale on restore), kept so operators
+// can see who offered what after the fact.
+type ArchivedRegistration struct {
+	PeerID     string             `json:"peer_id"`
+	Record     RegistrationRecord `json:"record"`
+	Reason     string             `json:"reason"`
+	ArchivedAt time.Time          `json:"archived_at"`
+}
+
+// Archive stores dropped registrations apart from the live ones, so they are
+// never restored. Every Storage backend implements it.
+type Archive interface {
+	// ArchiveRegistration keeps entry for ttl (0 = never expires).
+	ArchiveRegistration(ctx context.Context, entry ArchivedRegistration, ttl time.Duration) error
+	// ListArchived returns up to limit entries, newest first, optionally
+	// only those of one peer (peerID "" = all).
+	ListArchived(ctx context.Context, peerID string, limit int) ([]ArchivedRegistration, error)
+}
+
+var (
+	_ Archive = (*RedisStorage)(nil)
+	_ Archive = (*MemoryStorage)(nil)
+	_ Archive = (*BoltStorage)(nil)
+)
+
+// archiveKey orders a peer's archived entries by time.
+func archiveKey(entry ArchivedRegistration) string {
+	return entry.PeerID + ":" + entry.ArchivedAt.UTC().Format("20060102T150405.000000000")
+}
+
+// newestArchived sorts entries newest first and cuts them to limit (<= 0 =
+// no limit).
+func newestArchived(entries []ArchivedRegistration, limit int) []ArchivedRegistration {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ArchivedAt.After(entries[j].ArchivedAt)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
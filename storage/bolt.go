@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	registrationsBucket = []byte("registrations")
+	archivedBucket      = []byte("archived")
+)
+
+// BoltStorage persists registrations in a local BoltDB file, for registries
+// that run without Redis. Records expire ttl after their last save, like
+// Redis keys; expired records are skipped on read and purged on restore.
+type BoltStorage struct {
+	db    *bolt.DB
+	ttl   time.Duration
+	clock common.Clock // nil = wall clock
+}
+
+// SetClock replaces the clock used for expiry and staleness, for tests.
+func (b *BoltStorage) SetClock(clock common.Clock) {
+	b.clock = clock
+}
+
+func (b *BoltStorage) now() time.Time {
+	if b.clock == nil {
+		return time.Now()
+	}
+	return b.clock.Now()
+}
+
+// boltArchivedEntry is the stored form of an archived registration.
+type boltArchivedEntry struct {
+	Entry     ArchivedRegistration `json:"entry"`
+	ExpiresAt time.Time            `json:"expires_at"` // zero = never
+}
+
+// boltEntry is the stored form of a registration.
+type boltEntry struct {
+	Record    RegistrationRecord `json:"record"`
+	ExpiresAt time.Time          `json:"expires_at"` // zero = never
+}
+
+// NewBoltStorage opens (or creates) the database file at path.
+func NewBoltStorage(path string, ttl time.Duration) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database %s: %v", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(registrationsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(archivedBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize bolt database: %v", err)
+	}
+
+	log.Printf("[Storage] Bolt database opened: path=%s\n", path)
+	return &BoltStorage{db: db, ttl: ttl}, nil
+}
+
+// SaveRegistration stores a registration record.
+func (b *BoltStorage) SaveRegistration(ctx context.Context, pid peer.ID, record *RegistrationRecord, ttl time.Duration) error {
+	entry := boltEntry{Record: *record}
+	if ttl <= 0 {
+		ttl = b.ttl
+	}
+	if ttl > 0 {
+		entry.ExpiresAt = b.now().Add(ttl)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal registration: %v", err)
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(registrationsBucket).Put([]byte(pid.String()), data)
+	})
+}
+
+// LoadRegistration retrieves a registration record, or ErrNotFound.
+func (b *BoltStorage) LoadRegistration(ctx context.Context, pid peer.ID) (*RegistrationRecord, error) {
+	var entry boltEntry
+	found := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(registrationsBucket).Get([]byte(pid.String()))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &entry)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registration: %v", err)
+	}
+	if !found || b.expired(entry, b.now()) {
+		return nil, ErrNotFound
+	}
+	return &entry.Record, nil
+}
+
+// DeleteRegistration removes a registration record.
+func (b *BoltStorage) DeleteRegistration(ctx context.Context, pid peer.ID, serviceName string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(registrationsBucket).Delete([]byte(pid.String()))
+	})
+}
+
+// RestoreAllRegistrations returns every record seen within maxAge. Expired,
+// stale and unreadable records are deleted so the file doesn't grow forever.
+func (b *BoltStorage) RestoreAllRegistrations(ctx context.Context, maxAge time.Duration) (map[peer.ID]*RegistrationRecord, error) {
+	registrations := make(map[peer.ID]*RegistrationRecord)
+	now := b.now()
+	skippedCount := 0
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(registrationsBucket)
+		var purge [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var entry boltEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				log.Printf("[Storage] Warning: Failed to unmarshal record for key %s: %v", k, err)
+				purge = append(purge, k)
+				return nil
+			}
+			if b.expired(entry, now) || now.Sub(entry.Record.LastSeen) > maxAge {
+				skippedCount++
+				purge = append(purge, k)
+				return nil
+			}
+			pid, err := peer.Decode(string(k))
+			if err != nil {
+				log.Printf("[Storage] Warning: Failed to decode peer ID from key %s: %v", k, err)
+				purge = append(purge, k)
+				return nil
+			}
+			record := entry.Record
+			registrations[pid] = &record
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range purge {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt restore error: %v", err)
+	}
+
+	log.Printf("[Storage] Restored %d registrations from bolt (%d stale records skipped)", len(registrations), skippedCount)
+	return registrations, nil
+}
+
+// ArchiveRegistration stores entry in the archive bucket until ttl passes.
+func (b *BoltStorage) ArchiveRegistration(ctx context.Context, entry ArchivedRegistration, ttl time.Duration) error {
+	stored := boltArchivedEntry{Entry: entry}
+	if ttl > 0 {
+		stored.ExpiresAt = b.now().Add(ttl)
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal archived registration: %v", err)
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(archivedBucket).Put([]byte(archiveKey(entry)), data)
+	})
+}
+
+// ListArchived returns unexpired archived entries, newest first. Expired
+// and unreadable entries are deleted.
+func (b *BoltStorage) ListArchived(ctx context.Context, peerID string, limit int) ([]ArchivedRegistration, error) {
+	entries := []ArchivedRegistration{}
+	now := b.now()
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(archivedBucket)
+		var purge [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var stored boltArchivedEntry
+			if err := json.Unmarshal(v, &stored); err != nil {
+				log.Printf("[Storage] Warning: Failed to unmarshal archived record %s: %v", k, err)
+				purge = append(purge, k)
+				return nil
+			}
+			if !stored.ExpiresAt.IsZero() && now.After(stored.ExpiresAt) {
+				purge = append(purge, k)
+				return nil
+			}
+			if peerID == "" || stored.Entry.PeerID == peerID {
+				entries = append(entries, stored.Entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range purge {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt archive read error: %v", err)
+	}
+	return newestArchived(entries, limit), nil
+}
+
+// Close closes the database file.
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
+
+func (b *BoltStorage) expired(entry boltEntry, now time.Time) bool {
+	return !entry.ExpiresAt.IsZero() && now.After(entry.ExpiresAt)
+}
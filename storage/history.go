@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Service history events.
+const (
+	ServiceEventRegistered   = "registered"
+	ServiceEventDeregistered = "deregistered"
+)
+
+// ServiceEvent is one change to a service's provider set.
+type ServiceEvent struct {
+	Event  string `json:"event"`
+	PeerID string `json:"peer_id"`
+	Reason string `json:"reason,omitempty"` // Why a provider left, e.g. "pruned"
+	At     int64  `json:"at"`               // Unix seconds
+}
+
+func historyKey(service string) string {
+	return fmt.Sprintf("history:%s", service)
+}
+
+// RecordServiceEvent prepends ev to the service's history list and trims it
+// to the newest maxLen entries.
+func (r *RedisStorage) RecordServiceEvent(ctx context.Context, service string, ev ServiceEvent, maxLen int) error {
+	if r == nil || r.client == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal service event: %v", err)
+	}
+	key := historyKey(service)
+	pipe := r.client.TxPipeline()
+	pipe.LPush(ctx, key, data)
+	pipe.LTrim(ctx, key, 0, int64(maxLen)-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record service event: %v", err)
+	}
+	return nil
+}
+
+// ServiceHistory returns up to limit of the service's events, newest first.
+func (r *RedisStorage) ServiceHistory(ctx context.Context, service string, limit int) ([]ServiceEvent, error) {
+	if r == nil || r.client == nil {
+		return nil, fmt.Errorf("redis not configured")
+	}
+
+	raw, err := r.client.LRange(ctx, historyKey(service), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load service history: %v", err)
+	}
+	events := make([]ServiceEvent, 0, len(raw))
+	for _, s := range raw {
+		var ev ServiceEvent
+		if err := json.Unmarshal([]byte(s), &ev); err != nil {
+			log.Printf("[Storage] Skipping corrupt history entry for %s: %v\n", service, err)
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
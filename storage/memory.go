@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// MemoryStorage is an in-process Storage. Records expire ttl after their last
+// save, mirroring Redis key expiry, and are lost when the process exits.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	records  map[peer.ID]memoryEntry
+	archived []archivedEntry
+	clock    common.Clock // nil = wall clock
+}
+
+type archivedEntry struct {
+	entry     ArchivedRegistration
+	expiresAt time.Time // Zero = never
+}
+
+type memoryEntry struct {
+	record    RegistrationRecord
+	expiresAt time.Time // Zero = never
+}
+
+// NewMemoryStorage creates an empty in-memory store (ttl 0 = never expire).
+func NewMemoryStorage(ttl time.Duration) *MemoryStorage {
+	return &MemoryStorage{
+		ttl:     ttl,
+		records: make(map[peer.ID]memoryEntry),
+	}
+}
+
+// SetClock replaces the clock used for expiry and staleness, for tests.
+func (m *MemoryStorage) SetClock(clock common.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = clock
+}
+
+func (m *MemoryStorage) now() time.Time {
+	if m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
+
+// SaveRegistration stores a copy of the record.
+func (m *MemoryStorage) SaveRegistration(ctx context.Context, pid peer.ID, record *RegistrationRecord, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := memoryEntry{record: *record}
+	if ttl <= 0 {
+		ttl = m.ttl
+	}
+	if ttl > 0 {
+		entry.expiresAt = m.now().Add(ttl)
+	}
+	m.records[pid] = entry
+	return nil
+}
+
+// LoadRegistration returns a copy of the record for pid.
+func (m *MemoryStorage) LoadRegistration(ctx context.Context, pid peer.ID) (*RegistrationRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.records[pid]
+	if !ok || m.expired(entry) {
+		return nil, ErrNotFound
+	}
+	record := entry.record
+	return &record, nil
+}
+
+// DeleteRegistration removes the record for pid.
+func (m *MemoryStorage) DeleteRegistration(ctx context.Context, pid peer.ID, serviceName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, pid)
+	return nil
+}
+
+// RestoreAllRegistrations returns copies of every unexpired record seen
+// within maxAge, like RedisStorage.
+func (m *MemoryStorage) RestoreAllRegistrations(ctx context.Context, maxAge time.Duration) (map[peer.ID]*RegistrationRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	registrations := make(map[peer.ID]*RegistrationRecord)
+	now := m.now()
+	skippedCount := 0
+	for pid, entry := range m.records {
+		if m.expired(entry) || now.Sub(entry.record.LastSeen) > maxAge {
+			skippedCount++
+			continue
+		}
+		record := entry.record
+		registrations[pid] = &record
+	}
+
+	log.Printf("[Storage] Restored %d registrations from memory (%d stale records skipped)", len(registrations), skippedCount)
+	return registrations, nil
+}
+
+// ArchiveRegistration keeps a copy of entry until ttl passes.
+func (m *MemoryStorage) ArchiveRegistration(ctx context.Context, entry ArchivedRegistration, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := archivedEntry{entry: entry}
+	if ttl > 0 {
+		a.expiresAt = m.now().Add(ttl)
+	}
+	m.archived = append(m.archived, a)
+	return nil
+}
+
+// ListArchived returns unexpired archived entries, newest first, dropping
+// expired ones as it goes.
+func (m *MemoryStorage) ListArchived(ctx context.Context, peerID string, limit int) ([]ArchivedRegistration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	kept := m.archived[:0]
+	entries := []ArchivedRegistration{}
+	for _, a := range m.archived {
+		if !a.expiresAt.IsZero() && now.After(a.expiresAt) {
+			continue
+		}
+		kept = append(kept, a)
+		if peerID == "" || a.entry.PeerID == peerID {
+			entries = append(entries, a.entry)
+		}
+	}
+	m.archived = kept
+	return newestArchived(entries, limit), nil
+}
+
+// Close is a no-op.
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+func (m *MemoryStorage) expired(entry memoryEntry) bool {
+	return !entry.expiresAt.IsZero() && m.now().After(entry.expiresAt)
+}
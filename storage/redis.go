@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand"
 	"strings"
 	"time"
 
@@ -21,6 +22,20 @@ type RegistrationRecord struct {
 	ServiceCard common.ServiceCard
 	StakeProof  *common.StakeProof
 	AddrInfo    peer.AddrInfo
+	Extra       []common.ServiceCard `json:",omitempty"`
+
+	// SuppliedEmbeddings names the cards whose Embedding the provider sent
+	// rather than the registry computed.
+	SuppliedEmbeddings []string `json:",omitempty"`
+}
+
+// ServiceNames lists the names of every service the record registers.
+func (rec *RegistrationRecord) ServiceNames() []string {
+	names := []string{rec.ServiceCard.Name}
+	for _, card := range rec.Extra {
+		names = append(names, card.Name)
+	}
+	return names
 }
 
 // FreezedStake represents a stake that is temporarily frozen during unregistration.
@@ -35,6 +50,19 @@ type FreezedStake struct {
 type RedisStorage struct {
 	client *redis.Client
 	ttl    time.Duration
+	clock  common.Clock // nil = wall clock
+}
+
+// SetClock replaces the clock used for staleness and rate windows, for tests.
+func (r *RedisStorage) SetClock(clock common.Clock) {
+	r.clock = clock
+}
+
+func (r *RedisStorage) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
 }
 
 // NewRedisStorage creates a new Redis storage instance.
@@ -66,10 +94,13 @@ func NewRedisStorage(addr string, ttl time.Duration) (*RedisStorage, error) {
 }
 
 // SaveRegistration stores a registration record in Redis.
-func (r *RedisStorage) SaveRegistration(ctx context.Context, pid peer.ID, record *RegistrationRecord) error {
+func (r *RedisStorage) SaveRegistration(ctx context.Context, pid peer.ID, record *RegistrationRecord, ttl time.Duration) error {
 	if r == nil || r.client == nil {
 		return nil
 	}
+	if ttl <= 0 {
+		ttl = r.ttl
+	}
 
 	data, err := json.Marshal(record)
 	if err != nil {
@@ -77,16 +108,19 @@ func (r *RedisStorage) SaveRegistration(ctx context.Context, pid peer.ID, record
 	}
 
 	key := fmt.Sprintf("registration:%s", pid.String())
-	if err := r.client.Set(ctx, key, data, r.ttl).Err(); err != nil {
+	if err := r.client.Set(ctx, key, data, ttl).Err(); err != nil {
 		return fmt.Errorf("failed to save to redis: %v", err)
 	}
 
 	// Also maintain a service index in Redis (set of peer IDs for each service name)
-	serviceKey := fmt.Sprintf("service:%s", record.ServiceCard.Name)
-	if err := r.client.SAdd(ctx, serviceKey, pid.String()).Err(); err != nil {
-		return fmt.Errorf("failed to add to service index: %v", err)
+	for _, name := range record.ServiceNames() {
+		serviceKey := fmt.Sprintf("service:%s", name)
+		if err := r.client.SAdd(ctx, serviceKey, pid.String()).Err(); err != nil {
+			return fmt.Errorf("failed to add to service index: %v", err)
+		}
+		// The set holds records with different TTLs; never shorten it below the default
+		r.client.Expire(ctx, serviceKey, max(ttl, r.ttl))
 	}
-	r.client.Expire(ctx, serviceKey, r.ttl)
 
 	return nil
 }
@@ -99,6 +133,9 @@ func (r *RedisStorage) LoadRegistration(ctx context.Context, pid peer.ID) (*Regi
 
 	key := fmt.Sprintf("registration:%s", pid.String())
 	data, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -111,7 +148,9 @@ func (r *RedisStorage) LoadRegistration(ctx context.Context, pid peer.ID) (*Regi
 	return &record, nil
 }
 
-// DeleteRegistration removes a registration record from Redis.
+// DeleteRegistration removes a registration record from Redis. Only the
+// serviceName set is updated; sets of a gateway's other services are
+// cleaned up by CompactServiceSets.
 func (r *RedisStorage) DeleteRegistration(ctx context.Context, pid peer.ID, serviceName string) error {
 	if r == nil || r.client == nil {
 		return nil
@@ -132,14 +171,15 @@ func (r *RedisStorage) DeleteRegistration(ctx context.Context, pid peer.ID, serv
 }
 
 // RestoreAllRegistrations retrieves all registrations from Redis.
-// This is used during startup to restore the registry state.
-func (r *RedisStorage) RestoreAllRegistrations(ctx context.Context) (map[peer.ID]*RegistrationRecord, error) {
+// This is used during startup to restore the registry state. Records not seen
+// within maxAge are considered stale and skipped.
+func (r *RedisStorage) RestoreAllRegistrations(ctx context.Context, maxAge time.Duration) (map[peer.ID]*RegistrationRecord, error) {
 	if r == nil || r.client == nil {
 		return nil, fmt.Errorf("redis not configured")
 	}
 
 	registrations := make(map[peer.ID]*RegistrationRecord)
-	now := time.Now()
+	now := r.now()
 	restoredCount := 0
 	skippedCount := 0
 
@@ -156,11 +196,12 @@ func (r *RedisStorage) RestoreAllRegistrations(ctx context.Context) (map[peer.ID
 		var record RegistrationRecord
 		if err := json.Unmarshal(data, &record); err != nil {
 			log.Printf("[Storage] Warning: Failed to unmarshal record for key %s: %v", key, err)
+			r.deleteCorrupt(ctx, key)
 			continue
 		}
 
-		// Skip stale records (older than 90 seconds, matching the GC logic)
-		if now.Sub(record.LastSeen) > 90*time.Second {
+		// Skip stale records (matching the registry's GC prune window)
+		if now.Sub(record.LastSeen) > maxAge {
 			skippedCount++
 			log.Printf("[Storage] Skipping stale registration: %s (last seen: %s)", key, record.LastSeen.Format(time.RFC3339))
 			continue
@@ -171,6 +212,7 @@ func (r *RedisStorage) RestoreAllRegistrations(ctx context.Context) (map[peer.ID
 		pid, err := peer.Decode(peerIDStr)
 		if err != nil {
 			log.Printf("[Storage] Warning: Failed to decode peer ID from key %s: %v", key, err)
+			r.deleteCorrupt(ctx, key)
 			continue
 		}
 
@@ -186,6 +228,67 @@ func (r *RedisStorage) RestoreAllRegistrations(ctx context.Context) (map[peer.ID
 	return registrations, nil
 }
 
+// ArchiveRegistration stores entry under archived:<peerID>:<time>, outside
+// the registration: keyspace so it is never restored, expiring after ttl.
+func (r *RedisStorage) ArchiveRegistration(ctx context.Context, entry ArchivedRegistration, ttl time.Duration) error {
+	if r == nil || r.client == nil {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal archived registration: %v", err)
+	}
+	if err := r.client.Set(ctx, "archived:"+archiveKey(entry), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to archive to redis: %v", err)
+	}
+	return nil
+}
+
+// ListArchived scans the archived: keyspace and returns entries newest
+// first.
+func (r *RedisStorage) ListArchived(ctx context.Context, peerID string, limit int) ([]ArchivedRegistration, error) {
+	if r == nil || r.client == nil {
+		return nil, fmt.Errorf("redis not configured")
+	}
+	pattern := "archived:*"
+	if peerID != "" {
+		pattern = "archived:" + peerID + ":*"
+	}
+
+	entries := []ArchivedRegistration{}
+	iter := r.client.Scan(ctx, 0, pattern, 0).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		data, err := r.client.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			continue // Expired since the scan
+		}
+		if err != nil {
+			log.Printf("[Storage] Warning: Failed to read key %s: %v", key, err)
+			continue
+		}
+		var entry ArchivedRegistration
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Printf("[Storage] Warning: Failed to unmarshal archived record %s: %v", key, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("redis scan error: %v", err)
+	}
+	return newestArchived(entries, limit), nil
+}
+
+// deleteCorrupt removes a registration key that can never be restored.
+func (r *RedisStorage) deleteCorrupt(ctx context.Context, key string) {
+	if err := r.client.Del(ctx, key).Err(); err != nil {
+		log.Printf("[Storage] Warning: Failed to delete corrupt key %s: %v", key, err)
+		return
+	}
+	log.Printf("[Storage] Deleted unrecoverable registration key %s", key)
+}
+
 // SavePeerStakes saves the stake IDs for a specific peer to Redis.
 func (r *RedisStorage) SavePeerStakes(ctx context.Context, pid peer.ID, stakes []string) error {
 	if r == nil || r.client == nil {
@@ -428,6 +531,132 @@ func (r *RedisStorage) RestoreAllFreezedPeerStakes(ctx context.Context) (map[pee
 	return freezedPeerStakes, nil
 }
 
+// CompactServiceSets removes members of the service:<name> sets that no
+// longer have a live registration:<peer> key for that service. Set members
+// are only removed on explicit delete, so expired registrations and
+// providers that switched service otherwise linger. Returns how many
+// members were removed.
+func (r *RedisStorage) CompactServiceSets(ctx context.Context) (int, error) {
+	if r == nil || r.client == nil {
+		return 0, nil
+	}
+
+	removed := 0
+	iter := r.client.Scan(ctx, 0, "service:*", 0).Iterator()
+	for iter.Next(ctx) {
+		serviceKey := iter.Val()
+		serviceName := strings.TrimPrefix(serviceKey, "service:")
+
+		members, err := r.client.SMembers(ctx, serviceKey).Result()
+		if err != nil {
+			log.Printf("[Storage] Warning: Failed to read service set %s: %v", serviceKey, err)
+			continue
+		}
+
+		for _, member := range members {
+			data, err := r.client.Get(ctx, fmt.Sprintf("registration:%s", member)).Bytes()
+			if err != nil && err != redis.Nil {
+				log.Printf("[Storage] Warning: Failed to read registration %s: %v", member, err)
+				continue
+			}
+			if err == nil {
+				var record RegistrationRecord
+				if json.Unmarshal(data, &record) != nil || containsString(record.ServiceNames(), serviceName) {
+					continue
+				}
+			}
+			if err := r.client.SRem(ctx, serviceKey, member).Err(); err != nil {
+				log.Printf("[Storage] Warning: Failed to remove %s from %s: %v", member, serviceKey, err)
+				continue
+			}
+			removed++
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return removed, fmt.Errorf("redis scan error: %v", err)
+	}
+
+	if removed > 0 {
+		log.Printf("[Storage] Compacted service sets: removed %d orphaned members", removed)
+	}
+	return removed, nil
+}
+
+// SetFeatured adds or removes a service name from the featured set.
+func (r *RedisStorage) SetFeatured(ctx context.Context, serviceName string, featured bool) error {
+	if r == nil || r.client == nil {
+		return nil
+	}
+
+	var err error
+	if featured {
+		err = r.client.SAdd(ctx, "featured_services", serviceName).Err()
+	} else {
+		err = r.client.SRem(ctx, "featured_services", serviceName).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update featured services: %v", err)
+	}
+	return nil
+}
+
+// LoadFeatured returns every featured service name.
+func (r *RedisStorage) LoadFeatured(ctx context.Context) ([]string, error) {
+	if r == nil || r.client == nil {
+		return nil, fmt.Errorf("redis not configured")
+	}
+
+	names, err := r.client.SMembers(ctx, "featured_services").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load featured services: %v", err)
+	}
+	return names, nil
+}
+
+// slidingWindowScript atomically trims a sorted-set log to the window, and
+// records a new event only if the log holds fewer than the limit.
+// KEYS[1] = log key; ARGV = now (ms), window (ms), limit, member.
+// Returns the new count, or -1 - (ms until the oldest event leaves the
+// window) when the limit is reached.
+var slidingWindowScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', tonumber(ARGV[1]) - tonumber(ARGV[2]))
+local n = redis.call('ZCARD', KEYS[1])
+if n >= tonumber(ARGV[3]) then
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	local wait = 0
+	if oldest[2] then
+		wait = math.max(0, tonumber(oldest[2]) + tonumber(ARGV[2]) - tonumber(ARGV[1]))
+	end
+	return -1 - wait
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return n + 1
+`)
+
+// AllowInWindow implements a cluster-wide sliding-window rate limit shared by
+// every registry using this Redis. It returns true and records the event when
+// fewer than limit events happened within window, false otherwise along with
+// how long until the next event would be allowed.
+func (r *RedisStorage) AllowInWindow(ctx context.Context, name string, limit int, window time.Duration) (bool, time.Duration, error) {
+	if r == nil || r.client == nil {
+		return true, 0, nil
+	}
+
+	key := fmt.Sprintf("ratelimit:%s", name)
+	now := r.now()
+	member := fmt.Sprintf("%d-%d", now.UnixNano(), rand.Int63())
+	n, err := slidingWindowScript.Run(ctx, r.client, []string{key},
+		now.UnixMilli(), window.Milliseconds(), limit, member).Int64()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to evaluate rate window: %v", err)
+	}
+	if n < 0 {
+		return false, time.Duration(-1-n) * time.Millisecond, nil
+	}
+	return true, 0, nil
+}
+
 // stringSliceToInterface converts a string slice to an interface slice for Redis commands.
 func stringSliceToInterface(strs []string) []interface{} {
 	result := make([]interface{}, len(strs))
@@ -437,6 +666,16 @@ func stringSliceToInterface(strs []string) []interface{} {
 	return result
 }
 
+// containsString reports whether s is in list.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // Close closes the Redis connection.
 func (r *RedisStorage) Close() error {
 	if r == nil || r.client == nil {
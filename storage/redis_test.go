@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"prxs/common"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedis returns a RedisStorage backed by an in-process miniredis.
+func newTestRedis(t *testing.T, ttl time.Duration) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rs, err := NewRedisStorage(mr.Addr(), ttl)
+	if err != nil {
+		t.Fatalf("failed to connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { rs.Close() })
+	return rs, mr
+}
+
+func TestAllowInWindow(t *testing.T) {
+	rs, _ := newTestRedis(t, time.Minute)
+	clock := common.NewMockClock(time.Unix(1_700_000_000, 0))
+	rs.SetClock(clock)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		ok, _, err := rs.AllowInWindow(ctx, "registrations", 3, time.Minute)
+		if err != nil || !ok {
+			t.Fatalf("event %d: ok=%v err=%v", i, ok, err)
+		}
+		clock.Advance(10 * time.Second)
+	}
+
+	ok, wait, err := rs.AllowInWindow(ctx, "registrations", 3, time.Minute)
+	if err != nil || ok {
+		t.Fatalf("4th event in the window: ok=%v err=%v", ok, err)
+	}
+	// The first event, 30s ago, leaves the window in 30s
+	if wait != 30*time.Second {
+		t.Fatalf("wait = %s, want 30s", wait)
+	}
+
+	clock.Advance(wait)
+	if ok, _, err := rs.AllowInWindow(ctx, "registrations", 3, time.Minute); err != nil || !ok {
+		t.Fatalf("after the oldest left the window: ok=%v err=%v", ok, err)
+	}
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ErrNotFound is returned by LoadRegistration when no record exists.
+var ErrNotFound = errors.New("registration not found")
+
+// Storage persists registration records so a restarted registry can restore
+// its providers. RedisStorage is the shared backend, BoltStorage a local file
+// for single registries without Redis, and MemoryStorage keeps records
+// in-process for tests and ephemeral deployments.
+type Storage interface {
+	// SaveRegistration stores or replaces the record for pid. A ttl > 0
+	// overrides the backend's default expiry for this record.
+	SaveRegistration(ctx context.Context, pid peer.ID, record *RegistrationRecord, ttl time.Duration) error
+	// LoadRegistration returns the record for pid, or ErrNotFound.
+	LoadRegistration(ctx context.Context, pid peer.ID) (*RegistrationRecord, error)
+	// DeleteRegistration removes the record for pid under serviceName.
+	DeleteRegistration(ctx context.Context, pid peer.ID, serviceName string) error
+	// RestoreAllRegistrations returns every record seen within maxAge.
+	RestoreAllRegistrations(ctx context.Context, maxAge time.Duration) (map[peer.ID]*RegistrationRecord, error)
+	// Close releases the backend.
+	Close() error
+}
+
+var (
+	_ Storage = (*RedisStorage)(nil)
+	_ Storage = (*MemoryStorage)(nil)
+	_ Storage = (*BoltStorage)(nil)
+)
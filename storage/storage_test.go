@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"prxs/common"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// storageTTL is the default record expiry the contract backends are opened with.
+const storageTTL = time.Minute
+
+// testBackend is a Storage under test with a clock the test drives.
+type testBackend struct {
+	Storage
+	// advance moves the backend's notion of time forward by d.
+	advance func(d time.Duration)
+	now     func() time.Time
+}
+
+// storageBackends opens each Storage implementation with storageTTL.
+func storageBackends() map[string]func(t *testing.T) testBackend {
+	start := time.Unix(1_700_000_000, 0)
+	return map[string]func(t *testing.T) testBackend{
+		"memory": func(t *testing.T) testBackend {
+			clock := common.NewMockClock(start)
+			m := NewMemoryStorage(storageTTL)
+			m.SetClock(clock)
+			return testBackend{Storage: m, advance: clock.Advance, now: clock.Now}
+		},
+		"bolt": func(t *testing.T) testBackend {
+			clock := common.NewMockClock(start)
+			b, err := NewBoltStorage(filepath.Join(t.TempDir(), "registry.db"), storageTTL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { b.Close() })
+			b.SetClock(clock)
+			return testBackend{Storage: b, advance: clock.Advance, now: clock.Now}
+		},
+		"redis": func(t *testing.T) testBackend {
+			clock := common.NewMockClock(start)
+			rs, mr := newTestRedis(t, storageTTL)
+			rs.SetClock(clock)
+			// Key expiry runs on miniredis' clock, so move both
+			advance := func(d time.Duration) {
+				clock.Advance(d)
+				mr.FastForward(d)
+			}
+			return testBackend{Storage: rs, advance: advance, now: clock.Now}
+		},
+	}
+}
+
+func newTestPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// TestStorageContract runs the same register/heartbeat/expiry/delete
+// sequence against every backend, so the registry behaves the same
+// whichever one it is given.
+func TestStorageContract(t *testing.T) {
+	ctx := context.Background()
+	for name, open := range storageBackends() {
+		t.Run(name, func(t *testing.T) {
+			tests := []struct {
+				name string
+				run  func(t *testing.T, s testBackend)
+			}{
+				{"register and load", func(t *testing.T, s testBackend) {
+					pid := newTestPeerID(t)
+					rec := &RegistrationRecord{
+						LastSeen:    s.now(),
+						ServiceCard: common.ServiceCard{Name: "svc", Tags: []string{"a"}},
+						AddrInfo:    peer.AddrInfo{ID: pid},
+						Extra:       []common.ServiceCard{{Name: "extra"}},
+					}
+					if err := s.SaveRegistration(ctx, pid, rec, 0); err != nil {
+						t.Fatal(err)
+					}
+					got, err := s.LoadRegistration(ctx, pid)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got.ServiceCard.Name != "svc" || len(got.Extra) != 1 || !got.LastSeen.Equal(rec.LastSeen) || got.AddrInfo.ID != pid {
+						t.Fatalf("loaded %+v", got)
+					}
+					if _, err := s.LoadRegistration(ctx, newTestPeerID(t)); !errors.Is(err, ErrNotFound) {
+						t.Fatalf("unknown peer: err = %v, want ErrNotFound", err)
+					}
+				}},
+				{"heartbeat extends expiry", func(t *testing.T, s testBackend) {
+					pid := newTestPeerID(t)
+					save(t, s, pid, 0)
+					s.advance(storageTTL - time.Second)
+					save(t, s, pid, 0)
+					s.advance(storageTTL - time.Second)
+					if _, err := s.LoadRegistration(ctx, pid); err != nil {
+						t.Fatalf("expired despite heartbeat: %v", err)
+					}
+				}},
+				{"expires after ttl", func(t *testing.T, s testBackend) {
+					pid := newTestPeerID(t)
+					save(t, s, pid, 0)
+					s.advance(storageTTL + time.Second)
+					if _, err := s.LoadRegistration(ctx, pid); !errors.Is(err, ErrNotFound) {
+						t.Fatalf("err = %v, want ErrNotFound", err)
+					}
+					restored, err := s.RestoreAllRegistrations(ctx, time.Hour)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, ok := restored[pid]; ok {
+						t.Fatal("expired record restored")
+					}
+				}},
+				{"per-record ttl", func(t *testing.T, s testBackend) {
+					pid := newTestPeerID(t)
+					save(t, s, pid, 3*storageTTL)
+					s.advance(2 * storageTTL)
+					if _, err := s.LoadRegistration(ctx, pid); err != nil {
+						t.Fatalf("expired before its own ttl: %v", err)
+					}
+				}},
+				{"restore skips stale records", func(t *testing.T, s testBackend) {
+					stale, fresh := newTestPeerID(t), newTestPeerID(t)
+					save(t, s, stale, 0)
+					s.advance(30 * time.Second)
+					save(t, s, fresh, 0)
+					restored, err := s.RestoreAllRegistrations(ctx, 20*time.Second)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, ok := restored[stale]; ok || len(restored) != 1 || restored[fresh] == nil {
+						t.Fatalf("restored %v, want only %s", restored, fresh)
+					}
+				}},
+				{"delete", func(t *testing.T, s testBackend) {
+					pid := newTestPeerID(t)
+					save(t, s, pid, 0)
+					if err := s.DeleteRegistration(ctx, pid, "svc"); err != nil {
+						t.Fatal(err)
+					}
+					if _, err := s.LoadRegistration(ctx, pid); !errors.Is(err, ErrNotFound) {
+						t.Fatalf("err = %v, want ErrNotFound", err)
+					}
+					if err := s.DeleteRegistration(ctx, pid, "svc"); err != nil {
+						t.Fatalf("deleting a missing record: %v", err)
+					}
+				}},
+				{"archive ttl", func(t *testing.T, s testBackend) {
+					kept, expiring := newTestPeerID(t), newTestPeerID(t)
+					for pid, ttl := range map[peer.ID]time.Duration{kept: 0, expiring: storageTTL} {
+						entry := ArchivedRegistration{PeerID: pid.String(), Record: RegistrationRecord{AddrInfo: peer.AddrInfo{ID: pid}}, Reason: "pruned", ArchivedAt: s.now()}
+						if err := s.Storage.(Archive).ArchiveRegistration(ctx, entry, ttl); err != nil {
+							t.Fatal(err)
+						}
+					}
+					s.advance(storageTTL + time.Second)
+					archived, err := s.Storage.(Archive).ListArchived(ctx, "", 0)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(archived) != 1 || archived[0].PeerID != kept.String() {
+						t.Fatalf("archived %+v, want only the entry kept without a ttl", archived)
+					}
+				}},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tt.run(t, open(t))
+				})
+			}
+		})
+	}
+}
+
+// save stores a record of "svc" for pid, seen now.
+func save(t *testing.T, s testBackend, pid peer.ID, ttl time.Duration) {
+	t.Helper()
+	rec := &RegistrationRecord{LastSeen: s.now(), ServiceCard: common.ServiceCard{Name: "svc"}, AddrInfo: peer.AddrInfo{ID: pid}}
+	if err := s.SaveRegistration(context.Background(), pid, rec, ttl); err != nil {
+		t.Fatal(err)
+	}
+}